@@ -24,9 +24,13 @@ type NodeChain interface {
 	GetDestinationNode() node.PPNode
 }
 type ServiceClient interface {
-	InitiatePayment(context.Context, NodeChain, *models.PaymentRequest) ([]*models.PaymentTransactionReplacing, error)
+	// InitiatePayment and CreateTransactions refuse the routes whose fees exceed maxFee in total
+	InitiatePayment(ctx context.Context, nodes NodeChain, pr *models.PaymentRequest, maxFee models.TransactionAmount) ([]*models.PaymentTransactionReplacing, error)
+	CreateTransactions(ctx context.Context, nodes NodeChain, pr *models.PaymentRequest, maxFee models.TransactionAmount) (*TransactionsCollection, error)
+	SignTransactions(context.Context, NodeChain, *models.PaymentRequest, *TransactionsCollection) ([]*models.PaymentTransactionReplacing, error)
 	VerifyTransactions(context.Context, []*models.PaymentTransactionReplacing) error
 	FinalizePayment(context.Context, NodeChain, *models.PaymentRequest, []*models.PaymentTransactionReplacing) error
+	RevokePayment(context.Context, NodeChain, *models.PaymentRequest, []*models.PaymentTransactionReplacing) error
 }
 type serviceClient struct {
 	root.RootApi
@@ -165,7 +169,7 @@ func (client *serviceClient) signTransactions(ctx context.Context, paymentReques
 
 	if err != nil {
 		log.Printf("Error signing terminal transaction ( node %s) : %v ", serviceNodeAddress, err)
-		return nil, errors.Errorf("Error signing terminal transaction (%v): %v", debitTransaction, err)
+		return nil, fmt.Errorf("Error signing terminal transaction (%v): %w", debitTransaction, &models.HopError{Address: serviceNodeAddress, Err: err})
 	}
 
 	signedDebitTransaction := signedDebitTransactionResponse.Transaction
@@ -188,7 +192,7 @@ func (client *serviceClient) signTransactions(ctx context.Context, paymentReques
 
 		if err != nil {
 			log.Print("Error signing transaction ( node " + destAddress + ") : " + err.Error())
-			return nil, errors.Errorf("Error signing transaction (%v): %w", debitTransaction, err)
+			return nil, fmt.Errorf("Error signing transaction (%v): %w", debitTransaction, &models.HopError{Address: destAddress, Err: err})
 		}
 		signedTransactions = append(signedTransactions, signedTransaction.Debit)
 
@@ -212,7 +216,40 @@ func (client *serviceClient) signTransactions(ctx context.Context, paymentReques
 	return signedTransactions, nil
 }
 
-func (client *serviceClient) createTransactions(ctx context.Context, paymentRequest *models.PaymentRequest, nodeCollection NodeChain) (*TransactionsCollection, error) {
+// quoteFees asks the hops for their fees, from the destination back to the first hop,
+// as every hop forwards the payment amount with the fees of the hops after it
+func (client *serviceClient) quoteFees(ctx context.Context, paymentRequest *models.PaymentRequest, nodeCollection NodeChain,
+	maxFee models.TransactionAmount) ([]models.TransactionAmount, error) {
+	var totalFee models.TransactionAmount = 0
+	nodes := nodeCollection.GetAllNodes()
+	fees := make([]models.TransactionAmount, len(nodes))
+	for i := len(nodes) - 1; i > 0; i-- {
+		destNode := nodes[i]
+		destAddress := destNode.GetAddress()
+		quote, err := destNode.QuoteFee(ctx, &models.QuoteFeeCommand{
+			ServiceSessionId: paymentRequest.ServiceSessionId,
+			Amount:           paymentRequest.Amount + totalFee,
+			Asset:            paymentRequest.Asset,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error quoting fee of node %v: %w", destAddress, &models.HopError{Address: destAddress, Err: err})
+		}
+		log.Printf("InitiatePayment: Fee of %s: %d", destAddress, quote.Fee)
+		// The total stays within maxFee, the fee of a hop is compared to the remaining part so the sum doesn't overflow
+		if quote.Fee > maxFee-totalFee {
+			err = fmt.Errorf("fee %d exceeds the %d remaining of the maximum fee %d", quote.Fee, maxFee-totalFee, maxFee)
+			return nil, fmt.Errorf("error quoting fee of node %v: %w", destAddress, &models.HopError{Address: destAddress, Err: err})
+		}
+		if paymentRequest.Amount+totalFee+quote.Fee < paymentRequest.Amount {
+			return nil, fmt.Errorf("amount %d with the fees overflows", paymentRequest.Amount)
+		}
+		fees[i] = quote.Fee
+		totalFee = totalFee + quote.Fee
+	}
+	return fees, nil
+}
+
+func (client *serviceClient) createTransactions(ctx context.Context, paymentRequest *models.PaymentRequest, nodeCollection NodeChain, fees []models.TransactionAmount) (*TransactionsCollection, error) {
 	var totalFee models.TransactionAmount = 0
 	nodes := nodeCollection.GetAllNodes()
 	payChainLen := len(nodes)
@@ -224,25 +261,26 @@ func (client *serviceClient) createTransactions(ctx context.Context, paymentRequ
 		destNode := nodes[i]
 		sourceAddress := sourceNode.GetAddress()
 		destAddress := destNode.GetAddress()
-		transactionFee := destNode.GetFee()
+		transactionFee := fees[i]
 		log.Printf("InitiatePayment: Creating transaction %s => %s", sourceAddress, destAddress)
 		request := &models.CreateTransactionCommand{
 			TotalIn:          paymentRequest.Amount + totalFee + transactionFee,
 			TotalOut:         paymentRequest.Amount + totalFee,
 			SourceAddress:    sourceAddress,
 			ServiceSessionId: paymentRequest.ServiceSessionId,
+			Asset:            paymentRequest.Asset,
 		}
 
 		// Create and store transaction
 		nodeTransaction, err := destNode.CreateTransaction(ctx, request)
 
 		if err != nil {
-			return nil, errors.Errorf("error creating transaction for node %v: %v", sourceAddress, err)
+			return nil, fmt.Errorf("error creating transaction for node %v: %w", sourceAddress, &models.HopError{Address: destAddress, Err: err})
 		}
 		tr := nodeTransaction.Transaction
 		err = tr.PendingTransaction.Validate()
 		if err != nil {
-			return nil, err
+			return nil, &models.HopError{Address: destAddress, Err: err}
 		}
 
 		log.Printf("InitiatePayment: Transaction created  %s %d => %s", nodeTransaction.Transaction.PendingTransaction.PaymentSourceAddress,
@@ -262,7 +300,22 @@ func (client *serviceClient) createTransactions(ctx context.Context, paymentRequ
 
 func (client *serviceClient) InitiatePayment(context context.Context,
 	nodeCollection NodeChain,
-	paymentRequest *models.PaymentRequest) ([]*models.PaymentTransactionReplacing, error) {
+	paymentRequest *models.PaymentRequest,
+	maxFee models.TransactionAmount) ([]*models.PaymentTransactionReplacing, error) {
+
+	trs, err := client.CreateTransactions(context, nodeCollection, paymentRequest, maxFee)
+	if err != nil {
+		return nil, err
+	}
+	return client.SignTransactions(context, nodeCollection, paymentRequest, trs)
+}
+
+// CreateTransactions validates the route, quotes the fees within maxFee, checks that the client balance covers
+// the amount with the fees and asks every hop to create its transaction
+func (client *serviceClient) CreateTransactions(context context.Context,
+	nodeCollection NodeChain,
+	paymentRequest *models.PaymentRequest,
+	maxFee models.TransactionAmount) (*TransactionsCollection, error) {
 
 	ctx, span := client.tracer.Start(context, "client-InitiatePayment")
 	defer span.End()
@@ -273,25 +326,44 @@ func (client *serviceClient) InitiatePayment(context context.Context,
 	if err != nil {
 		return nil, err
 	}
+	fees, err := client.quoteFees(ctx, paymentRequest, nodeCollection, maxFee)
+	if err != nil {
+		return nil, fmt.Errorf("quote fees error:%w", err)
+	}
+	total := paymentRequest.Amount
+	for _, fee := range fees {
+		total += fee
+	}
 	balance, err := client.GetMicroPPTokenBalance()
 	if err != nil {
 		return nil, err
 	}
-	if paymentRequest.Amount > uint32(balance) {
+	if total > balance {
 		log.Printf("insufficient client balance: %v", balance)
-		return nil, errors.Errorf("client has insufficient account balance =%v", balance)
+		return nil, errors.Errorf("client has insufficient account balance =%v for %v with the fees", balance, total)
 	}
 
 	//Iterating in reverse order
 
-	trs, err := client.createTransactions(ctx, paymentRequest, nodeCollection)
+	trs, err := client.createTransactions(ctx, paymentRequest, nodeCollection, fees)
 	if err != nil {
-		return nil, fmt.Errorf("create transactions error:%v", err)
+		return nil, fmt.Errorf("create transactions error:%w", err)
 	}
+	return trs, nil
+}
+
+// SignTransactions collects the hop signatures on the created transactions and signs the initial one
+func (client *serviceClient) SignTransactions(context context.Context,
+	nodeCollection NodeChain,
+	paymentRequest *models.PaymentRequest,
+	trs *TransactionsCollection) ([]*models.PaymentTransactionReplacing, error) {
+
+	ctx, span := client.tracer.Start(context, "client-SignTransactions")
+	defer span.End()
 
 	singedTransaction, err := client.signTransactions(ctx, paymentRequest, nodeCollection, trs)
 	if err != nil {
-		return nil, fmt.Errorf("signTransactions error: %v", err)
+		return nil, fmt.Errorf("signTransactions error: %w", err)
 	}
 
 	for _, t := range singedTransaction { // Move to http layer
@@ -329,7 +401,7 @@ func (client *serviceClient) FinalizePayment(context context.Context,
 				PaymentRequest: pr,
 			})
 			if err != nil {
-				return fmt.Errorf("error committing transaction: %v", err)
+				return fmt.Errorf("error committing transaction: %w", err)
 			}
 			continue
 		}
@@ -338,10 +410,54 @@ func (client *serviceClient) FinalizePayment(context context.Context,
 			Transaction: tr,
 		})
 		if err != nil {
-			return fmt.Errorf("error committing transaction: %v", err)
+			return fmt.Errorf("error committing transaction: %w", err)
 		}
 
 	}
 
 	return nil
 }
+
+// RevokePayment asks every hop to revoke its transaction of a payment which failed to finalize, from the service node
+// back to the first hop, each hop with the revocation of the node it paid. Hops which didn't commit only sign their
+// revocation. All hops are attempted, the last error is returned.
+func (client *serviceClient) RevokePayment(context context.Context,
+	nodeManager NodeChain,
+	pr *models.PaymentRequest,
+	transactions []*models.PaymentTransactionReplacing) error {
+
+	ctx, span := client.tracer.Start(context, "client-RevokePayment")
+	defer span.End()
+
+	log.Printf("Started RevokePayment (%s) %d => %s", pr.ServiceRef, pr.Amount, pr.Address)
+
+	var revokeErr error
+	var revocation *models.Revocation
+	for i := len(transactions) - 1; i >= 0; i-- {
+		tr := transactions[i]
+		destination := tr.PendingTransaction.PaymentDestinationAddress
+		paymentNode := nodeManager.GetNodeByAddress(destination)
+		if paymentNode == nil {
+			revokeErr = fmt.Errorf("error retrieving node object %s", destination)
+			log.Print(revokeErr)
+			continue
+		}
+		command := &models.RevokeTransactionCommand{
+			Transaction: tr,
+			Revocation:  revocation,
+		}
+		if destination == pr.Address {
+			command.PaymentRequest = pr
+		}
+		log.Printf("Requesting RevokeTransaction (%s) => %s", tr.PendingTransaction.ServiceSessionId, destination)
+		response, err := paymentNode.RevokeTransaction(ctx, command)
+		if err != nil {
+			revokeErr = fmt.Errorf("error revoking transaction on %s: %w", destination, err)
+			log.Print(revokeErr)
+			revocation = nil
+			continue
+		}
+		revocation = response.Revocation
+	}
+	return revokeErr
+}
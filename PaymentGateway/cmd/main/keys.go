@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/stellar/go/keypair"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/keystore"
+)
+
+// NewPassphraseEnv is the environment variable with the new passphrase of keys rotate
+const NewPassphraseEnv = "PP_KEYSTORE_NEW_PASSPHRASE"
+
+const keysUsage = `usage: payment-gateway keys <command> [flags]
+
+commands:
+  create  create a keystore with a new node key and print its address
+  import  encrypt the seed read from -seed-fd or stdin in a new keystore, or the StellarSeed of -config
+  export  print the seed of the keystore
+  rotate  encrypt the keystore with a new passphrase
+
+The passphrase is read from -passphrase-fd, $` + keystore.PassphraseEnv + ` or the terminal,
+the new passphrase of rotate from -new-passphrase-fd, $` + NewPassphraseEnv + ` or the terminal.
+
+flags:
+`
+
+// runKeys manages the keystore referenced by StellarKeystore in config.json
+func runKeys(args []string) error {
+	flags := flag.NewFlagSet("keys", flag.ContinueOnError)
+	file := flags.String("keystore", "keystore.json", "keystore file")
+	passphraseFd := flags.Int("passphrase-fd", 0, "file descriptor the passphrase is read from")
+	newPassphraseFd := flags.Int("new-passphrase-fd", 0, "file descriptor the new passphrase is read from (rotate)")
+	seedFd := flags.Int("seed-fd", 0, "file descriptor the seed is read from (import)")
+	configFile := flags.String("config", "", "configuration file the cleartext StellarSeed is read from (import)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), keysUsage)
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing keys command")
+	}
+	command := args[0]
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "create":
+		return createKeystore(*file, keypair.MustRandom(), *passphraseFd)
+	case "import":
+		var seed string
+		if *configFile != "" {
+			seed, err = config.ReadCleartextSeed(*configFile)
+		} else {
+			seed, err = keystore.ReadSecret(*seedFd, "", "Seed: ")
+		}
+		if err != nil {
+			return err
+		}
+		kp, err := keypair.ParseFull(seed)
+		if err != nil {
+			return fmt.Errorf("invalid seed: %v", err)
+		}
+		return createKeystore(*file, kp, *passphraseFd)
+	case "export":
+		kp, err := keystore.Open(*file, *passphraseFd)
+		if err != nil {
+			return err
+		}
+		fmt.Println(kp.Seed())
+		return nil
+	case "rotate":
+		kp, err := keystore.Open(*file, *passphraseFd)
+		if err != nil {
+			return err
+		}
+		passphrase, err := keystore.ReadNewPassphrase(*newPassphraseFd, NewPassphraseEnv)
+		if err != nil {
+			return err
+		}
+		k, err := keystore.Encrypt(kp, passphrase, keystore.DefaultScryptParams)
+		if err != nil {
+			return err
+		}
+		err = k.Save(*file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Passphrase of %s changed\n", *file)
+		return nil
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown keys command %q", command)
+	}
+}
+
+func createKeystore(file string, kp *keypair.Full, passphraseFd int) error {
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("%s already exists", file)
+	}
+	passphrase, err := keystore.ReadNewPassphrase(passphraseFd, keystore.PassphraseEnv)
+	if err != nil {
+		return err
+	}
+	k, err := keystore.Encrypt(kp, passphrase, keystore.DefaultScryptParams)
+	if err != nil {
+		return err
+	}
+	err = k.Save(file)
+	if err != nil {
+		return err
+	}
+	fmt.Println(kp.Address())
+	return nil
+}
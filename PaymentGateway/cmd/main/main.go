@@ -1,9 +1,12 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
 	"paidpiper.com/payment-gateway/common"
 	"paidpiper.com/payment-gateway/config"
@@ -12,27 +15,40 @@ import (
 	"paidpiper.com/payment-gateway/serviceNode"
 )
 
+var passphraseFd = flag.Int("passphrase-fd", 0, "file descriptor the keystore passphrase is read from")
+
 func main() {
+	flag.Parse()
+	if flag.Arg(0) == "keys" {
+		err := runKeys(flag.Args()[1:])
+		if err != nil {
+			log.Fatalf("keys: %v", err)
+		}
+		return
+	}
 
 	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	log.Printf("payment_gateway %v, built %v ", version.Version(), version.BuildDate())
 	config, err := config.ParseConfig()
 
 	if err != nil {
 		log.Fatalf("get config error: %v", err)
-		<-stop
-		return
 	}
+	config.RootApiConfig.KeystorePassphraseFd = *passphraseFd
 
 	tracerShutdownFunc := common.InitGlobalTracer(config.JaegerConfig)
-	defer tracerShutdownFunc()
 	runtime.GOMAXPROCS(config.MaxConcurrency)
 	runtime.NumGoroutine()
 	serverShutdown, err := serviceNode.RunHttpServer(config)
 	if err != nil {
+		tracerShutdownFunc()
 		log.Panicf("Error starting serviceNode: %v", err)
-	} else {
-		defer serverShutdown()
 	}
-	<-stop
+	sig := <-stop
+	log.Printf("Received %v, shutting down", sig)
+	signal.Stop(stop)
+	serverShutdown()
+	tracerShutdownFunc()
+	log.Printf("payment_gateway stopped")
 }
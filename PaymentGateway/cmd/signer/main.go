@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"paidpiper.com/payment-gateway/signer"
+	"paidpiper.com/payment-gateway/version"
+)
+
+// The signing daemon keeps the node key out of the gateway process, the gateway
+// connects to its unix socket with SignerSocket in its configuration
+func main() {
+	configFile := flag.String("config", "signer.json", "signer configuration file")
+	passphraseFd := flag.Int("passphrase-fd", 0, "file descriptor the keystore passphrase is read from")
+	flag.Parse()
+
+	log.Printf("payment_signer %v, built %v ", version.Version(), version.BuildDate())
+	cfg, err := signer.ParseConfiguration(*configFile, *passphraseFd)
+	if err != nil {
+		log.Fatalf("get config error: %v", err)
+	}
+	listener, err := signer.Listen(cfg.Socket)
+	if err != nil {
+		log.Fatalf("Error listening on %s: %v", cfg.Socket, err)
+	}
+	log.Printf("Signing with %s for %s on %s, policy %+v", cfg.KeyPair.Address(), cfg.Account, cfg.Socket, cfg.Policy)
+	server := signer.NewServer(cfg.KeyPair, cfg.NetworkPassphrase, cfg.Policy)
+	server.SetAccount(cfg.Account)
+
+	// The co-signing endpoint of a multisig node account, the requests are authorized by the node key
+	httpServer := &http.Server{Addr: cfg.HttpAddress, Handler: server}
+	if cfg.HttpAddress != "" {
+		go func() {
+			log.Printf("Co-signing on http://%s", cfg.HttpAddress)
+			err := httpServer.ListenAndServe()
+			if err != http.ErrServerClosed {
+				log.Fatalf("Error serving %s: %v", cfg.HttpAddress, err)
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-stop
+		log.Printf("Received %v, shutting down", sig)
+		httpServer.Close()
+		listener.Close()
+	}()
+	err = server.Serve(listener)
+	log.Printf("payment_signer stopped: %v", err)
+}
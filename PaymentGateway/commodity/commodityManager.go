@@ -2,86 +2,209 @@ package commodity
 
 import (
 	"fmt"
+	"math"
+	"sync"
+	"time"
 
 	"paidpiper.com/payment-gateway/models"
 )
 
 type Descriptor struct {
-	UnitPrice float64
-	Asset     string
+	UnitPrice float64 `json:"unitPrice" yaml:"unitPrice"`
+	Asset     string  `json:"asset" yaml:"asset"`
+	// Tiers are the volume prices per client, TierPeriod is the period the bought units are counted in (24h by default)
+	Tiers      []Tier      `json:"tiers,omitempty" yaml:"tiers,omitempty"`
+	TierPeriod string      `json:"tierPeriod,omitempty" yaml:"tierPeriod,omitempty"`
+	TimeOfDay  []TimeOfDay `json:"timeOfDay,omitempty" yaml:"timeOfDay,omitempty"`
+	Surge      []Surge     `json:"surge,omitempty" yaml:"surge,omitempty"`
 }
 type Manager interface {
 	Calculate(commodiryRequest *models.CreatePaymentInfo) (*models.PaymentRequstBase, error)
-	ReverseCalculate(service string, commodity string, price uint32, asset string) (*models.ValidatePaymentResponse, error)
+	ReverseCalculate(service string, commodity string, price uint32, asset string, quote *models.PriceQuote) (*models.ValidatePaymentResponse, error)
+	Prices() PriceTable
+	SetPrices(priceTable PriceTable) error
 }
+
+// usage counts the units a client bought in the current tier period
+type usage struct {
+	periodEnd time.Time
+	units     uint64
+}
+
 type manager struct {
-	priceTable map[string]map[string]Descriptor
+	mutex      sync.RWMutex
+	priceTable PriceTable
+	pricing    map[string]map[string]*pricing
+	usage      map[string]*usage
+	requests   map[string][]time.Time
+	now        func() time.Time
 }
 
 func New() Manager {
-
-	return &manager{priceTable: map[string]map[string]Descriptor{
-		"ipfs": {
-			"data": {
-				UnitPrice: 0.00000002,
-				Asset:     models.PPTokenAssetName,
-			},
-		},
-		"tor": {
-			"data": {
-				UnitPrice: 0.1,
-				Asset:     models.PPTokenAssetName,
-			},
-		},
-		"http": {
-			"attention": {
-				UnitPrice: 0.1,
-				Asset:     models.PPTokenAssetName,
-			},
-		},
-	},
+	m, err := newManager(DefaultPriceTable())
+	if err != nil {
+		panic(err)
 	}
+	return m
 }
 
-func (cm *manager) Calculate(commodiryRequest *models.CreatePaymentInfo) (*models.PaymentRequstBase, error) {
-	st, ok := cm.priceTable[commodiryRequest.ServiceType]
+// NewFromFile creates the manager with the prices of the file, see LoadPriceTable
+func NewFromFile(path string) (Manager, error) {
+	priceTable, err := LoadPriceTable(path)
+	if err != nil {
+		return nil, err
+	}
+	return newManager(priceTable)
+}
 
-	if !ok {
-		return nil, fmt.Errorf("unknown service %s", commodiryRequest.ServiceType)
+func newManager(priceTable PriceTable) (*manager, error) {
+	m := &manager{
+		usage:    map[string]*usage{},
+		requests: map[string][]time.Time{},
+		now:      time.Now,
+	}
+	err := m.SetPrices(priceTable)
+	if err != nil {
+		return nil, err
 	}
+	return m, nil
+}
 
-	d, ok := st[commodiryRequest.CommodityType]
+// Prices returns a copy of the current price table
+func (cm *manager) Prices() PriceTable {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	return cm.priceTable.copy()
+}
 
-	if !ok {
-		return nil, fmt.Errorf("unknown commodity %s", commodiryRequest.CommodityType)
+// SetPrices replaces the price table, calculations in progress complete with the previous prices.
+// Units bought by clients keep counting towards the volume tiers of the new prices.
+func (cm *manager) SetPrices(priceTable PriceTable) error {
+	p, err := priceTable.pricing()
+	if err != nil {
+		return err
 	}
-	amount := uint32(d.UnitPrice * float64(commodiryRequest.Amount))
-	return &models.PaymentRequstBase{
-		ServiceRef: commodiryRequest.ServiceType,
-		Asset:      d.Asset,
-		Amount:     amount,
-	}, nil
+	priceTable = priceTable.copy()
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	cm.priceTable = priceTable
+	cm.pricing = p
+	return nil
 }
 
-func (cm *manager) ReverseCalculate(service string, commodity string, price uint32, asset string) (*models.ValidatePaymentResponse, error) {
-	st, ok := cm.priceTable[service]
+func (cm *manager) descriptor(service string, commodity string) (*pricing, error) {
+	st, ok := cm.pricing[service]
 
 	if !ok {
 		return nil, fmt.Errorf("unknown service %s", service)
 	}
 
-	d, ok := st[commodity]
+	p, ok := st[commodity]
 
 	if !ok {
 		return nil, fmt.Errorf("unknown commodity %s", commodity)
 	}
+	return p, nil
+}
 
-	if d.Asset != asset {
+// requestCount records a request of the commodity and returns the number of requests in the surge window
+func (cm *manager) requestCount(key string, now time.Time) int {
+	requests := cm.requests[key]
+	i := 0
+	for i < len(requests) && now.Sub(requests[i]) >= surgeWindow {
+		i++
+	}
+	requests = append(requests[i:], now)
+	cm.requests[key] = requests
+	return len(requests)
+}
+
+// clientUsage returns the units the client bought in the current tier period
+func (cm *manager) clientUsage(key string, period time.Duration, now time.Time) *usage {
+	u, ok := cm.usage[key]
+	if ok && now.Before(u.periodEnd) {
+		return u
+	}
+	for k, u := range cm.usage {
+		if !now.Before(u.periodEnd) {
+			delete(cm.usage, k)
+		}
+	}
+	u = &usage{periodEnd: now.Add(period)}
+	cm.usage[key] = u
+	return u
+}
+
+// Calculate prices the request with the volume tier of the client, the time of day and the current surge.
+// The quantity is counted as bought by the client when the request is priced.
+func (cm *manager) Calculate(commodiryRequest *models.CreatePaymentInfo) (*models.PaymentRequstBase, error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	p, err := cm.descriptor(commodiryRequest.ServiceType, commodiryRequest.CommodityType)
+	if err != nil {
+		return nil, err
+	}
+	now := cm.now()
+	key := commodiryRequest.ServiceType + "/" + commodiryRequest.CommodityType
+	multiplier := p.timeMultiplier(now)
+	if len(p.surge) > 0 {
+		multiplier = multiplier * p.surgeMultiplier(cm.requestCount(key, now)) / multiplierOne
+	}
+
+	var clientUsage *usage
+	usedUnits := uint64(0)
+	if commodiryRequest.ClientId != "" && len(p.tiers) > 1 {
+		clientUsage = cm.clientUsage(key+"/"+commodiryRequest.ClientId, p.period, now)
+		usedUnits = clientUsage.units
+	}
+
+	amount := p.price(usedUnits, uint64(commodiryRequest.Amount), multiplier)
+	if !amount.IsUint64() || amount.Uint64() > math.MaxUint32 {
+		return nil, fmt.Errorf("price of %d %s exceeds the transaction limit", commodiryRequest.Amount, commodiryRequest.CommodityType)
+	}
+	if clientUsage != nil {
+		clientUsage.units += uint64(commodiryRequest.Amount)
+	}
+
+	var quote *models.PriceQuote
+	if multiplier != multiplierOne || usedUnits != 0 {
+		quote = &models.PriceQuote{
+			Multiplier: multiplier,
+			UsedUnits:  usedUnits,
+		}
+	}
+	return &models.PaymentRequstBase{
+		ServiceRef: commodiryRequest.ServiceType,
+		Asset:      p.asset,
+		Amount:     uint32(amount.Uint64()),
+		Quote:      quote,
+	}, nil
+}
+
+// ReverseCalculate returns the largest quantity the price pays for, with the quote of the payment request.
+// Requests without a quote are priced at the base tier without multipliers.
+func (cm *manager) ReverseCalculate(service string, commodity string, price uint32, asset string, quote *models.PriceQuote) (*models.ValidatePaymentResponse, error) {
+	cm.mutex.RLock()
+	p, err := cm.descriptor(service, commodity)
+	cm.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.asset != asset {
 		return nil, fmt.Errorf("asset missmatch %s", asset)
 	}
+	if p.free() {
+		return nil, fmt.Errorf("commodity %s of %s is free", commodity, service)
+	}
+	if quote == nil {
+		quote = &models.PriceQuote{Multiplier: multiplierOne}
+	}
+	if quote.Multiplier == 0 {
+		return nil, fmt.Errorf("invalid price multiplier")
+	}
 
-	quantity := uint32(float64(price) / d.UnitPrice)
 	return &models.ValidatePaymentResponse{
-		Quantity: quantity,
+		Quantity: p.quantity(quote.UsedUnits, price, quote.Multiplier),
 	}, nil
 }
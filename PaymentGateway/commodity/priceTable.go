@@ -0,0 +1,103 @@
+package commodity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// PriceTable maps a service and a commodity of the service to its price
+type PriceTable map[string]map[string]Descriptor
+
+var knownAssets = map[string]bool{
+	models.PPTokenAssetName: true,
+}
+
+// DefaultPriceTable is used when no price table file is configured
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"ipfs": {
+			"data": {
+				UnitPrice: 0.00000002,
+				Asset:     models.PPTokenAssetName,
+			},
+		},
+		"tor": {
+			"data": {
+				UnitPrice: 0.1,
+				Asset:     models.PPTokenAssetName,
+			},
+		},
+		"http": {
+			"attention": {
+				UnitPrice: 0.1,
+				Asset:     models.PPTokenAssetName,
+			},
+		},
+	}
+}
+
+func (t PriceTable) Validate() error {
+	_, err := t.pricing()
+	return err
+}
+
+func (t PriceTable) pricing() (map[string]map[string]*pricing, error) {
+	if len(t) == 0 {
+		return nil, fmt.Errorf("price table is empty")
+	}
+	result := map[string]map[string]*pricing{}
+	for service, commodities := range t {
+		result[service] = map[string]*pricing{}
+		for commodity, d := range commodities {
+			p, err := d.pricing()
+			if err != nil {
+				return nil, fmt.Errorf("invalid price of %s/%s: %v", service, commodity, err)
+			}
+			result[service][commodity] = p
+		}
+	}
+	return result, nil
+}
+
+func (t PriceTable) copy() PriceTable {
+	result := PriceTable{}
+	for service, commodities := range t {
+		result[service] = map[string]Descriptor{}
+		for commodity, d := range commodities {
+			d.Tiers = append([]Tier(nil), d.Tiers...)
+			d.TimeOfDay = append([]TimeOfDay(nil), d.TimeOfDay...)
+			d.Surge = append([]Surge(nil), d.Surge...)
+			result[service][commodity] = d
+		}
+	}
+	return result
+}
+
+// LoadPriceTable reads and validates a price table, files with a .yaml or .yml extension are parsed as yaml, others as json
+func LoadPriceTable(path string) (PriceTable, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	table := PriceTable{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(bs, &table)
+	default:
+		err = json.Unmarshal(bs, &table)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing price table %s: %v", path, err)
+	}
+	err = table.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid price table %s: %v", path, err)
+	}
+	return table, nil
+}
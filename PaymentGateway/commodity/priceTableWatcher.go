@@ -0,0 +1,62 @@
+package commodity
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// WatchPriceTable reloads the prices of the manager from the file on SIGHUP or when the file
+// modification time changes. An invalid file is reported and the current prices are kept.
+// The returned function stops watching.
+func WatchPriceTable(manager Manager, path string, pollInterval time.Duration) func() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(pollInterval)
+	done := make(chan struct{})
+
+	modTime := func() time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	reload := func(reason string) {
+		priceTable, err := LoadPriceTable(path)
+		if err == nil {
+			err = manager.SetPrices(priceTable)
+		}
+		if err != nil {
+			log.Printf("Price table not reloaded (%s): %v", reason, err)
+			return
+		}
+		log.Printf("Price table reloaded from %s (%s)", path, reason)
+	}
+
+	go func() {
+		lastModified := modTime()
+		for {
+			select {
+			case <-hup:
+				lastModified = modTime()
+				reload("SIGHUP")
+			case <-ticker.C:
+				modified := modTime()
+				if !modified.IsZero() && !modified.Equal(lastModified) {
+					lastModified = modified
+					reload("file changed")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hup)
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,116 @@
+package commodity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/models"
+)
+
+func writePriceTable(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadPriceTable(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	jsonFile := writePriceTable(t, dir, "prices.json", `{"ipfs": {"data": {"unitPrice": 0.5, "asset": "pptoken"}}}`)
+	table, err := LoadPriceTable(jsonFile)
+	assert.NoError(t, err)
+	assert.Equal(t, Descriptor{UnitPrice: 0.5, Asset: models.PPTokenAssetName}, table["ipfs"]["data"])
+
+	yamlFile := writePriceTable(t, dir, "prices.yaml", "tor:\n  data:\n    unitPrice: 0.25\n    asset: pptoken\n")
+	table, err = LoadPriceTable(yamlFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, table["tor"]["data"].UnitPrice)
+
+	for name, content := range map[string]string{
+		"negative.json": `{"ipfs": {"data": {"unitPrice": -1, "asset": "pptoken"}}}`,
+		"asset.json":    `{"ipfs": {"data": {"unitPrice": 1, "asset": "btc"}}}`,
+		"empty.json":    `{}`,
+		"field.yaml":    "ipfs:\n  data:\n    price: 1\n    asset: pptoken\n",
+	} {
+		_, err = LoadPriceTable(writePriceTable(t, dir, name, content))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestSetPrices(t *testing.T) {
+	m := New()
+	info := &models.CreatePaymentInfo{ServiceType: "http", CommodityType: "attention", Amount: 100}
+	pr, err := m.Calculate(info)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(10), pr.Amount)
+
+	assert.Error(t, m.SetPrices(PriceTable{"http": {"attention": {UnitPrice: -1, Asset: models.PPTokenAssetName}}}))
+	assert.NoError(t, m.SetPrices(PriceTable{"http": {"attention": {UnitPrice: 0.5, Asset: models.PPTokenAssetName}}}))
+	pr, err = m.Calculate(info)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(50), pr.Amount)
+
+	_, err = m.Calculate(&models.CreatePaymentInfo{ServiceType: "ipfs", CommodityType: "data", Amount: 100})
+	assert.Error(t, err)
+
+	prices := m.Prices()
+	prices["http"]["attention"] = Descriptor{UnitPrice: 2}
+	assert.Equal(t, 0.5, m.Prices()["http"]["attention"].UnitPrice)
+}
+
+func waitForPrice(m Manager, price float64) bool {
+	for i := 0; i < 100; i++ {
+		if m.Prices()["ipfs"]["data"].UnitPrice == price {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestWatchPriceTable(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := writePriceTable(t, dir, "prices.json", `{"ipfs": {"data": {"unitPrice": 1, "asset": "pptoken"}}}`)
+
+	m, err := NewFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := WatchPriceTable(m, path, 10*time.Millisecond)
+	defer stop()
+
+	// An invalid file keeps the current prices
+	writePriceTable(t, dir, "prices.json", `{"ipfs": {"data": {"unitPrice": -1, "asset": "pptoken"}}}`)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	assert.False(t, waitForPrice(m, -1))
+	assert.Equal(t, 1.0, m.Prices()["ipfs"]["data"].UnitPrice)
+
+	writePriceTable(t, dir, "prices.json", `{"ipfs": {"data": {"unitPrice": 2, "asset": "pptoken"}}}`)
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second))
+	assert.True(t, waitForPrice(m, 2))
+
+	// SIGHUP reloads even if the modification time is unchanged
+	info, _ := os.Stat(path)
+	writePriceTable(t, dir, "prices.json", `{"ipfs": {"data": {"unitPrice": 3, "asset": "pptoken"}}}`)
+	os.Chtimes(path, time.Now(), info.ModTime())
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	assert.True(t, waitForPrice(m, 3))
+}
@@ -0,0 +1,232 @@
+package commodity
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"time"
+
+	"paidpiper.com/payment-gateway/models"
+)
+
+// Prices are calculated in integer micro transaction units per million commodity units,
+// the float unit prices of the price table are converted once when the table is validated
+const (
+	unitsScale = 1000000
+	microScale = 1000000
+
+	multiplierOne     = models.PriceQuoteMultiplierOne
+	defaultTierPeriod = 24 * time.Hour
+	surgeWindow       = time.Minute
+)
+
+var rateDenominator = new(big.Int).Mul(big.NewInt(unitsScale*microScale), big.NewInt(multiplierOne))
+
+// Tier lowers the unit price once a client has bought FromUnits units in the tier period
+type Tier struct {
+	FromUnits uint64  `json:"fromUnits" yaml:"fromUnits"`
+	UnitPrice float64 `json:"unitPrice" yaml:"unitPrice"`
+}
+
+// TimeOfDay multiplies prices between From and To, in the "15:04" format of the node local time.
+// A window with From after To spans midnight.
+type TimeOfDay struct {
+	From       string  `json:"from" yaml:"from"`
+	To         string  `json:"to" yaml:"to"`
+	Multiplier float64 `json:"multiplier" yaml:"multiplier"`
+}
+
+// Surge multiplies prices while the commodity was requested at least RequestsPerMinute times in the last minute
+type Surge struct {
+	RequestsPerMinute uint32  `json:"requestsPerMinute" yaml:"requestsPerMinute"`
+	Multiplier        float64 `json:"multiplier" yaml:"multiplier"`
+}
+
+type tierRate struct {
+	from uint64
+	rate uint64
+}
+
+type timeWindow struct {
+	from       int
+	to         int
+	multiplier uint64
+}
+
+type surgeRate struct {
+	requests   uint32
+	multiplier uint64
+}
+
+// pricing is the integer form of a descriptor
+type pricing struct {
+	asset     string
+	tiers     []tierRate
+	period    time.Duration
+	timeOfDay []timeWindow
+	surge     []surgeRate
+}
+
+func toRate(unitPrice float64) (uint64, error) {
+	if unitPrice < 0 {
+		return 0, fmt.Errorf("negative price: %v", unitPrice)
+	}
+	rate := math.Round(unitPrice * unitsScale * microScale)
+	if rate >= math.MaxUint64 {
+		return 0, fmt.Errorf("price too high: %v", unitPrice)
+	}
+	return uint64(rate), nil
+}
+
+func toMultiplier(multiplier float64) (uint64, error) {
+	m := math.Round(multiplier * multiplierOne)
+	if m <= 0 || m >= math.MaxUint32 {
+		return 0, fmt.Errorf("invalid multiplier: %v", multiplier)
+	}
+	return uint64(m), nil
+}
+
+func minuteOfDay(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %s", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (d Descriptor) pricing() (*pricing, error) {
+	if !knownAssets[d.Asset] {
+		return nil, fmt.Errorf("unknown asset %s", d.Asset)
+	}
+	rate, err := toRate(d.UnitPrice)
+	if err != nil {
+		return nil, err
+	}
+	p := &pricing{
+		asset: d.Asset,
+		tiers: []tierRate{{from: 0, rate: rate}},
+	}
+	for _, t := range d.Tiers {
+		if t.FromUnits <= p.tiers[len(p.tiers)-1].from {
+			return nil, fmt.Errorf("tiers must start above zero units in increasing order")
+		}
+		rate, err := toRate(t.UnitPrice)
+		if err != nil {
+			return nil, err
+		}
+		p.tiers = append(p.tiers, tierRate{from: t.FromUnits, rate: rate})
+	}
+	p.period = defaultTierPeriod
+	if d.TierPeriod != "" {
+		p.period, err = time.ParseDuration(d.TierPeriod)
+		if err != nil || p.period <= 0 {
+			return nil, fmt.Errorf("invalid tier period %s", d.TierPeriod)
+		}
+	}
+	for _, w := range d.TimeOfDay {
+		from, err := minuteOfDay(w.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := minuteOfDay(w.To)
+		if err != nil {
+			return nil, err
+		}
+		multiplier, err := toMultiplier(w.Multiplier)
+		if err != nil {
+			return nil, err
+		}
+		p.timeOfDay = append(p.timeOfDay, timeWindow{from: from, to: to, multiplier: multiplier})
+	}
+	for _, s := range d.Surge {
+		multiplier, err := toMultiplier(s.Multiplier)
+		if err != nil {
+			return nil, err
+		}
+		p.surge = append(p.surge, surgeRate{requests: s.RequestsPerMinute, multiplier: multiplier})
+	}
+	sort.Slice(p.surge, func(i, j int) bool { return p.surge[i].requests < p.surge[j].requests })
+	return p, nil
+}
+
+func (p *pricing) free() bool {
+	for _, t := range p.tiers {
+		if t.rate != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pricing) timeMultiplier(now time.Time) uint64 {
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range p.timeOfDay {
+		inside := minute >= w.from && minute < w.to
+		if w.from > w.to {
+			inside = minute >= w.from || minute < w.to
+		}
+		if inside {
+			return w.multiplier
+		}
+	}
+	return multiplierOne
+}
+
+func (p *pricing) surgeMultiplier(requests int) uint64 {
+	multiplier := uint64(multiplierOne)
+	for _, s := range p.surge {
+		if uint64(requests) >= uint64(s.requests) {
+			multiplier = s.multiplier
+		}
+	}
+	return multiplier
+}
+
+// price of quantity units bought after usedUnits, rounded down to whole transaction units
+func (p *pricing) price(usedUnits uint64, quantity uint64, multiplier uint64) *big.Int {
+	total := new(big.Int)
+	start, end := usedUnits, usedUnits+quantity
+	for i, t := range p.tiers {
+		tierEnd := uint64(math.MaxUint64)
+		if i+1 < len(p.tiers) {
+			tierEnd = p.tiers[i+1].from
+		}
+		from, to := start, end
+		if from < t.from {
+			from = t.from
+		}
+		if to > tierEnd {
+			to = tierEnd
+		}
+		if from >= to {
+			continue
+		}
+		units := new(big.Int).SetUint64(to - from)
+		total.Add(total, units.Mul(units, new(big.Int).SetUint64(t.rate)))
+	}
+	total.Mul(total, new(big.Int).SetUint64(multiplier))
+	return total.Quo(total, rateDenominator)
+}
+
+// quantity is the largest quantity whose price doesn't exceed amount, the inverse of price
+func (p *pricing) quantity(usedUnits uint64, amount uint32, multiplier uint64) uint32 {
+	limit := big.NewInt(int64(amount))
+	fits := func(q uint64) bool {
+		return p.price(usedUnits, q, multiplier).Cmp(limit) <= 0
+	}
+	low, high := uint64(0), uint64(math.MaxUint32)
+	if fits(high) {
+		return math.MaxUint32
+	}
+	// price(low) <= amount < price(high)
+	for high-low > 1 {
+		middle := low + (high-low)/2
+		if fits(middle) {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return uint32(low)
+}
@@ -0,0 +1,137 @@
+package commodity
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/models"
+)
+
+func testManager(t *testing.T, d Descriptor, now *time.Time) *manager {
+	d.Asset = models.PPTokenAssetName
+	m, err := newManager(PriceTable{"tor": {"data": d}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func calculate(t *testing.T, m Manager, client string, quantity uint32) *models.PaymentRequstBase {
+	pr, err := m.Calculate(&models.CreatePaymentInfo{ServiceType: "tor", CommodityType: "data", Amount: quantity, ClientId: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pr
+}
+
+func reverse(t *testing.T, m Manager, pr *models.PaymentRequstBase) uint32 {
+	response, err := m.ReverseCalculate("tor", "data", pr.Amount, pr.Asset, pr.Quote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.Quantity
+}
+
+func TestIntegerPrices(t *testing.T) {
+	m := New()
+	pr, err := m.Calculate(&models.CreatePaymentInfo{ServiceType: "ipfs", CommodityType: "data", Amount: 1000000000})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(20), pr.Amount)
+	assert.Nil(t, pr.Quote)
+
+	response, err := m.ReverseCalculate("ipfs", "data", 20, models.PPTokenAssetName, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1049999999), response.Quantity)
+
+	_, err = m.Calculate(&models.CreatePaymentInfo{ServiceType: "http", CommodityType: "attention", Amount: 4294967295})
+	assert.NoError(t, err)
+	_, err = m.ReverseCalculate("http", "attention", 10, "btc", nil)
+	assert.Error(t, err)
+}
+
+func TestVolumeTiers(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.Local)
+	m := testManager(t, Descriptor{
+		UnitPrice:  4,
+		Tiers:      []Tier{{FromUnits: 100, UnitPrice: 2}, {FromUnits: 200, UnitPrice: 1}},
+		TierPeriod: "1h",
+	}, &now)
+
+	first := calculate(t, m, "client", 150)
+	assert.Equal(t, uint32(400+100), first.Amount)
+	assert.Nil(t, first.Quote)
+
+	second := calculate(t, m, "client", 100)
+	assert.Equal(t, uint32(100+50), second.Amount)
+	assert.Equal(t, &models.PriceQuote{Multiplier: models.PriceQuoteMultiplierOne, UsedUnits: 150}, second.Quote)
+	assert.Equal(t, uint32(100), reverse(t, m, second))
+
+	// Other clients and requests without a client start at the base tier
+	assert.Equal(t, uint32(40), calculate(t, m, "other", 10).Amount)
+	assert.Equal(t, uint32(400+200+100), calculate(t, m, "", 300).Amount)
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, uint32(40), calculate(t, m, "client", 10).Amount)
+
+	// Prices round down, the reversed quantity is the most the amount pays for
+	m.SetPrices(PriceTable{"tor": {"data": {UnitPrice: 0.25, Asset: models.PPTokenAssetName}}})
+	assert.Equal(t, uint32(103), reverse(t, m, calculate(t, m, "", 101)))
+
+	_, err := newManager(PriceTable{"tor": {"data": {UnitPrice: 1, Asset: models.PPTokenAssetName, Tiers: []Tier{{FromUnits: 0, UnitPrice: 0.5}}}}})
+	assert.Error(t, err)
+}
+
+func TestTimeOfDayAndSurge(t *testing.T) {
+	now := time.Date(2020, 1, 1, 23, 30, 0, 0, time.Local)
+	m := testManager(t, Descriptor{
+		UnitPrice: 2,
+		TimeOfDay: []TimeOfDay{{From: "22:00", To: "06:00", Multiplier: 0.5}, {From: "17:00", To: "22:00", Multiplier: 1.5}},
+		Surge:     []Surge{{RequestsPerMinute: 3, Multiplier: 2}},
+	}, &now)
+
+	night := calculate(t, m, "", 100)
+	assert.Equal(t, uint32(100), night.Amount)
+	assert.Equal(t, uint64(500000), night.Quote.Multiplier)
+
+	now = time.Date(2020, 1, 2, 18, 0, 0, 0, time.Local)
+	assert.Equal(t, uint32(300), calculate(t, m, "", 100).Amount)
+	assert.Equal(t, uint32(300), calculate(t, m, "", 100).Amount)
+	surge := calculate(t, m, "", 100)
+	assert.Equal(t, uint32(600), surge.Amount)
+	assert.Equal(t, uint32(100), reverse(t, m, surge))
+	assert.Equal(t, uint32(100), reverse(t, m, night))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, uint32(300), calculate(t, m, "", 100).Amount)
+
+	_, err := m.ReverseCalculate("tor", "data", 100, models.PPTokenAssetName, &models.PriceQuote{})
+	assert.Error(t, err)
+	assert.Error(t, m.SetPrices(PriceTable{"tor": {"data": {UnitPrice: 1, Asset: models.PPTokenAssetName, TimeOfDay: []TimeOfDay{{From: "25:00", To: "06:00", Multiplier: 1}}}}}))
+	assert.Error(t, m.SetPrices(PriceTable{"tor": {"data": {UnitPrice: 1, Asset: models.PPTokenAssetName, Surge: []Surge{{RequestsPerMinute: 1, Multiplier: 0}}}}}))
+}
+
+func TestReverseCalculateConsistency(t *testing.T) {
+	now := time.Date(2020, 1, 1, 8, 0, 0, 0, time.Local)
+	m := testManager(t, Descriptor{
+		UnitPrice: 0.003,
+		Tiers:     []Tier{{FromUnits: 1000, UnitPrice: 0.0021}, {FromUnits: 50000, UnitPrice: 0.0007}},
+		TimeOfDay: []TimeOfDay{{From: "07:00", To: "09:00", Multiplier: 1.37}},
+		Surge:     []Surge{{RequestsPerMinute: 5, Multiplier: 1.11}},
+	}, &now)
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		quantity := uint32(random.Intn(100000))
+		pr := calculate(t, m, "client", quantity)
+		reversed := reverse(t, m, pr)
+		assert.True(t, reversed >= quantity)
+
+		// The reversed quantity costs the same, one unit more exceeds the price
+		assert.Equal(t, uint64(pr.Amount), m.pricing["tor"]["data"].price(pr.Quote.UsedUnits, uint64(reversed), pr.Quote.Multiplier).Uint64())
+		next := m.pricing["tor"]["data"].price(pr.Quote.UsedUnits, uint64(reversed)+1, pr.Quote.Multiplier)
+		assert.True(t, next.Uint64() > uint64(pr.Amount))
+	}
+}
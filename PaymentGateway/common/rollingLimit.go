@@ -0,0 +1,61 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type rollingAmount struct {
+	at     time.Time
+	amount int64
+}
+
+// RollingLimit caps the total of the amounts taken within the period preceding each take
+type RollingLimit struct {
+	mutex  sync.Mutex
+	limit  int64
+	period time.Duration
+	taken  []rollingAmount
+}
+
+func NewRollingLimit(limit int64, period time.Duration) *RollingLimit {
+	return &RollingLimit{
+		limit:  limit,
+		period: period,
+	}
+}
+
+// Take adds the amount if the total within the period stays within the limit
+func (l *RollingLimit) Take(amount int64, now time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	total := l.total(now)
+	if total+amount > l.limit {
+		return fmt.Errorf("limit of %d per %v reached, %d taken", l.limit, l.period, total)
+	}
+	l.taken = append(l.taken, rollingAmount{at: now, amount: amount})
+	return nil
+}
+
+// Remaining is what can be taken at the given time
+func (l *RollingLimit) Remaining(now time.Time) int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.limit - l.total(now)
+}
+
+// total drops the amounts taken before the period
+func (l *RollingLimit) total(now time.Time) int64 {
+	start := now.Add(-l.period)
+	i := 0
+	for i < len(l.taken) && !l.taken[i].at.After(start) {
+		i++
+	}
+	l.taken = l.taken[i:]
+	var total int64
+	for _, t := range l.taken {
+		total += t.amount
+	}
+	return total
+}
@@ -52,8 +52,9 @@ func HttpGetWithContext(ctx context.Context, url string) (*http.Response, error)
 	return http.DefaultClient.Do(req)
 }
 
+// HttpPostWithContext posts the body, the request is canceled when the context ends
 func HttpPostWithContext(ctx context.Context, url string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest("POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 
 	if err != nil {
 		return nil, err
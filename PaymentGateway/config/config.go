@@ -4,25 +4,58 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
-	"strconv"
+	"math"
+	"net/url"
 	"time"
 
 	"github.com/go-errors/errors"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
 	"github.com/tkanos/gonfig"
 )
 
 const StellarImmediateOperationTimeoutSec = 60
 const StellarImmediateOperationBaseFee = 200
 
+// StellarMaxBaseFee is the default ceiling of the base fee taken from the horizon fee stats, in stroops per operation
+const StellarMaxBaseFee = 10000
+const StellarPeerAccountStartingBalance = "5"
+const StellarChannelAccountStartingBalance = "5"
+
 type jsonCnfiguration struct {
 	Port                         int
+	GrpcPort                     int
+	GrpcAddress                  string
+	CommandGrpcTarget            string
 	StellarSeed                  string
+	StellarKeystore              string
+	AllowCleartextSeed           bool
 	JaegerUrl                    string
 	JaegerServiceName            string
 	AutoFlushPeriod              Duration
 	MaxConcurrency               int
 	TransactionValidityPeriodSec int64
+	MaxBaseFee                   int64
+	ChannelKeystores             []string
+	ChannelAccounts              int
+	SignerSocket                 string
+	CoSigners                    []CoSignerConfig
+	StellarNetwork               string
+	HorizonUrl                   string
+	NetworkPassphrase            string
+	CommandTimeout               Duration
+	CommandRetries               *int
+	CommandRetryBackoff          Duration
+	Fees                         *FeeConfig
+	PriceTable                   string
+	PaymentRequestValidity       Duration
+	ShutdownTimeout              Duration
+	FlushSourceAmount            *uint32
+	FlushPendingCount            *int
+	FlushExpiryMargin            Duration
+	FlushCheckInterval           Duration
+	PeerAccountsPerDay           *int
+	MaxPaymentFee                uint32
 }
 
 type Duration struct {
@@ -58,31 +91,276 @@ type NodeConfig struct {
 	AutoFlushPeriod        time.Duration
 	AsyncMode              bool
 	AccumulateTransactions bool
+	Fees                   FeeConfig
+	PaymentRequestValidity time.Duration // of the signed payment requests issued by the node
+	Flush                  FlushPolicy
+	PeerAccountsPerDay     int    // funded by the node for the side channel peers, zero disables the creation
+	MaxPaymentFee          uint32 // total fee of the hops per payment of the node, in transaction units
+}
+
+// FlushPolicy flushes the accumulated transactions before AutoFlushPeriod elapses once any of
+// the limits is reached, a zero limit is disabled
+type FlushPolicy struct {
+	SourceAmount  uint32        // accumulated from a single payment source, in transaction units
+	PendingCount  int           // of the accumulated transactions
+	ExpiryMargin  time.Duration // remaining before the upper timebound of an accumulated transaction
+	CheckInterval time.Duration // of the limits, they are also checked after each committed payment
+}
+
+func (p FlushPolicy) String() string {
+	return fmt.Sprintf("source amount %d, pending count %d, expiry margin %v, checked every %v",
+		p.SourceAmount, p.PendingCount, p.ExpiryMargin, p.CheckInterval)
+}
+
+// FeePolicy is the relay fee charged for forwarding a payment, the amounts are
+// in transaction units (1e-3 pptoken)
+type FeePolicy struct {
+	Flat       uint32
+	Percentage float64 // of the forwarded amount
+	Minimum    uint32
+}
+
+// Fee returns the fee for forwarding the amount, the percentage part is rounded up.
+// A fee which doesn't fit the transaction amounts is an error.
+func (p FeePolicy) Fee(amount uint32) (uint32, error) {
+	percentage := math.Ceil(float64(amount) * p.Percentage / 100)
+	if !(percentage >= 0 && percentage <= math.MaxUint32) {
+		return 0, fmt.Errorf("fee percentage %v of amount %d is out of range", p.Percentage, amount)
+	}
+	fee := uint64(p.Flat) + uint64(percentage)
+	if fee > math.MaxUint32 {
+		return 0, fmt.Errorf("fee of amount %d exceeds the maximum amount", amount)
+	}
+	if fee < uint64(p.Minimum) {
+		return p.Minimum, nil
+	}
+	return uint32(fee), nil
 }
+
+func (p FeePolicy) Validate() error {
+	if !(p.Percentage >= 0 && p.Percentage <= 100) {
+		return fmt.Errorf("fee percentage %v is out of range", p.Percentage)
+	}
+	return nil
+}
+
+// FeeConfig is the fee policy published by the node, the policy of an asset overrides the default one
+type FeeConfig struct {
+	Default FeePolicy
+	Assets  map[string]FeePolicy
+}
+
+func (c FeeConfig) Policy(asset string) FeePolicy {
+	policy, ok := c.Assets[asset]
+	if ok {
+		return policy
+	}
+	return c.Default
+}
+
+func (c FeeConfig) Validate() error {
+	err := c.Default.Validate()
+	if err != nil {
+		return err
+	}
+	for asset, policy := range c.Assets {
+		err = policy.Validate()
+		if err != nil {
+			return fmt.Errorf("asset %s: %v", asset, err)
+		}
+	}
+	return nil
+}
+
+// CommandConfig controls the commands sent to the hops of a payment
+type CommandConfig struct {
+	Timeout      time.Duration // of a single attempt, applies unless the context ends earlier
+	Retries      int           // additional attempts of the idempotent commands (create and sign)
+	RetryBackoff time.Duration // delay before the first retry, doubled for each next one
+}
+
+type StellarNetwork string
+
+const (
+	TestNetwork   StellarNetwork = "testnet"
+	PublicNetwork StellarNetwork = "pubnet"
+	// PrivateNetwork is any other network (e.g. a standalone quickstart), both
+	// HorizonUrl and NetworkPassphrase have to be configured explicitly
+	PrivateNetwork StellarNetwork = "private"
+)
+
+const testNetworkHorizonUrl = "https://horizon-testnet.stellar.org/"
+const publicNetworkHorizonUrl = "https://horizon.stellar.org/"
+
 type RootApiConfig struct {
-	UseTestApi              bool
-	Seed                    string
+	Network                 StellarNetwork
+	HorizonUrl              string
+	NetworkPassphrase       string
 	TransactionValiditySecs int64
+	// Keystore is the encrypted file of the node seed
+	Keystore string
+	// CleartextSeed is the node seed used instead of the keystore, only with AllowCleartextSeed for the in-memory
+	// ledger and the tests
+	CleartextSeed      string
+	AllowCleartextSeed bool
+	// KeystorePassphraseFd is the file descriptor the keystore passphrase is read from, it comes from the command line
+	KeystorePassphraseFd int
+	// MaxBaseFee caps the base fee in stroops per operation during network surges
+	MaxBaseFee int64
+	// ChannelKeystores are the encrypted files of the channel accounts sourcing the node operations which don't
+	// need a node sequence, their passphrases are read like the ones of the co-signers
+	ChannelKeystores []string
+	// ChannelAccounts is the number of channel accounts derived from the node seed, created if they don't exist
+	ChannelAccounts int
+	// SignerSocket is the unix socket of the signing daemon holding the node key, the Keystore isn't used if it is set
+	SignerSocket string
+	// CoSigners complete the signatures of the node key when the node account is multisig
+	CoSigners []CoSignerConfig
+	// UseMemoryLedger replaces horizon with the process wide in-memory ledger (offline testing)
+	UseMemoryLedger bool
+}
+
+// CoSignerConfig is another signer of the node account, either a local keystore or a co-signing endpoint.
+// The passphrases of the keystores are read after the one of the node keystore, from the same file descriptor
+// or environment variable, unless the keystore has its own PassphraseEnv.
+type CoSignerConfig struct {
+	Keystore      string
+	PassphraseEnv string
+	Url           string
+}
+
+func (cfg CoSignerConfig) Validate() error {
+	if (cfg.Keystore == "") == (cfg.Url == "") {
+		return fmt.Errorf("either the keystore or the url has to be set")
+	}
+	if cfg.PassphraseEnv != "" && cfg.Keystore == "" {
+		return fmt.Errorf("the passphrase variable is only used with a keystore")
+	}
+	if cfg.Url != "" {
+		u, err := url.Parse(cfg.Url)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid url %s", cfg.Url)
+		}
+	}
+	return nil
 }
+
+func (cfg RootApiConfig) GetNetwork() StellarNetwork {
+	if cfg.Network == "" {
+		return TestNetwork
+	}
+	return cfg.Network
+}
+
+// GetHorizonUrl returns the configured horizon url or the default one of a well known network
+func (cfg RootApiConfig) GetHorizonUrl() string {
+	if cfg.HorizonUrl != "" {
+		return cfg.HorizonUrl
+	}
+	switch cfg.GetNetwork() {
+	case TestNetwork:
+		return testNetworkHorizonUrl
+	case PublicNetwork:
+		return publicNetworkHorizonUrl
+	default:
+		return ""
+	}
+}
+
+// GetNetworkPassphrase returns the configured passphrase or the one of a well known network
+func (cfg RootApiConfig) GetNetworkPassphrase() string {
+	if cfg.NetworkPassphrase != "" {
+		return cfg.NetworkPassphrase
+	}
+	switch cfg.GetNetwork() {
+	case TestNetwork:
+		return network.TestNetworkPassphrase
+	case PublicNetwork:
+		return network.PublicNetworkPassphrase
+	default:
+		return ""
+	}
+}
+
+// Validate checks that the network selection, horizon url and passphrase are consistent,
+// so that transactions are never signed for a network other than the one selected
+func (cfg RootApiConfig) Validate() error {
+	if cfg.UseMemoryLedger {
+		return nil
+	}
+	switch cfg.GetNetwork() {
+	case TestNetwork:
+		if cfg.NetworkPassphrase != "" && cfg.NetworkPassphrase != network.TestNetworkPassphrase {
+			return fmt.Errorf("network passphrase %q doesn't match the test network", cfg.NetworkPassphrase)
+		}
+	case PublicNetwork:
+		if cfg.NetworkPassphrase != "" && cfg.NetworkPassphrase != network.PublicNetworkPassphrase {
+			return fmt.Errorf("network passphrase %q doesn't match the public network", cfg.NetworkPassphrase)
+		}
+	case PrivateNetwork:
+		if cfg.HorizonUrl == "" {
+			return fmt.Errorf("horizon url is required for a private network")
+		}
+		if cfg.NetworkPassphrase == "" {
+			return fmt.Errorf("network passphrase is required for a private network")
+		}
+		if cfg.NetworkPassphrase == network.TestNetworkPassphrase || cfg.NetworkPassphrase == network.PublicNetworkPassphrase {
+			return fmt.Errorf("private network can't use the %q passphrase, select the corresponding network instead", cfg.NetworkPassphrase)
+		}
+	default:
+		return fmt.Errorf("unknown stellar network %q (expected %s, %s or %s)", cfg.Network, TestNetwork, PublicNetwork, PrivateNetwork)
+	}
+
+	u, err := url.Parse(cfg.GetHorizonUrl())
+	if err != nil {
+		return fmt.Errorf("invalid horizon url %q: %v", cfg.GetHorizonUrl(), err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid horizon url %q", cfg.GetHorizonUrl())
+	}
+	return nil
+}
+
 type JaegerConfig struct {
 	Url         string
 	ServiceName string
 }
 type Configuration struct {
-	RootApiConfig    RootApiConfig
-	Port             int
-	JaegerConfig     *JaegerConfig
-	MaxConcurrency   int
-	TorAddressPrefix string
-	NodeConfig       NodeConfig
+	RootApiConfig     RootApiConfig
+	Port              int
+	GrpcPort          int    // gRPC services are disabled if zero
+	GrpcAddress       string // host the gRPC services listen on, they have no TLS nor authentication so it is local by default
+	CommandGrpcTarget string // host:port of the grpc command streams, the http callbacks are used if empty
+	JaegerConfig      *JaegerConfig
+	MaxConcurrency    int
+	TorAddressPrefix  string
+	NodeConfig        NodeConfig
+	CommandConfig     CommandConfig
+	PriceTableFile    string        // json or yaml price table, reloaded on SIGHUP or change; the built-in prices are used if empty
+	ShutdownTimeout   time.Duration // for the payments in progress to complete, then for each server to stop and for the final flush
 }
 
 const torAddressPrefix = "http://localhost:5817"
 const asyncMode = false
-const useTestApi = true
 const accumulateTransactions = true
 const jaegerUrl = "http://192.168.162.128:14268/api/traces"
 const jaegerServiceURL = "PaymentGatewayTest"
+const commandTimeout = 60 * time.Second
+const commandRetries = 2
+const commandRetryBackoff = time.Second
+const relayFee = 10
+const paymentRequestValidity = 10 * time.Minute
+const shutdownTimeout = 30 * time.Second
+const grpcAddress = "127.0.0.1"
+const autoFlushPeriod = 15 * time.Minute
+const flushPendingCount = 100
+const flushExpiryMargin = time.Hour
+const flushCheckInterval = time.Minute
+const peerAccountsPerDay = 20
+const maxPaymentFee = 1000
 
 func DefaultCfg() *Configuration {
 	return &Configuration{
@@ -93,16 +371,36 @@ func DefaultCfg() *Configuration {
 		},
 
 		TorAddressPrefix: torAddressPrefix,
+		GrpcAddress:      grpcAddress,
 		MaxConcurrency:   10,
+		ShutdownTimeout:  shutdownTimeout,
 		RootApiConfig: RootApiConfig{
 			TransactionValiditySecs: 21600,
-			UseTestApi:              true,
+			MaxBaseFee:              StellarMaxBaseFee,
+			Network:                 TestNetwork,
 		},
 
 		NodeConfig: NodeConfig{
-			AutoFlushPeriod:        15 * time.Minute,
+			AutoFlushPeriod:        autoFlushPeriod,
 			AsyncMode:              asyncMode,
 			AccumulateTransactions: accumulateTransactions,
+			Fees: FeeConfig{
+				Default: FeePolicy{Flat: relayFee},
+			},
+			PaymentRequestValidity: paymentRequestValidity,
+			Flush: FlushPolicy{
+				PendingCount:  flushPendingCount,
+				ExpiryMargin:  flushExpiryMargin,
+				CheckInterval: flushCheckInterval,
+			},
+			PeerAccountsPerDay: peerAccountsPerDay,
+			MaxPaymentFee:      maxPaymentFee,
+		},
+
+		CommandConfig: CommandConfig{
+			Timeout:      commandTimeout,
+			Retries:      commandRetries,
+			RetryBackoff: commandRetryBackoff,
 		},
 	}
 }
@@ -116,11 +414,25 @@ func ParseConfiguration(configFile string) (*Configuration, error) {
 		return nil, err
 	}
 	instance := &Configuration{
-		Port: rawConfig.Port,
+		Port:              rawConfig.Port,
+		GrpcPort:          rawConfig.GrpcPort,
+		GrpcAddress:       rawConfig.GrpcAddress,
+		CommandGrpcTarget: rawConfig.CommandGrpcTarget,
+		PriceTableFile:    rawConfig.PriceTable,
+		ShutdownTimeout:   rawConfig.ShutdownTimeout.Duration,
 		RootApiConfig: RootApiConfig{
-			UseTestApi:              useTestApi,
-			Seed:                    rawConfig.StellarSeed,
+			Network:                 StellarNetwork(rawConfig.StellarNetwork),
+			HorizonUrl:              rawConfig.HorizonUrl,
+			NetworkPassphrase:       rawConfig.NetworkPassphrase,
+			Keystore:                rawConfig.StellarKeystore,
+			CleartextSeed:           rawConfig.StellarSeed,
+			AllowCleartextSeed:      rawConfig.AllowCleartextSeed,
 			TransactionValiditySecs: rawConfig.TransactionValidityPeriodSec,
+			MaxBaseFee:              rawConfig.MaxBaseFee,
+			ChannelKeystores:        rawConfig.ChannelKeystores,
+			ChannelAccounts:         rawConfig.ChannelAccounts,
+			SignerSocket:            rawConfig.SignerSocket,
+			CoSigners:               rawConfig.CoSigners,
 		},
 		JaegerConfig: &JaegerConfig{
 			Url:         rawConfig.JaegerUrl,
@@ -129,9 +441,19 @@ func ParseConfiguration(configFile string) (*Configuration, error) {
 
 		MaxConcurrency: rawConfig.MaxConcurrency,
 		NodeConfig: NodeConfig{
-			AutoFlushPeriod:        0,
+			AutoFlushPeriod:        rawConfig.AutoFlushPeriod.Duration,
 			AsyncMode:              asyncMode,
 			AccumulateTransactions: accumulateTransactions,
+			PaymentRequestValidity: rawConfig.PaymentRequestValidity.Duration,
+			Flush: FlushPolicy{
+				ExpiryMargin:  rawConfig.FlushExpiryMargin.Duration,
+				CheckInterval: rawConfig.FlushCheckInterval.Duration,
+			},
+		},
+		CommandConfig: CommandConfig{
+			Timeout:      rawConfig.CommandTimeout.Duration,
+			Retries:      commandRetries,
+			RetryBackoff: rawConfig.CommandRetryBackoff.Duration,
 		},
 	}
 
@@ -139,31 +461,126 @@ func ParseConfiguration(configFile string) (*Configuration, error) {
 	if instance.Port == 0 {
 		instance.Port = defCfg.Port
 	}
+	if instance.GrpcAddress == "" {
+		instance.GrpcAddress = defCfg.GrpcAddress
+	}
 	if instance.MaxConcurrency == 0 {
 		instance.MaxConcurrency = defCfg.MaxConcurrency
 	}
+	if instance.ShutdownTimeout == 0 {
+		instance.ShutdownTimeout = defCfg.ShutdownTimeout
+	}
 	if instance.RootApiConfig.TransactionValiditySecs == 0 {
 		instance.RootApiConfig.TransactionValiditySecs = defCfg.RootApiConfig.TransactionValiditySecs
 	}
+	if instance.RootApiConfig.MaxBaseFee == 0 {
+		instance.RootApiConfig.MaxBaseFee = defCfg.RootApiConfig.MaxBaseFee
+	} else if instance.RootApiConfig.MaxBaseFee < txnbuild.MinBaseFee {
+		return nil, fmt.Errorf("max base fee %d is below the network minimum %d", instance.RootApiConfig.MaxBaseFee, txnbuild.MinBaseFee)
+	}
+	if instance.RootApiConfig.CleartextSeed != "" {
+		if instance.RootApiConfig.Keystore != "" {
+			return nil, fmt.Errorf("StellarSeed and StellarKeystore can't be both set")
+		}
+		if !instance.RootApiConfig.AllowCleartextSeed {
+			return nil, fmt.Errorf("StellarSeed is stored in cleartext, move it to a keystore with `payment-gateway keys import -config %s`", configFile)
+		}
+		log.Printf("StellarSeed is stored in cleartext, it is only allowed for testing")
+	}
+	if instance.RootApiConfig.ChannelAccounts < 0 {
+		return nil, fmt.Errorf("invalid number of channel accounts %d", instance.RootApiConfig.ChannelAccounts)
+	}
+	for _, file := range instance.RootApiConfig.ChannelKeystores {
+		if file == "" || file == instance.RootApiConfig.Keystore {
+			return nil, fmt.Errorf("invalid channel keystore %q", file)
+		}
+	}
+	for _, coSigner := range instance.RootApiConfig.CoSigners {
+		err = coSigner.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid co-signer: %v", err)
+		}
+	}
+	if instance.RootApiConfig.Network == "" {
+		instance.RootApiConfig.Network = defCfg.RootApiConfig.Network
+	}
+	if instance.CommandConfig.Timeout == 0 {
+		instance.CommandConfig.Timeout = defCfg.CommandConfig.Timeout
+	}
+	if rawConfig.CommandRetries != nil {
+		instance.CommandConfig.Retries = *rawConfig.CommandRetries
+	}
+	if instance.CommandConfig.RetryBackoff == 0 {
+		instance.CommandConfig.RetryBackoff = defCfg.CommandConfig.RetryBackoff
+	}
 	instance.NodeConfig.AsyncMode = asyncMode
 	instance.NodeConfig.AccumulateTransactions = accumulateTransactions
+	if instance.NodeConfig.AutoFlushPeriod == 0 {
+		instance.NodeConfig.AutoFlushPeriod = defCfg.NodeConfig.AutoFlushPeriod
+	}
+	instance.NodeConfig.Flush.PendingCount = defCfg.NodeConfig.Flush.PendingCount
+	if rawConfig.FlushPendingCount != nil {
+		instance.NodeConfig.Flush.PendingCount = *rawConfig.FlushPendingCount
+	}
+	if rawConfig.FlushSourceAmount != nil {
+		instance.NodeConfig.Flush.SourceAmount = *rawConfig.FlushSourceAmount
+	}
+	// The default margin leaves at least three quarters of the validity for accumulating
+	validity := time.Duration(instance.RootApiConfig.TransactionValiditySecs) * time.Second
+	if instance.NodeConfig.Flush.ExpiryMargin == 0 {
+		instance.NodeConfig.Flush.ExpiryMargin = defCfg.NodeConfig.Flush.ExpiryMargin
+		if instance.NodeConfig.Flush.ExpiryMargin > validity/4 {
+			instance.NodeConfig.Flush.ExpiryMargin = validity / 4
+		}
+	} else if instance.NodeConfig.Flush.ExpiryMargin >= validity {
+		return nil, fmt.Errorf("flush expiry margin %v isn't shorter than the transaction validity %v", instance.NodeConfig.Flush.ExpiryMargin, validity)
+	}
+	if instance.NodeConfig.Flush.CheckInterval == 0 {
+		instance.NodeConfig.Flush.CheckInterval = defCfg.NodeConfig.Flush.CheckInterval
+	}
+	if instance.NodeConfig.PaymentRequestValidity == 0 {
+		instance.NodeConfig.PaymentRequestValidity = defCfg.NodeConfig.PaymentRequestValidity
+	}
+	instance.NodeConfig.PeerAccountsPerDay = defCfg.NodeConfig.PeerAccountsPerDay
+	if rawConfig.PeerAccountsPerDay != nil {
+		if *rawConfig.PeerAccountsPerDay < 0 {
+			return nil, fmt.Errorf("invalid number of peer accounts per day %d", *rawConfig.PeerAccountsPerDay)
+		}
+		instance.NodeConfig.PeerAccountsPerDay = *rawConfig.PeerAccountsPerDay
+	}
+	instance.NodeConfig.MaxPaymentFee = rawConfig.MaxPaymentFee
+	if instance.NodeConfig.MaxPaymentFee == 0 {
+		instance.NodeConfig.MaxPaymentFee = defCfg.NodeConfig.MaxPaymentFee
+	}
+	instance.NodeConfig.Fees = defCfg.NodeConfig.Fees
+	if rawConfig.Fees != nil {
+		instance.NodeConfig.Fees = *rawConfig.Fees
+	}
+	err = instance.NodeConfig.Fees.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid fee configuration: %v", err)
+	}
+
+	err = instance.RootApiConfig.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid stellar network configuration: %v", err)
+	}
 	return instance, nil
 }
 
-func ParseConfig() (*Configuration, error) {
-	config, err := ParseConfiguration("config.json")
-
+// ReadCleartextSeed returns the StellarSeed of the configuration file, for its import into a keystore
+func ReadCleartextSeed(configFile string) (string, error) {
+	rawConfig := jsonCnfiguration{}
+	err := gonfig.GetConf(configFile, &rawConfig)
 	if err != nil {
-		log.Printf("Error reading configuration file (config.json), trying cmdline params: %v", err)
-		if len(os.Args) < 3 {
-			log.Panic("Reading configuration file failed, and no command line parameters supplied.")
-		}
-		config.RootApiConfig.Seed = os.Args[1]
-		config.Port, err = strconv.Atoi(os.Args[2])
-		if err != nil {
-			return nil, fmt.Errorf("port supplied, but couldn't be parsed: %v", err)
-		}
-		return config, nil
+		return "", err
+	}
+	if rawConfig.StellarSeed == "" {
+		return "", fmt.Errorf("%s has no StellarSeed", configFile)
 	}
-	return config, nil
+	return rawConfig.StellarSeed, nil
+}
+
+func ParseConfig() (*Configuration, error) {
+	return ParseConfiguration("config.json")
 }
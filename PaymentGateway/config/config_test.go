@@ -0,0 +1,210 @@
+package config
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultNetworkIsTestnet(t *testing.T) {
+	cfg := RootApiConfig{}
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, network.TestNetworkPassphrase, cfg.GetNetworkPassphrase())
+	assert.Equal(t, testNetworkHorizonUrl, cfg.GetHorizonUrl())
+}
+
+func TestPublicNetwork(t *testing.T) {
+	cfg := RootApiConfig{Network: PublicNetwork}
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, network.PublicNetworkPassphrase, cfg.GetNetworkPassphrase())
+	assert.Equal(t, publicNetworkHorizonUrl, cfg.GetHorizonUrl())
+
+	cfg.HorizonUrl = "https://horizon.example.com"
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, "https://horizon.example.com", cfg.GetHorizonUrl())
+}
+
+func TestPassphraseMismatch(t *testing.T) {
+	cfg := RootApiConfig{Network: PublicNetwork, NetworkPassphrase: network.TestNetworkPassphrase}
+	assert.Error(t, cfg.Validate())
+
+	cfg = RootApiConfig{Network: TestNetwork, NetworkPassphrase: network.PublicNetworkPassphrase}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestPrivateNetwork(t *testing.T) {
+	cfg := RootApiConfig{Network: PrivateNetwork}
+	assert.Error(t, cfg.Validate())
+
+	cfg.HorizonUrl = "http://localhost:8000"
+	assert.Error(t, cfg.Validate())
+
+	cfg.NetworkPassphrase = network.PublicNetworkPassphrase
+	assert.Error(t, cfg.Validate())
+
+	cfg.NetworkPassphrase = "Standalone Network ; February 2017"
+	assert.NoError(t, cfg.Validate())
+	assert.Equal(t, "Standalone Network ; February 2017", cfg.GetNetworkPassphrase())
+}
+
+func TestInvalidNetwork(t *testing.T) {
+	assert.Error(t, RootApiConfig{Network: "mainnet"}.Validate())
+	assert.Error(t, RootApiConfig{Network: PublicNetwork, HorizonUrl: "horizon.stellar.org"}.Validate())
+}
+
+func fee(t *testing.T, p FeePolicy, amount uint32) uint32 {
+	fee, err := p.Fee(amount)
+	assert.NoError(t, err)
+	return fee
+}
+
+func TestFeePolicy(t *testing.T) {
+	assert.Equal(t, uint32(10), fee(t, FeePolicy{Flat: 10}, 1000))
+	assert.Equal(t, uint32(13), fee(t, FeePolicy{Flat: 10, Percentage: 0.25}, 1001))
+	assert.Equal(t, uint32(50), fee(t, FeePolicy{Percentage: 1, Minimum: 50}, 1000))
+	assert.Error(t, FeePolicy{Percentage: 101}.Validate())
+	assert.Error(t, FeePolicy{Percentage: math.NaN()}.Validate())
+
+	fees := FeeConfig{
+		Default: FeePolicy{Flat: 10},
+		Assets:  map[string]FeePolicy{"XLM": {Flat: 1}},
+	}
+	assert.Equal(t, uint32(1), fee(t, fees.Policy("XLM"), 1000))
+	assert.Equal(t, uint32(10), fee(t, fees.Policy("pptoken"), 1000))
+	fees.Assets["XLM"] = FeePolicy{Percentage: -1}
+	assert.Error(t, fees.Validate())
+}
+
+func TestFeePolicyOverflow(t *testing.T) {
+	// The fee doesn't wrap around to a small one
+	_, err := FeePolicy{Flat: 10, Percentage: 100}.Fee(math.MaxUint32)
+	assert.Error(t, err)
+	_, err = FeePolicy{Flat: math.MaxUint32, Percentage: 1}.Fee(1000)
+	assert.Error(t, err)
+	_, err = FeePolicy{Percentage: 1e12}.Fee(math.MaxUint32)
+	assert.Error(t, err)
+	_, err = FeePolicy{Percentage: math.NaN()}.Fee(1000)
+	assert.Error(t, err)
+
+	assert.Equal(t, uint32(math.MaxUint32), fee(t, FeePolicy{Percentage: 100}, math.MaxUint32))
+	assert.Equal(t, uint32(math.MaxUint32), fee(t, FeePolicy{Flat: math.MaxUint32 - 10, Percentage: 1}, 1000))
+}
+
+func parseJson(t *testing.T, content string) (*Configuration, error) {
+	file, err := ioutil.TempFile("", "config*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(content)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ParseConfiguration(file.Name())
+}
+
+func TestFlushPolicy(t *testing.T) {
+	cfg, err := parseJson(t, `{"TransactionValidityPeriodSec": 3600}`)
+	assert.NoError(t, err)
+	assert.Equal(t, autoFlushPeriod, cfg.NodeConfig.AutoFlushPeriod)
+	assert.Equal(t, FlushPolicy{PendingCount: flushPendingCount, ExpiryMargin: 15 * time.Minute, CheckInterval: flushCheckInterval}, cfg.NodeConfig.Flush)
+
+	cfg, err = parseJson(t, `{"AutoFlushPeriod": "5m", "FlushSourceAmount": 500, "FlushPendingCount": 0, "FlushExpiryMargin": "2h", "FlushCheckInterval": "10s"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, cfg.NodeConfig.AutoFlushPeriod)
+	assert.Equal(t, FlushPolicy{SourceAmount: 500, ExpiryMargin: 2 * time.Hour, CheckInterval: 10 * time.Second}, cfg.NodeConfig.Flush)
+
+	_, err = parseJson(t, `{"TransactionValidityPeriodSec": 3600, "FlushExpiryMargin": "1h"}`)
+	assert.Error(t, err)
+}
+
+func TestMaxBaseFee(t *testing.T) {
+	cfg, err := parseJson(t, `{}`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(StellarMaxBaseFee), cfg.RootApiConfig.MaxBaseFee)
+
+	cfg, err = parseJson(t, `{"MaxBaseFee": 5000}`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000), cfg.RootApiConfig.MaxBaseFee)
+
+	_, err = parseJson(t, `{"MaxBaseFee": 50}`)
+	assert.Error(t, err)
+}
+
+func TestChannelAccounts(t *testing.T) {
+	cfg, err := parseJson(t, `{"ChannelKeystores": ["channel.json"], "ChannelAccounts": 2}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"channel.json"}, cfg.RootApiConfig.ChannelKeystores)
+	assert.Equal(t, 2, cfg.RootApiConfig.ChannelAccounts)
+
+	_, err = parseJson(t, `{"ChannelKeystores": [""]}`)
+	assert.Error(t, err)
+	_, err = parseJson(t, `{"ChannelAccounts": -1}`)
+	assert.Error(t, err)
+	_, err = parseJson(t, `{"StellarKeystore": "keystore.json", "ChannelKeystores": ["keystore.json"]}`)
+	assert.Error(t, err)
+}
+
+func TestSignerSocket(t *testing.T) {
+	cfg, err := parseJson(t, `{"SignerSocket": "/run/pp-signer.sock"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "/run/pp-signer.sock", cfg.RootApiConfig.SignerSocket)
+	assert.Empty(t, cfg.RootApiConfig.CleartextSeed)
+}
+
+func TestKeystore(t *testing.T) {
+	cfg, err := parseJson(t, `{"StellarKeystore": "keystore.json"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "keystore.json", cfg.RootApiConfig.Keystore)
+	assert.Empty(t, cfg.RootApiConfig.CleartextSeed)
+
+	_, err = parseJson(t, `{"StellarSeed": "`+keypair.MustRandom().Seed()+`", "StellarKeystore": "keystore.json"}`)
+	assert.Error(t, err)
+}
+
+func TestCleartextSeed(t *testing.T) {
+	seed := keypair.MustRandom().Seed()
+	_, err := parseJson(t, `{"StellarSeed": "`+seed+`"}`)
+	assert.Error(t, err)
+
+	cfg, err := parseJson(t, `{"StellarSeed": "`+seed+`", "AllowCleartextSeed": true}`)
+	assert.NoError(t, err)
+	assert.Equal(t, seed, cfg.RootApiConfig.CleartextSeed)
+	assert.True(t, cfg.RootApiConfig.AllowCleartextSeed)
+}
+
+func TestCoSigners(t *testing.T) {
+	cfg, err := parseJson(t, `{"CoSigners": [{"Keystore": "cosigner.json"}, {"Url": "https://cosigner.example.com/sign"}]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []CoSignerConfig{{Keystore: "cosigner.json"}, {Url: "https://cosigner.example.com/sign"}}, cfg.RootApiConfig.CoSigners)
+
+	_, err = parseJson(t, `{"CoSigners": [{}]}`)
+	assert.Error(t, err)
+	_, err = parseJson(t, `{"CoSigners": [{"Keystore": "cosigner.json", "Url": "https://cosigner.example.com/sign"}]}`)
+	assert.Error(t, err)
+	_, err = parseJson(t, `{"CoSigners": [{"Url": "unix:///tmp/signer.sock"}]}`)
+	assert.Error(t, err)
+
+	cfg, err = parseJson(t, `{"CoSigners": [{"Keystore": "cosigner.json", "PassphraseEnv": "PP_COSIGNER_PASSPHRASE"}]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "PP_COSIGNER_PASSPHRASE", cfg.RootApiConfig.CoSigners[0].PassphraseEnv)
+	_, err = parseJson(t, `{"CoSigners": [{"Url": "https://cosigner.example.com/sign", "PassphraseEnv": "PP_COSIGNER_PASSPHRASE"}]}`)
+	assert.Error(t, err)
+}
+
+func TestGrpcAddress(t *testing.T) {
+	cfg, err := parseJson(t, `{"GrpcPort": 28081}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", cfg.GrpcAddress)
+
+	cfg, err = parseJson(t, `{"GrpcPort": 28081, "GrpcAddress": "0.0.0.0"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0", cfg.GrpcAddress)
+}
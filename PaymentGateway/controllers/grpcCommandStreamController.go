@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/stellar/go/support/log"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local"
+	"paidpiper.com/payment-gateway/ppsidechannel"
+)
+
+type GrpcCommandStreamController struct {
+	node local.LocalPPNode
+}
+
+func NewGrpcCommandStreamController(n local.LocalPPNode) *GrpcCommandStreamController {
+	return &GrpcCommandStreamController{
+		node: n,
+	}
+}
+
+// CommandStream handles the commands of a session concurrently, each reply carries the id of its command
+func (c *GrpcCommandStreamController) CommandStream(stream ppsidechannel.PPCommandStream_CommandStreamServer) error {
+	ctx, span := spanFromGrpcContext(stream.Context(), "grpc:CommandStream")
+	defer span.End()
+
+	sendMutex := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		command := &models.UtilityCommand{}
+		err = json.Unmarshal([]byte(request.GetCommandBody()), command)
+		if err != nil {
+			log.Errorf("Invalid command on grpc stream: %v", err)
+			continue
+		}
+		wg.Add(1)
+		go func(command *models.UtilityCommand) {
+			defer wg.Done()
+			reply := &models.CommandStreamReply{
+				CommandResponseCore: models.CommandResponseCore{
+					SessionId: command.SessionId,
+					CommandId: command.CommandId,
+					NodeId:    command.NodeId,
+				},
+			}
+			response, err := c.node.CommandHandler(ctx, command)
+			if err == nil {
+				reply.CommandResponse, err = json.Marshal(response)
+			}
+			if err != nil {
+				reply.Error = err.Error()
+			}
+			bs, err := json.Marshal(reply)
+			if err != nil {
+				log.Errorf("Error serializing command reply: %v", err)
+				return
+			}
+			sendMutex.Lock()
+			defer sendMutex.Unlock()
+			err = stream.Send(&ppsidechannel.CommandReply{
+				ResponseBody: string(bs),
+			})
+			if err != nil {
+				log.Errorf("Error sending reply of command %s: %v", command.CommandId, err)
+			}
+		}(command)
+	}
+}
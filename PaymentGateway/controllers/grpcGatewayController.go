@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local"
+	"paidpiper.com/payment-gateway/ppsidechannel"
+)
+
+type GrpcGatewayController struct {
+	node local.LocalPPNode
+}
+
+func NewGrpcGatewayController(n local.LocalPPNode) *GrpcGatewayController {
+	return &GrpcGatewayController{
+		node: n,
+	}
+}
+
+// ProcessPayment starts the payment, the route is resolved by tor if no addresses are given
+func (c *GrpcGatewayController) ProcessPayment(ctx context.Context, request *ppsidechannel.PaymentRequest) (*ppsidechannel.PaymentReply, error) {
+	ctx, span := spanFromGrpcContext(ctx, "grpc:ProcessPayment")
+	defer span.End()
+
+	var route []models.RoutingNode
+	for _, address := range request.GetRouteAddresses() {
+		route = append(route, models.RoutingNode{
+			NodeId:  address,
+			Address: address,
+		})
+	}
+	var quote *models.PriceQuote
+	if request.GetQuoteMultiplier() != 0 {
+		quote = &models.PriceQuote{
+			Multiplier: request.GetQuoteMultiplier(),
+			UsedUnits:  request.GetQuoteUsedUnits(),
+		}
+	}
+	_, err := c.node.ProcessPayment(ctx, &models.ProcessPaymentRequest{
+		Route: route,
+		PaymentRequest: &models.PaymentRequest{
+			Amount:           models.TransactionAmount(request.GetTransactionAmount()),
+			Asset:            request.GetAsset(),
+			ServiceRef:       request.GetServiceRef(),
+			ServiceSessionId: request.GetServiceSessionId(),
+			Address:          request.GetAddress(),
+			Quote:            quote,
+			IssuedAt:         request.GetIssuedAt(),
+			ExpiresAt:        request.GetExpiresAt(),
+			Nonce:            request.GetNonce(),
+			Signature:        request.GetSignature(),
+		},
+		NodeId: models.PeerID(request.GetAddress()),
+	})
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &ppsidechannel.PaymentReply{}, nil
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local"
+	"paidpiper.com/payment-gateway/ppsidechannel"
+)
+
+type GrpcSideChannelController struct {
+	node local.LocalPPNode
+}
+
+func NewGrpcSideChannelController(n local.LocalPPNode) *GrpcSideChannelController {
+	return &GrpcSideChannelController{
+		node: n,
+	}
+}
+
+func (c *GrpcSideChannelController) SetUpPeer(ctx context.Context, request *ppsidechannel.SetUpPeerRequest) (*ppsidechannel.SetUpPeerResponse, error) {
+	ctx, span := spanFromGrpcContext(ctx, "grpc:SetUpPeer")
+	defer span.End()
+
+	if request.GetStellarAddress() == "" {
+		return nil, status.Error(codes.InvalidArgument, "stellar address not specified")
+	}
+	res, err := c.node.SetUpPeer(ctx, &models.SetUpPeerRequest{
+		Address:   request.GetStellarAddress(),
+		Timestamp: request.GetTimestamp(),
+		Signature: request.GetSignature(),
+	})
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	response := &ppsidechannel.SetUpPeerResponse{
+		Status: ppsidechannel.SetUpPeerResponse_SetUpStatus(res.Status),
+	}
+	if res.TransactionXdr != nil {
+		response.TransactionXdr = res.TransactionXdr.String()
+	}
+	return response, nil
+}
+
+func (c *GrpcSideChannelController) CreateOrFund(ctx context.Context, request *ppsidechannel.CreateOrFundRequest) (*ppsidechannel.CreateOrFundResponse, error) {
+	ctx, span := spanFromGrpcContext(ctx, "grpc:CreateOrFund")
+	defer span.End()
+
+	err := c.node.CreateOrFund(ctx, models.NewXDR(request.GetTransactionXdr()))
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &ppsidechannel.CreateOrFundResponse{
+		Success: true,
+	}, nil
+}
+
+func (c *GrpcSideChannelController) InitiatePayment(ctx context.Context, request *ppsidechannel.InitiatePaymentRequest) (*ppsidechannel.InitiatePaymentResponse, error) {
+	ctx, span := spanFromGrpcContext(ctx, "grpc:InitiatePayment")
+	defer span.End()
+
+	paymentRequest := &models.InitiatePaymentRequest{
+		FromAddress: request.GetFromStellarAddress(),
+		Amount:      request.GetAmount(),
+		Asset:       request.GetAsset(),
+		Memo:        request.GetMemo(),
+		ToAddress:   request.GetToStellarAddress(),
+	}
+	if prev := request.GetPrevTransactionXdr(); prev != "" {
+		paymentRequest.PrevTransactionXdr = models.NewXDR(prev)
+	}
+	res, err := c.node.InitiatePayment(ctx, paymentRequest)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &ppsidechannel.InitiatePaymentResponse{
+		GwPresentTransactionXdr:       res.PresentTransactionXdr.String(),
+		GwReimbursementTransactionXdr: res.ReimbursementTransactionXdr.String(),
+	}, nil
+}
+
+func (c *GrpcSideChannelController) PaymentCommit(ctx context.Context, request *ppsidechannel.PaymentCommitRequest) (*ppsidechannel.PaymentCommitResponse, error) {
+	ctx, span := spanFromGrpcContext(ctx, "grpc:PaymentCommit")
+	defer span.End()
+
+	signed, err := c.node.PaymentCommit(ctx, models.NewXDR(request.GetSignedReimbursementTransactionXdr()))
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &ppsidechannel.PaymentCommitResponse{
+		SignedDestinationTransactionXdr: signed.String(),
+	}, nil
+}
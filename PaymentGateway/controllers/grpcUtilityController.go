@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local"
+	"paidpiper.com/payment-gateway/ppsidechannel"
+)
+
+type GrpcUtilityController struct {
+	node local.LocalPPNode
+}
+
+func NewGrpcUtilityController(n local.LocalPPNode) *GrpcUtilityController {
+	return &GrpcUtilityController{
+		node: n,
+	}
+}
+
+// ProcessCommand handles the command synchronously, the body and the reply are the json used by the http api
+func (c *GrpcUtilityController) ProcessCommand(ctx context.Context, request *ppsidechannel.CommandRequest) (*ppsidechannel.CommandReply, error) {
+	ctx, span := spanFromGrpcContext(ctx, "grpc:ProcessCommand")
+	defer span.End()
+
+	commandType := models.CommandType(request.GetCommandType())
+	body, err := models.CommandType_Command(commandType)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	err = json.Unmarshal([]byte(request.GetCommandBody()), body)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid command body: %v", err)
+	}
+	reply, err := c.node.CommandHandler(ctx, &models.UtilityCommand{
+		CommandCore: models.CommandCore{
+			CommandType: commandType,
+		},
+		CommandBody: body,
+	})
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	bs, err := json.Marshal(reply)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &ppsidechannel.CommandReply{
+		ResponseBody: string(bs),
+	}, nil
+}
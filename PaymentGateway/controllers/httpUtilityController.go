@@ -7,12 +7,18 @@ import (
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
 	"paidpiper.com/payment-gateway/common"
 
 	"paidpiper.com/payment-gateway/models"
 	"paidpiper.com/payment-gateway/node/local"
 )
 
+const (
+	qrCodeSize               = 256 // pixels
+	defaultFlushHistoryLimit = 50
+)
+
 type HttpUtilityController struct {
 	local.LocalPPNode
 }
@@ -48,12 +54,80 @@ func (u *HttpUtilityController) HttpFlushTransactions(w http.ResponseWriter, r *
 
 	ctx, span := spanFromRequest(r, "requesthandler:FlushTransactions")
 	defer span.End()
-	err := u.FlushTransactions(ctx)
+	report, err := u.FlushTransactions(ctx)
 	if err != nil {
 		Respond(w, MessageWithStatus(http.StatusBadRequest, "Error in FlushTransactions: "+err.Error()))
+		return
+	}
+
+	Respond(w, report)
+}
+
+// HttpFlushHistory lists the latest flush reports, at most ?limit of them
+func (u *HttpUtilityController) HttpFlushHistory(w http.ResponseWriter, r *http.Request) {
+	_, span := spanFromRequest(r, "requesthandler:FlushHistory")
+	defer span.End()
+
+	limit := defaultFlushHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			Respond(w, MessageWithStatus(http.StatusBadRequest, "limit should be int"))
+			return
+		}
+	}
+	reports, err := u.GetFlushHistory(limit)
+	if err != nil {
+		Respond(w, MessageWithStatus(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	Respond(w, reports)
+}
+
+func (u *HttpUtilityController) HttpGetFlushReport(w http.ResponseWriter, r *http.Request) {
+	_, span := spanFromRequest(r, "requesthandler:GetFlushReport")
+	defer span.End()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		Respond(w, MessageWithStatus(http.StatusBadRequest, "id should be int"))
+		return
+	}
+	report, err := u.GetFlushReport(id)
+	if err != nil {
+		Respond(w, MessageWithStatus(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	if report == nil {
+		Respond(w, MessageWithStatus(http.StatusNotFound, "flush report not found"))
+		return
 	}
+	Respond(w, report)
+}
+
+func (u *HttpUtilityController) HttpGetSequenceState(w http.ResponseWriter, r *http.Request) {
+	Respond(w, u.GetSequenceState())
+}
+
+func (u *HttpUtilityController) HttpUnflushedTransactions(w http.ResponseWriter, r *http.Request) {
+	_, span := spanFromRequest(r, "requesthandler:UnflushedTransactions")
+	defer span.End()
 
-	Respond(w, MessageWithStatus(http.StatusOK, "Transactions committed"))
+	res, err := u.GetUnflushedTransactions()
+	if err != nil {
+		Respond(w, MessageWithStatus(http.StatusConflict, err.Error()))
+		return
+	}
+	Respond(w, res)
+}
+
+func (u *HttpUtilityController) HttpGetPrices(w http.ResponseWriter, r *http.Request) {
+	Respond(w, u.GetPrices())
+}
+
+func (u *HttpUtilityController) HttpGetFeePolicy(w http.ResponseWriter, r *http.Request) {
+	Respond(w, u.GetFeePolicy())
 }
 
 func (u *HttpUtilityController) HttpGetStellarAddress(w http.ResponseWriter, r *http.Request) {
@@ -81,7 +155,26 @@ func (u *HttpUtilityController) HttpNewPaymentRequest(w http.ResponseWriter, r *
 		return
 	}
 
-	Respond(w, pr)
+	withUri, _ := strconv.ParseBool(r.URL.Query().Get("uri"))
+	if !withUri {
+		Respond(w, pr)
+		return
+	}
+	uri, err := pr.PaymentURI(u.GetNetworkPassphrase())
+	if err != nil {
+		Respond(w, MessageWithStatus(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	qr, err := qrcode.Encode(uri, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		Respond(w, MessageWithStatus(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	Respond(w, &models.PaymentRequestWithUri{
+		PaymentRequest: *pr,
+		PaymentUri:     uri,
+		QrCode:         qr,
+	})
 }
 
 func (u *HttpUtilityController) HttpValidatePayment(w http.ResponseWriter, r *http.Request) {
@@ -109,7 +109,7 @@ func (r *ResolverController) resolveByEthLink(domain string) (string, error) {
 
 		if strings.HasPrefix(answer.Data, "dnslink") {
 			resolvedData = strings.TrimPrefix(answer.Data, "dnslink=")
-			log.Debugf("resolveByEthLink dnslink response: %s ", answer)
+			log.Debugf("resolveByEthLink dnslink response: %s ", answer.Data)
 		}
 	}
 
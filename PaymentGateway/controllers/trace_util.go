@@ -60,3 +60,8 @@ func spanFromRequest(r *http.Request, spanName string) (context.Context, trace.S
 
 	return ctx, span
 }
+
+func spanFromGrpcContext(ctx context.Context, spanName string) (context.Context, trace.Span) {
+	tracer := common.CreateTracer("paidpiper/controller")
+	return tracer.Start(ctx, spanName)
+}
@@ -17,12 +17,20 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.7
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/rs/xid v1.2.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/stellar/go v0.0.0-20210324164845-827227e3edd3
 	github.com/stretchr/testify v1.5.1
 	github.com/tkanos/gonfig v0.0.0-20181112185242-896f3d81fadf
 	github.com/tylertreat/BoomFilters v0.0.0-20210315201527-1a82519a3e43
 	go.opentelemetry.io/otel v0.4.2
 	go.opentelemetry.io/otel/exporters/trace/jaeger v0.4.2
+	golang.org/x/crypto v0.11.0
+	golang.org/x/net v0.12.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	golang.org/x/term v0.10.0
+	golang.org/x/text v0.13.0 // indirect
 	google.golang.org/grpc v1.27.1
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,202 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/strkey"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	kdfScrypt       = "scrypt"
+	cipherXChaCha   = "xchacha20-poly1305"
+	saltSize        = 32
+)
+
+// ErrPassphrase is returned when the keystore can't be decrypted, the passphrase is wrong or the file was altered
+var ErrPassphrase = errors.New("invalid keystore passphrase")
+
+// ScryptParams are the cost parameters of the key derivation
+type ScryptParams struct {
+	N int
+	R int
+	P int
+}
+
+// DefaultScryptParams take about a second and 128MB to derive the key
+var DefaultScryptParams = ScryptParams{N: 1 << 17, R: 8, P: 1}
+
+// The parameters of a keystore are bounded, a crafted file can't make the derivation take
+// unbounded memory and time: 1GB at most with the highest N and R
+var maxScryptParams = ScryptParams{N: 1 << 20, R: 8, P: 16}
+
+func (p ScryptParams) validate() error {
+	if p.N <= 1 || p.N&(p.N-1) != 0 || p.N > maxScryptParams.N {
+		return fmt.Errorf("scrypt N %d isn't a power of two up to %d", p.N, maxScryptParams.N)
+	}
+	if p.R < 1 || p.R > maxScryptParams.R {
+		return fmt.Errorf("scrypt R %d isn't within 1 and %d", p.R, maxScryptParams.R)
+	}
+	if p.P < 1 || p.P > maxScryptParams.P {
+		return fmt.Errorf("scrypt P %d isn't within 1 and %d", p.P, maxScryptParams.P)
+	}
+	return nil
+}
+
+// Keystore is the node seed encrypted with a key derived from a passphrase. The address is
+// readable without the passphrase, it is authenticated with the seed.
+type Keystore struct {
+	Version    int
+	Address    string
+	KDF        string
+	Scrypt     ScryptParams
+	Salt       []byte
+	Cipher     string
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+func deriveKey(passphrase string, salt []byte, params ScryptParams) ([]byte, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	return scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, chacha20poly1305.KeySize)
+}
+
+// Encrypt seals the seed of the key pair with the passphrase, a new salt and nonce are used every time
+func Encrypt(kp *keypair.Full, passphrase string, params ScryptParams) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("empty keystore passphrase")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt, params)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	rawSeed, err := strkey.Decode(strkey.VersionByteSeed, kp.Seed())
+	if err != nil {
+		return nil, err
+	}
+	return &Keystore{
+		Version:    keystoreVersion,
+		Address:    kp.Address(),
+		KDF:        kdfScrypt,
+		Scrypt:     params,
+		Salt:       salt,
+		Cipher:     cipherXChaCha,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, rawSeed, []byte(kp.Address())),
+	}, nil
+}
+
+// Decrypt opens the keystore with the passphrase
+func (k *Keystore) Decrypt(passphrase string) (*keypair.Full, error) {
+	if k.Version != keystoreVersion || k.KDF != kdfScrypt || k.Cipher != cipherXChaCha {
+		return nil, fmt.Errorf("unsupported keystore version %d (%s, %s)", k.Version, k.KDF, k.Cipher)
+	}
+	key, err := deriveKey(passphrase, k.Salt, k.Scrypt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore: %v", err)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid keystore nonce")
+	}
+	seed, err := aead.Open(nil, k.Nonce, k.Ciphertext, []byte(k.Address))
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	var rawSeed [32]byte
+	if len(seed) != len(rawSeed) {
+		return nil, fmt.Errorf("invalid keystore seed")
+	}
+	copy(rawSeed[:], seed)
+	kp, err := keypair.FromRawSeed(rawSeed)
+	if err != nil {
+		return nil, err
+	}
+	if kp.Address() != k.Address {
+		return nil, fmt.Errorf("keystore seed doesn't match the address %s", k.Address)
+	}
+	return kp, nil
+}
+
+// Load reads the keystore file
+func Load(file string) (*Keystore, error) {
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keystore{}
+	err = json.Unmarshal(body, k)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing keystore %s: %v", file, err)
+	}
+	return k, nil
+}
+
+// Save writes the keystore readable only by the owner, an existing file is replaced atomically
+func (k *Keystore) Save(file string) error {
+	body, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(body)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// TempFile creates the file with 0600
+	return os.Rename(tmp.Name(), file)
+}
+
+// Open decrypts the keystore file with the passphrase read as described in ReadSecret
+func Open(file string, passphraseFd int) (*keypair.Full, error) {
+	return OpenWithEnv(file, passphraseFd, PassphraseEnv)
+}
+
+// OpenWithEnv is Open with the passphrase in the environment variable passphraseEnv
+func OpenWithEnv(file string, passphraseFd int, passphraseEnv string) (*keypair.Full, error) {
+	k, err := Load(file)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := ReadSecret(passphraseFd, passphraseEnv, fmt.Sprintf("Passphrase of %s (%s): ", file, k.Address))
+	if err != nil {
+		return nil, err
+	}
+	return k.Decrypt(passphrase)
+}
@@ -0,0 +1,157 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+)
+
+// The tests don't need the cost of the default parameters
+var testScryptParams = ScryptParams{N: 1 << 10, R: 8, P: 1}
+
+func TestKeystore(t *testing.T) {
+	kp := keypair.MustRandom()
+	k, err := Encrypt(kp, "passphrase", testScryptParams)
+	assert.NoError(t, err)
+	assert.Equal(t, kp.Address(), k.Address)
+
+	dir, err := ioutil.TempDir("", "keystore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "keystore.json")
+	assert.NoError(t, k.Save(file))
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	body, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(body), kp.Seed()))
+
+	loaded, err := Load(file)
+	assert.NoError(t, err)
+	decrypted, err := loaded.Decrypt("passphrase")
+	assert.NoError(t, err)
+	assert.Equal(t, kp.Seed(), decrypted.Seed())
+
+	_, err = loaded.Decrypt("wrong")
+	assert.Equal(t, ErrPassphrase, err)
+
+	// The address is authenticated
+	loaded.Address = keypair.MustRandom().Address()
+	_, err = loaded.Decrypt("passphrase")
+	assert.Equal(t, ErrPassphrase, err)
+
+	_, err = Encrypt(kp, "", testScryptParams)
+	assert.Error(t, err)
+
+	// A new salt and nonce every time
+	again, err := Encrypt(kp, "passphrase", testScryptParams)
+	assert.NoError(t, err)
+	assert.NotEqual(t, k.Salt, again.Salt)
+	assert.NotEqual(t, k.Ciphertext, again.Ciphertext)
+}
+
+func TestScryptParamsBounded(t *testing.T) {
+	kp := keypair.MustRandom()
+	k, err := Encrypt(kp, "passphrase", testScryptParams)
+	assert.NoError(t, err)
+
+	for _, params := range []ScryptParams{
+		{N: 1 << 21, R: 8, P: 1},
+		{N: 1000, R: 8, P: 1},
+		{N: 1, R: 8, P: 1},
+		{N: 1 << 10, R: 1 << 20, P: 1},
+		{N: 1 << 10, R: 8, P: 1 << 20},
+		{N: 1 << 10, R: 0, P: 1},
+	} {
+		k.Scrypt = params
+		_, err = k.Decrypt("passphrase")
+		assert.Error(t, err, "%+v", params)
+		assert.NotEqual(t, ErrPassphrase, err)
+
+		_, err = Encrypt(kp, "passphrase", params)
+		assert.Error(t, err, "%+v", params)
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	_, err = w.WriteString("passphrase\nseed\n")
+	assert.NoError(t, err)
+	w.Close()
+	// Both secrets can be sent on the same stream
+	line, err := readLine(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "passphrase", line)
+	line, err = readLine(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "seed", line)
+	_, err = readLine(r)
+	assert.Error(t, err)
+	r.Close()
+
+	r, w, err = os.Pipe()
+	assert.NoError(t, err)
+	_, err = w.WriteString("from fd")
+	assert.NoError(t, err)
+	w.Close()
+	secret, err := ReadSecret(int(r.Fd()), PassphraseEnv, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "from fd", secret)
+
+	os.Setenv(PassphraseEnv, "from env")
+	secret, err = ReadSecret(0, PassphraseEnv, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "from env", secret)
+	_, set := os.LookupEnv(PassphraseEnv)
+	assert.False(t, set)
+	ForgetEnvSecrets()
+}
+
+func TestOpenKeystoresFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	var files []string
+	var keyPairs []*keypair.Full
+	for _, name := range []string{"node.json", "cosigner.json"} {
+		kp := keypair.MustRandom()
+		k, err := Encrypt(kp, "from env", testScryptParams)
+		assert.NoError(t, err)
+		file := filepath.Join(dir, name)
+		assert.NoError(t, k.Save(file))
+		files = append(files, file)
+		keyPairs = append(keyPairs, kp)
+	}
+
+	// Both keystores are opened with the variable, which is cleared after the first one
+	os.Setenv(PassphraseEnv, "from env")
+	defer ForgetEnvSecrets()
+	for i, file := range files {
+		kp, err := Open(file, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, keyPairs[i].Seed(), kp.Seed())
+		_, set := os.LookupEnv(PassphraseEnv)
+		assert.False(t, set)
+	}
+
+	// Another variable for a keystore with its own passphrase
+	k, err := Encrypt(keyPairs[0], "own passphrase", testScryptParams)
+	assert.NoError(t, err)
+	own := filepath.Join(dir, "own.json")
+	assert.NoError(t, k.Save(own))
+	os.Setenv("PP_TEST_OWN_PASSPHRASE", "own passphrase")
+	kp, err := OpenWithEnv(own, 0, "PP_TEST_OWN_PASSPHRASE")
+	assert.NoError(t, err)
+	assert.Equal(t, keyPairs[0].Seed(), kp.Seed())
+
+	ForgetEnvSecrets()
+	_, ok := lookupEnvSecret(PassphraseEnv)
+	assert.False(t, ok)
+}
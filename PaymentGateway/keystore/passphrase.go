@@ -0,0 +1,127 @@
+package keystore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// PassphraseEnv is the environment variable with the keystore passphrase
+const PassphraseEnv = "PP_KEYSTORE_PASSPHRASE"
+
+// The file descriptors stay open, the successive secrets are read line by line
+var (
+	secretFilesMutex sync.Mutex
+	secretFiles      = map[int]*os.File{}
+)
+
+// The secrets of the environment are kept after the variables are cleared, until ForgetEnvSecrets,
+// so the keystores sharing a variable are all opened
+var (
+	envSecretsMutex sync.Mutex
+	envSecrets      = map[string]string{}
+)
+
+func lookupEnvSecret(env string) (string, bool) {
+	if env == "" {
+		return "", false
+	}
+	envSecretsMutex.Lock()
+	defer envSecretsMutex.Unlock()
+	if secret, ok := envSecrets[env]; ok {
+		return secret, true
+	}
+	secret, ok := os.LookupEnv(env)
+	if !ok {
+		return "", false
+	}
+	os.Unsetenv(env)
+	envSecrets[env] = secret
+	return secret, true
+}
+
+// ForgetEnvSecrets drops the secrets read from the environment, once the keystores of the configuration are opened
+func ForgetEnvSecrets() {
+	envSecretsMutex.Lock()
+	defer envSecretsMutex.Unlock()
+	envSecrets = map[string]string{}
+}
+
+// ReadSecret reads a passphrase or a seed from the file descriptor fd if it is positive, then from
+// the environment variable env which is cleared so child processes don't inherit it, otherwise from
+// stdin with the prompt if stdin is a terminal
+func ReadSecret(fd int, env string, prompt string) (string, error) {
+	if fd > 0 {
+		secretFilesMutex.Lock()
+		defer secretFilesMutex.Unlock()
+		f, ok := secretFiles[fd]
+		if !ok {
+			f = os.NewFile(uintptr(fd), "secret")
+			if f == nil {
+				return "", fmt.Errorf("invalid file descriptor %d", fd)
+			}
+			secretFiles[fd] = f
+		}
+		return readLine(f)
+	}
+	if secret, ok := lookupEnvSecret(env); ok {
+		return secret, nil
+	}
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		return readLine(os.Stdin)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("error reading from terminal: %v", err)
+	}
+	return string(secret), nil
+}
+
+// ReadNewPassphrase is ReadSecret asking twice for the passphrase on the terminal
+func ReadNewPassphrase(fd int, env string) (string, error) {
+	_, fromEnv := lookupEnvSecret(env)
+	if fd > 0 || fromEnv || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return ReadSecret(fd, env, "")
+	}
+	passphrase, err := ReadSecret(fd, env, "New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	confirmation, err := ReadSecret(fd, env, "Repeat the passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase != confirmation {
+		return "", fmt.Errorf("the passphrases don't match")
+	}
+	return passphrase, nil
+}
+
+// readLine reads byte by byte so the next secret on the same stream isn't consumed
+func readLine(r io.Reader) (string, error) {
+	var line strings.Builder
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line.WriteByte(b[0])
+		}
+		if err == io.EOF && line.Len() > 0 {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading secret: %v", err)
+		}
+	}
+	return strings.TrimRight(line.String(), "\r"), nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CommandTimeoutError is returned when a hop doesn't reply to a command before its deadline
+type CommandTimeoutError struct {
+	NodeId      string
+	CommandId   string
+	CommandType CommandType
+	Timeout     time.Duration
+}
+
+func (e *CommandTimeoutError) Error() string {
+	return fmt.Sprintf("command %s (%s) timed out after %v waiting for node %s", e.CommandType, e.CommandId, e.Timeout, e.NodeId)
+}
+
+// HopError attributes the failure of a payment step to the route node which processes it
+type HopError struct {
+	Address string
+	Err     error
+}
+
+func (e *HopError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HopError) Unwrap() error {
+	return e.Err
+}
+
+// FailedHopAddress returns the address of the hop which caused the error, if it's known
+func FailedHopAddress(err error) (string, bool) {
+	var hopErr *HopError
+	if errors.As(err, &hopErr) {
+		return hopErr.Address, true
+	}
+	return "", false
+}
+
+// IsCommandTimeout checks whether a hop command timed out anywhere in the error chain
+func IsCommandTimeout(err error) bool {
+	var timeoutErr *CommandTimeoutError
+	return errors.As(err, &timeoutErr)
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+
 	"github.com/go-errors/errors"
 	"github.com/stellar/go/txnbuild"
 )
@@ -78,6 +80,35 @@ type PaymentTransaction struct {
 	ServiceSessionId          string
 }
 
+type jsonPaymentTransaction struct {
+	TransactionSourceAddress  string
+	ReferenceAmountIn         TransactionAmount
+	AmountOut                 TransactionAmount
+	XDR                       string
+	PaymentSourceAddress      string
+	PaymentDestinationAddress string
+	StellarNetworkToken       string
+	ServiceSessionId          string
+}
+
+// UnmarshalJSON restores the XDR interface field, which encoding/json can't decode on its own
+func (pt *PaymentTransaction) UnmarshalJSON(data []byte) error {
+	in := &jsonPaymentTransaction{}
+	err := json.Unmarshal(data, in)
+	if err != nil {
+		return err
+	}
+	pt.TransactionSourceAddress = in.TransactionSourceAddress
+	pt.ReferenceAmountIn = in.ReferenceAmountIn
+	pt.AmountOut = in.AmountOut
+	pt.XDR = NewXDR(in.XDR)
+	pt.PaymentSourceAddress = in.PaymentSourceAddress
+	pt.PaymentDestinationAddress = in.PaymentDestinationAddress
+	pt.StellarNetworkToken = in.StellarNetworkToken
+	pt.ServiceSessionId = in.ServiceSessionId
+	return nil
+}
+
 func (pt *PaymentTransaction) Validate() error {
 	if pt.PaymentSourceAddress == pt.PaymentDestinationAddress {
 		return errors.Errorf("error invalid transaction chain, address targets itself %s.", pt.PaymentSourceAddress)
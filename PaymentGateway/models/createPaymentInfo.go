@@ -4,4 +4,6 @@ type CreatePaymentInfo struct {
 	ServiceType   string
 	CommodityType string
 	Amount        uint32
+	// ClientId identifies the buyer for volume tier pricing, requests without it are priced at the base tier
+	ClientId string `json:",omitempty"`
 }
@@ -5,6 +5,7 @@ type CreateTransactionCommand struct {
 	TotalOut         uint32 `json:"totalOut"`
 	SourceAddress    string `json:"sourceAddress"`
 	ServiceSessionId string `json:"serviceSessionId"`
+	Asset            string `json:"asset,omitempty"`
 }
 
 func (cmd *CreateTransactionCommand) Type() CommandType {
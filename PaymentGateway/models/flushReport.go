@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Triggers of a flush which isn't started by the flush policy
+const (
+	FlushTriggerRequest  = "request"
+	FlushTriggerShutdown = "shutdown"
+	FlushTriggerPeer     = "peer account"
+)
+
+// TransactionResultCodes are the horizon result codes of a failed transaction submission
+type TransactionResultCodes struct {
+	TransactionCode      string
+	InnerTransactionCode string   `json:",omitempty"` // of a fee-bump transaction
+	OperationCodes       []string `json:",omitempty"`
+}
+
+// FlushedTransaction is an accumulated transaction in a flush report
+type FlushedTransaction struct {
+	ServiceSessionId     string
+	PaymentSourceAddress string
+	Amount               TransactionAmount
+	Sequence             int64
+	ResultCodes          *TransactionResultCodes `json:",omitempty"`
+	Error                string                  `json:",omitempty"`
+	Kept                 bool                    `json:",omitempty"` // a failed transaction stays accumulated for the next flush
+	FeeBump              int64                   `json:",omitempty"` // base fee of the fee-bump transaction paid by the node, in stroops
+}
+
+// SequenceBump moved the node account sequence over a gap of the accumulated transactions
+type SequenceBump struct {
+	From int64
+	To   int64
+}
+
+// FlushReport is the outcome of a flush of the accumulated transactions
+type FlushReport struct {
+	Id          int `json:",omitempty"`
+	NodeAddress string
+	Trigger     string
+	Started     time.Time
+	Finished    time.Time
+	Submitted   []FlushedTransaction
+	Expired     []FlushedTransaction // their upper timebound passed
+	Skipped     []FlushedTransaction // the account sequence already passed them
+	Bumped      []SequenceBump
+	Failed      []FlushedTransaction
+	Remaining   []FlushedTransaction // not submitted after a kept failure, they are flushed again later
+	Error       string               `json:",omitempty"`
+}
+
+func NewFlushedTransaction(t *PaymentTransactionWithSequence) FlushedTransaction {
+	return FlushedTransaction{
+		ServiceSessionId:     t.ServiceSessionId,
+		PaymentSourceAddress: t.PaymentSourceAddress,
+		Amount:               t.AmountOut,
+		Sequence:             t.Sequence,
+	}
+}
+
+// Empty is true if the flush found nothing to do
+func (r *FlushReport) Empty() bool {
+	return len(r.Submitted)+len(r.Expired)+len(r.Skipped)+len(r.Failed)+len(r.Remaining) == 0 && r.Error == ""
+}
@@ -1,5 +1,22 @@
 package models
 
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stellar/go/keypair"
+)
+
+// PaymentRequestClockSkew is the tolerated difference of the clocks of the service and the payer
+const PaymentRequestClockSkew = 5 * time.Minute
+
+var (
+	ErrPaymentRequestExpired   = errors.New("payment request expired")
+	ErrPaymentRequestSignature = errors.New("invalid payment request signature")
+)
+
 type TransactionAmount = uint32
 type PeerID string
 
@@ -11,6 +28,7 @@ type PaymentRequstBase struct {
 	Amount     TransactionAmount
 	Asset      string
 	ServiceRef string
+	Quote      *PriceQuote
 }
 type PaymentRequest struct {
 	Amount           TransactionAmount
@@ -18,6 +36,71 @@ type PaymentRequest struct {
 	ServiceRef       string
 	ServiceSessionId string
 	Address          string
+	Quote            *PriceQuote `json:",omitempty"`
+	// IssuedAt and ExpiresAt are unix times in seconds
+	IssuedAt  int64
+	ExpiresAt int64
+	Nonce     string
+	// Signature of the service node (Address) over SigningPayload, base64 encoded
+	Signature string
+}
+
+const paymentRequestDomain = "pp-payment-request-v1"
+
+// SigningPayload is the content of the request covered by the signature, every field except the signature
+// itself. The quote is preceded by a presence flag.
+func (pr *PaymentRequest) SigningPayload() []byte {
+	p := newSigningPayload(paymentRequestDomain).
+		int64(int64(pr.Amount)).
+		string(pr.Asset).
+		string(pr.ServiceRef).
+		string(pr.ServiceSessionId).
+		string(pr.Address)
+	if pr.Quote == nil {
+		p.int64(0)
+	} else {
+		p.int64(1).uint64(pr.Quote.Multiplier).uint64(pr.Quote.UsedUnits)
+	}
+	return p.int64(pr.IssuedAt).
+		int64(pr.ExpiresAt).
+		string(pr.Nonce).
+		bytes()
+}
+
+// Verify checks that the request is signed by the service node at Address and is valid at the given time
+func (pr *PaymentRequest) Verify(now time.Time) error {
+	err := pr.VerifySignature()
+	if err != nil {
+		return err
+	}
+	if time.Unix(pr.IssuedAt, 0).After(now.Add(PaymentRequestClockSkew)) {
+		return fmt.Errorf("%w: payment request %s is issued in the future", ErrPaymentRequestSignature, pr.ServiceSessionId)
+	}
+	expiresAt := time.Unix(pr.ExpiresAt, 0)
+	if !now.Before(expiresAt) {
+		return fmt.Errorf("%w: payment request %s expired at %s", ErrPaymentRequestExpired, pr.ServiceSessionId, expiresAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// VerifySignature checks only that the request is signed by the service node at Address
+func (pr *PaymentRequest) VerifySignature() error {
+	if pr.Signature == "" {
+		return fmt.Errorf("%w: payment request %s isn't signed", ErrPaymentRequestSignature, pr.ServiceSessionId)
+	}
+	kp, err := keypair.ParseAddress(pr.Address)
+	if err != nil {
+		return fmt.Errorf("%w: invalid service address %s", ErrPaymentRequestSignature, pr.Address)
+	}
+	signature, err := base64.StdEncoding.DecodeString(pr.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPaymentRequestSignature, err)
+	}
+	err = kp.Verify(pr.SigningPayload(), signature)
+	if err != nil {
+		return fmt.Errorf("%w: payment request %s was altered or not signed by %s", ErrPaymentRequestSignature, pr.ServiceSessionId, pr.Address)
+	}
+	return nil
 }
 
 /*
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPaymentRequest(t *testing.T) {
+	assert := assert.New(t)
+	kp := keypair.MustRandom()
+	now := time.Now()
+	sign := func(pr PaymentRequest) *PaymentRequest {
+		signature, err := kp.Sign(pr.SigningPayload())
+		assert.NoError(err)
+		pr.Signature = base64.StdEncoding.EncodeToString(signature)
+		return &pr
+	}
+	pr := PaymentRequest{
+		Amount:           100,
+		Asset:            PPTokenAssetName,
+		ServiceRef:       "ipfs",
+		ServiceSessionId: "session",
+		Address:          kp.Address(),
+		Quote:            &PriceQuote{Multiplier: 1500000},
+		IssuedAt:         now.Unix(),
+		ExpiresAt:        now.Add(time.Minute).Unix(),
+		Nonce:            "nonce",
+	}
+	signed := sign(pr)
+	assert.NoError(signed.Verify(now))
+	assert.True(bytes.HasPrefix(signed.SigningPayload(), append([]byte{0, 0, 0, 21}, "pp-payment-request-v1"...)))
+
+	assert.True(errors.Is(signed.Verify(now.Add(time.Minute)), ErrPaymentRequestExpired))
+	assert.True(errors.Is(pr.Verify(now), ErrPaymentRequestSignature))
+
+	future := pr
+	future.IssuedAt = now.Add(time.Hour).Unix()
+	future.ExpiresAt = now.Add(2 * time.Hour).Unix()
+	assert.True(errors.Is(sign(future).Verify(now), ErrPaymentRequestSignature))
+
+	for _, tamper := range []func(pr *PaymentRequest){
+		func(pr *PaymentRequest) { pr.Amount = 1 },
+		func(pr *PaymentRequest) { pr.Quote.Multiplier = 1000000 },
+		func(pr *PaymentRequest) { pr.ExpiresAt++ },
+		func(pr *PaymentRequest) { pr.Nonce = "replay" },
+		func(pr *PaymentRequest) { pr.Address = keypair.MustRandom().Address() },
+		func(pr *PaymentRequest) { pr.Quote = nil },
+		// The fields are length prefixed, moving a character between two fields changes the payload
+		func(pr *PaymentRequest) { pr.Asset, pr.ServiceRef = pr.Asset+"i", "pfs" },
+	} {
+		tampered := *signed
+		quote := *signed.Quote
+		tampered.Quote = &quote
+		tamper(&tampered)
+		assert.True(errors.Is(tampered.Verify(now), ErrPaymentRequestSignature))
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+type PaymentState string
+
+const (
+	PaymentStateInitiated   PaymentState = "initiated"
+	PaymentStateHopsCreated PaymentState = "hops_created"
+	PaymentStateSigned      PaymentState = "signed"
+	PaymentStateVerified    PaymentState = "verified"
+	PaymentStateCommitted   PaymentState = "committed"
+	PaymentStateFailed      PaymentState = "failed"
+)
+
+func (s PaymentState) IsFinal() bool {
+	return s == PaymentStateCommitted || s == PaymentStateFailed
+}
+
+// PaymentSession is the persisted state of a payment processed by the source node
+type PaymentSession struct {
+	ServiceSessionId   string
+	State              PaymentState
+	Request            *ProcessPaymentRequest
+	Route              []RoutingNode // resolved route, the request route may be empty
+	CommandCallbackUrl string
+	StatusCallbackUrls []string
+	Transactions       []*PaymentTransactionReplacing
+	Error              string
+	FailedHops         []FailedHop // hops which failed the session, excluded from its alternative routes
+}
+
+// FailedHop records a route node which failed or timed out before the commit
+type FailedHop struct {
+	NodeId  string
+	Address string
+	Error   string
+	Timeout bool
+}
+
+// FailedNodeIds returns the ids of the hops which failed the session
+func (s *PaymentSession) FailedNodeIds() []string {
+	ids := []string{}
+	for _, hop := range s.FailedHops {
+		ids = append(ids, hop.NodeId)
+	}
+	return ids
+}
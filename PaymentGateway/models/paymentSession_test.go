@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPaymentSessionRoundTrip(t *testing.T) {
+	session := &PaymentSession{
+		ServiceSessionId: "session",
+		State:            PaymentStateSigned,
+		Transactions: []*PaymentTransactionReplacing{{
+			PendingTransaction: PaymentTransaction{
+				XDR:              NewXDR("AAAA"),
+				AmountOut:        10,
+				ServiceSessionId: "session",
+			},
+			ReferenceTransaction: &PaymentTransaction{
+				XDR: NewXDR("BBBB"),
+			},
+		}},
+	}
+	bs, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &PaymentSession{}
+	err = json.Unmarshal(bs, restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := restored.Transactions[0]
+	if tr.PendingTransaction.XDR.String() != "AAAA" || tr.ReferenceTransaction.XDR.String() != "BBBB" {
+		t.Errorf("XDR not restored")
+	}
+	if tr.PendingTransaction.AmountOut != 10 || restored.State != PaymentStateSigned {
+		t.Errorf("session not restored")
+	}
+}
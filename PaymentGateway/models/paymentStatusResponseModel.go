@@ -2,5 +2,7 @@ package models
 
 type PaymentStatusResponseModel struct { //TODO REMOVE
 	SessionId string
-	Status    int //TODO to bool
+	Status    int    //TODO to bool
+	Error     string `json:",omitempty"`
+	Timeout   bool   `json:",omitempty"` // a hop didn't reply to a command in time
 }
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/strkey"
+)
+
+// SEP-7 (https://github.com/stellar/stellar-protocol/blob/master/ecosystem/sep-0007.md) payment URIs
+const (
+	PaymentUriScheme    = "web+stellar"
+	paymentUriOperation = "pay"
+	memoTypeText        = "MEMO_TEXT"
+	maxTextMemoLength   = 28
+	stroopsPerUnit      = 1e4 // a transaction unit is 1e-3 pptoken
+)
+
+// PaymentRequestWithUri is the payment request with its SEP-7 URI and the QR code of the URI
+type PaymentRequestWithUri struct {
+	PaymentRequest
+	PaymentUri string
+	QrCode     []byte // png
+}
+
+// PaymentURI returns the web+stellar:pay URI of the request, the session id is the text memo and the
+// service reference the message. The network passphrase is omitted for the public network.
+func (pr *PaymentRequest) PaymentURI(networkPassphrase string) (string, error) {
+	if pr.Asset != PPTokenAssetName {
+		return "", fmt.Errorf("unsupported asset %s", pr.Asset)
+	}
+	if len(pr.ServiceSessionId) > maxTextMemoLength {
+		return "", fmt.Errorf("session id %s doesn't fit a text memo", pr.ServiceSessionId)
+	}
+	values := url.Values{}
+	values.Set("destination", pr.Address)
+	values.Set("amount", amount.StringFromInt64(int64(pr.Amount)*stroopsPerUnit))
+	values.Set("asset_code", PPTokenAssetName)
+	values.Set("asset_issuer", PPTokenIssuerAddress)
+	values.Set("memo", pr.ServiceSessionId)
+	values.Set("memo_type", memoTypeText)
+	if pr.ServiceRef != "" {
+		values.Set("msg", pr.ServiceRef)
+	}
+	if networkPassphrase != "" && networkPassphrase != network.PublicNetworkPassphrase {
+		values.Set("network_passphrase", networkPassphrase)
+	}
+	// SEP-7 values are percent encoded, url.Values encodes spaces as +
+	query := strings.Replace(values.Encode(), "+", "%20", -1)
+	return PaymentUriScheme + ":" + paymentUriOperation + "?" + query, nil
+}
+
+// ParsePaymentURI converts a web+stellar:pay URI of a pptoken payment to a payment request,
+// the request isn't signed by the service node
+func ParsePaymentURI(uri string) (*PaymentRequest, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment uri: %v", err)
+	}
+	if u.Scheme != PaymentUriScheme || u.Opaque != paymentUriOperation {
+		return nil, fmt.Errorf("not a %s:%s uri", PaymentUriScheme, paymentUriOperation)
+	}
+	values, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment uri: %v", err)
+	}
+
+	destination := values.Get("destination")
+	if !strkey.IsValidEd25519PublicKey(destination) {
+		return nil, fmt.Errorf("invalid destination %s", destination)
+	}
+	if values.Get("asset_code") != PPTokenAssetName || values.Get("asset_issuer") != PPTokenIssuerAddress {
+		return nil, fmt.Errorf("unsupported asset %s:%s", values.Get("asset_code"), values.Get("asset_issuer"))
+	}
+	if values.Get("amount") == "" {
+		return nil, fmt.Errorf("payment amount is missing")
+	}
+	stroops, err := amount.ParseInt64(values.Get("amount"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %s: %v", values.Get("amount"), err)
+	}
+	if stroops <= 0 || stroops%stroopsPerUnit != 0 || stroops/stroopsPerUnit > int64(^TransactionAmount(0)) {
+		return nil, fmt.Errorf("amount %s isn't a valid transaction amount", values.Get("amount"))
+	}
+	memoType := values.Get("memo_type")
+	if memoType != "" && memoType != memoTypeText {
+		return nil, fmt.Errorf("unsupported memo type %s", memoType)
+	}
+	if values.Get("memo") == "" {
+		return nil, fmt.Errorf("session memo is missing")
+	}
+
+	return &PaymentRequest{
+		Amount:           TransactionAmount(stroops / stroopsPerUnit),
+		Asset:            PPTokenAssetName,
+		ServiceRef:       values.Get("msg"),
+		ServiceSessionId: values.Get("memo"),
+		Address:          destination,
+	}, nil
+}
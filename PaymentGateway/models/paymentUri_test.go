@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentURI(t *testing.T) {
+	assert := assert.New(t)
+	pr := &PaymentRequest{
+		Amount:           1500,
+		Asset:            PPTokenAssetName,
+		ServiceRef:       "tor data",
+		ServiceSessionId: "c0ffee0123456789abcd",
+		Address:          keypair.MustRandom().Address(),
+		Signature:        "signature",
+	}
+	uri, err := pr.PaymentURI(network.PublicNetworkPassphrase)
+	assert.NoError(err)
+	assert.Equal("web+stellar:pay?amount=1.5000000&asset_code=pptoken&asset_issuer="+PPTokenIssuerAddress+
+		"&destination="+pr.Address+"&memo=c0ffee0123456789abcd&memo_type=MEMO_TEXT&msg=tor%20data", uri)
+
+	parsed, err := ParsePaymentURI(uri)
+	assert.NoError(err)
+	assert.Equal(&PaymentRequest{
+		Amount:           pr.Amount,
+		Asset:            pr.Asset,
+		ServiceRef:       pr.ServiceRef,
+		ServiceSessionId: pr.ServiceSessionId,
+		Address:          pr.Address,
+	}, parsed)
+
+	uri, err = pr.PaymentURI(network.TestNetworkPassphrase)
+	assert.NoError(err)
+	assert.Contains(uri, "network_passphrase=Test%20SDF%20Network%20%3B%20September%202015")
+	_, err = ParsePaymentURI(uri)
+	assert.NoError(err)
+
+	pr.Asset = "XLM"
+	_, err = pr.PaymentURI("")
+	assert.Error(err)
+
+	valid := "web+stellar:pay?destination=" + pr.Address + "&asset_code=pptoken&asset_issuer=" + PPTokenIssuerAddress + "&memo=session"
+	for _, uri := range []string{
+		"web+stellar:tx?xdr=AAAA",
+		"https://example.com/pay?destination=" + pr.Address,
+		valid,
+		valid + "&amount=0.00001",
+		valid + "&amount=-1",
+		valid + "&amount=1&memo_type=MEMO_ID",
+		"web+stellar:pay?destination=GABC&amount=1&asset_code=pptoken&asset_issuer=" + PPTokenIssuerAddress + "&memo=session",
+		"web+stellar:pay?destination=" + pr.Address + "&amount=1&memo=session",
+		"web+stellar:pay?destination=" + pr.Address + "&amount=1&asset_code=pptoken&asset_issuer=" + PPTokenIssuerAddress,
+	} {
+		_, err = ParsePaymentURI(uri)
+		assert.Error(err, uri)
+	}
+	_, err = ParsePaymentURI(valid + "&amount=0.001")
+	assert.NoError(err)
+}
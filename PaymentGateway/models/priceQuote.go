@@ -0,0 +1,13 @@
+package models
+
+// PriceQuoteMultiplierOne is the multiplier of base prices, multipliers are in parts per million
+const PriceQuoteMultiplierOne = 1000000
+
+// PriceQuote is the pricing state a payment request was calculated with, validating the payment
+// with the same quote maps the amount back to the requested quantity
+type PriceQuote struct {
+	// Multiplier of the time of day and surge pricing in parts per million
+	Multiplier uint64
+	// UsedUnits the client had bought in the volume tier period before the request
+	UsedUnits uint64
+}
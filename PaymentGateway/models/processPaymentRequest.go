@@ -10,4 +10,6 @@ type ProcessPaymentRequest struct {
 	PaymentRequest *PaymentRequest // json body
 
 	NodeId PeerID // request reference identification
+
+	MaxFee TransactionAmount // total fee of the hops the payer accepts, the configured maximum if zero
 }
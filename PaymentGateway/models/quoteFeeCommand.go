@@ -0,0 +1,20 @@
+package models
+
+// QuoteFeeCommand asks a hop for the fee of forwarding the amount of the payment session
+type QuoteFeeCommand struct {
+	ServiceSessionId string `json:"serviceSessionId"`
+	Amount           uint32 `json:"amount"`
+	Asset            string `json:"asset"`
+}
+
+func (cmd *QuoteFeeCommand) Type() CommandType {
+	return CommandType_QuoteFee
+}
+
+type QuoteFeeResponse struct {
+	Fee uint32 `json:"fee"`
+}
+
+func (cmd *QuoteFeeResponse) OutType() CommandType {
+	return CommandType_QuoteFee
+}
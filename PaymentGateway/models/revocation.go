@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/stellar/go/keypair"
+)
+
+const revocationDomain = "pp-revocation-v1"
+
+// Revocation is signed by a node which revoked its transaction of a failed payment session. The service node
+// signs it only while the session isn't paid, each hop revokes only with the revocation of the node it paid.
+type Revocation struct {
+	ServiceSessionId string
+	Address          string
+	Signature        string // base64 signature of the node at Address over SigningPayload
+}
+
+func (r *Revocation) SigningPayload() []byte {
+	return newSigningPayload(revocationDomain).string(r.ServiceSessionId).string(r.Address).bytes()
+}
+
+// Verify checks that the session was revoked by the node at address
+func (r *Revocation) Verify(address string, serviceSessionId string) error {
+	if r.Address != address {
+		return fmt.Errorf("revocation is issued by %s instead of %s", r.Address, address)
+	}
+	if r.ServiceSessionId != serviceSessionId {
+		return fmt.Errorf("revocation of session %s doesn't match session %s", r.ServiceSessionId, serviceSessionId)
+	}
+	kp, err := keypair.ParseAddress(r.Address)
+	if err != nil {
+		return fmt.Errorf("invalid revocation address %s", r.Address)
+	}
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || kp.Verify(r.SigningPayload(), signature) != nil {
+		return fmt.Errorf("revocation of session %s isn't signed by %s", r.ServiceSessionId, r.Address)
+	}
+	return nil
+}
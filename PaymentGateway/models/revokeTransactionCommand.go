@@ -0,0 +1,23 @@
+package models
+
+// RevokeTransactionCommand discards the committed pending transaction of a failed payment,
+// the reference transaction it replaced becomes the active one again
+type RevokeTransactionCommand struct {
+	Transaction    *PaymentTransactionReplacing `json:"transaction"`
+	PaymentRequest *PaymentRequest              `json:"paymentRequest"` // set for the service node
+	Revocation     *Revocation                  `json:"revocation"`     // set for a hop, by the node the hop paid
+	Context        *TraceContext                `json:"context"`
+}
+
+func (cmd *RevokeTransactionCommand) Type() CommandType {
+	return CommandType_RevokeTransaction
+}
+
+// RevokeTransactionResponse carries the revocation of the node, for the node which paid it
+type RevokeTransactionResponse struct {
+	Revocation *Revocation `json:"revocation"`
+}
+
+func (cmd *RevokeTransactionResponse) OutType() CommandType {
+	return CommandType_RevokeTransaction
+}
@@ -3,6 +3,8 @@ package models
 type RouteResponse struct {
 	Route []RoutingNode
 
+	AlternativeRoutes [][]RoutingNode `json:",omitempty"` // Candidates used when a hop of the route fails
+
 	CallbackUrl string // Payment command url
 
 	StatusCallbackUrl string // Status callback command url
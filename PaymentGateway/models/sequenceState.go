@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// SequenceState is the allocation state of the node account sequence numbers
+type SequenceState struct {
+	NodeAddress     string
+	AccountSequence int64     // on the ledger when it was last read
+	HighWaterMark   int64     // the last allocated sequence
+	Unsubmitted     []int64   // allocated to signed transactions which weren't submitted yet
+	Reconciled      time.Time `json:",omitempty"` // with horizon
+}
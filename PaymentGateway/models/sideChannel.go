@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/stellar/go/keypair"
+)
+
+// SetUpPeerRequestValidity is how far the time of a peer setup request can be from the clock of the node
+const SetUpPeerRequestValidity = 5 * time.Minute
+
+const setUpPeerDomain = "pp-setup-peer-v1"
+
+type PeerSetupStatus int32
+
+const (
+	PeerAlreadyExists PeerSetupStatus = iota
+	PeerAccountCreationRequired
+	PeerAccountFundingRequired
+)
+
+// SetUpPeerRequest is signed by the key of the peer account, the node funds only accounts whose key it was shown
+type SetUpPeerRequest struct {
+	Address   string
+	Timestamp int64 // unix time in seconds
+	Signature string
+}
+
+func (r *SetUpPeerRequest) SigningPayload() []byte {
+	return newSigningPayload(setUpPeerDomain).string(r.Address).int64(r.Timestamp).bytes()
+}
+
+// Sign signs the request with the key of the peer account at the given time
+func (r *SetUpPeerRequest) Sign(kp *keypair.Full, now time.Time) error {
+	r.Address = kp.Address()
+	r.Timestamp = now.Unix()
+	signature, err := kp.Sign(r.SigningPayload())
+	if err != nil {
+		return err
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// Verify checks the signature of the peer and the time of the request
+func (r *SetUpPeerRequest) Verify(now time.Time) error {
+	kp, err := keypair.ParseAddress(r.Address)
+	if err != nil {
+		return fmt.Errorf("invalid peer address %s", r.Address)
+	}
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || kp.Verify(r.SigningPayload(), signature) != nil {
+		return fmt.Errorf("peer setup request isn't signed by %s", r.Address)
+	}
+	at := time.Unix(r.Timestamp, 0)
+	if at.Before(now.Add(-SetUpPeerRequestValidity)) || at.After(now.Add(SetUpPeerRequestValidity)) {
+		return fmt.Errorf("peer setup request time %s is out of range", at.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+type SetUpPeerResponse struct {
+	Status         PeerSetupStatus
+	TransactionXdr XDR // unsigned transaction of the peer, to be signed by the peer and passed to CreateOrFund
+}
+
+type InitiatePaymentRequest struct {
+	FromAddress        string
+	Amount             float64 // pptoken
+	Asset              string
+	Memo               string
+	ToAddress          string
+	PrevTransactionXdr XDR // alternative destination: the source of the previous transaction in the chain
+}
+
+type InitiatePaymentResponse struct {
+	PresentTransactionXdr       XDR // payment of the node to the destination, signed by the node on commit
+	ReimbursementTransactionXdr XDR // payment of the payer to the node, to be signed by the payer
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/stellar/go/keypair"
+)
+
+const signAuthorizationDomain = "pp-sign-authorization-v1"
+
+// SignAuthorization authenticates a request to a co-signing endpoint, it is signed by the node key for the
+// request body within the replay window of the endpoint
+type SignAuthorization struct {
+	Address     string // of the node key
+	Timestamp   int64  // unix seconds
+	Nonce       string
+	RequestHash string // hex sha256 of the request body
+	Signature   string // base64 signature of the node key over SigningPayload
+}
+
+// AuthorizedSignRequest is the body posted to a co-signing endpoint
+type AuthorizedSignRequest struct {
+	Request       json.RawMessage // the SignRequest
+	Authorization *SignAuthorization
+}
+
+func SignRequestHash(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+func (a *SignAuthorization) SigningPayload() []byte {
+	return newSigningPayload(signAuthorizationDomain).
+		string(a.Address).
+		int64(a.Timestamp).
+		string(a.Nonce).
+		string(a.RequestHash).
+		bytes()
+}
+
+// Verify checks that the request body was authorized by the node at address within window of now
+func (a *SignAuthorization) Verify(address string, body []byte, now time.Time, window time.Duration) error {
+	if a.Address != address {
+		return fmt.Errorf("authorization is issued by %s instead of %s", a.Address, address)
+	}
+	issued := time.Unix(a.Timestamp, 0)
+	if issued.Before(now.Add(-window)) || issued.After(now.Add(window)) {
+		return fmt.Errorf("authorization issued at %v is outside the window of %v", issued, window)
+	}
+	if a.Nonce == "" {
+		return fmt.Errorf("authorization nonce missing")
+	}
+	if a.RequestHash != SignRequestHash(body) {
+		return fmt.Errorf("authorization isn't for the request")
+	}
+	kp, err := keypair.ParseAddress(a.Address)
+	if err != nil {
+		return fmt.Errorf("invalid authorization address %s", a.Address)
+	}
+	signature, err := base64.StdEncoding.DecodeString(a.Signature)
+	if err != nil || kp.Verify(a.SigningPayload(), signature) != nil {
+		return fmt.Errorf("authorization isn't signed by %s", a.Address)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignAuthorization(t *testing.T) {
+	assert := assert.New(t)
+	kp := keypair.MustRandom()
+	now := time.Now()
+	body := []byte(`{"Kind":"address"}`)
+	a := &SignAuthorization{
+		Address:     kp.Address(),
+		Timestamp:   now.Unix(),
+		Nonce:       "nonce",
+		RequestHash: SignRequestHash(body),
+	}
+	signature, err := kp.Sign(a.SigningPayload())
+	assert.NoError(err)
+	a.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	assert.NoError(a.Verify(kp.Address(), body, now, time.Minute))
+	assert.Error(a.Verify(keypair.MustRandom().Address(), body, now, time.Minute))
+	assert.Error(a.Verify(kp.Address(), []byte(`{"Kind":"transaction"}`), now, time.Minute))
+	assert.Error(a.Verify(kp.Address(), body, now.Add(2*time.Minute), time.Minute))
+	assert.Error(a.Verify(kp.Address(), body, now.Add(-2*time.Minute), time.Minute))
+
+	tampered := *a
+	tampered.Nonce = "replay"
+	assert.Error(tampered.Verify(kp.Address(), body, now, time.Minute))
+}
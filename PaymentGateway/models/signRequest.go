@@ -0,0 +1,27 @@
+package models
+
+// Kinds of the requests to the signing daemon
+const (
+	SignRequestAddress        = "address"
+	SignRequestTransaction    = "transaction" // a transaction or a fee-bump transaction envelope
+	SignRequestPaymentRequest = "payment_request"
+	SignRequestRevocation     = "revocation"
+	SignRequestAuthorization  = "authorization" // of the requests of the node to its co-signing endpoints
+)
+
+// SignRequest is sent to the signing daemon over its unix socket, one request per connection
+type SignRequest struct {
+	Kind              string
+	NetworkPassphrase string             `json:",omitempty"`
+	Transaction       string             `json:",omitempty"` // base64 envelope
+	PaymentRequest    *PaymentRequest    `json:",omitempty"`
+	Revocation        *Revocation        `json:",omitempty"`
+	Authorization     *SignAuthorization `json:",omitempty"`
+}
+
+// SignResponse carries the base64 signature of the node key, or the reason the request was refused
+type SignResponse struct {
+	Address   string `json:",omitempty"`
+	Signature string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
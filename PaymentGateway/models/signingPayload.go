@@ -0,0 +1,39 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// signingPayload is the explicit encoding of signed content: the domain of the signature, then each
+// field in a fixed order, strings prefixed by their length and integers as 8 bytes, all big endian.
+// The domain separates the signatures made with the Stellar key of the node from its other uses.
+type signingPayload struct {
+	buf bytes.Buffer
+}
+
+func newSigningPayload(domain string) *signingPayload {
+	p := &signingPayload{}
+	p.string(domain)
+	return p
+}
+
+func (p *signingPayload) string(s string) *signingPayload {
+	binary.Write(&p.buf, binary.BigEndian, uint32(len(s)))
+	p.buf.WriteString(s)
+	return p
+}
+
+func (p *signingPayload) int64(i int64) *signingPayload {
+	binary.Write(&p.buf, binary.BigEndian, i)
+	return p
+}
+
+func (p *signingPayload) uint64(i uint64) *signingPayload {
+	binary.Write(&p.buf, binary.BigEndian, i)
+	return p
+}
+
+func (p *signingPayload) bytes() []byte {
+	return p.buf.Bytes()
+}
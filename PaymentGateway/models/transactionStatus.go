@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+type TransactionStatus string
+
+const (
+	TransactionStatusActive    TransactionStatus = "active"
+	TransactionStatusReplaced  TransactionStatus = "replaced"
+	TransactionStatusSubmitted TransactionStatus = "submitted"
+	TransactionStatusFailed    TransactionStatus = "failed"
+	TransactionStatusExpired   TransactionStatus = "expired"
+	TransactionStatusRevoked   TransactionStatus = "revoked" // its payment failed, the replaced transaction is active again
+)
+
+// UnflushedTransactionsResponse describes the accumulated transactions which weren't submitted to the ledger yet
+type UnflushedTransactionsResponse struct {
+	Count         int
+	Amount        float64 // value of the transactions that can still be submitted
+	ExpiredCount  int
+	ExpiredAmount float64 // value of the transactions that can't be submitted anymore
+	NextExpiry    JsonTime
+	Timestamp     JsonTime
+}
+
+// TransactionExpiry returns the upper timebound of the transaction, zero time if it has none
+func TransactionExpiry(transaction *PaymentTransaction) (time.Time, error) {
+	wrapper, err := transaction.XDR.TransactionFromXDR()
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, ok := wrapper.Transaction()
+	if !ok {
+		return time.Time{}, errors.Errorf("Error deserializing transaction from XDR (GenericTransaction)")
+	}
+	maxTime := t.Timebounds().MaxTime
+	if maxTime == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(maxTime, 0), nil
+}
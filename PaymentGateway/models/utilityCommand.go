@@ -22,6 +22,12 @@ func (ct CommandType) String() string {
 
 	case CommandType_CommitServiceTransaction:
 		return "CommitServiceTransaction"
+
+	case CommandType_RevokeTransaction:
+		return "RevokeTransaction"
+
+	case CommandType_QuoteFee:
+		return "QuoteFee"
 	default:
 		return "none"
 	}
@@ -33,6 +39,8 @@ const (
 	CommandType_SignChainTransaction
 	CommandType_CommitChainTransaction
 	CommandType_CommitServiceTransaction
+	CommandType_RevokeTransaction
+	CommandType_QuoteFee
 )
 
 type InCommandType interface {
@@ -44,13 +52,17 @@ func CommandType_Command(c CommandType) (InCommandType, error) {
 	case CommandType_CreateTransaction:
 		return &CreateTransactionCommand{}, nil
 	case CommandType_SignServiceTransaction:
-		return &CreateTransactionCommand{}, nil
+		return &SignServiceTransactionCommand{}, nil
 	case CommandType_SignChainTransaction:
-		return &CreateTransactionCommand{}, nil
+		return &SignChainTransactionCommand{}, nil
 	case CommandType_CommitChainTransaction:
-		return &CreateTransactionCommand{}, nil
+		return &CommitChainTransactionCommand{}, nil
 	case CommandType_CommitServiceTransaction:
-		return &CreateTransactionCommand{}, nil
+		return &CommitServiceTransactionCommand{}, nil
+	case CommandType_RevokeTransaction:
+		return &RevokeTransactionCommand{}, nil
+	case CommandType_QuoteFee:
+		return &QuoteFeeCommand{}, nil
 	default:
 		return nil, fmt.Errorf("command type not found")
 	}
@@ -65,13 +77,17 @@ func CommandType_CommandResponse(c CommandType) (OutCommandType, error) {
 	case CommandType_CreateTransaction:
 		return &CreateTransactionResponse{}, nil
 	case CommandType_SignServiceTransaction:
-		return &CreateTransactionResponse{}, nil
+		return &SignServiceTransactionResponse{}, nil
 	case CommandType_SignChainTransaction:
-		return &CreateTransactionResponse{}, nil
+		return &SignChainTransactionResponse{}, nil
 	case CommandType_CommitChainTransaction:
-		return &CreateTransactionResponse{}, nil
+		return &CommitChainTransactionResponse{}, nil
 	case CommandType_CommitServiceTransaction:
-		return &CreateTransactionResponse{}, nil
+		return &CommitServiceTransactionResponse{}, nil
+	case CommandType_RevokeTransaction:
+		return &RevokeTransactionResponse{}, nil
+	case CommandType_QuoteFee:
+		return &QuoteFeeResponse{}, nil
 	default:
 		return nil, fmt.Errorf("command response type not found")
 	}
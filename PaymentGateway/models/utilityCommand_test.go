@@ -42,3 +42,35 @@ func TestUnmarshal(t *testing.T) {
 		t.Errorf("Not equals")
 	}
 }
+
+func TestUnmarshalCommandBodyType(t *testing.T) {
+	commands := []InCommandType{
+		&CreateTransactionCommand{SourceAddress: "SourceAddress"},
+		&SignServiceTransactionCommand{},
+		&SignChainTransactionCommand{},
+		&CommitChainTransactionCommand{},
+		&CommitServiceTransactionCommand{},
+		&RevokeTransactionCommand{},
+		&QuoteFeeCommand{},
+	}
+	for _, body := range commands {
+		ut := &UtilityCommand{
+			CommandCore: CommandCore{
+				CommandType: body.Type(),
+			},
+			CommandBody: body,
+		}
+		bs, err := json.Marshal(ut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unm := &UtilityCommand{}
+		err = json.Unmarshal(bs, unm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%T", unm.CommandBody) != fmt.Sprintf("%T", body) {
+			t.Errorf("command %v decoded as %T", body.Type(), unm.CommandBody)
+		}
+	}
+}
@@ -5,9 +5,20 @@ type CommandResponseCore struct {
 	CommandId string `json:"commandId"`
 	NodeId    string `json:"nodeId"`
 }
+// UtilityResponse is the reply of a command posted back to the callback url,
+// Error is set instead of the response when the command failed
 type UtilityResponse struct {
 	CommandResponseCore
 	CommandResponse []byte `json:"responseBody"`
+	Error           string `json:"error,omitempty"`
+}
+
+// CommandStreamReply is the reply of a command sent over a grpc command stream,
+// Error is set instead of the response when the command failed
+type CommandStreamReply struct {
+	CommandResponseCore
+	CommandResponse []byte `json:"responseBody"`
+	Error           string `json:"error,omitempty"`
 }
 
 /*
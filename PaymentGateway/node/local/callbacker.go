@@ -3,6 +3,7 @@ package local
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 
 	"github.com/stellar/go/support/log"
 	"paidpiper.com/payment-gateway/common"
@@ -25,32 +26,34 @@ func newCallbacker(cmd *models.UtilityCommand) CallBacker {
 	}
 }
 
-func (cb *callBackerImpl) call(reply models.OutCommandType, err error) error {
-	if cb.url == "" || err != nil {
+// call posts the reply of the command, or the error the command failed with
+func (cb *callBackerImpl) call(reply models.OutCommandType, commandErr error) error {
+	if cb.url == "" {
 		return nil
 	}
-	data, err := json.Marshal(reply)
-
-	if err != nil {
-		log.Fatalf("Command response marshal failed: %v", err)
-		return err
-	}
 	cmd := cb.cmd
 	values := &models.UtilityResponse{
-		CommandResponse: data,
 		CommandResponseCore: models.CommandResponseCore{
 			CommandId: cmd.CommandCore.CommandId,
 			NodeId:    cmd.CommandCore.NodeId,
 			SessionId: cmd.CommandCore.SessionId,
 		},
 	}
+	if commandErr != nil {
+		values.Error = commandErr.Error()
+	} else {
+		data, err := json.Marshal(reply)
+		if err != nil {
+			return fmt.Errorf("command response marshal failed: %v", err)
+		}
+		values.CommandResponse = data
+	}
 	jsonValue, _ := json.Marshal(values)
 
-	err = common.HttpPostWithoutResponseContext(cmd.CallbackUrl, bytes.NewBuffer(jsonValue))
+	err := common.HttpPostWithoutResponseContext(cmd.CallbackUrl, bytes.NewBuffer(jsonValue))
 
 	if err != nil {
 		log.Errorf("Callback url execution failed: : %v", err)
-		log.Fatal(err)
 		return err
 	}
 
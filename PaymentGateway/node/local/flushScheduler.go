@@ -0,0 +1,177 @@
+package local
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/stellar/go/support/log"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// Reasons of the automatic flushes
+const (
+	flushTriggerPeriod       = "period"
+	flushTriggerSourceAmount = "source_amount"
+	flushTriggerPendingCount = "pending_count"
+	flushTriggerExpiry       = "expiry"
+)
+
+// The stale records of the node are pruned every pruneInterval
+const pruneInterval = time.Hour
+
+// flushMetrics are published on /debug/vars, the keys are prefixed with the node address
+var flushMetrics = expvar.NewMap("flush")
+
+// pendingTransaction is the part of an accumulated transaction the flush policy depends on
+type pendingTransaction struct {
+	source string
+	amount models.TransactionAmount
+	expiry time.Time
+}
+
+// flushTrigger returns the reason to flush the pending transactions under the policy, empty if there is none
+func flushTrigger(policy config.FlushPolicy, transactions []pendingTransaction, now time.Time) string {
+	if policy.PendingCount > 0 && len(transactions) >= policy.PendingCount {
+		return flushTriggerPendingCount
+	}
+	amounts := map[string]uint64{}
+	for _, t := range transactions {
+		if policy.ExpiryMargin > 0 && !t.expiry.IsZero() && t.expiry.Sub(now) <= policy.ExpiryMargin {
+			return flushTriggerExpiry
+		}
+		amounts[t.source] += uint64(t.amount)
+		if policy.SourceAmount > 0 && amounts[t.source] >= uint64(policy.SourceAmount) {
+			return flushTriggerSourceAmount
+		}
+	}
+	return ""
+}
+
+// flushScheduler flushes the accumulated transactions of the node periodically and whenever the flush policy triggers,
+// it also prunes the stale records of the node
+type flushScheduler struct {
+	policy       config.FlushPolicy
+	address      string
+	flush        func(ctx context.Context, trigger string) (*models.FlushReport, error)
+	transactions func() []pendingTransaction
+	prune        func()
+	periods      chan time.Duration
+	checks       chan struct{}
+	done         chan struct{}
+}
+
+func newFlushScheduler(address string, policy config.FlushPolicy, period time.Duration,
+	flush func(ctx context.Context, trigger string) (*models.FlushReport, error), transactions func() []pendingTransaction,
+	prune func()) *flushScheduler {
+	s := &flushScheduler{
+		policy:       policy,
+		address:      address,
+		flush:        flush,
+		transactions: transactions,
+		prune:        prune,
+		periods:      make(chan time.Duration),
+		checks:       make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	policyVar := &expvar.String{}
+	policyVar.Set(policy.String())
+	flushMetrics.Set(address+".policy", policyVar)
+	log.Infof("Node %s flush policy: period %v, %s", address, period, policy)
+	go s.run(period)
+	return s
+}
+
+func (s *flushScheduler) run(period time.Duration) {
+	periodic := newOptionalTicker(period)
+	checks := newOptionalTicker(s.policy.CheckInterval)
+	prunes := time.NewTicker(pruneInterval)
+	defer periodic.Stop()
+	defer checks.Stop()
+	defer prunes.Stop()
+	for {
+		select {
+		case period := <-s.periods:
+			periodic.Stop()
+			periodic = newOptionalTicker(period)
+			log.Infof("Node %s flush period changed to %v", s.address, period)
+		case <-periodic.C:
+			s.flushFor(flushTriggerPeriod)
+		case <-checks.C:
+			s.check()
+		case <-s.checks:
+			s.check()
+		case <-prunes.C:
+			s.prune()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *flushScheduler) check() {
+	reason := flushTrigger(s.policy, s.transactions(), time.Now())
+	if reason != "" {
+		s.flushFor(reason)
+	}
+}
+
+func (s *flushScheduler) flushFor(reason string) {
+	log.Infof("Node %s auto flush triggered by %s", s.address, reason)
+	flushMetrics.Add(s.address+".triggers."+reason, 1)
+	report, err := s.flush(context.Background(), reason)
+	if err != nil {
+		flushMetrics.Add(s.address+".errors", 1)
+		log.Errorf("Error during autoflush of node %s: %s", s.address, err.Error())
+		return
+	}
+	if len(report.Failed) > 0 {
+		flushMetrics.Add(s.address+".failed", int64(len(report.Failed)))
+		log.Errorf("Autoflush of node %s: %d transactions failed, %d remaining", s.address, len(report.Failed), len(report.Remaining))
+	}
+}
+
+// setPeriod replaces the flush period, zero disables the periodic flush
+func (s *flushScheduler) setPeriod(period time.Duration) {
+	select {
+	case s.periods <- period:
+	case <-s.done:
+	}
+}
+
+// notify requests a check of the policy, e.g. after a payment is committed
+func (s *flushScheduler) notify() {
+	select {
+	case s.checks <- struct{}{}:
+	default:
+	}
+}
+
+func (s *flushScheduler) stop() {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+}
+
+// optionalTicker never ticks if its period isn't positive
+type optionalTicker struct {
+	C      <-chan time.Time
+	ticker *time.Ticker
+}
+
+func newOptionalTicker(period time.Duration) *optionalTicker {
+	if period <= 0 {
+		return &optionalTicker{}
+	}
+	ticker := time.NewTicker(period)
+	return &optionalTicker{C: ticker.C, ticker: ticker}
+}
+
+func (t *optionalTicker) Stop() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+	}
+}
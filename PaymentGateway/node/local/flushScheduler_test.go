@@ -0,0 +1,59 @@
+package local
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+)
+
+func TestFlushTrigger(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	policy := config.FlushPolicy{SourceAmount: 100, PendingCount: 4, ExpiryMargin: time.Hour}
+	transactions := []pendingTransaction{
+		{source: "A", amount: 60, expiry: now.Add(3 * time.Hour)},
+		{source: "B", amount: 60, expiry: now.Add(2 * time.Hour)},
+	}
+	assert.Equal(t, "", flushTrigger(policy, transactions, now))
+	assert.Equal(t, "", flushTrigger(policy, nil, now))
+
+	assert.Equal(t, flushTriggerSourceAmount, flushTrigger(policy, append(transactions, pendingTransaction{source: "A", amount: 40}), now))
+	assert.Equal(t, flushTriggerPendingCount, flushTrigger(policy, append(transactions, pendingTransaction{source: "C", amount: 1}, pendingTransaction{source: "D", amount: 1}), now))
+	assert.Equal(t, flushTriggerExpiry, flushTrigger(policy, transactions, now.Add(time.Hour)))
+
+	// Zero limits are disabled
+	assert.Equal(t, "", flushTrigger(config.FlushPolicy{}, append(transactions, pendingTransaction{source: "A", amount: 1000}), now.Add(2*time.Hour)))
+}
+
+func TestFlushSchedulerNotify(t *testing.T) {
+	flushed := make(chan struct{}, 1)
+	pending := []pendingTransaction{{source: "A", amount: 10}}
+	s := newFlushScheduler("test", config.FlushPolicy{SourceAmount: 10}, 0,
+		func(ctx context.Context, trigger string) (*models.FlushReport, error) {
+			flushed <- struct{}{}
+			return &models.FlushReport{Trigger: trigger}, nil
+		},
+		func() []pendingTransaction { return pending },
+		func() {})
+	defer s.stop()
+
+	s.notify()
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("policy check didn't flush")
+	}
+	assert.Equal(t, "1", flushMetrics.Get("test.triggers."+flushTriggerSourceAmount).String())
+
+	s.setPeriod(time.Millisecond)
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("periodic flush didn't run")
+	}
+	s.stop()
+	s.setPeriod(time.Second)
+}
@@ -2,9 +2,12 @@ package local
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/stellar/go/protocols/horizon"
@@ -25,8 +28,6 @@ import (
 	"go.opentelemetry.io/otel/api/trace"
 )
 
-const nodeTransactionFee = 10
-
 type LocalPPNode interface {
 	node.PPNode
 	GetStellarAddress() *models.GetStellarAddressResponse
@@ -34,7 +35,12 @@ type LocalPPNode interface {
 	ValidatePayment(ctx context.Context, request *models.ValidatePaymentRequest) (*models.ValidatePaymentResponse, error)
 	GetTransactions() []*models.PaymentTransaction
 	GetTransaction(sessionId string) *models.PaymentTransaction
-	FlushTransactions(context context.Context) error
+	// FlushTransactions submits the accumulated transactions, the report is kept in the flush history
+	FlushTransactions(context context.Context) (*models.FlushReport, error)
+	GetFlushHistory(limit int) ([]*models.FlushReport, error)
+	GetFlushReport(id int) (*models.FlushReport, error)
+	// GetSequenceState returns the allocation state of the node account sequence numbers
+	GetSequenceState() models.SequenceState
 	ProcessResponse(ctx context.Context, response *models.UtilityResponse) error
 	CommandHandler(ctx context.Context, cmd *models.UtilityCommand) (models.OutCommandType, error)
 	SetTransactionValiditySecs(transactionValiditySecs int64)
@@ -45,81 +51,119 @@ type LocalPPNode interface {
 	// Additional
 	GetBookHistory(commodity string, bins int, hours int) (*models.BookHistoryResponse, error)
 	GetBookBalance() (*models.BookBalanceResponse, error)
+	GetUnflushedTransactions() (*models.UnflushedTransactionsResponse, error)
+	GetFeePolicy() config.FeeConfig
+	GetPrices() commodity.PriceTable
+	GetNetworkPassphrase() string
+	// Side channel
+	SetUpPeer(ctx context.Context, request *models.SetUpPeerRequest) (*models.SetUpPeerResponse, error)
+	CreateOrFund(ctx context.Context, xdr models.XDR) error
+	InitiatePayment(ctx context.Context, request *models.InitiatePaymentRequest) (*models.InitiatePaymentResponse, error)
+	PaymentCommit(ctx context.Context, signedReimbursement models.XDR) (models.XDR, error)
+	// Shutdown stops accepting new payment sessions and waits until the sessions in progress complete or the context ends
+	Shutdown(ctx context.Context) error
+	// Close stops the auto flush, flushes the accumulated transactions and closes the database
+	Close(ctx context.Context) error
 }
 
 type nodeImpl struct {
 	db                           database.Db
 	rootClient                   root.RootApi
 	accumulatingTransactionsMode bool
-	transactionFee               models.TransactionAmount
+	fees                         config.FeeConfig
 	paymentRegistry              paymentregestry.PaymentRegistry
 	paymentManagerRegestry       regestry.PaymentManagerRegestry
 	commodityManager             commodity.Manager
 	tracer                       trace.Tracer
-	autoFlushPeriod              *time.Ticker
+	flushScheduler               *flushScheduler
 	flushMux                     sync.Mutex
 	asyncMode                    bool
 	callbackerFactory            CallbackerFactory
+	sideChannelPayments          *sideChannelPayments
+	issuedTransactions           *issuedTransactions
+	signedSessions               *signedSessions
+	peerAccounts                 *common.RollingLimit
+	commandJournal               paymentregestry.CommandJournal
+	flushHistory                 paymentregestry.FlushHistory
+	paymentRequestValidity       time.Duration
+	maxPaymentFee                models.TransactionAmount
+	shuttingDown                 int32
 }
 
+var errShuttingDown = errors.New("node is shutting down")
+
 func New(rootClient root.RootApi,
+	db database.Db,
 	paymentManager regestry.PaymentManagerRegestry,
+	commodityManager commodity.Manager,
 	callbackerFactory CallbackerFactory,
 	nodeConfig config.NodeConfig,
 ) (LocalPPNode, error) {
 
 	log.SetLevel(log.InfoLevel)
-	db, err := database.NewLiteDB()
-	if err != nil {
-		return nil, err
-	}
-	paymentRegestry, err := paymentregestry.NewWithDB(db)
+	paymentRegestry, err := paymentregestry.NewWithDB(db, rootClient.GetAddress())
 	if err != nil {
 		return nil, err
 	}
 	node := &nodeImpl{
 		db:                           db,
 		rootClient:                   rootClient,
-		transactionFee:               nodeTransactionFee,
+		fees:                         nodeConfig.Fees,
 		paymentRegistry:              paymentRegestry,
-		commodityManager:             commodity.New(),
+		commodityManager:             commodityManager,
 		paymentManagerRegestry:       paymentManager,
 		tracer:                       common.CreateTracer("node"),
 		callbackerFactory:            callbackerFactory,
 		flushMux:                     sync.Mutex{}, //TODO MOVE TO PAYMENT REGESTRY
 		accumulatingTransactionsMode: nodeConfig.AccumulateTransactions,
 		asyncMode:                    nodeConfig.AsyncMode,
+		sideChannelPayments:          newSideChannelPayments(),
+		issuedTransactions:           newIssuedTransactions(),
+		signedSessions:               newSignedSessions(),
+		peerAccounts:                 common.NewRollingLimit(int64(nodeConfig.PeerAccountsPerDay), 24*time.Hour),
+		commandJournal:               paymentregestry.NewCommandJournal(db, rootClient.GetAddress()),
+		flushHistory:                 paymentregestry.NewFlushHistory(db, rootClient.GetAddress()),
+		paymentRequestValidity:       nodeConfig.PaymentRequestValidity,
+		maxPaymentFee:                nodeConfig.MaxPaymentFee,
 	}
-	node.runTicker(nodeConfig.AutoFlushPeriod)
-	return node, nil
-}
+	if node.paymentRequestValidity == 0 {
+		node.paymentRequestValidity = config.DefaultCfg().NodeConfig.PaymentRequestValidity
+	}
+	if node.maxPaymentFee == 0 {
+		node.maxPaymentFee = config.DefaultCfg().NodeConfig.MaxPaymentFee
+	}
+	node.flushScheduler = newFlushScheduler(node.GetAddress(), nodeConfig.Flush, nodeConfig.AutoFlushPeriod,
+		node.flush, node.pendingTransactions, node.prune)
 
-func (n *nodeImpl) runTicker(autoFlushPeriod time.Duration) {
-	if n.autoFlushPeriod != nil {
-		if autoFlushPeriod == 0 {
-			n.autoFlushPeriod.Stop()
-		} else {
-			n.autoFlushPeriod.Reset(autoFlushPeriod)
-		}
-		return
-	}
-	if autoFlushPeriod > 0 {
-		n.autoFlushPeriod = time.NewTicker(autoFlushPeriod)
-		go func(n *nodeImpl) {
-			address := n.GetAddress()
-			for now := range n.autoFlushPeriod.C {
-				log.Debugf("Node %s autoflush tick: %s", address, now.String())
-				err := n.FlushTransactions(context.Background())
-				if err != nil {
-					log.Errorf("Error during autoflush of node %s: %s", address, err.Error())
-				}
-			}
-		}(n)
+	unflushed, err := node.GetUnflushedTransactions()
+	if err != nil {
+		log.Errorf("Error reading unflushed transactions of node %s: %v", node.GetAddress(), err)
+	} else if unflushed.Count+unflushed.ExpiredCount > 0 {
+		log.Warnf("Node %s has %d unflushed transactions (%v pptoken), %d expired (%v pptoken)", node.GetAddress(),
+			unflushed.Count, unflushed.Amount, unflushed.ExpiredCount, unflushed.ExpiredAmount)
+	}
 
-	} else {
-		log.Debugf("node %s: autoflush disabled.", n.GetAddress())
+	// Sessions are always resumed asynchronously, command replies can only arrive once the node serves requests
+	err = paymentManager.Recover(context.Background(), node, true)
+	if err != nil {
+		log.Errorf("Error recovering payment sessions of node %s: %v", node.GetAddress(), err)
 	}
+	return node, nil
+}
 
+// pendingTransactions lists the accumulated transactions for the flush policy, their expiry is zero if it can't be read
+func (n *nodeImpl) pendingTransactions() []pendingTransaction {
+	transactions := n.paymentRegistry.GetActiveTransactions()
+	pending := make([]pendingTransaction, 0, len(transactions))
+	for _, t := range transactions {
+		expiry, _ := models.TransactionExpiry(&t.PaymentTransaction)
+		pending = append(pending, pendingTransaction{
+			source: t.PaymentSourceAddress,
+			amount: t.AmountOut,
+			expiry: expiry,
+		})
+	}
+	return pending
 }
 
 func (n *nodeImpl) GetStellarAddress() *models.GetStellarAddressResponse {
@@ -132,33 +176,97 @@ func (n *nodeImpl) SetAccumulatingTransactionsMode(accumulateTransactions bool)
 	n.accumulatingTransactionsMode = accumulateTransactions
 }
 
+func (n *nodeImpl) isShuttingDown() bool {
+	return atomic.LoadInt32(&n.shuttingDown) != 0
+}
+
+func (n *nodeImpl) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&n.shuttingDown, 1)
+	log.Infof("Node %s is shutting down, waiting for the payments in progress", n.GetAddress())
+	return n.paymentManagerRegestry.Drain(ctx)
+}
+
+func (n *nodeImpl) Close(ctx context.Context) error {
+	atomic.StoreInt32(&n.shuttingDown, 1)
+	n.flushScheduler.stop()
+	_, flushErr := n.flush(ctx, models.FlushTriggerShutdown)
+	if flushErr != nil {
+		log.Errorf("Final flush of node %s failed: %v", n.GetAddress(), flushErr)
+	}
+	err := n.db.Close()
+	if err != nil {
+		return err
+	}
+	return flushErr
+}
+
 func (n *nodeImpl) SetAutoFlush(autoFlush time.Duration) {
-	n.runTicker(autoFlush)
+	n.flushScheduler.setPeriod(autoFlush)
 }
 
 func (n *nodeImpl) SetTransactionValiditySecs(transactionValiditySecs int64) {
 	n.rootClient.SetTransactionValiditySecs(transactionValiditySecs)
 }
 
-func (n *nodeImpl) GetFee() uint32 {
-	return 0
+// quoteFee returns the fee of forwarding the amount, the node doesn't charge the payments of its own sessions
+func (n *nodeImpl) quoteFee(serviceSessionId string, amount models.TransactionAmount, asset string) (models.TransactionAmount, error) {
+	_, ok := n.paymentRegistry.GetPendingAmount(serviceSessionId)
+	if ok {
+		return 0, nil
+	}
+	return n.fees.Policy(asset).Fee(amount)
+}
+
+func (n *nodeImpl) GetPrices() commodity.PriceTable {
+	return n.commodityManager.Prices()
+}
+
+func (n *nodeImpl) GetFeePolicy() config.FeeConfig {
+	return n.fees
+}
+
+func (n *nodeImpl) QuoteFee(ctx context.Context, command *models.QuoteFeeCommand) (*models.QuoteFeeResponse, error) {
+	fee, err := n.quoteFee(command.ServiceSessionId, command.Amount, command.Asset)
+	if err != nil {
+		return nil, err
+	}
+	return &models.QuoteFeeResponse{
+		Fee: fee,
+	}, nil
 }
 
 func (n *nodeImpl) NewPaymentRequest(ctx context.Context, request *models.CreatePaymentInfo) (*models.PaymentRequest, error) {
 	nodeAddress := n.GetAddress()
 	_, span := n.tracer.Start(ctx, "node-CreatePaymentRequest "+nodeAddress)
 	defer span.End()
+	if n.isShuttingDown() {
+		return nil, errShuttingDown
+	}
 	paymentRequest, err := n.commodityManager.Calculate(request)
 	if err != nil {
 		return nil, errors.Errorf("invalid commodity")
 	}
 	sessionId := xid.New().String()
+	nonce := make([]byte, 16)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	issuedAt := time.Now()
 	pr := &models.PaymentRequest{
 		Address:          nodeAddress,
 		ServiceSessionId: sessionId,
 		Amount:           paymentRequest.Amount,
 		Asset:            paymentRequest.Asset,
 		ServiceRef:       paymentRequest.ServiceRef,
+		Quote:            paymentRequest.Quote,
+		IssuedAt:         issuedAt.Unix(),
+		ExpiresAt:        issuedAt.Add(n.paymentRequestValidity).Unix(),
+		Nonce:            hex.EncodeToString(nonce),
+	}
+	err = n.rootClient.SignPaymentRequest(pr)
+	if err != nil {
+		return nil, err
 	}
 	log.Infof("CreatePaymentRequest: Starting %d  %s/%s ", request.Amount, pr.Asset, pr.ServiceRef)
 
@@ -170,8 +278,18 @@ func (n *nodeImpl) CreateTransaction(context context.Context, request *models.Cr
 	nodeAddress := n.GetAddress()
 	_, span := n.tracer.Start(context, "node-CreateTransaction "+nodeAddress)
 	defer span.End()
+	if request.TotalIn < request.TotalOut {
+		return nil, fmt.Errorf("incoming amount %d is less than the outgoing amount %d", request.TotalIn, request.TotalOut)
+	}
 	fee := request.TotalIn - request.TotalOut
 	log.Infof("CreateTransaction: Starting %s %d + %d = %d => %s ", request.SourceAddress, request.TotalIn, fee, request.TotalOut, nodeAddress)
+	expectedFee, err := n.quoteFee(request.ServiceSessionId, request.TotalOut, request.Asset)
+	if err != nil {
+		return nil, err
+	}
+	if fee != expectedFee {
+		return nil, fmt.Errorf("transaction fee %d doesn't match the fee %d of node %s", fee, expectedFee, nodeAddress)
+	}
 	span.SetAttributes(core.KeyValue{Key: "payment.source-address", Value: core.String(request.SourceAddress)})
 	span.SetAttributes(core.KeyValue{Key: "payment.destination-address", Value: core.String(nodeAddress)})
 	span.SetAttributes(core.KeyValue{Key: "payment.amount-in", Value: core.Uint32(request.TotalIn)})
@@ -200,8 +318,18 @@ func (n *nodeImpl) CreateTransaction(context context.Context, request *models.Cr
 	}, nil
 }
 
+// ValidatePayment returns the quantity paid by a payment request of the node, the quote of the request
+// is trusted because the signature of the node covers it
 func (n *nodeImpl) ValidatePayment(ctx context.Context, request *models.ValidatePaymentRequest) (*models.ValidatePaymentResponse, error) {
-	return n.commodityManager.ReverseCalculate(request.ServiceType, request.CommodityType, request.PaymentRequest.Amount, request.PaymentRequest.Asset)
+	pr := &request.PaymentRequest
+	if pr.Address != n.GetAddress() {
+		return nil, fmt.Errorf("payment request %s wasn't issued by node %s", pr.ServiceSessionId, n.GetAddress())
+	}
+	err := pr.VerifySignature()
+	if err != nil {
+		return nil, err
+	}
+	return n.commodityManager.ReverseCalculate(request.ServiceType, request.CommodityType, pr.Amount, pr.Asset, pr.Quote)
 
 }
 
@@ -209,6 +337,10 @@ func (n *nodeImpl) GetAddress() string {
 	return n.rootClient.GetAddress()
 }
 
+func (n *nodeImpl) GetNetworkPassphrase() string {
+	return n.rootClient.GetNetworkPassphrase()
+}
+
 func (n *nodeImpl) GetAccount() (*horizon.Account, error) {
 	return n.rootClient.GetAccount()
 }
@@ -269,6 +401,7 @@ func (n *nodeImpl) SignServiceTransaction(context context.Context, command *mode
 	if err != nil {
 		return nil, errors.Errorf("Error UpdateTransactionXDR %v", err)
 	}
+	n.signedSessions.sign(creditTransaction.ServiceSessionId, "")
 	log.Infof("SignServiceTransaction: done %s => %s ",
 		creditTransactionPayload.PendingTransaction.PaymentSourceAddress,
 		creditTransactionPayload.PendingTransaction.PaymentDestinationAddress)
@@ -295,19 +428,20 @@ func (n *nodeImpl) SignChainTransaction(context context.Context,
 	signedCreditTransaction, err := n.rootClient.SignPaymentTransaction(&creditTransaction)
 
 	if err != nil {
-		log.Fatal("Failed to signed transaction")
-		return nil, err
+		log.Errorf("SignChainTransaction: failed to sign credit transaction: %v", err)
+		return nil, errors.Errorf("error signing credit transaction: %v", err)
 	}
 	credit.PendingTransaction = *signedCreditTransaction
 
 	signedDebitTransaction, err := n.rootClient.SignPaymentTransaction(&debit.PendingTransaction)
 
 	if err != nil {
-		log.Fatal("Failed to signed transaction")
-		return nil, err
+		log.Errorf("SignChainTransaction: failed to sign debit transaction: %v", err)
+		return nil, errors.Errorf("error signing debit transaction: %v", err)
 	}
 
 	debit.PendingTransaction = *signedDebitTransaction
+	n.signedSessions.sign(debit.PendingTransaction.ServiceSessionId, debit.PendingTransaction.PaymentDestinationAddress)
 
 	log.Infof("SignChainTransaction: done %s => %s ", credit.PendingTransaction.PaymentSourceAddress,
 		credit.PendingTransaction.PaymentDestinationAddress)
@@ -345,7 +479,11 @@ func (n *nodeImpl) commitTransaction(context context.Context, transaction *model
 	if err != nil {
 		return fmt.Errorf("GetTransactionSequenceNumber error : %v", err)
 	}
-	n.paymentRegistry.SaveTransaction(sequence, transaction)
+	err = n.paymentRegistry.SaveTransaction(sequence, transaction)
+	if err != nil {
+		return err
+	}
+	n.flushScheduler.notify()
 	log.Infof("CommitChainTransaction finished %s => %s", transaction.PaymentSourceAddress,
 		transaction.PaymentDestinationAddress)
 
@@ -357,7 +495,13 @@ func (n *nodeImpl) CommitChainTransaction(context context.Context, command *mode
 
 	_, span := n.tracer.Start(context, "node-CommitChainTransaction "+n.GetAddress())
 	defer span.End()
-	err := n.commitTransaction(context, &command.Transaction.PendingTransaction)
+	sessionId := command.Transaction.PendingTransaction.ServiceSessionId
+	err := n.signedSessions.beginCommit(sessionId)
+	if err != nil {
+		return err
+	}
+	err = n.commitTransaction(context, &command.Transaction.PendingTransaction)
+	n.signedSessions.endCommit(sessionId, err)
 	if err != nil {
 		return err
 	}
@@ -375,22 +519,125 @@ func (n *nodeImpl) CommitServiceTransaction(context context.Context, command *mo
 	log.Infof("CommitServiceTransaction started %s => %s", transaction.PaymentSourceAddress,
 		transaction.PaymentDestinationAddress)
 
-	err := n.commitTransaction(context, &transaction)
+	if paymentRequest == nil {
+		return fmt.Errorf("payment request is missing")
+	}
+	if paymentRequest.Address != n.GetAddress() {
+		return fmt.Errorf("payment request %s wasn't issued by node %s", paymentRequest.ServiceSessionId, n.GetAddress())
+	}
+	err := paymentRequest.Verify(time.Now())
+	if err != nil {
+		return err
+	}
 
+	// The session is paid once committed, it can't be revoked anymore
+	err = n.signedSessions.beginCommit(transaction.ServiceSessionId)
 	if err != nil {
 		return err
 	}
-	command.Transaction.ToSpanAttributes(span, "single")
-	err = n.paymentRegistry.ReducePendingAmount(paymentRequest.ServiceSessionId, transaction.AmountOut)
+	err = n.commitServiceTransaction(context, paymentRequest, &transaction)
+	n.signedSessions.endCommit(transaction.ServiceSessionId, err)
 	if err != nil {
 		return err
 	}
+	command.Transaction.ToSpanAttributes(span, "single")
 	log.Infof("CommitServiceTransaction finished %s => %s", transaction.PaymentSourceAddress,
 		transaction.PaymentDestinationAddress)
 
 	return nil
 }
 
+func (n *nodeImpl) commitServiceTransaction(context context.Context, paymentRequest *models.PaymentRequest, transaction *models.PaymentTransaction) error {
+	if transaction.ServiceSessionId != paymentRequest.ServiceSessionId {
+		return fmt.Errorf("transaction of session %s doesn't pay payment request %s", transaction.ServiceSessionId, paymentRequest.ServiceSessionId)
+	}
+	err := n.commitTransaction(context, transaction)
+	if err != nil {
+		return err
+	}
+	return n.paymentRegistry.ReducePendingAmount(paymentRequest.ServiceSessionId, transaction.AmountOut)
+}
+
+// RevokeTransaction compensates the commit of a failed payment, a transaction which is no longer
+// the active one (never committed, already revoked or flushed) is left as is. The service node revokes
+// a session it issued until the session is paid, a hop needs the revocation of the node it paid.
+// The revocation of the node is returned for the previous hop.
+func (n *nodeImpl) RevokeTransaction(context context.Context, command *models.RevokeTransactionCommand) (*models.RevokeTransactionResponse, error) {
+
+	_, span := n.tracer.Start(context, "node-RevokeTransaction "+n.GetAddress())
+	defer span.End()
+	transaction := command.Transaction.PendingTransaction
+	log.Infof("RevokeTransaction started %s => %s", transaction.PaymentSourceAddress,
+		transaction.PaymentDestinationAddress)
+
+	sessionId := transaction.ServiceSessionId
+	pr := command.PaymentRequest
+	if pr != nil {
+		if pr.Address != n.GetAddress() || pr.ServiceSessionId != sessionId {
+			return nil, fmt.Errorf("payment request %s isn't the request of session %s of node %s", pr.ServiceSessionId, sessionId, n.GetAddress())
+		}
+		err := pr.VerifySignature()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := n.signedSessions.revoke(sessionId, func(next string) error {
+		if next == "" {
+			if pr == nil {
+				return fmt.Errorf("payment request of session %s is missing", sessionId)
+			}
+			return nil
+		}
+		if command.Revocation == nil {
+			return fmt.Errorf("revocation of session %s by %s is missing", sessionId, next)
+		}
+		return command.Revocation.Verify(next, sessionId)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var reference *models.PaymentTransactionWithSequence
+	ref := command.Transaction.ReferenceTransaction
+	if ref != nil && !ref.XDR.Empty() {
+		sequence, err := n.rootClient.GetTransactionSequenceNumber(ref)
+		if err != nil {
+			return nil, fmt.Errorf("GetTransactionSequenceNumber error : %v", err)
+		}
+		reference = &models.PaymentTransactionWithSequence{
+			PaymentTransaction: *ref,
+			Sequence:           sequence,
+		}
+	}
+
+	// The revoked transaction must not be submitted meanwhile
+	n.flushMux.Lock()
+	defer n.flushMux.Unlock()
+	revoked, err := n.paymentRegistry.RevokeTransaction(&transaction, reference)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		log.Infof("RevokeTransaction: transaction of session %s isn't active, nothing to revoke", sessionId)
+	} else {
+		command.Transaction.ToSpanAttributes(span, "revoked")
+		log.Infof("RevokeTransaction finished %s => %s", transaction.PaymentSourceAddress,
+			transaction.PaymentDestinationAddress)
+	}
+
+	revocation := &models.Revocation{
+		ServiceSessionId: sessionId,
+		Address:          n.GetAddress(),
+	}
+	err = n.rootClient.SignRevocation(revocation)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RevokeTransactionResponse{
+		Revocation: revocation,
+	}, nil
+}
+
 func (n *nodeImpl) GetTransactions() []*models.PaymentTransaction {
 	trs := []*models.PaymentTransaction{}
 	for _, item := range n.paymentRegistry.GetActiveTransactions() {
@@ -403,69 +650,224 @@ func (n *nodeImpl) GetTransaction(sessionId string) *models.PaymentTransaction {
 	return n.paymentRegistry.GetTransactionBySessionId(sessionId)
 }
 
-func (n *nodeImpl) FlushTransactions(context context.Context) error {
+func (n *nodeImpl) FlushTransactions(context context.Context) (*models.FlushReport, error) {
+	return n.flush(context, models.FlushTriggerRequest)
+}
+
+func (n *nodeImpl) GetSequenceState() models.SequenceState {
+	return n.rootClient.GetSequenceState()
+}
+
+func (n *nodeImpl) GetFlushHistory(limit int) ([]*models.FlushReport, error) {
+	return n.flushHistory.List(limit)
+}
+
+func (n *nodeImpl) GetFlushReport(id int) (*models.FlushReport, error) {
+	return n.flushHistory.Get(id)
+}
+
+// prune drops the command replies past the retention of the journal and the nonces of the expired payment requests
+func (n *nodeImpl) prune() {
+	now := time.Now()
+	err := n.commandJournal.Prune(now)
+	if err != nil {
+		log.Errorf("Error pruning command journal of node %s: %v", n.GetAddress(), err)
+	}
+	err = n.paymentManagerRegestry.Prune(now)
+	if err != nil {
+		log.Errorf("Error pruning payment request nonces of node %s: %v", n.GetAddress(), err)
+	}
+}
+
+// flush submits the accumulated transactions in sequence order and reports the outcome of each of them,
+// the report is saved unless there was nothing to flush
+func (n *nodeImpl) flush(context context.Context, trigger string) (*models.FlushReport, error) {
 
 	_, span := n.tracer.Start(context, "node-FlushTransactions "+n.GetAddress())
 	defer span.End()
 
 	log.Infof("FlushTransactions started")
 
-	//TODO Sort transaction by sequence number and make sure to submit them only in sequence number order
-	transactions := n.paymentRegistry.GetActiveTransactions()
+	n.flushMux.Lock()
+	defer n.flushMux.Unlock()
 
-	if len(transactions) == 0 {
+	report := &models.FlushReport{
+		NodeAddress: n.GetAddress(),
+		Trigger:     trigger,
+		Started:     time.Now(),
+	}
+	err := n.submitTransactions(report)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.Finished = time.Now()
+	span.SetAttributes(core.KeyValue{Key: "flush.submitted", Value: core.Int(len(report.Submitted))})
+	span.SetAttributes(core.KeyValue{Key: "flush.failed", Value: core.Int(len(report.Failed))})
+
+	if report.Empty() {
 		log.Info("FlushTransactions: No transactions to flush.")
-		return nil
+		return report, nil
 	}
+	log.Infof("FlushTransactions finished: %d submitted, %d expired, %d skipped, %d failed, %d remaining",
+		len(report.Submitted), len(report.Expired), len(report.Skipped), len(report.Failed), len(report.Remaining))
+	saveErr := n.flushHistory.Save(report)
+	if saveErr != nil {
+		log.Errorf("Error saving flush report of node %s: %v", n.GetAddress(), saveErr)
+	}
+	return report, err
+}
 
-	n.flushMux.Lock()
-	defer n.flushMux.Unlock()
+func (n *nodeImpl) submitTransactions(report *models.FlushReport) error {
+	transactions := n.removeExpiredTransactions(n.paymentRegistry.GetActiveTransactions(), report)
+
+	if len(transactions) == 0 {
+		return nil
+	}
 
 	sort.Slice(transactions, func(i, j int) bool {
 		return transactions[i].Sequence < transactions[j].Sequence
 	})
-	//
-	transactions, err := n.rootClient.RemoveTransactionsIfSequence(transactions)
+	remaining, err := n.rootClient.RemoveTransactionsIfSequence(transactions)
 	if err != nil {
+		report.Remaining = flushedTransactions(transactions)
 		return err
 	}
-	if len(transactions) > 0 {
-
-		err := n.rootClient.BumpSequenceIfNeed(transactions[0])
-		if err != nil {
-			return err
-		}
-		for _, t := range transactions {
-			log.Infof("Submitting transaction for session %s", t.ServiceSessionId)
-			err := n.rootClient.SubmitTransactionXDR(t.XDR)
+	// The removed transactions are the leading ones, the account sequence already passed them
+	for _, t := range transactions[:len(transactions)-len(remaining)] {
+		n.completePayment(t, models.TransactionStatusFailed)
+		report.Skipped = append(report.Skipped, models.NewFlushedTransaction(t))
+	}
+	transactions = remaining
+	// A transaction rejected before it made it into a ledger leaves a gap in the sequence
+	needBump := false
+	for i, t := range transactions {
+		if i == 0 || needBump || t.Sequence != transactions[i-1].Sequence+1 {
+			bump, err := n.rootClient.BumpSequenceIfNeed(t)
 			if err != nil {
-				log.Errorf("Error in submit transaction (%v): %s", err, t.XDR)
-
-				break
+				report.Remaining = flushedTransactions(transactions[i:])
+				return err
+			}
+			if bump != nil {
+				report.Bumped = append(report.Bumped, *bump)
 			}
-			//TODO: Make the transaction removal more intellegent
-			n.paymentRegistry.CompletePayment(t.PaymentSourceAddress, t.ServiceSessionId)
-			//processedTransactions = append(processedTransactions, &t.PaymentTransaction)
+			needBump = false
+		}
+		log.Infof("Submitting transaction for session %s", t.ServiceSessionId)
+		flushed := models.NewFlushedTransaction(t)
+		xdr, err := n.submitWithFeeBump(t, &flushed)
+		if root.Kind(err) == root.ErrInsufficientFee {
+			// The fee stats were outdated
+			xdr, err = n.submitWithFeeBump(t, &flushed)
+		}
+		if err == nil {
+			n.completePayment(t, models.TransactionStatusSubmitted)
+			report.Submitted = append(report.Submitted, flushed)
+			continue
+		}
+		log.Errorf("Error in submit transaction (%v): %s", err, xdr)
+		failed := flushed
+		failed.Error = err.Error()
+		horizonErr, _ := root.AsHorizonError(err)
+		if horizonErr != nil {
+			failed.ResultCodes = horizonErr.ResultCodes
+		}
+		switch root.Kind(err) {
+		case root.ErrExpired:
+			n.completePayment(t, models.TransactionStatusExpired)
+			report.Expired = append(report.Expired, failed)
+			needBump = true
+		case root.ErrBadAuth, root.ErrNoTrustline:
+			// Resubmitting doesn't help, the transaction is given up
+			n.completePayment(t, models.TransactionStatusFailed)
+			report.Failed = append(report.Failed, failed)
+			needBump = true
+		default:
+			// Transient failures, a short node balance or a sequence moved by another submitter:
+			// the transaction and the ones depending on its sequence are flushed again later
+			failed.Kept = true
+			report.Failed = append(report.Failed, failed)
+			report.Remaining = flushedTransactions(transactions[i+1:])
+			return nil
 		}
 	}
 
 	return nil
 }
 
+// submitWithFeeBump wraps the pre-signed transaction in a fee-bump transaction if its fee is too low for the network
+func (n *nodeImpl) submitWithFeeBump(t *models.PaymentTransactionWithSequence, flushed *models.FlushedTransaction) (models.XDR, error) {
+	xdr, feeBump, err := n.rootClient.FeeBumpIfNeeded(t.XDR)
+	if err != nil {
+		return t.XDR, err
+	}
+	flushed.FeeBump = feeBump
+	return xdr, n.rootClient.SubmitTransactionXDR(xdr)
+}
+
+func flushedTransactions(transactions []*models.PaymentTransactionWithSequence) []models.FlushedTransaction {
+	flushed := []models.FlushedTransaction{}
+	for _, t := range transactions {
+		flushed = append(flushed, models.NewFlushedTransaction(t))
+	}
+	return flushed
+}
+
+// removeExpiredTransactions marks the transactions which can't be submitted anymore and returns the rest
+func (n *nodeImpl) removeExpiredTransactions(transactions []*models.PaymentTransactionWithSequence, report *models.FlushReport) []*models.PaymentTransactionWithSequence {
+	now := time.Now()
+	valid := []*models.PaymentTransactionWithSequence{}
+	for _, t := range transactions {
+		expiry, err := models.TransactionExpiry(&t.PaymentTransaction)
+		if err != nil {
+			log.Warnf("Problematic transaction of session %s detected, couldn't read timebounds (%v) - removing.", t.ServiceSessionId, err)
+			n.completePayment(t, models.TransactionStatusFailed)
+			failed := models.NewFlushedTransaction(t)
+			failed.Error = err.Error()
+			report.Failed = append(report.Failed, failed)
+			continue
+		}
+		if isExpired(expiry, now) {
+			log.Warnf("Transaction of session %s expired at %v - removing.", t.ServiceSessionId, expiry)
+			n.completePayment(t, models.TransactionStatusExpired)
+			report.Expired = append(report.Expired, models.NewFlushedTransaction(t))
+			continue
+		}
+		valid = append(valid, t)
+	}
+	return valid
+}
+
+func (n *nodeImpl) completePayment(t *models.PaymentTransactionWithSequence, status models.TransactionStatus) {
+	err := n.paymentRegistry.CompletePayment(t.PaymentSourceAddress, t.ServiceSessionId, status)
+	if err != nil {
+		log.Errorf("Error marking transaction of session %s %s: %v", t.ServiceSessionId, status, err)
+	}
+}
+
+func isExpired(expiry time.Time, now time.Time) bool {
+	return !expiry.IsZero() && !now.Before(expiry)
+}
+
 func (n *nodeImpl) ProcessResponse(ctx context.Context, response *models.UtilityResponse) error {
 	paymentManager := n.paymentManagerRegestry.Get(response.SessionId)
 	if paymentManager == nil {
 		return fmt.Errorf("session unknown")
 	}
-	return paymentManager.ProcessResponse(ctx, response.NodeId, response.CommandId, response.CommandResponse)
+	return paymentManager.ProcessResponse(ctx, response)
 
 }
 
 func (n *nodeImpl) ProcessPayment(ctx context.Context, request *models.ProcessPaymentRequest) (*models.ProcessPaymentAccepted, error) {
+	if n.isShuttingDown() {
+		return nil, errShuttingDown
+	}
 	sessionId := request.PaymentRequest.ServiceSessionId
 	if n.paymentManagerRegestry.Has(sessionId) {
 		return nil, fmt.Errorf("duplicate session id")
 	}
+	if request.MaxFee == 0 {
+		request.MaxFee = n.maxPaymentFee
+	}
 	paymentManager, err := n.paymentManagerRegestry.New(ctx, n, request)
 	if err != nil {
 		return nil, err
@@ -483,7 +885,14 @@ func (n *nodeImpl) ProcessPayment(ctx context.Context, request *models.ProcessPa
 
 }
 
+// CommandHandler executes the command once per command id, see paymentregestry.CommandJournal
 func (u *nodeImpl) CommandHandler(ctx context.Context, cmd *models.UtilityCommand) (models.OutCommandType, error) {
+	return u.commandJournal.Process(cmd, func() (models.OutCommandType, error) {
+		return u.handleCommand(ctx, cmd)
+	})
+}
+
+func (u *nodeImpl) handleCommand(ctx context.Context, cmd *models.UtilityCommand) (models.OutCommandType, error) {
 
 	switch body := cmd.CommandBody.(type) {
 	case *models.CreateTransactionCommand:
@@ -508,6 +917,12 @@ func (u *nodeImpl) CommandHandler(ctx context.Context, cmd *models.UtilityComman
 			return nil, err
 		}
 		return &models.CommitServiceTransactionResponse{}, nil
+
+	case *models.RevokeTransactionCommand:
+		return u.RevokeTransaction(ctx, body)
+
+	case *models.QuoteFeeCommand:
+		return u.QuoteFee(ctx, body)
 	default:
 		return nil, fmt.Errorf("unknow command type: %v", body)
 	}
@@ -520,33 +935,21 @@ func (u *nodeImpl) ProcessCommand(ctx context.Context, command *models.UtilityCo
 		go func(callbacker CallBacker) {
 			reply, err := u.CommandHandler(ctx, command)
 			if err != nil {
-				log.Fatalf("CommandHandler error: %v", err)
-				return
+				log.Errorf("Command %s failed: %v", command.CommandId, err)
 			}
+			// The error is replied to the caller, which fails the hop
 			err = callbacker.call(reply, err)
 			if err != nil {
-				log.Fatalf("Callback error: %v", err)
-				return
+				log.Errorf("Callback of command %s failed: %v", command.CommandId, err)
 			}
 		}(callbacker)
 		return nil, nil
 	}
-	reply, err := u.CommandHandler(ctx, command)
-
-	if err != nil {
-		return nil, fmt.Errorf("command submitted")
-	} else {
-		return reply, nil
-	}
+	return u.CommandHandler(ctx, command)
 
 }
 
 func (n *nodeImpl) GetBookHistory(commodity string, bins int, hours int) (*models.BookHistoryResponse, error) {
-	err := n.db.Open()
-	if err != nil {
-		return nil, err
-	}
-	defer n.db.Close()
 	stepDuration := time.Duration(hours) * time.Hour
 	till := time.Now().Truncate(stepDuration).Add(stepDuration)
 	from := till.Add(-stepDuration * time.Duration(bins))
@@ -560,14 +963,48 @@ func (n *nodeImpl) GetBookHistory(commodity string, bins int, hours int) (*model
 }
 
 func (n *nodeImpl) GetActiveTransactionsAmount() (amount models.TransactionAmount) {
-
+	now := time.Now()
 	for _, t := range n.paymentRegistry.GetActiveTransactions() {
-		if err := n.rootClient.ValidateTimebounds(&t.PaymentTransaction); err == nil {
+		expiry, err := models.TransactionExpiry(&t.PaymentTransaction)
+		if err == nil && !isExpired(expiry, now) {
 			amount += t.AmountOut
 		}
 	}
 	return amount
 }
+
+// GetUnflushedTransactions reports the value of the accumulated transactions which weren't submitted yet
+func (n *nodeImpl) GetUnflushedTransactions() (*models.UnflushedTransactionsResponse, error) {
+	var (
+		amount        models.TransactionAmount
+		expiredAmount models.TransactionAmount
+		nextExpiry    time.Time
+	)
+	now := time.Now()
+	response := &models.UnflushedTransactionsResponse{}
+	for _, t := range n.paymentRegistry.GetActiveTransactions() {
+		expiry, err := models.TransactionExpiry(&t.PaymentTransaction)
+		if err != nil {
+			return nil, err
+		}
+		if isExpired(expiry, now) {
+			response.ExpiredCount++
+			expiredAmount += t.AmountOut
+			continue
+		}
+		response.Count++
+		amount += t.AmountOut
+		if !expiry.IsZero() && (nextExpiry.IsZero() || expiry.Before(nextExpiry)) {
+			nextExpiry = expiry
+		}
+	}
+	response.Amount = models.PPtoken2MicroPP(amount)
+	response.ExpiredAmount = models.PPtoken2MicroPP(expiredAmount)
+	response.NextExpiry = models.JsonTime(nextExpiry)
+	response.Timestamp = models.JsonTime(now)
+	return response, nil
+}
+
 func (n *nodeImpl) GetBookBalance() (*models.BookBalanceResponse, error) {
 	amount := n.GetActiveTransactionsAmount()
 
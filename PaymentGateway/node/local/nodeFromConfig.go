@@ -4,15 +4,24 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
+	"github.com/stellar/go/keypair"
+	"google.golang.org/grpc"
 	"paidpiper.com/payment-gateway/client"
 	"paidpiper.com/payment-gateway/commodity"
 	"paidpiper.com/payment-gateway/common"
 	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/keystore"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
 	"paidpiper.com/payment-gateway/node/proxy"
 	"paidpiper.com/payment-gateway/regestry"
 	"paidpiper.com/payment-gateway/root"
+	"paidpiper.com/payment-gateway/root/ledger"
 	"paidpiper.com/payment-gateway/torclient"
 )
 
@@ -32,14 +41,21 @@ import (
 // 	AutoFlushDuration time.Duration
 // }
 
+const priceTablePollPeriod = 10 * time.Second
+
 func FromConfig(config *config.Configuration) (LocalPPNode, error) {
 	//cfg := NewNodeStartConfig(config)
-	clientFactory := TorClientFactory(config.TorAddressPrefix)
+	clientFactory := TorClientFactory(config.TorAddressPrefix, config.CommandConfig)
+	if config.CommandGrpcTarget != "" {
+		clientFactory = GrpcClientFactory(config.CommandGrpcTarget, config.CommandConfig)
+	}
 	return FromConfigWithClientFactory(config, clientFactory)
 }
 
 func FromConfigWithClientFactory(config *config.Configuration, clientFactory regestry.CommandClientFactory) (LocalPPNode, error) {
 	tracer := common.CreateTracer("paidpiper/serviceNode")
+	// The passphrases of the environment are shared by the keystores of the configuration
+	defer keystore.ForgetEnvSecrets()
 
 	_, span := tracer.Start(context.Background(), "serviceNode-initialization")
 	defer span.End()
@@ -57,30 +73,174 @@ func FromConfigWithClientFactory(config *config.Configuration, clientFactory reg
 func LocalHost(config *config.Configuration, rootClient root.RootApi,
 	torClient torclient.TorClient,
 	commandClientFactory regestry.CommandClientFactory) (LocalPPNode, error) {
-	commodityManager := commodity.New()
+	commodityManager, stopWatching, err := CommodityManager(config.PriceTableFile)
+	if err != nil {
+		return nil, err
+	}
+	db, err := database.NewLiteDB()
+	if err != nil {
+		return nil, err
+	}
+	// The sequences of the stored transactions aren't allocated again
+	err = rootClient.SetSequenceStore(paymentregestry.NewSequenceStore(db, rootClient.GetAddress()))
+	if err != nil {
+		stopWatching()
+		return nil, err
+	}
+	rootCfg := config.RootApiConfig
+	if len(rootCfg.ChannelKeystores) > 0 || rootCfg.ChannelAccounts > 0 {
+		channels, err := OpenChannelKeyPairs(rootCfg)
+		if err == nil {
+			err = rootClient.SetUpChannels(channels, rootCfg.ChannelAccounts)
+		}
+		if err != nil {
+			stopWatching()
+			return nil, err
+		}
+	}
 	paymentRegestry := regestry.NewPaymentManagerRegestry(
 		commodityManager,
 		client.New(rootClient),
 		commandClientFactory,
-		torClient)
-	localNode, err := New(rootClient, paymentRegestry,
+		torClient,
+		paymentregestry.NewPaymentSessionStore(db, rootClient.GetAddress()),
+		paymentregestry.NewNonceStore(db, rootClient.GetAddress()))
+	localNode, err := New(rootClient, db, paymentRegestry,
+		commodityManager,
 		newCallbacker,
 		config.NodeConfig)
 
 	if err != nil {
+		stopWatching()
 		glog.Infof("Error creating Node object: %s", err)
 		return nil, err
 	}
 
-	return localNode, nil
+	return &hostNode{LocalPPNode: localNode, stopWatching: stopWatching}, nil
+}
+
+// hostNode stops watching the price table when the node is closed
+type hostNode struct {
+	LocalPPNode
+	stopWatching func()
+}
+
+func (h *hostNode) Close(ctx context.Context) error {
+	h.stopWatching()
+	return h.LocalPPNode.Close(ctx)
+}
+
+// CommodityManager loads the price table file and keeps watching it until the returned function is called,
+// the built-in prices are used without a file
+func CommodityManager(priceTableFile string) (commodity.Manager, func(), error) {
+	if priceTableFile == "" {
+		return commodity.New(), func() {}, nil
+	}
+	commodityManager, err := commodity.NewFromFile(priceTableFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := commodity.WatchPriceTable(commodityManager, priceTableFile, priceTablePollPeriod)
+	return commodityManager, stop, nil
+}
+
+// CreateSigner connects to the signing daemon if it is configured, the node key of the keystore is used in the process
+// otherwise. The cleartext seed is only used when it is explicitly allowed, for testing.
+func CreateSigner(cfg config.RootApiConfig) (root.Signer, error) {
+	if cfg.SignerSocket != "" {
+		return root.NewRemoteSigner(cfg.SignerSocket)
+	}
+	if cfg.CleartextSeed != "" {
+		if !cfg.AllowCleartextSeed {
+			return nil, fmt.Errorf("the cleartext node seed isn't allowed, use a keystore")
+		}
+		return root.NewKeyPairSigner(cfg.CleartextSeed)
+	}
+	if cfg.Keystore == "" {
+		return nil, fmt.Errorf("the keystore of the node key isn't set")
+	}
+	kp, err := keystore.Open(cfg.Keystore, cfg.KeystorePassphraseFd)
+	if err != nil {
+		return nil, fmt.Errorf("error opening keystore %s: %v", cfg.Keystore, err)
+	}
+	return root.NewKeyPairSigner(kp.Seed())
+}
+
+// CreateCoSigners opens the keystores and connects to the co-signing endpoints of the co-signers,
+// the requests to the endpoints are authorized by the node signer
+func CreateCoSigners(cfg config.RootApiConfig, node root.Signer) ([]root.Signer, error) {
+	coSigners := make([]root.Signer, 0, len(cfg.CoSigners))
+	for _, coSignerCfg := range cfg.CoSigners {
+		if coSignerCfg.Url != "" {
+			coSigner, err := root.NewHttpSigner(coSignerCfg.Url, node)
+			if err != nil {
+				return nil, fmt.Errorf("error connecting to co-signer %s: %v", coSignerCfg.Url, err)
+			}
+			coSigners = append(coSigners, coSigner)
+			continue
+		}
+		passphraseFd, passphraseEnv := cfg.KeystorePassphraseFd, keystore.PassphraseEnv
+		if coSignerCfg.PassphraseEnv != "" {
+			passphraseFd, passphraseEnv = 0, coSignerCfg.PassphraseEnv
+		}
+		kp, err := keystore.OpenWithEnv(coSignerCfg.Keystore, passphraseFd, passphraseEnv)
+		if err != nil {
+			return nil, fmt.Errorf("error opening keystore %s: %v", coSignerCfg.Keystore, err)
+		}
+		coSigner, err := root.NewKeyPairSigner(kp.Seed())
+		if err != nil {
+			return nil, err
+		}
+		coSigners = append(coSigners, coSigner)
+	}
+	return coSigners, nil
+}
+
+// OpenChannelKeyPairs opens the keystores of the channel accounts
+func OpenChannelKeyPairs(cfg config.RootApiConfig) ([]*keypair.Full, error) {
+	keyPairs := make([]*keypair.Full, 0, len(cfg.ChannelKeystores))
+	for _, file := range cfg.ChannelKeystores {
+		kp, err := keystore.Open(file, cfg.KeystorePassphraseFd)
+		if err != nil {
+			return nil, fmt.Errorf("error opening keystore %s: %v", file, err)
+		}
+		keyPairs = append(keyPairs, kp)
+	}
+	return keyPairs, nil
 }
 
 func CreateRootApi(cfg config.RootApiConfig) (root.RootApi, error) {
-	clientFactory := root.CreateRootApiFactory(cfg.UseTestApi)
-	rootClient, err := clientFactory(cfg.Seed, cfg.TransactionValiditySecs)
+	var clientFactory root.SignerRootApiFactory
+	if cfg.UseMemoryLedger {
+		clientFactory = root.CreateSignerRootApiFactoryWithClient(ledger.Default(), ledger.NetworkPassphrase)
+	} else {
+		factory, err := root.CreateSignerRootApiFactoryFromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clientFactory = factory
+	}
+	signer, err := CreateSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+	rootClient, err := clientFactory(signer, cfg.TransactionValiditySecs)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.MaxBaseFee != 0 {
+		rootClient.SetMaxBaseFee(cfg.MaxBaseFee)
+	}
+	if len(cfg.CoSigners) > 0 {
+		coSigners, err := CreateCoSigners(cfg, signer)
+		if err != nil {
+			return nil, err
+		}
+		err = rootClient.SetCoSigners(coSigners)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// Account validation
 	err = rootClient.ValidateForPPNode()
 	if err != nil {
@@ -100,14 +260,50 @@ func CreateRootApi(cfg config.RootApiConfig) (root.RootApi, error) {
 	return rootClient, nil
 }
 
-func TorClientFactory(host string) regestry.CommandClientFactory {
+func TorClientFactory(host string, policy config.CommandConfig) regestry.CommandClientFactory {
 	defaultUrl := fmt.Sprintf("%s/api/command", host)
 	return func(url string, sessionId string, nodeId string) (proxy.CommandClient, proxy.CommandResponseHandler) {
 		if url == "" {
 			log.Printf("Callback url not provided for %s", sessionId)
 			url = defaultUrl
 		}
-		return proxy.NewCommandClient(url, sessionId, nodeId)
+		return proxy.NewCommandClient(url, sessionId, nodeId, policy)
+	}
+}
+
+const grpcUrlScheme = "grpc://"
+
+// GrpcClientFactory sends the commands over grpc streams, a callback url with the grpc scheme
+// (grpc://host:port) overrides the default target. The connections are shared by the sessions.
+func GrpcClientFactory(defaultTarget string, policy config.CommandConfig) regestry.CommandClientFactory {
+	return grpcClientFactory(defaultTarget, policy, func(target string) (*grpc.ClientConn, error) {
+		// Dial doesn't block, connection errors are reported by the commands
+		return grpc.Dial(target, grpc.WithInsecure())
+	})
+}
+
+// grpcClientFactory keeps the connections dial opens, a failed one isn't kept and the commands of the session fail
+func grpcClientFactory(defaultTarget string, policy config.CommandConfig, dial func(target string) (*grpc.ClientConn, error)) regestry.CommandClientFactory {
+	mutex := &sync.Mutex{}
+	connections := make(map[string]*grpc.ClientConn)
+	return func(url string, sessionId string, nodeId string) (proxy.CommandClient, proxy.CommandResponseHandler) {
+		target := defaultTarget
+		if strings.HasPrefix(url, grpcUrlScheme) {
+			target = strings.TrimPrefix(url, grpcUrlScheme)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		conn, ok := connections[target]
+		if !ok {
+			var err error
+			conn, err = dial(target)
+			if err != nil {
+				log.Printf("Error connecting to %s for session %s: %v", target, sessionId, err)
+				return proxy.NewFailedCommandClient(fmt.Errorf("error connecting to %s: %v", target, err))
+			}
+			connections[target] = conn
+		}
+		return proxy.NewGrpcCommandClient(conn, sessionId, nodeId, policy)
 	}
 }
 
@@ -0,0 +1,35 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+)
+
+func TestGrpcClientFactoryDialError(t *testing.T) {
+	dials := 0
+	dialErr := errors.New("dial refused")
+	factory := grpcClientFactory("localhost:1", config.CommandConfig{}, func(target string) (*grpc.ClientConn, error) {
+		dials++
+		if dials == 1 {
+			return nil, dialErr
+		}
+		return grpc.Dial(target, grpc.WithInsecure())
+	})
+
+	client, handler := factory("", "session", "node")
+	_, err := client.CreateTransaction(context.Background(), &models.CreateTransactionCommand{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "dial refused")
+	assert.Error(t, handler.ProcessResponse(context.Background(), &models.UtilityResponse{}))
+
+	// The failed connection isn't kept, the next session dials again and the connection is shared afterwards
+	factory("", "session2", "node")
+	factory("", "session3", "node")
+	assert.Equal(t, 2, dials)
+}
@@ -0,0 +1,150 @@
+package paymentregestry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/support/log"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+)
+
+// Replies are kept long enough to cover the retries of a payment session
+const commandJournalRetention = 24 * time.Hour
+
+// CommandJournal makes the commands idempotent: a command id is executed once,
+// a repeated command gets the reply of the first execution
+type CommandJournal interface {
+	Process(cmd *models.UtilityCommand, handler func() (models.OutCommandType, error)) (models.OutCommandType, error)
+	// Prune drops the replies older than the retention
+	Prune(now time.Time) error
+}
+
+type commandJournal struct {
+	db          database.Db
+	nodeAddress string
+	mutex       sync.Mutex
+	inProgress  map[string]chan struct{}
+}
+
+func NewCommandJournal(db database.Db, nodeAddress string) CommandJournal {
+	j := &commandJournal{
+		db:          db,
+		nodeAddress: nodeAddress,
+		inProgress:  map[string]chan struct{}{},
+	}
+	err := j.Prune(time.Now())
+	if err != nil {
+		log.Errorf("Error pruning command journal of node %s: %v", nodeAddress, err)
+	}
+	return j
+}
+
+func (j *commandJournal) Prune(now time.Time) error {
+	return j.db.DeleteCommandsBefore(j.nodeAddress, now.Add(-commandJournalRetention))
+}
+
+// lock waits for a concurrent execution of the same command id to complete
+func (j *commandJournal) lock(commandId string) {
+	for {
+		j.mutex.Lock()
+		done, ok := j.inProgress[commandId]
+		if !ok {
+			j.inProgress[commandId] = make(chan struct{})
+			j.mutex.Unlock()
+			return
+		}
+		j.mutex.Unlock()
+		<-done
+	}
+}
+
+func (j *commandJournal) unlock(commandId string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	close(j.inProgress[commandId])
+	delete(j.inProgress, commandId)
+}
+
+// commandBodyHash hashes the body without its trace context, which differs between the runs of a resumed payment
+func commandBodyHash(cmd *models.UtilityCommand) (string, error) {
+	bs, err := json.Marshal(cmd.CommandBody)
+	if err != nil {
+		return "", err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(bs, &fields)
+	if err != nil {
+		return "", err
+	}
+	delete(fields, "context")
+	bs, err = json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(bs)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Process executes the handler unless the command id is in the journal. Failed commands
+// aren't recorded so they can be retried, a reused id with another body is rejected.
+func (j *commandJournal) Process(cmd *models.UtilityCommand, handler func() (models.OutCommandType, error)) (models.OutCommandType, error) {
+	commandId := cmd.CommandId
+	if commandId == "" {
+		return handler()
+	}
+	hash, err := commandBodyHash(cmd)
+	if err != nil {
+		return nil, err
+	}
+	j.lock(commandId)
+	defer j.unlock(commandId)
+
+	stored, err := j.db.SelectCommand(j.nodeAddress, commandId)
+	if err != nil {
+		return nil, fmt.Errorf("error reading command journal: %v", err)
+	}
+	if stored != nil {
+		if stored.BodyHash != hash || models.CommandType(stored.CommandType) != cmd.CommandType {
+			return nil, fmt.Errorf("command id %s reused with a different command", commandId)
+		}
+		reply, err := models.CommandType_CommandResponse(cmd.CommandType)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(stored.Response), reply)
+		if err != nil {
+			return nil, fmt.Errorf("error reading stored reply of command %s: %v", commandId, err)
+		}
+		log.Infof("Duplicate command %s (%s) of session %s, returning the stored reply", commandId, cmd.CommandType, cmd.SessionId)
+		return reply, nil
+	}
+
+	reply, err := handler()
+	if err != nil {
+		return nil, err
+	}
+	response, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	err = j.db.InsertCommand(&entity.DbCommand{
+		NodeAddress: j.nodeAddress,
+		CommandId:   commandId,
+		CommandType: int(cmd.CommandType),
+		SessionId:   cmd.SessionId,
+		BodyHash:    hash,
+		Response:    string(response),
+		Date:        time.Now(),
+	})
+	if err != nil {
+		// The command was executed, its reply is still returned
+		log.Errorf("Error recording command %s in the journal: %v", commandId, err)
+	}
+	return reply, nil
+}
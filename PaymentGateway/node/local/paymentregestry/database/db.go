@@ -25,5 +25,22 @@ type Db interface {
 	SelectPaymentRequestById(id int) (*entity.DbPaymentRequest, error)
 	InsertTransaction(item *entity.DbTransactoin) error
 	SelectTransaction() ([]*entity.DbTransactoin, error)
+	SelectTransactionsByStatus(nodeAddress string, status string) ([]*entity.DbTransactoin, error)
+	UpdateTransactionStatus(nodeAddress string, paymentSourceAddress string, serviceSessionId string, status string, updateDate time.Time) error
+	RevokeTransaction(nodeAddress string, paymentSourceAddress string, serviceSessionId string, referenceSessionId string, updateDate time.Time) (bool, error)
 	SelectPaymentRequestGroup(comodity string, group time.Duration, where time.Time) ([]*models.BookHistoryItem, error)
+	InsertPaymentSession(item *entity.DbPaymentSession) error
+	UpdatePaymentSessionState(nodeAddress string, serviceSessionId string, state string, route string, transactions string, failedHops string, sessionError string, updateDate time.Time) error
+	SelectPaymentSessions(nodeAddress string, excludeStates ...string) ([]*entity.DbPaymentSession, error)
+	InsertCommand(item *entity.DbCommand) error
+	SelectCommand(nodeAddress string, commandId string) (*entity.DbCommand, error)
+	DeleteCommandsBefore(nodeAddress string, date time.Time) error
+	InsertFlushReport(item *entity.DbFlushReport) error
+	SelectFlushReports(nodeAddress string, limit int) ([]*entity.DbFlushReport, error)
+	SelectFlushReport(nodeAddress string, id int) (*entity.DbFlushReport, error)
+	SaveSequenceState(item *entity.DbSequenceState) error
+	SelectSequenceState(nodeAddress string) (*entity.DbSequenceState, error)
+	InsertNonce(item *entity.DbNonce) (bool, error)
+	DeleteNonce(nodeAddress string, serviceAddress string, nonce string) error
+	DeleteNoncesExpiredBefore(nodeAddress string, date time.Time) error
 }
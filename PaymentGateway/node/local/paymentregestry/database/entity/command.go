@@ -0,0 +1,16 @@
+package entity
+
+import (
+	"time"
+)
+
+type DbCommand struct {
+	Id          int
+	NodeAddress string
+	CommandId   string
+	CommandType int
+	SessionId   string
+	BodyHash    string
+	Response    string // json
+	Date        time.Time
+}
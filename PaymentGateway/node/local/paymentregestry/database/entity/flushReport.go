@@ -0,0 +1,13 @@
+package entity
+
+import (
+	"time"
+)
+
+type DbFlushReport struct {
+	Id          int
+	NodeAddress string
+	Trigger     string
+	Report      string // json
+	Date        time.Time
+}
@@ -0,0 +1,9 @@
+package entity
+
+type DbNonce struct {
+	Id             int
+	NodeAddress    string
+	ServiceAddress string
+	Nonce          string
+	ExpiresAt      int64 // unix time of the payment request expiry
+}
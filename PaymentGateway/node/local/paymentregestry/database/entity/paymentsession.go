@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"time"
+)
+
+type DbPaymentSession struct {
+	Id                 int
+	NodeAddress        string
+	ServiceSessionId   string
+	State              string
+	Request            string // json
+	Route              string // json
+	CommandCallbackUrl string
+	StatusCallbackUrls string // json
+	Transactions       string // json
+	Error              string
+	FailedHops         string // json
+	Date               time.Time
+	UpdateDate         time.Time
+}
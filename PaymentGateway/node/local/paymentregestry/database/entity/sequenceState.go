@@ -0,0 +1,12 @@
+package entity
+
+import (
+	"time"
+)
+
+type DbSequenceState struct {
+	NodeAddress   string
+	HighWaterMark int64
+	Unsubmitted   string // json
+	UpdateDate    time.Time
+}
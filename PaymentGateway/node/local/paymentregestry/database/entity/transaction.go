@@ -1,5 +1,9 @@
 package entity
 
+import (
+	"time"
+)
+
 type DbTransactoin struct {
 	Id                        int
 	Sequence                  int64
@@ -11,4 +15,8 @@ type DbTransactoin struct {
 	PaymentDestinationAddress string
 	StellarNetworkToken       string
 	ServiceSessionId          string
+	NodeAddress               string
+	Status                    string
+	Date                      time.Time
+	UpdateDate                time.Time
 }
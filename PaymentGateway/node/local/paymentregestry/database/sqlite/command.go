@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+)
+
+func (prdb *liteDb) createTableCommand() error {
+	err := prdb.exec(`
+	CREATE TABLE IF NOT EXISTS CommandJournal (
+		Id 					INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		NodeAddress 		TEXT NOT NULL,
+		CommandId 			TEXT NOT NULL,
+		CommandType 		INTEGER NOT NULL,
+		SessionId 			TEXT NOT NULL,
+		BodyHash 			TEXT NOT NULL,
+		Response 			TEXT NOT NULL,
+		Date 				LONG NOT NULL,
+		UNIQUE(NodeAddress, CommandId)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+	// The replies are pruned by date
+	return prdb.exec(`CREATE INDEX IF NOT EXISTS CommandJournalDate ON CommandJournal (NodeAddress, Date)`)
+}
+
+func (prdb *liteDb) InsertCommand(item *entity.DbCommand) error {
+	stmt, err := prdb.db.Prepare(`INSERT INTO CommandJournal (
+		NodeAddress,
+		CommandId,
+		CommandType,
+		SessionId,
+		BodyHash,
+		Response,
+		Date
+	)
+	VALUES (
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?
+	);
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(
+		item.NodeAddress,
+		item.CommandId,
+		item.CommandType,
+		item.SessionId,
+		item.BodyHash,
+		item.Response,
+		item.Date,
+	)
+	return err
+}
+
+// SelectCommand returns nil if the command isn't in the journal
+func (prdb *liteDb) SelectCommand(nodeAddress string, commandId string) (*entity.DbCommand, error) {
+	query := `SELECT Id,
+					NodeAddress,
+					CommandId,
+					CommandType,
+					SessionId,
+					BodyHash,
+					Response,
+					Date
+				FROM CommandJournal WHERE NodeAddress=? AND CommandId=?;
+	`
+	item := &entity.DbCommand{}
+	var date SqlTime
+	err := prdb.db.QueryRow(query, nodeAddress, commandId).Scan(
+		&item.Id,
+		&item.NodeAddress,
+		&item.CommandId,
+		&item.CommandType,
+		&item.SessionId,
+		&item.BodyHash,
+		&item.Response,
+		&date,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	item.Date = time.Time(date)
+	return item, nil
+}
+
+func (prdb *liteDb) DeleteCommandsBefore(nodeAddress string, date time.Time) error {
+	_, err := prdb.db.Exec(`DELETE FROM CommandJournal WHERE NodeAddress=? AND Date<?;`, nodeAddress, date)
+	return err
+}
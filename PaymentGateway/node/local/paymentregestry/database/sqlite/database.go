@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"database/sql"
+	"fmt"
 	"sync"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -28,10 +29,7 @@ func (prdb *liteDb) init() error {
 	}
 	err = prdb.createTables()
 	if err != nil {
-		return err
-	}
-	err = prdb.Close()
-	if err != nil {
+		prdb.Close()
 		return err
 	}
 	return nil
@@ -46,6 +44,26 @@ func (prdb *liteDb) createTables() error {
 	if err != nil {
 		return err
 	}
+	err = prdb.createTablePaymentSession()
+	if err != nil {
+		return err
+	}
+	err = prdb.createTableCommand()
+	if err != nil {
+		return err
+	}
+	err = prdb.createTableFlushReport()
+	if err != nil {
+		return err
+	}
+	err = prdb.createTableSequenceState()
+	if err != nil {
+		return err
+	}
+	err = prdb.createTableNonce()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -57,7 +75,45 @@ func (prdb *liteDb) exec(sql string) error {
 	return nil
 }
 
+// addColumnIfNotExists migrates tables created before the column was introduced
+func (prdb *liteDb) addColumnIfNotExists(table string, column string, definition string) error {
+	res, err := prdb.db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	columns, err := res.Columns()
+	if err != nil {
+		return err
+	}
+	for res.Next() {
+		values := make([]interface{}, len(columns))
+		var name string
+		for i := range values {
+			values[i] = new(interface{})
+		}
+		// table_info columns: cid, name, type, notnull, dflt_value, pk
+		values[1] = &name
+		err = res.Scan(values...)
+		if err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err = res.Err(); err != nil {
+		return err
+	}
+	res.Close()
+	return prdb.exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+}
+
+// Open connects to the database file, the connection is kept until Close is called
 func (prdb *liteDb) Open() error {
+	if prdb.db != nil {
+		return nil
+	}
 	db, err := sql.Open("sqlite3", "./db.db") // "file:locked.sqlite?cache=shared")
 	if err != nil {
 		return err
@@ -69,7 +125,9 @@ func (prdb *liteDb) Open() error {
 
 func (prdb *liteDb) Close() error {
 	if prdb.db != nil {
-		prdb.db.Close()
+		err := prdb.db.Close()
+		prdb.db = nil
+		return err
 	}
 	return nil
 }
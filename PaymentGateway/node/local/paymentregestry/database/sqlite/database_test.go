@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/rs/xid"
 	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
 )
 
@@ -44,3 +45,220 @@ func TestSelect(t *testing.T) {
 		t.Errorf("Select count is null")
 	}
 }
+
+func TestPaymentSession(t *testing.T) {
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeAddress := xid.New().String()
+	now := time.Now()
+	for _, id := range []string{"first", "second"} {
+		err = db.InsertPaymentSession(&entity.DbPaymentSession{
+			NodeAddress:        nodeAddress,
+			ServiceSessionId:   id,
+			State:              "initiated",
+			Request:            "{}",
+			Route:              "[]",
+			StatusCallbackUrls: "[]",
+			Transactions:       "null",
+			FailedHops:         "[]",
+			Date:               now,
+			UpdateDate:         now,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.InsertPaymentSession(&entity.DbPaymentSession{
+		NodeAddress:      nodeAddress,
+		ServiceSessionId: "first",
+		Date:             now,
+		UpdateDate:       now,
+	})
+	if err == nil {
+		t.Error("duplicate session inserted")
+	}
+
+	err = db.UpdatePaymentSessionState(nodeAddress, "second", "committed", "[]", "[]", "[]", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := db.SelectPaymentSessions(nodeAddress, "committed", "failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ServiceSessionId != "first" || items[0].State != "initiated" {
+		t.Errorf("unexpected sessions: %v", items)
+	}
+}
+
+func TestTransactionStatus(t *testing.T) {
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeAddress := xid.New().String()
+	now := time.Now()
+	for i, id := range []string{"first", "second"} {
+		err = db.InsertTransaction(&entity.DbTransactoin{
+			Sequence:             int64(i + 1),
+			XDR:                  "XDR",
+			PaymentSourceAddress: "payer",
+			ServiceSessionId:     id,
+			NodeAddress:          nodeAddress,
+			Status:               "active",
+			Date:                 now,
+			UpdateDate:           now,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := db.SelectTransactionsByStatus(nodeAddress, "active")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ServiceSessionId != "second" || items[0].Sequence != 2 {
+		t.Fatalf("unexpected active transactions: %v", items)
+	}
+	items, err = db.SelectTransactionsByStatus(nodeAddress, "replaced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ServiceSessionId != "first" {
+		t.Fatalf("unexpected replaced transactions: %v", items)
+	}
+
+	err = db.UpdateTransactionStatus(nodeAddress, "payer", "second", "submitted", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err = db.SelectTransactionsByStatus(nodeAddress, "active")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("unexpected active transactions: %v", items)
+	}
+}
+
+func TestCommandJournal(t *testing.T) {
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeAddress := xid.New().String()
+	item := &entity.DbCommand{
+		NodeAddress: nodeAddress,
+		CommandId:   "command",
+		CommandType: 1,
+		SessionId:   "session",
+		BodyHash:    "hash",
+		Response:    "{}",
+		Date:        time.Now().Add(-time.Hour),
+	}
+	err = db.InsertCommand(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.InsertCommand(item) == nil {
+		t.Fatal("duplicate command id accepted")
+	}
+	stored, err := db.SelectCommand(nodeAddress, "command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.BodyHash != "hash" || stored.Response != "{}" || stored.CommandType != 1 {
+		t.Fatalf("unexpected command: %v", stored)
+	}
+	err = db.DeleteCommandsBefore(nodeAddress, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err = db.SelectCommand(nodeAddress, "command")
+	if err != nil || stored != nil {
+		t.Fatalf("command not deleted: %v %v", stored, err)
+	}
+}
+
+func TestNonce(t *testing.T) {
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeAddress := xid.New().String()
+	now := time.Now()
+	item := &entity.DbNonce{
+		NodeAddress:    nodeAddress,
+		ServiceAddress: "service",
+		Nonce:          "nonce",
+		ExpiresAt:      now.Add(time.Minute).Unix(),
+	}
+	inserted, err := db.InsertNonce(item)
+	if err != nil || !inserted {
+		t.Fatalf("nonce not inserted: %v", err)
+	}
+	inserted, err = db.InsertNonce(item)
+	if err != nil || inserted {
+		t.Fatalf("duplicate nonce accepted: %v", err)
+	}
+	// The nonces are by service
+	inserted, err = db.InsertNonce(&entity.DbNonce{NodeAddress: nodeAddress, ServiceAddress: "other", Nonce: "nonce", ExpiresAt: item.ExpiresAt})
+	if err != nil || !inserted {
+		t.Fatalf("nonce of another service not inserted: %v", err)
+	}
+
+	err = db.DeleteNoncesExpiredBefore(nodeAddress, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted, _ = db.InsertNonce(item); inserted {
+		t.Fatal("unexpired nonce pruned")
+	}
+	err = db.DeleteNoncesExpiredBefore(nodeAddress, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted, _ = db.InsertNonce(item); !inserted {
+		t.Fatal("expired nonce not pruned")
+	}
+
+	err = db.DeleteNonce(nodeAddress, "service", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted, _ = db.InsertNonce(item); !inserted {
+		t.Fatal("released nonce not deleted")
+	}
+}
+
+func TestSequenceState(t *testing.T) {
+	db, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeAddress := xid.New().String()
+	stored, err := db.SelectSequenceState(nodeAddress)
+	if err != nil || stored != nil {
+		t.Fatalf("unexpected sequence state: %v %v", stored, err)
+	}
+	for _, highWaterMark := range []int64{10, 12} {
+		err = db.SaveSequenceState(&entity.DbSequenceState{
+			NodeAddress:   nodeAddress,
+			HighWaterMark: highWaterMark,
+			Unsubmitted:   "[11,12]",
+			UpdateDate:    time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored, err = db.SelectSequenceState(nodeAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.HighWaterMark != 12 || stored.Unsubmitted != "[11,12]" {
+		t.Fatalf("unexpected sequence state: %v", stored)
+	}
+}
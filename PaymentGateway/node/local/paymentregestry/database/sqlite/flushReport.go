@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+)
+
+func (prdb *liteDb) createTableFlushReport() error {
+	return prdb.exec(`
+	CREATE TABLE IF NOT EXISTS FlushReport (
+		Id 					INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		NodeAddress 		TEXT NOT NULL,
+		Trigger 			TEXT NOT NULL,
+		Report 				TEXT NOT NULL,
+		Date 				LONG NOT NULL
+	)
+	`)
+}
+
+func (prdb *liteDb) InsertFlushReport(item *entity.DbFlushReport) error {
+	stmt, err := prdb.db.Prepare(`INSERT INTO FlushReport (
+		NodeAddress,
+		Trigger,
+		Report,
+		Date
+	)
+	VALUES (
+		?,
+		?,
+		?,
+		?
+	);
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(
+		item.NodeAddress,
+		item.Trigger,
+		item.Report,
+		item.Date,
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	item.Id = int(id)
+	return nil
+}
+
+// SelectFlushReports returns the latest reports of the node first, limit isn't applied if it isn't positive
+func (prdb *liteDb) SelectFlushReports(nodeAddress string, limit int) ([]*entity.DbFlushReport, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	query := `SELECT Id,
+					NodeAddress,
+					Trigger,
+					Report,
+					Date
+				FROM FlushReport WHERE NodeAddress=? ORDER BY Id DESC LIMIT ?;
+	`
+	res, err := prdb.db.Query(query, nodeAddress, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	items := []*entity.DbFlushReport{}
+	for res.Next() {
+		item := &entity.DbFlushReport{}
+		var date SqlTime
+		err = res.Scan(
+			&item.Id,
+			&item.NodeAddress,
+			&item.Trigger,
+			&item.Report,
+			&date,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.Date = time.Time(date)
+		items = append(items, item)
+	}
+	return items, res.Err()
+}
+
+func (prdb *liteDb) SelectFlushReport(nodeAddress string, id int) (*entity.DbFlushReport, error) {
+	query := `SELECT Id,
+					NodeAddress,
+					Trigger,
+					Report,
+					Date
+				FROM FlushReport WHERE NodeAddress=? AND Id=?;
+	`
+	item := &entity.DbFlushReport{}
+	var date SqlTime
+	err := prdb.db.QueryRow(query, nodeAddress, id).Scan(
+		&item.Id,
+		&item.NodeAddress,
+		&item.Trigger,
+		&item.Report,
+		&date,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	item.Date = time.Time(date)
+	return item, nil
+}
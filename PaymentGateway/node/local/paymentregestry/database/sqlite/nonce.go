@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"time"
+
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+)
+
+func (prdb *liteDb) createTableNonce() error {
+	err := prdb.exec(`
+	CREATE TABLE IF NOT EXISTS PaymentRequestNonce (
+		Id 					INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		NodeAddress 		TEXT NOT NULL,
+		ServiceAddress 		TEXT NOT NULL,
+		Nonce 				TEXT NOT NULL,
+		ExpiresAt 			LONG NOT NULL,
+		UNIQUE(NodeAddress, ServiceAddress, Nonce)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+	// The nonces are pruned by expiry
+	return prdb.exec(`CREATE INDEX IF NOT EXISTS PaymentRequestNonceExpiry ON PaymentRequestNonce (NodeAddress, ExpiresAt)`)
+}
+
+// InsertNonce returns false if the nonce of the service is already stored
+func (prdb *liteDb) InsertNonce(item *entity.DbNonce) (bool, error) {
+	res, err := prdb.db.Exec(`INSERT OR IGNORE INTO PaymentRequestNonce (
+		NodeAddress,
+		ServiceAddress,
+		Nonce,
+		ExpiresAt
+	)
+	VALUES (
+		?,
+		?,
+		?,
+		?
+	);`,
+		item.NodeAddress,
+		item.ServiceAddress,
+		item.Nonce,
+		item.ExpiresAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+func (prdb *liteDb) DeleteNonce(nodeAddress string, serviceAddress string, nonce string) error {
+	_, err := prdb.db.Exec(`DELETE FROM PaymentRequestNonce WHERE NodeAddress=? AND ServiceAddress=? AND Nonce=?;`,
+		nodeAddress, serviceAddress, nonce)
+	return err
+}
+
+// DeleteNoncesExpiredBefore drops the nonces of the payment requests which expired before date
+func (prdb *liteDb) DeleteNoncesExpiredBefore(nodeAddress string, date time.Time) error {
+	_, err := prdb.db.Exec(`DELETE FROM PaymentRequestNonce WHERE NodeAddress=? AND ExpiresAt<=?;`, nodeAddress, date.Unix())
+	return err
+}
@@ -0,0 +1,166 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+)
+
+func (prdb *liteDb) createTablePaymentSession() error {
+	err := prdb.exec(`
+	CREATE TABLE IF NOT EXISTS PaymentSession (
+		Id 					INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		NodeAddress 		TEXT NOT NULL,
+		ServiceSessionId 	TEXT NOT NULL,
+		State 				TEXT NOT NULL,
+		Request 			TEXT NOT NULL,
+		Route 				TEXT NOT NULL,
+		CommandCallbackUrl 	TEXT NOT NULL,
+		StatusCallbackUrls 	TEXT NOT NULL,
+		Transactions 		TEXT NOT NULL,
+		Error 				TEXT NOT NULL,
+		FailedHops 			TEXT NOT NULL DEFAULT '[]',
+		Date 				LONG NOT NULL,
+		UpdateDate 			LONG NOT NULL,
+		UNIQUE(NodeAddress, ServiceSessionId)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+	err = prdb.addColumnIfNotExists("PaymentSession", "FailedHops", "TEXT NOT NULL DEFAULT '[]'")
+	if err != nil {
+		return err
+	}
+	// The unfinished sessions are selected by state
+	return prdb.exec(`CREATE INDEX IF NOT EXISTS PaymentSessionState ON PaymentSession (NodeAddress, State)`)
+}
+
+func (prdb *liteDb) InsertPaymentSession(item *entity.DbPaymentSession) error {
+	stmt, err := prdb.db.Prepare(`INSERT INTO PaymentSession (
+		NodeAddress,
+		ServiceSessionId,
+		State,
+		Request,
+		Route,
+		CommandCallbackUrl,
+		StatusCallbackUrls,
+		Transactions,
+		Error,
+		FailedHops,
+		Date,
+		UpdateDate
+	)
+	VALUES (
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?,
+		?
+	);
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(
+		item.NodeAddress,
+		item.ServiceSessionId,
+		item.State,
+		item.Request,
+		item.Route,
+		item.CommandCallbackUrl,
+		item.StatusCallbackUrls,
+		item.Transactions,
+		item.Error,
+		item.FailedHops,
+		item.Date,
+		item.UpdateDate,
+	)
+	return err
+}
+
+func (prdb *liteDb) UpdatePaymentSessionState(nodeAddress string, serviceSessionId string,
+	state string, route string, transactions string, failedHops string, sessionError string, updateDate time.Time) error {
+	query := `UPDATE PaymentSession set State=?, Route=?, Transactions=?, FailedHops=?, Error=?, UpdateDate=?
+	WHERE NodeAddress=? AND ServiceSessionId=?;
+	`
+	stmt, err := prdb.db.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(state, route, transactions, failedHops, sessionError, updateDate, nodeAddress, serviceSessionId)
+	return err
+}
+
+// SelectPaymentSessions returns the sessions of the node except the ones in the excluded (final) states
+func (prdb *liteDb) SelectPaymentSessions(nodeAddress string, excludeStates ...string) ([]*entity.DbPaymentSession, error) {
+	query := `SELECT Id,
+					NodeAddress,
+					ServiceSessionId,
+					State,
+					Request,
+					Route,
+					CommandCallbackUrl,
+					StatusCallbackUrls,
+					Transactions,
+					Error,
+					FailedHops,
+					Date,
+					UpdateDate
+				FROM PaymentSession WHERE NodeAddress=?%s
+				ORDER BY Id;
+	`
+	args := []interface{}{nodeAddress}
+	filter := ""
+	if len(excludeStates) > 0 {
+		filter = " AND State NOT IN (?" + strings.Repeat(", ?", len(excludeStates)-1) + ")"
+		for _, state := range excludeStates {
+			args = append(args, state)
+		}
+	}
+	res, err := prdb.db.Query(fmt.Sprintf(query, filter), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var items []*entity.DbPaymentSession
+	for res.Next() {
+		item := &entity.DbPaymentSession{}
+		var date SqlTime
+		var updateDate SqlTime
+		err := res.Scan(
+			&item.Id,
+			&item.NodeAddress,
+			&item.ServiceSessionId,
+			&item.State,
+			&item.Request,
+			&item.Route,
+			&item.CommandCallbackUrl,
+			&item.StatusCallbackUrls,
+			&item.Transactions,
+			&item.Error,
+			&item.FailedHops,
+			&date,
+			&updateDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.Date = time.Time(date)
+		item.UpdateDate = time.Time(updateDate)
+		items = append(items, item)
+	}
+	return items, nil
+}
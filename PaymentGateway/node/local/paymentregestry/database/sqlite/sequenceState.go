@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+)
+
+func (prdb *liteDb) createTableSequenceState() error {
+	return prdb.exec(`
+	CREATE TABLE IF NOT EXISTS SequenceState (
+		NodeAddress 		TEXT NOT NULL PRIMARY KEY,
+		HighWaterMark 		LONG NOT NULL,
+		Unsubmitted 		TEXT NOT NULL,
+		UpdateDate 			LONG NOT NULL
+	)
+	`)
+}
+
+// SaveSequenceState replaces the sequence state of the node
+func (prdb *liteDb) SaveSequenceState(item *entity.DbSequenceState) error {
+	stmt, err := prdb.db.Prepare(`INSERT OR REPLACE INTO SequenceState (
+		NodeAddress,
+		HighWaterMark,
+		Unsubmitted,
+		UpdateDate
+	)
+	VALUES (
+		?,
+		?,
+		?,
+		?
+	);
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(
+		item.NodeAddress,
+		item.HighWaterMark,
+		item.Unsubmitted,
+		item.UpdateDate,
+	)
+	return err
+}
+
+// SelectSequenceState returns nil if the state of the node wasn't saved
+func (prdb *liteDb) SelectSequenceState(nodeAddress string) (*entity.DbSequenceState, error) {
+	query := `SELECT NodeAddress,
+					HighWaterMark,
+					Unsubmitted,
+					UpdateDate
+				FROM SequenceState WHERE NodeAddress=?;
+	`
+	item := &entity.DbSequenceState{}
+	var date SqlTime
+	err := prdb.db.QueryRow(query, nodeAddress).Scan(
+		&item.NodeAddress,
+		&item.HighWaterMark,
+		&item.Unsubmitted,
+		&date,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	item.UpdateDate = time.Time(date)
+	return item, nil
+}
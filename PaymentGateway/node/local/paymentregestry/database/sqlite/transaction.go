@@ -2,12 +2,14 @@ package sqlite
 
 import (
 	"log"
+	"time"
 
+	"paidpiper.com/payment-gateway/models"
 	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
 )
 
 func (prdb *liteDb) createTableTransaction() error {
-	return prdb.exec(`
+	err := prdb.exec(`
 	CREATE TABLE IF NOT EXISTS Transactoin (
 		Id 							INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
 		Sequence                  	INTEGER NOT NULL,
@@ -18,16 +20,46 @@ func (prdb *liteDb) createTableTransaction() error {
 		PaymentSourceAddress      	TEXT NOT NULL,
 		PaymentDestinationAddress 	TEXT NOT NULL,
 		StellarNetworkToken       	TEXT NOT NULL,
-		ServiceSessionId          	TEXT  NOT NULL
+		ServiceSessionId          	TEXT  NOT NULL,
+		NodeAddress 				TEXT NOT NULL DEFAULT '',
+		Status 						TEXT NOT NULL DEFAULT '',
+		Date 						LONG NOT NULL DEFAULT '',
+		UpdateDate 					LONG NOT NULL DEFAULT ''
 	)
 `)
+	if err != nil {
+		return err
+	}
+	// Tables created by earlier versions only have the transaction columns,
+	// their rows get an empty status and are never loaded as active
+	for _, column := range []string{"NodeAddress", "Status", "Date", "UpdateDate"} {
+		err = prdb.addColumnIfNotExists("Transactoin", column, "TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// InsertTransaction stores the transaction as the active one of its payment source,
+// the previously active transaction of the same source is marked replaced
 func (prdb *liteDb) InsertTransaction(item *entity.DbTransactoin) error {
 	tx, err := prdb.db.Begin()
 	if err != nil {
 		log.Fatal(err)
 	}
+	_, err = tx.Exec(`UPDATE Transactoin set Status=?, UpdateDate=?
+		WHERE NodeAddress=? AND PaymentSourceAddress=? AND Status=?;`,
+		string(models.TransactionStatusReplaced),
+		item.Date,
+		item.NodeAddress,
+		item.PaymentSourceAddress,
+		string(models.TransactionStatusActive),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 	stmt, err := tx.Prepare(`INSERT INTO Transactoin (
 		Sequence,
 		TransactionSourceAddress,
@@ -37,7 +69,11 @@ func (prdb *liteDb) InsertTransaction(item *entity.DbTransactoin) error {
 		PaymentSourceAddress,
 		PaymentDestinationAddress,
 		StellarNetworkToken,
-		ServiceSessionId
+		ServiceSessionId,
+		NodeAddress,
+		Status,
+		Date,
+		UpdateDate
 	)
 	VALUES (
 		?,
@@ -48,6 +84,10 @@ func (prdb *liteDb) InsertTransaction(item *entity.DbTransactoin) error {
 		?,
 		?,
 		?,
+		?,
+		?,
+		?,
+		?,
 		?
 	);
 
@@ -66,16 +106,81 @@ func (prdb *liteDb) InsertTransaction(item *entity.DbTransactoin) error {
 		item.PaymentDestinationAddress,
 		item.StellarNetworkToken,
 		item.ServiceSessionId,
+		item.NodeAddress,
+		item.Status,
+		item.Date,
+		item.UpdateDate,
 	)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 	return tx.Commit()
 
 }
 
-func (prdb *liteDb) SelectTransaction() ([]*entity.DbTransactoin, error) {
-	query := `
+// UpdateTransactionStatus changes the status of the active transaction of the payment source
+func (prdb *liteDb) UpdateTransactionStatus(nodeAddress string, paymentSourceAddress string, serviceSessionId string,
+	status string, updateDate time.Time) error {
+	query := `UPDATE Transactoin set Status=?, UpdateDate=?
+	WHERE NodeAddress=? AND PaymentSourceAddress=? AND ServiceSessionId=? AND Status=?;
+	`
+	stmt, err := prdb.db.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(status, updateDate, nodeAddress, paymentSourceAddress, serviceSessionId,
+		string(models.TransactionStatusActive))
+	return err
+}
+
+// RevokeTransaction marks the active transaction of the session revoked and activates again the transaction
+// of the reference session it replaced, it returns false if the session has no active transaction
+func (prdb *liteDb) RevokeTransaction(nodeAddress string, paymentSourceAddress string, serviceSessionId string,
+	referenceSessionId string, updateDate time.Time) (bool, error) {
+	tx, err := prdb.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec(`UPDATE Transactoin set Status=?, UpdateDate=?
+		WHERE NodeAddress=? AND PaymentSourceAddress=? AND ServiceSessionId=? AND Status=?;`,
+		string(models.TransactionStatusRevoked),
+		updateDate,
+		nodeAddress,
+		paymentSourceAddress,
+		serviceSessionId,
+		string(models.TransactionStatusActive),
+	)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil || count == 0 {
+		tx.Rollback()
+		return false, err
+	}
+	if referenceSessionId != "" {
+		_, err = tx.Exec(`UPDATE Transactoin set Status=?, UpdateDate=?
+			WHERE Id=(SELECT MAX(Id) FROM Transactoin
+				WHERE NodeAddress=? AND PaymentSourceAddress=? AND ServiceSessionId=? AND Status=?);`,
+			string(models.TransactionStatusActive),
+			updateDate,
+			nodeAddress,
+			paymentSourceAddress,
+			referenceSessionId,
+			string(models.TransactionStatusReplaced),
+		)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+const selectTransactionQuery = `
 		SELECT Id,
 			Sequence,
 			TransactionSourceAddress,
@@ -85,56 +190,58 @@ func (prdb *liteDb) SelectTransaction() ([]*entity.DbTransactoin, error) {
 			PaymentSourceAddress,
 			PaymentDestinationAddress,
 			StellarNetworkToken,
-			ServiceSessionId
-		FROM Transactoin;
-	`
+			ServiceSessionId,
+			NodeAddress,
+			Status,
+			Date,
+			UpdateDate
+		FROM Transactoin`
+
+func (prdb *liteDb) SelectTransaction() ([]*entity.DbTransactoin, error) {
+	return prdb.selectTransactions(selectTransactionQuery + ";")
+}
 
-	res, err := prdb.db.Query(query)
+// SelectTransactionsByStatus returns the transactions of the node in the given status ordered by sequence
+func (prdb *liteDb) SelectTransactionsByStatus(nodeAddress string, status string) ([]*entity.DbTransactoin, error) {
+	return prdb.selectTransactions(selectTransactionQuery+`
+		WHERE NodeAddress=? AND Status=?
+		ORDER BY Sequence, Id;`, nodeAddress, status)
+}
+
+func (prdb *liteDb) selectTransactions(query string, args ...interface{}) ([]*entity.DbTransactoin, error) {
+	res, err := prdb.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Close()
 	var items []*entity.DbTransactoin
 	for res.Next() {
-		var id int
-		var sequence int64
-		var transactionSourceAddress string
-		var referenceAmountIn int
-		var amountOut int
-		var xdr string
-		var paymentSourceAddress string
-		var paymentDestinationAddress string
-		var stellarNetworkToken string
-		var serviceSessionId string
+		item := &entity.DbTransactoin{}
+		var date SqlTime
+		var updateDate SqlTime
 
 		err := res.Scan(
-			&id,
-			&sequence,
-			&transactionSourceAddress,
-			&referenceAmountIn,
-			&amountOut,
-			&xdr,
-			&paymentSourceAddress,
-			&paymentDestinationAddress,
-			&stellarNetworkToken,
-			&serviceSessionId,
+			&item.Id,
+			&item.Sequence,
+			&item.TransactionSourceAddress,
+			&item.ReferenceAmountIn,
+			&item.AmountOut,
+			&item.XDR,
+			&item.PaymentSourceAddress,
+			&item.PaymentDestinationAddress,
+			&item.StellarNetworkToken,
+			&item.ServiceSessionId,
+			&item.NodeAddress,
+			&item.Status,
+			&date,
+			&updateDate,
 		)
 		if err != nil {
 			return nil, err
 		}
-		item := &entity.DbTransactoin{
-			Id:                        id,
-			Sequence:                  sequence,
-			TransactionSourceAddress:  transactionSourceAddress,
-			ReferenceAmountIn:         referenceAmountIn,
-			AmountOut:                 amountOut,
-			XDR:                       xdr,
-			PaymentSourceAddress:      paymentSourceAddress,
-			PaymentDestinationAddress: paymentDestinationAddress,
-			StellarNetworkToken:       stellarNetworkToken,
-			ServiceSessionId:          serviceSessionId,
-		}
+		item.Date = time.Time(date)
+		item.UpdateDate = time.Time(updateDate)
 		items = append(items, item)
 	}
-	return items, nil
+	return items, res.Err()
 }
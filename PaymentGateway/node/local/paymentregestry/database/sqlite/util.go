@@ -16,6 +16,10 @@ func (t *SqlTime) Scan(v interface{}) error {
 	// Should be more strictly to check this type.
 	switch val := v.(type) {
 	case string:
+		if val == "" {
+			*t = SqlTime(time.Time{})
+			return nil
+		}
 		vt, err := time.Parse(sqlForat, val)
 		if err != nil {
 			return err
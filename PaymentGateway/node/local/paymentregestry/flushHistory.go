@@ -0,0 +1,83 @@
+package paymentregestry
+
+import (
+	"encoding/json"
+
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+)
+
+// FlushHistory keeps the reports of the flushes of a node to audit what was settled on-chain
+type FlushHistory interface {
+	Save(report *models.FlushReport) error
+	// List returns the latest reports first, all of them if limit isn't positive
+	List(limit int) ([]*models.FlushReport, error)
+	// Get returns nil if there is no report with the id
+	Get(id int) (*models.FlushReport, error)
+}
+
+type flushHistory struct {
+	db          database.Db
+	nodeAddress string
+}
+
+func NewFlushHistory(db database.Db, nodeAddress string) FlushHistory {
+	return &flushHistory{
+		db:          db,
+		nodeAddress: nodeAddress,
+	}
+}
+
+func (h *flushHistory) Save(report *models.FlushReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	item := &entity.DbFlushReport{
+		NodeAddress: h.nodeAddress,
+		Trigger:     report.Trigger,
+		Report:      string(body),
+		Date:        report.Started,
+	}
+	err = h.db.InsertFlushReport(item)
+	if err != nil {
+		return err
+	}
+	report.Id = item.Id
+	return nil
+}
+
+func (h *flushHistory) List(limit int) ([]*models.FlushReport, error) {
+	items, err := h.db.SelectFlushReports(h.nodeAddress, limit)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]*models.FlushReport, 0, len(items))
+	for _, item := range items {
+		report, err := toFlushReport(item)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (h *flushHistory) Get(id int) (*models.FlushReport, error) {
+	item, err := h.db.SelectFlushReport(h.nodeAddress, id)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return toFlushReport(item)
+}
+
+func toFlushReport(item *entity.DbFlushReport) (*models.FlushReport, error) {
+	report := &models.FlushReport{}
+	err := json.Unmarshal([]byte(item.Report), report)
+	if err != nil {
+		return nil, err
+	}
+	report.Id = item.Id
+	return report, nil
+}
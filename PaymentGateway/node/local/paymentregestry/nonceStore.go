@@ -0,0 +1,44 @@
+package paymentregestry
+
+import (
+	"time"
+
+	"github.com/stellar/go/support/log"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+	"paidpiper.com/payment-gateway/regestry"
+)
+
+type nonceStore struct {
+	db          database.Db
+	nodeAddress string
+}
+
+func NewNonceStore(db database.Db, nodeAddress string) regestry.NonceStore {
+	s := &nonceStore{
+		db:          db,
+		nodeAddress: nodeAddress,
+	}
+	err := s.Prune(time.Now())
+	if err != nil {
+		log.Errorf("Error pruning payment request nonces of node %s: %v", nodeAddress, err)
+	}
+	return s
+}
+
+func (s *nonceStore) Use(serviceAddress string, nonce string, expiresAt int64) (bool, error) {
+	return s.db.InsertNonce(&entity.DbNonce{
+		NodeAddress:    s.nodeAddress,
+		ServiceAddress: serviceAddress,
+		Nonce:          nonce,
+		ExpiresAt:      expiresAt,
+	})
+}
+
+func (s *nonceStore) Release(serviceAddress string, nonce string) error {
+	return s.db.DeleteNonce(s.nodeAddress, serviceAddress, nonce)
+}
+
+func (s *nonceStore) Prune(now time.Time) error {
+	return s.db.DeleteNoncesExpiredBefore(s.nodeAddress, now)
+}
@@ -2,8 +2,11 @@ package paymentregestry
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 
+	"github.com/stellar/go/support/log"
+
 	"paidpiper.com/payment-gateway/models"
 	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
 	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
@@ -11,10 +14,12 @@ import (
 
 type paymentRegistryWithDb struct {
 	PaymentRegistry
-	db database.Db
+	db          database.Db
+	nodeAddress string
 }
 
-func NewWithDB(db database.Db) (PaymentRegistry, error) {
+// NewWithDB creates the registry of the node, the active transactions stored by a previous run are restored
+func NewWithDB(db database.Db, nodeAddress string) (PaymentRegistry, error) {
 	pr, err := New()
 	if err != nil {
 		return nil, err
@@ -23,12 +28,51 @@ func NewWithDB(db database.Db) (PaymentRegistry, error) {
 	regestryWithDb := &paymentRegistryWithDb{
 		PaymentRegistry: pr,
 		db:              db,
+		nodeAddress:     nodeAddress,
+	}
+	transactions, err := regestryWithDb.selectActiveTransactions()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transactions {
+		err = pr.SaveTransaction(t.Sequence, &t.PaymentTransaction)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(transactions) > 0 {
+		log.Infof("Node %s: restored %d active transactions", nodeAddress, len(transactions))
 	}
 
 	return regestryWithDb, nil
 }
+
 func (prdb *paymentRegistryWithDb) LogError(err error) {
-	//TODO TO LOGGER
+	log.Errorf("Payment registry of node %s: %v", prdb.nodeAddress, err)
+}
+
+func (prdb *paymentRegistryWithDb) selectActiveTransactions() ([]*models.PaymentTransactionWithSequence, error) {
+	items, err := prdb.db.SelectTransactionsByStatus(prdb.nodeAddress, string(models.TransactionStatusActive))
+	if err != nil {
+		return nil, err
+	}
+	transactions := []*models.PaymentTransactionWithSequence{}
+	for _, item := range items {
+		transactions = append(transactions, &models.PaymentTransactionWithSequence{
+			PaymentTransaction: models.PaymentTransaction{
+				TransactionSourceAddress:  item.TransactionSourceAddress,
+				ReferenceAmountIn:         models.TransactionAmount(item.ReferenceAmountIn),
+				AmountOut:                 models.TransactionAmount(item.AmountOut),
+				XDR:                       models.NewXDR(item.XDR),
+				PaymentSourceAddress:      item.PaymentSourceAddress,
+				PaymentDestinationAddress: item.PaymentDestinationAddress,
+				StellarNetworkToken:       item.StellarNetworkToken,
+				ServiceSessionId:          item.ServiceSessionId,
+			},
+			Sequence: item.Sequence,
+		})
+	}
+	return transactions, nil
 }
 
 func (prdb *paymentRegistryWithDb) AddServiceUsage(sessionId string, pr *models.PaymentRequest) {
@@ -58,25 +102,61 @@ func (prdb *paymentRegistryWithDb) GetPendingAmount(sourceAddress string) (amoun
 	return prdb.PaymentRegistry.GetPendingAmount(sourceAddress)
 }
 
-func (prdb *paymentRegistryWithDb) SaveTransaction(sequence int64, transaction *models.PaymentTransaction) {
+func (prdb *paymentRegistryWithDb) SaveTransaction(sequence int64, transaction *models.PaymentTransaction) error {
+	now := time.Now()
 	err := prdb.db.InsertTransaction(&entity.DbTransactoin{
-		Sequence: sequence,
+		Sequence:                  sequence,
+		TransactionSourceAddress:  transaction.TransactionSourceAddress,
+		ReferenceAmountIn:         int(transaction.ReferenceAmountIn),
+		AmountOut:                 int(transaction.AmountOut),
+		XDR:                       transaction.XDR.String(),
+		PaymentSourceAddress:      transaction.PaymentSourceAddress,
+		PaymentDestinationAddress: transaction.PaymentDestinationAddress,
+		StellarNetworkToken:       transaction.StellarNetworkToken,
+		ServiceSessionId:          transaction.ServiceSessionId,
+		NodeAddress:               prdb.nodeAddress,
+		Status:                    string(models.TransactionStatusActive),
+		Date:                      now,
+		UpdateDate:                now,
 	})
 	if err != nil {
-		prdb.LogError(err)
+		return fmt.Errorf("error saving transaction of session %s: %v", transaction.ServiceSessionId, err)
 	}
-	prdb.PaymentRegistry.SaveTransaction(sequence, transaction)
+	return prdb.PaymentRegistry.SaveTransaction(sequence, transaction)
 }
 
+// GetActiveTransactions is served from the database, the in-memory registry is only used if it can't be read
 func (prdb *paymentRegistryWithDb) GetActiveTransactions() []*models.PaymentTransactionWithSequence {
-
-	return prdb.PaymentRegistry.GetActiveTransactions()
+	transactions, err := prdb.selectActiveTransactions()
+	if err != nil {
+		prdb.LogError(err)
+		return prdb.PaymentRegistry.GetActiveTransactions()
+	}
+	return transactions
 }
 
-func (prdb *paymentRegistryWithDb) CompletePayment(paymentSourceAddress string, serviceSessionId string) {
-
-	prdb.PaymentRegistry.CompletePayment(paymentSourceAddress, serviceSessionId)
+func (prdb *paymentRegistryWithDb) CompletePayment(paymentSourceAddress string, serviceSessionId string, status models.TransactionStatus) error {
+	err := prdb.db.UpdateTransactionStatus(prdb.nodeAddress, paymentSourceAddress, serviceSessionId, string(status), time.Now())
+	if err != nil {
+		return fmt.Errorf("error completing transaction of session %s: %v", serviceSessionId, err)
+	}
+	return prdb.PaymentRegistry.CompletePayment(paymentSourceAddress, serviceSessionId, status)
+}
 
+func (prdb *paymentRegistryWithDb) RevokeTransaction(transaction *models.PaymentTransaction, reference *models.PaymentTransactionWithSequence) (bool, error) {
+	referenceSessionId := ""
+	if reference != nil {
+		referenceSessionId = reference.ServiceSessionId
+	}
+	revoked, err := prdb.db.RevokeTransaction(prdb.nodeAddress, transaction.PaymentSourceAddress, transaction.ServiceSessionId,
+		referenceSessionId, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("error revoking transaction of session %s: %v", transaction.ServiceSessionId, err)
+	}
+	if !revoked {
+		return false, nil
+	}
+	return prdb.PaymentRegistry.RevokeTransaction(transaction, reference)
 }
 
 func (prdb *paymentRegistryWithDb) GetActiveTransaction(paymentSourceAddress string) *models.PaymentTransaction {
@@ -12,8 +12,9 @@ type PaymentRegistry interface {
 	ReducePendingAmount(sourceAddress string, amount models.TransactionAmount) error
 	GetPendingAmount(sourceAddress string) (amount models.TransactionAmount, ok bool)
 
-	SaveTransaction(sequence int64, transaction *models.PaymentTransaction)
-	CompletePayment(paymentSourceAddress string, serviceSessionId string)
+	SaveTransaction(sequence int64, transaction *models.PaymentTransaction) error
+	CompletePayment(paymentSourceAddress string, serviceSessionId string, status models.TransactionStatus) error
+	RevokeTransaction(transaction *models.PaymentTransaction, reference *models.PaymentTransactionWithSequence) (bool, error)
 
 	GetActiveTransactions() []*models.PaymentTransactionWithSequence
 	GetActiveTransaction(paymentSourceAddress string) *models.PaymentTransaction
@@ -115,7 +116,7 @@ func (r *paymentRegistry) GetPendingAmount(sourceAddress string) (amount models.
 	}
 }
 
-func (r *paymentRegistry) SaveTransaction(sequence int64, transaction *models.PaymentTransaction) {
+func (r *paymentRegistry) SaveTransaction(sequence int64, transaction *models.PaymentTransaction) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
@@ -125,6 +126,7 @@ func (r *paymentRegistry) SaveTransaction(sequence int64, transaction *models.Pa
 	}
 	r.paidTransactionsByAddress[transaction.PaymentSourceAddress] = tr
 	r.paidTransactionsBySessionId[transaction.ServiceSessionId] = tr
+	return nil
 }
 
 func (r *paymentRegistry) GetActiveTransactions() []*models.PaymentTransactionWithSequence {
@@ -138,11 +140,31 @@ func (r *paymentRegistry) GetActiveTransactions() []*models.PaymentTransactionWi
 	return tr
 }
 
-func (r *paymentRegistry) CompletePayment(paymentSourceAddress string, serviceSessionId string) {
+func (r *paymentRegistry) CompletePayment(paymentSourceAddress string, serviceSessionId string, status models.TransactionStatus) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	delete(r.paidTransactionsByAddress, paymentSourceAddress)
 	delete(r.paidTransactionsBySessionId, serviceSessionId)
+	return nil
+}
+
+// RevokeTransaction replaces the active transaction of the session by its reference, or removes it if there's no reference.
+// It returns false if the transaction of the session isn't the active one.
+func (r *paymentRegistry) RevokeTransaction(transaction *models.PaymentTransaction, reference *models.PaymentTransactionWithSequence) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	active, ok := r.paidTransactionsByAddress[transaction.PaymentSourceAddress]
+	if !ok || active.ServiceSessionId != transaction.ServiceSessionId {
+		return false, nil
+	}
+	delete(r.paidTransactionsBySessionId, transaction.ServiceSessionId)
+	if reference == nil {
+		delete(r.paidTransactionsByAddress, transaction.PaymentSourceAddress)
+		return true, nil
+	}
+	r.paidTransactionsByAddress[transaction.PaymentSourceAddress] = reference
+	r.paidTransactionsBySessionId[reference.ServiceSessionId] = reference
+	return true, nil
 }
 
 func (r *paymentRegistry) GetActiveTransaction(paymentSourceAddress string) *models.PaymentTransaction {
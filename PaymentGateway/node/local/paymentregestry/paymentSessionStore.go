@@ -0,0 +1,126 @@
+package paymentregestry
+
+import (
+	"encoding/json"
+	"time"
+
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+	"paidpiper.com/payment-gateway/regestry"
+)
+
+type paymentSessionStore struct {
+	db          database.Db
+	nodeAddress string
+}
+
+func NewPaymentSessionStore(db database.Db, nodeAddress string) regestry.PaymentSessionStore {
+	return &paymentSessionStore{
+		db:          db,
+		nodeAddress: nodeAddress,
+	}
+}
+
+func toJson(v interface{}) (string, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+func (s *paymentSessionStore) Create(session *models.PaymentSession) error {
+	request, err := toJson(session.Request)
+	if err != nil {
+		return err
+	}
+	route, err := toJson(session.Route)
+	if err != nil {
+		return err
+	}
+	statusCallbackUrls, err := toJson(session.StatusCallbackUrls)
+	if err != nil {
+		return err
+	}
+	transactions, err := toJson(session.Transactions)
+	if err != nil {
+		return err
+	}
+	failedHops, err := toJson(session.FailedHops)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return s.db.InsertPaymentSession(&entity.DbPaymentSession{
+		NodeAddress:        s.nodeAddress,
+		ServiceSessionId:   session.ServiceSessionId,
+		State:              string(session.State),
+		Request:            request,
+		Route:              route,
+		CommandCallbackUrl: session.CommandCallbackUrl,
+		StatusCallbackUrls: statusCallbackUrls,
+		Transactions:       transactions,
+		Error:              session.Error,
+		FailedHops:         failedHops,
+		Date:               now,
+		UpdateDate:         now,
+	})
+}
+
+func (s *paymentSessionStore) Update(session *models.PaymentSession) error {
+	route, err := toJson(session.Route)
+	if err != nil {
+		return err
+	}
+	transactions, err := toJson(session.Transactions)
+	if err != nil {
+		return err
+	}
+	failedHops, err := toJson(session.FailedHops)
+	if err != nil {
+		return err
+	}
+	return s.db.UpdatePaymentSessionState(s.nodeAddress, session.ServiceSessionId,
+		string(session.State), route, transactions, failedHops, session.Error, time.Now())
+}
+
+func (s *paymentSessionStore) GetUnfinished() ([]*models.PaymentSession, error) {
+	items, err := s.db.SelectPaymentSessions(s.nodeAddress,
+		string(models.PaymentStateCommitted),
+		string(models.PaymentStateFailed))
+	if err != nil {
+		return nil, err
+	}
+	sessions := []*models.PaymentSession{}
+	for _, item := range items {
+		session := &models.PaymentSession{
+			ServiceSessionId:   item.ServiceSessionId,
+			State:              models.PaymentState(item.State),
+			CommandCallbackUrl: item.CommandCallbackUrl,
+			Error:              item.Error,
+		}
+		err = json.Unmarshal([]byte(item.Request), &session.Request)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(item.Route), &session.Route)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(item.StatusCallbackUrls), &session.StatusCallbackUrls)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(item.Transactions), &session.Transactions)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(item.FailedHops), &session.FailedHops)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
@@ -0,0 +1,58 @@
+package paymentregestry
+
+import (
+	"encoding/json"
+	"time"
+
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database/entity"
+)
+
+// SequenceStore persists the sequence allocation state of a node account, it implements root.SequenceStore
+type SequenceStore interface {
+	// Load returns nil if the state wasn't saved
+	Load() (*models.SequenceState, error)
+	Save(state *models.SequenceState) error
+}
+
+type sequenceStore struct {
+	db          database.Db
+	nodeAddress string
+}
+
+func NewSequenceStore(db database.Db, nodeAddress string) SequenceStore {
+	return &sequenceStore{
+		db:          db,
+		nodeAddress: nodeAddress,
+	}
+}
+
+func (s *sequenceStore) Load() (*models.SequenceState, error) {
+	item, err := s.db.SelectSequenceState(s.nodeAddress)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	state := &models.SequenceState{
+		NodeAddress:   item.NodeAddress,
+		HighWaterMark: item.HighWaterMark,
+	}
+	err = json.Unmarshal([]byte(item.Unsubmitted), &state.Unsubmitted)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *sequenceStore) Save(state *models.SequenceState) error {
+	unsubmitted, err := json.Marshal(state.Unsubmitted)
+	if err != nil {
+		return err
+	}
+	return s.db.SaveSequenceState(&entity.DbSequenceState{
+		NodeAddress:   s.nodeAddress,
+		HighWaterMark: state.HighWaterMark,
+		Unsubmitted:   string(unsubmitted),
+		UpdateDate:    time.Now(),
+	})
+}
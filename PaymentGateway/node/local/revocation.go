@@ -0,0 +1,113 @@
+package local
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A session is revocable for sessionRetention after the node signed its transactions
+const sessionRetention = time.Hour
+
+type sessionState int
+
+const (
+	sessionSigned sessionState = iota
+	sessionCommitting
+	sessionCommitted
+	sessionRevoked
+)
+
+type signedSession struct {
+	next   string // the node a hop forwards the payment to, empty on the service node
+	state  sessionState
+	expiry time.Time
+}
+
+// signedSessions are the payment sessions the node signed its transactions of. A hop revokes its transaction
+// only with the revocation of the next node, the service node only until the session is paid, and the
+// commits of a revoked session are refused.
+type signedSessions struct {
+	mutex    sync.Mutex
+	sessions map[string]*signedSession // by service session id
+}
+
+func newSignedSessions() *signedSessions {
+	return &signedSessions{
+		sessions: map[string]*signedSession{},
+	}
+}
+
+func (s *signedSessions) sign(sessionId string, next string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for id, session := range s.sessions {
+		if isExpired(session.expiry, now) {
+			delete(s.sessions, id)
+		}
+	}
+	session, ok := s.sessions[sessionId]
+	if ok && session.state != sessionSigned {
+		return
+	}
+	s.sessions[sessionId] = &signedSession{
+		next:   next,
+		expiry: now.Add(sessionRetention),
+	}
+}
+
+// beginCommit marks the session committing, until endCommit
+func (s *signedSessions) beginCommit(sessionId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	session, ok := s.sessions[sessionId]
+	if !ok {
+		return fmt.Errorf("transactions of session %s weren't signed by the node", sessionId)
+	}
+	switch session.state {
+	case sessionRevoked:
+		return fmt.Errorf("session %s was revoked", sessionId)
+	case sessionCommitting:
+		return fmt.Errorf("session %s is being committed", sessionId)
+	}
+	session.state = sessionCommitting
+	return nil
+}
+
+func (s *signedSessions) endCommit(sessionId string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	session, ok := s.sessions[sessionId]
+	if !ok {
+		return
+	}
+	if err != nil {
+		session.state = sessionSigned
+	} else {
+		session.state = sessionCommitted
+	}
+}
+
+// revoke marks the session revoked if check accepts the node the hop paid, a paid session of the service node
+// isn't revocable
+func (s *signedSessions) revoke(sessionId string, check func(next string) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	session, ok := s.sessions[sessionId]
+	if !ok {
+		return fmt.Errorf("transactions of session %s weren't signed by the node", sessionId)
+	}
+	switch {
+	case session.state == sessionCommitting:
+		return fmt.Errorf("session %s is being committed", sessionId)
+	case session.state == sessionCommitted && session.next == "":
+		return fmt.Errorf("session %s was paid", sessionId)
+	}
+	err := check(session.next)
+	if err != nil {
+		return err
+	}
+	session.state = sessionRevoked
+	return nil
+}
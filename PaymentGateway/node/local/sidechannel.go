@@ -0,0 +1,252 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/support/log"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/root"
+)
+
+// Side channel payments are made by peers which don't run a node: the node pays the
+// destination and is reimbursed by the payer, each party signs only its own payment.
+
+type sideChannelPayment struct {
+	presentTransaction models.XDR
+	expiry             time.Time
+}
+
+type sideChannelPayments struct {
+	mutex    sync.Mutex
+	payments map[string]*sideChannelPayment // by reimbursement transaction hash
+}
+
+func newSideChannelPayments() *sideChannelPayments {
+	return &sideChannelPayments{
+		payments: map[string]*sideChannelPayment{},
+	}
+}
+
+func (p *sideChannelPayments) add(hash string, payment *sideChannelPayment) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := time.Now()
+	for h, pending := range p.payments {
+		if isExpired(pending.expiry, now) {
+			delete(p.payments, h)
+		}
+	}
+	p.payments[hash] = payment
+}
+
+func (p *sideChannelPayments) remove(hash string) *sideChannelPayment {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	payment, ok := p.payments[hash]
+	if !ok {
+		return nil
+	}
+	delete(p.payments, hash)
+	return payment
+}
+
+// issuedTransactions are the unsigned peer transactions handed out by SetUpPeer, CreateOrFund submits only these
+type issuedTransactions struct {
+	mutex    sync.Mutex
+	expiries map[string]time.Time // by transaction hash
+}
+
+func newIssuedTransactions() *issuedTransactions {
+	return &issuedTransactions{
+		expiries: map[string]time.Time{},
+	}
+}
+
+func (i *issuedTransactions) add(hash string, expiry time.Time) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	now := time.Now()
+	for h, e := range i.expiries {
+		if isExpired(e, now) {
+			delete(i.expiries, h)
+		}
+	}
+	i.expiries[hash] = expiry
+}
+
+func (i *issuedTransactions) remove(hash string) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	_, ok := i.expiries[hash]
+	delete(i.expiries, hash)
+	return ok
+}
+
+// SetUpPeer creates the account of the peer which signed the request, within the daily limit of created accounts,
+// and returns the trustline transaction the peer signs and pays for. Without channel accounts the creation takes
+// a node sequence and fails while transactions are accumulated, the peer retries after the next flush.
+func (n *nodeImpl) SetUpPeer(ctx context.Context, request *models.SetUpPeerRequest) (*models.SetUpPeerResponse, error) {
+	_, span := n.tracer.Start(ctx, "node-SetUpPeer "+n.GetAddress())
+	defer span.End()
+
+	err := request.Verify(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	address := request.Address
+	account, err := n.rootClient.GetPeerAccount(address)
+	if err != nil && root.Kind(err) != root.ErrNotFound {
+		return nil, fmt.Errorf("error getting peer account data: %v", err)
+	}
+	if err != nil {
+		// Anyone can show the key of a new account, the limit keeps the starting balances from draining the node
+		err = n.peerAccounts.Take(1, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("peer account %s isn't created: %v", address, err)
+		}
+		err = n.rootClient.CreatePeerAccount(address)
+		if err != nil {
+			return nil, fmt.Errorf("error creating peer account: %v", err)
+		}
+		log.Infof("Peer account %s created", address)
+		account, err = n.rootClient.GetPeerAccount(address)
+		if err != nil {
+			return nil, fmt.Errorf("error getting peer account data: %v", err)
+		}
+	}
+	if !root.HasPPTokenTrustline(account) {
+		xdr, err := n.rootClient.CreatePeerTrustlineTransaction(account)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := n.rootClient.TransactionHash(xdr)
+		if err != nil {
+			return nil, err
+		}
+		expiry, err := models.TransactionExpiry(&models.PaymentTransaction{XDR: xdr})
+		if err != nil {
+			return nil, err
+		}
+		n.issuedTransactions.add(hash, expiry)
+		return &models.SetUpPeerResponse{
+			Status:         models.PeerAccountFundingRequired,
+			TransactionXdr: xdr,
+		}, nil
+	}
+	return &models.SetUpPeerResponse{
+		Status: models.PeerAlreadyExists,
+	}, nil
+}
+
+// CreateOrFund submits a transaction issued by SetUpPeer once the peer signed it, the node doesn't relay other transactions
+func (n *nodeImpl) CreateOrFund(ctx context.Context, xdr models.XDR) error {
+	_, span := n.tracer.Start(ctx, "node-CreateOrFund "+n.GetAddress())
+	defer span.End()
+
+	err := xdr.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid transaction: %v", err)
+	}
+	hash, err := n.rootClient.TransactionHash(xdr)
+	if err != nil {
+		return err
+	}
+	if !n.issuedTransactions.remove(hash) {
+		return fmt.Errorf("transaction %s wasn't issued by the node", hash)
+	}
+	return n.rootClient.SubmitTransactionXDR(xdr)
+}
+
+func (n *nodeImpl) InitiatePayment(ctx context.Context, request *models.InitiatePaymentRequest) (*models.InitiatePaymentResponse, error) {
+	_, span := n.tracer.Start(ctx, "node-InitiatePayment "+n.GetAddress())
+	defer span.End()
+	if n.isShuttingDown() {
+		return nil, errShuttingDown
+	}
+
+	if request.Asset != "" && request.Asset != models.PPTokenAssetName {
+		return nil, fmt.Errorf("unsupported asset: %s", request.Asset)
+	}
+	if request.Amount <= 0 {
+		return nil, fmt.Errorf("invalid amount: %v", request.Amount)
+	}
+	destination := request.ToAddress
+	if request.PrevTransactionXdr != nil && !request.PrevTransactionXdr.Empty() {
+		wrapper, err := request.PrevTransactionXdr.TransactionFromXDR()
+		if err != nil {
+			return nil, fmt.Errorf("error deserializing previous transaction: %v", err)
+		}
+		t, ok := wrapper.Transaction()
+		if !ok {
+			return nil, fmt.Errorf("error deserializing previous transaction (GenericTransaction)")
+		}
+		destination = t.SourceAccount().AccountID
+	}
+	if destination == "" {
+		return nil, fmt.Errorf("payment destination not specified")
+	}
+
+	nodeAddress := n.GetAddress()
+	present, err := n.rootClient.CreatePeerPaymentTransaction(destination, nodeAddress, destination, request.Amount, request.Memo)
+	if err != nil {
+		return nil, err
+	}
+	fee, err := n.fees.Policy(models.PPTokenAssetName).Fee(models.MicroPPToken2PPtoken(request.Amount))
+	if err != nil {
+		return nil, err
+	}
+	reimbursementAmount := request.Amount + models.PPtoken2MicroPP(fee)
+	reimbursement, err := n.rootClient.CreatePeerPaymentTransaction(request.FromAddress, request.FromAddress, nodeAddress, reimbursementAmount, request.Memo)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := n.rootClient.TransactionHash(reimbursement)
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := models.TransactionExpiry(&models.PaymentTransaction{XDR: present})
+	if err != nil {
+		return nil, err
+	}
+	n.sideChannelPayments.add(hash, &sideChannelPayment{
+		presentTransaction: present,
+		expiry:             expiry,
+	})
+	log.Infof("Side channel payment initiated %s => %s: %v", request.FromAddress, destination, request.Amount)
+
+	return &models.InitiatePaymentResponse{
+		PresentTransactionXdr:       present,
+		ReimbursementTransactionXdr: reimbursement,
+	}, nil
+}
+
+// PaymentCommit submits the reimbursement signed by the payer and returns the present transaction signed by the node,
+// the present transaction is signed first so the payer isn't charged without getting it
+func (n *nodeImpl) PaymentCommit(ctx context.Context, signedReimbursement models.XDR) (models.XDR, error) {
+	_, span := n.tracer.Start(ctx, "node-PaymentCommit "+n.GetAddress())
+	defer span.End()
+
+	hash, err := n.rootClient.TransactionHash(signedReimbursement)
+	if err != nil {
+		return nil, err
+	}
+	payment := n.sideChannelPayments.remove(hash)
+	if payment == nil {
+		return nil, fmt.Errorf("unknown reimbursement transaction")
+	}
+	present, err := n.rootClient.SignXDR(payment.presentTransaction)
+	if err != nil {
+		n.sideChannelPayments.add(hash, payment)
+		return nil, fmt.Errorf("error signing present transaction: %v", err)
+	}
+	err = n.rootClient.SubmitTransactionXDR(signedReimbursement)
+	if err != nil {
+		// A reimbursement applied in the meantime fails the next submission with a bad sequence
+		n.sideChannelPayments.add(hash, payment)
+		return nil, fmt.Errorf("error submitting reimbursement transaction: %v", err)
+	}
+	return present, nil
+}
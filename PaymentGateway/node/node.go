@@ -13,6 +13,7 @@ type PPNode interface {
 	SignServiceTransaction(ctx context.Context, command *models.SignServiceTransactionCommand) (*models.SignServiceTransactionResponse, error)
 	CommitChainTransaction(ctx context.Context, command *models.CommitChainTransactionCommand) error
 	CommitServiceTransaction(ctx context.Context, command *models.CommitServiceTransactionCommand) error
+	RevokeTransaction(ctx context.Context, command *models.RevokeTransactionCommand) (*models.RevokeTransactionResponse, error)
+	QuoteFee(ctx context.Context, command *models.QuoteFeeCommand) (*models.QuoteFeeResponse, error)
 	GetAddress() string
-	GetFee() uint32
 }
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"time"
 
 	"github.com/go-errors/errors"
 	"github.com/google/uuid"
 	"paidpiper.com/payment-gateway/common"
+	"paidpiper.com/payment-gateway/config"
 	"paidpiper.com/payment-gateway/models"
 )
 
@@ -20,20 +22,31 @@ type CommandClient interface {
 	SignChainTransaction(context context.Context, command *models.SignChainTransactionCommand) (*models.SignChainTransactionResponse, error)
 	CommitServiceTransaction(context context.Context, req *models.CommitServiceTransactionCommand) error
 	CommitChainTransaction(context context.Context, request *models.CommitChainTransactionCommand) error
+	RevokeTransaction(context context.Context, request *models.RevokeTransactionCommand) (*models.RevokeTransactionResponse, error)
+	QuoteFee(context context.Context, request *models.QuoteFeeCommand) (*models.QuoteFeeResponse, error)
 }
 type CommandResponseHandler interface {
-	ProcessResponse(context context.Context, commandId string, responseBody []byte) error
+	ProcessResponse(context context.Context, response *models.UtilityResponse) error
+}
+
+// commandProcessor is the transport of the commands
+type commandProcessor interface {
+	WrapToCommand(cmd models.InCommandType) (*models.ProcessCommand, error)
+	processCommand(context context.Context, cmd *models.ProcessCommand) ([]byte, error)
+	commandPolicy() config.CommandConfig
 }
 
 func NewCommandClient(
 	url,
 	sessionId,
-	nodeId string) (CommandClient, CommandResponseHandler) {
+	nodeId string,
+	policy config.CommandConfig) (CommandClient, CommandResponseHandler) {
 	commandClient := &commandClient{
 		torUrl:     url,
 		chainStore: NewCommandChainStore(),
 		sessionId:  sessionId,
 		nodeId:     nodeId,
+		policy:     policy,
 	}
 	return commandClient, commandClient
 }
@@ -43,6 +56,7 @@ type commandClient struct {
 	chainStore *commandChannelStore
 	sessionId  string //TODO REMOVE AFTER SESSION WRAPPER TO INTERFACE
 	nodeId     string
+	policy     config.CommandConfig
 }
 
 func (cl *commandClient) CreateTransaction(context context.Context, request *models.CreateTransactionCommand) (*models.CreateTransactionResponse, error) {
@@ -83,17 +97,29 @@ func (cl *commandClient) CommitChainTransaction(context context.Context, request
 
 }
 
-func processCommandWrapperNoRes(cl *commandClient, context context.Context, request models.InCommandType) error {
-	body, err := cl.WrapToCommand(request)
+func (cl *commandClient) RevokeTransaction(context context.Context, request *models.RevokeTransactionCommand) (*models.RevokeTransactionResponse, error) {
+	response := &models.RevokeTransactionResponse{}
+	err := processCommandWrapper(cl, context, request, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
 
+func (cl *commandClient) QuoteFee(context context.Context, request *models.QuoteFeeCommand) (*models.QuoteFeeResponse, error) {
+	response := &models.QuoteFeeResponse{}
+	err := processCommandWrapper(cl, context, request, response)
 	if err != nil {
-		return errors.Errorf(err.Error())
+		return nil, err
 	}
+	return response, nil
+}
 
-	reply, err := cl.processCommand(context, body)
+func processCommandWrapperNoRes(cl commandProcessor, context context.Context, request models.InCommandType) error {
+	reply, err := executeCommand(cl, context, request)
 
 	if err != nil {
-		return errors.Errorf(err.Error())
+		return err
 	}
 
 	var response = &struct{}{}
@@ -107,30 +133,121 @@ func processCommandWrapperNoRes(cl *commandClient, context context.Context, requ
 	return nil
 }
 
-func processCommandWrapper(cl *commandClient, context context.Context, request models.InCommandType, out models.OutCommandType) error {
-	body, err := cl.WrapToCommand(request)
+func processCommandWrapper(cl commandProcessor, context context.Context, request models.InCommandType, out models.OutCommandType) error {
+	reply, err := executeCommand(cl, context, request)
 
 	if err != nil {
-		return errors.Errorf(err.Error())
+		return err
 	}
 
-	reply, err := cl.processCommand(context, body)
+	err = json.Unmarshal(reply, out)
 
 	if err != nil {
 		return errors.Errorf(err.Error())
 	}
 
-	err = json.Unmarshal(reply, out)
+	return nil
+}
+
+// isIdempotent tells whether a command can be sent again without side effects on the hop
+func isIdempotent(commandType models.CommandType) bool {
+	switch commandType {
+	case models.CommandType_CreateTransaction,
+		models.CommandType_SignServiceTransaction,
+		models.CommandType_SignChainTransaction,
+		models.CommandType_RevokeTransaction,
+		models.CommandType_QuoteFee:
+		return true
+	default:
+		return false
+	}
+}
+
+// executeCommand sends the command with a deadline for each attempt, idempotent commands are retried
+// with backoff. The attempts share the command id so a late reply to an earlier attempt is accepted.
+func executeCommand(cl commandProcessor, ctx context.Context, request models.InCommandType) ([]byte, error) {
+	cmd, err := cl.WrapToCommand(request)
 
 	if err != nil {
-		return errors.Errorf(err.Error())
+		return nil, errors.Errorf(err.Error())
 	}
 
-	return nil
+	policy := cl.commandPolicy()
+	attempts := 1
+	if isIdempotent(cmd.CommandType) {
+		attempts += policy.Retries
+	}
+	backoff := policy.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		reply, err := processCommandAttempt(cl, ctx, cmd, policy.Timeout)
+		if err == nil {
+			return reply, nil
+		}
+		if _, rejected := err.(*commandRejectedError); rejected || attempt >= attempts || ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("Command %s (%s) attempt %d failed, retrying in %v: %v", cmd.CommandType, cmd.CommandId, attempt, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+func processCommandAttempt(cl commandProcessor, ctx context.Context, cmd *models.ProcessCommand, timeout time.Duration) ([]byte, error) {
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	reply, err := cl.processCommand(attemptCtx, cmd)
+	if err != nil && attemptCtx.Err() == context.DeadlineExceeded {
+		return nil, &models.CommandTimeoutError{
+			NodeId:      cmd.NodeId,
+			CommandId:   cmd.CommandId,
+			CommandType: cmd.CommandType,
+			Timeout:     time.Since(start).Round(time.Millisecond),
+		}
+	}
+	return reply, err
+}
+
+// commandRejectedError is replied by a hop which processed the command, it isn't retried
+type commandRejectedError struct {
+	nodeId  string
+	message string
+}
+
+func (e *commandRejectedError) Error() string {
+	return fmt.Sprintf("command failed on %s: %s", e.nodeId, e.message)
 }
 
 //TODO WRAPPER TO INTERFACE
 func (cl *commandClient) WrapToCommand(cmd models.InCommandType) (*models.ProcessCommand, error) {
+	return wrapToCommand(cl.sessionId, cl.nodeId, cmd)
+}
+
+// commitCommandNamespace is the namespace of the command ids derived from the session
+var commitCommandNamespace = uuid.MustParse("709d936e-a36f-48ef-9d20-c61b420cb93f")
+
+// commandId identifies the command in the journal of the hop. A hop commits once per session, the id of a commit
+// is derived from the session, the hop and the command type stored with the session, so a payment resumed after
+// a restart replays the commit through the journal instead of committing again.
+func commandId(sessionId string, nodeId string, commandType models.CommandType) string {
+	switch commandType {
+	case models.CommandType_CommitChainTransaction, models.CommandType_CommitServiceTransaction:
+		name := fmt.Sprintf("%s/%s/%s", sessionId, nodeId, commandType)
+		return uuid.NewSHA1(commitCommandNamespace, []byte(name)).String()
+	default:
+		return uuid.New().String()
+	}
+}
+
+func wrapToCommand(sessionId string, nodeId string, cmd models.InCommandType) (*models.ProcessCommand, error) {
 	body, err := json.Marshal(cmd)
 
 	if err != nil {
@@ -138,9 +255,9 @@ func (cl *commandClient) WrapToCommand(cmd models.InCommandType) (*models.Proces
 	}
 	command := &models.ProcessCommand{
 		CommandCore: models.CommandCore{
-			SessionId:   cl.sessionId,
-			NodeId:      cl.nodeId,
-			CommandId:   uuid.New().String(),
+			SessionId:   sessionId,
+			NodeId:      nodeId,
+			CommandId:   commandId(sessionId, nodeId, cmd.Type()),
 			CommandType: cmd.Type(),
 		},
 		CommandBody: body,
@@ -150,6 +267,10 @@ func (cl *commandClient) WrapToCommand(cmd models.InCommandType) (*models.Proces
 
 }
 
+func (cl *commandClient) commandPolicy() config.CommandConfig {
+	return cl.policy
+}
+
 //TODO TO INTERFACE
 func (cl *commandClient) processCommand(context context.Context, cmd *models.ProcessCommand) ([]byte, error) {
 	commandId := cmd.CommandId
@@ -158,41 +279,74 @@ func (cl *commandClient) processCommand(context context.Context, cmd *models.Pro
 	defer cl.chainStore.close(commandId)
 
 	log.Printf("Process command SessionId=%s, NodeId=%s, CommandId=%s CommandType:%d", cmd.SessionId, cl.nodeId, commandId, cmd.CommandType)
-	//TODO ERROR
-	jsonValue, _ := json.Marshal(cmd)
-
-	res, err := common.HttpPostWithoutContext(cl.torUrl, bytes.NewBuffer(jsonValue))
+	jsonValue, err := json.Marshal(cmd)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
 
+	res, err := common.HttpPostWithContext(context, cl.torUrl, bytes.NewBuffer(jsonValue))
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
+	defer res.Body.Close()
 
 	bodyBytes, err := ioutil.ReadAll(res.Body)
-
-	if err == nil && len(bodyBytes) > 0 {
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("command post to %s failed: %s %s", cl.torUrl, res.Status, bodyBytes)
+	}
+	if len(bodyBytes) > 0 {
 		return bodyBytes, nil
 	}
 
-	if err != nil {
-		log.Fatal(err)
+	// Wait for the callback
+	select {
+	case bs, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("command %s superseded", commandId)
+		}
+		return commandReply(cl.nodeId, bs)
+	case <-context.Done():
+		return nil, context.Err()
 	}
+}
 
-	// Wait
-	responseBody := <-ch
-
-	return responseBody, nil
+// ProcessResponse delivers the reply posted to the callback url, as a CommandStreamReply
+func (cl *commandClient) ProcessResponse(context context.Context, response *models.UtilityResponse) error {
+	return deliverResponse(cl.chainStore, cl.nodeId, response)
 }
 
-func (cl *commandClient) ProcessResponse(context context.Context, commandId string, responseBody []byte) error {
-	ok := cl.chainStore.processResponse(commandId, responseBody)
+func deliverResponse(store *commandChannelStore, nodeId string, response *models.UtilityResponse) error {
+	bs, err := json.Marshal(&models.CommandStreamReply{
+		CommandResponseCore: response.CommandResponseCore,
+		CommandResponse:     response.CommandResponse,
+		Error:               response.Error,
+	})
+	if err != nil {
+		return err
+	}
+	ok := store.processResponse(response.CommandId, bs)
 	if !ok {
-		log.Printf("Unknown command response: : %s on %s", commandId, cl.nodeId)
-		return fmt.Errorf("unknown command response: : %s on %s", commandId, cl.nodeId)
+		log.Printf("Unknown command response: : %s on %s", response.CommandId, nodeId)
+		return fmt.Errorf("unknown command response: : %s on %s", response.CommandId, nodeId)
 	}
 	return nil
 }
+
+// commandReply returns the response of a CommandStreamReply, the error of a failed command is a commandRejectedError
+func commandReply(nodeId string, bs []byte) ([]byte, error) {
+	reply := &models.CommandStreamReply{}
+	err := json.Unmarshal(bs, reply)
+	if err != nil {
+		return nil, errors.Errorf(err.Error())
+	}
+	if reply.Error != "" {
+		return nil, &commandRejectedError{
+			nodeId:  nodeId,
+			message: reply.Error,
+		}
+	}
+	return reply.CommandResponse, nil
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+)
+
+type testProcessor struct {
+	policy    config.CommandConfig
+	attempts  int
+	commandId string
+	reply     func(ctx context.Context, attempt int) ([]byte, error)
+}
+
+func (p *testProcessor) WrapToCommand(cmd models.InCommandType) (*models.ProcessCommand, error) {
+	return wrapToCommand("session", "node", cmd)
+}
+
+func (p *testProcessor) commandPolicy() config.CommandConfig {
+	return p.policy
+}
+
+func (p *testProcessor) processCommand(ctx context.Context, cmd *models.ProcessCommand) ([]byte, error) {
+	if p.commandId != "" && p.commandId != cmd.CommandId {
+		return nil, errors.New("command id changed between attempts")
+	}
+	p.commandId = cmd.CommandId
+	p.attempts++
+	return p.reply(ctx, p.attempts)
+}
+
+var testPolicy = config.CommandConfig{
+	Timeout:      20 * time.Millisecond,
+	Retries:      2,
+	RetryBackoff: time.Millisecond,
+}
+
+func hang(ctx context.Context, attempt int) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCommandTimeout(t *testing.T) {
+	p := &testProcessor{policy: testPolicy, reply: hang}
+
+	err := processCommandWrapper(p, context.Background(), &models.CreateTransactionCommand{}, &models.CreateTransactionResponse{})
+	assert.True(t, models.IsCommandTimeout(err))
+	assert.Equal(t, 3, p.attempts)
+}
+
+func TestCommandRetrySucceeds(t *testing.T) {
+	p := &testProcessor{policy: testPolicy, reply: func(ctx context.Context, attempt int) ([]byte, error) {
+		if attempt == 1 {
+			return hang(ctx, attempt)
+		}
+		return []byte(`{"transaction":null}`), nil
+	}}
+
+	err := processCommandWrapper(p, context.Background(), &models.SignChainTransactionCommand{}, &models.SignChainTransactionResponse{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.attempts)
+}
+
+func TestCommitIsNotRetried(t *testing.T) {
+	p := &testProcessor{policy: testPolicy, reply: hang}
+
+	err := processCommandWrapperNoRes(p, context.Background(), &models.CommitChainTransactionCommand{})
+	assert.True(t, models.IsCommandTimeout(err))
+	assert.Equal(t, 1, p.attempts)
+}
+
+func TestRejectedCommandIsNotRetried(t *testing.T) {
+	p := &testProcessor{policy: testPolicy, reply: func(ctx context.Context, attempt int) ([]byte, error) {
+		return nil, &commandRejectedError{nodeId: "node", message: "invalid"}
+	}}
+
+	err := processCommandWrapper(p, context.Background(), &models.CreateTransactionCommand{}, &models.CreateTransactionResponse{})
+	assert.Error(t, err)
+	assert.False(t, models.IsCommandTimeout(err))
+	assert.Equal(t, 1, p.attempts)
+}
+
+func TestCommandCanceled(t *testing.T) {
+	p := &testProcessor{policy: testPolicy, reply: hang}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+
+	err := processCommandWrapper(p, ctx, &models.CreateTransactionCommand{}, &models.CreateTransactionResponse{})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, p.attempts)
+}
+
+func TestCommandChannelStore(t *testing.T) {
+	store := NewCommandChainStore()
+
+	ch := store.open("1")
+	assert.True(t, store.processResponse("1", []byte("reply")))
+	assert.False(t, store.processResponse("1", []byte("duplicate")))
+	assert.Equal(t, []byte("reply"), <-ch)
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.True(t, store.empty())
+
+	ch = store.open("2")
+	store.close("2")
+	_, ok = <-ch
+	assert.False(t, ok)
+	assert.False(t, store.processResponse("2", []byte("late")))
+	assert.True(t, store.empty())
+}
+
+func TestCallbackErrorRejectsCommand(t *testing.T) {
+	store := NewCommandChainStore()
+	ch := store.open("1")
+	err := deliverResponse(store, "node", &models.UtilityResponse{
+		CommandResponseCore: models.CommandResponseCore{CommandId: "1"},
+		Error:               "verify transaction error",
+	})
+	assert.NoError(t, err)
+	_, err = commandReply("node", <-ch)
+	_, rejected := err.(*commandRejectedError)
+	assert.True(t, rejected)
+	assert.Contains(t, err.Error(), "verify transaction error")
+
+	ch = store.open("2")
+	assert.NoError(t, deliverResponse(store, "node", &models.UtilityResponse{
+		CommandResponseCore: models.CommandResponseCore{CommandId: "2"},
+		CommandResponse:     []byte("reply"),
+	}))
+	reply, err := commandReply("node", <-ch)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("reply"), reply)
+}
+
+func TestCommitCommandIdsAreDerivedFromTheSession(t *testing.T) {
+	commit, err := wrapToCommand("session", "node", &models.CommitChainTransactionCommand{})
+	assert.NoError(t, err)
+	resumed, err := wrapToCommand("session", "node", &models.CommitChainTransactionCommand{})
+	assert.NoError(t, err)
+	assert.Equal(t, commit.CommandId, resumed.CommandId)
+
+	other, err := wrapToCommand("session", "other", &models.CommitChainTransactionCommand{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, commit.CommandId, other.CommandId)
+	service, err := wrapToCommand("session", "node", &models.CommitServiceTransactionCommand{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, commit.CommandId, service.CommandId)
+
+	create, err := wrapToCommand("session", "node", &models.CreateTransactionCommand{})
+	assert.NoError(t, err)
+	again, err := wrapToCommand("session", "node", &models.CreateTransactionCommand{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, create.CommandId, again.CommandId)
+}
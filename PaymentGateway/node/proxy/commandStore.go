@@ -4,6 +4,8 @@ import (
 	"sync"
 )
 
+// commandChannelStore delivers the replies to the waiting commands, a channel receives at most
+// one reply and is closed once the reply is delivered or the command stops waiting
 type commandChannelStore struct {
 	mutex          *sync.Mutex
 	commandChannel map[string]chan []byte
@@ -16,11 +18,16 @@ func NewCommandChainStore() *commandChannelStore {
 	}
 }
 
+// open registers the command, the channel of a previous attempt with the same id is closed
 func (n *commandChannelStore) open(id string) <-chan []byte {
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
 
-	ch := make(chan []byte, 2)
+	previous, ok := n.commandChannel[id]
+	if ok {
+		close(previous)
+	}
+	ch := make(chan []byte, 1)
 	n.commandChannel[id] = ch
 
 	return ch
@@ -32,17 +39,35 @@ func (n *commandChannelStore) close(id string) {
 	ch, ok := n.commandChannel[id]
 	if ok {
 		delete(n.commandChannel, id)
-		defer close(ch)
+		close(ch)
 	}
+}
 
+// closeAll releases the waiting commands, their channels are closed without a response
+func (n *commandChannelStore) closeAll() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for id, ch := range n.commandChannel {
+		delete(n.commandChannel, id)
+		close(ch)
+	}
+}
+
+func (n *commandChannelStore) empty() bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return len(n.commandChannel) == 0
 }
 
+// processResponse never blocks, replies of commands which aren't waited for are rejected
 func (n *commandChannelStore) processResponse(commandId string, bs []byte) bool {
 	n.mutex.Lock()
 	defer n.mutex.Unlock()
 	ch, ok := n.commandChannel[commandId]
 	if ok {
+		delete(n.commandChannel, commandId)
 		ch <- bs
+		close(ch)
 		return true
 	}
 	return false
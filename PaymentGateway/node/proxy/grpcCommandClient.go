@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/ppsidechannel"
+)
+
+// The stream of a session is closed when no command was sent for this period, it's reopened by the next command
+const commandStreamIdleTimeout = time.Minute
+
+// NewGrpcCommandClient sends the commands of the session and receives their replies on one grpc stream
+func NewGrpcCommandClient(
+	conn *grpc.ClientConn,
+	sessionId,
+	nodeId string,
+	policy config.CommandConfig) (CommandClient, CommandResponseHandler) {
+	commandClient := &grpcCommandClient{
+		client:     ppsidechannel.NewPPCommandStreamClient(conn),
+		chainStore: NewCommandChainStore(),
+		sessionId:  sessionId,
+		nodeId:     nodeId,
+		policy:     policy,
+	}
+	return commandClient, commandClient
+}
+
+// NewFailedCommandClient fails the commands of the session with err, e.g. when its connection can't be set up
+func NewFailedCommandClient(err error) (CommandClient, CommandResponseHandler) {
+	commandClient := &failedCommandClient{err: err}
+	return commandClient, commandClient
+}
+
+type failedCommandClient struct {
+	err error
+}
+
+func (cl *failedCommandClient) CreateTransaction(context.Context, *models.CreateTransactionCommand) (*models.CreateTransactionResponse, error) {
+	return nil, cl.err
+}
+
+func (cl *failedCommandClient) SignServiceTransaction(context.Context, *models.SignServiceTransactionCommand) (*models.SignServiceTransactionResponse, error) {
+	return nil, cl.err
+}
+
+func (cl *failedCommandClient) SignChainTransaction(context.Context, *models.SignChainTransactionCommand) (*models.SignChainTransactionResponse, error) {
+	return nil, cl.err
+}
+
+func (cl *failedCommandClient) CommitServiceTransaction(context.Context, *models.CommitServiceTransactionCommand) error {
+	return cl.err
+}
+
+func (cl *failedCommandClient) CommitChainTransaction(context.Context, *models.CommitChainTransactionCommand) error {
+	return cl.err
+}
+
+func (cl *failedCommandClient) RevokeTransaction(context.Context, *models.RevokeTransactionCommand) (*models.RevokeTransactionResponse, error) {
+	return nil, cl.err
+}
+
+func (cl *failedCommandClient) QuoteFee(context.Context, *models.QuoteFeeCommand) (*models.QuoteFeeResponse, error) {
+	return nil, cl.err
+}
+
+func (cl *failedCommandClient) ProcessResponse(context.Context, *models.UtilityResponse) error {
+	return cl.err
+}
+
+type grpcCommandClient struct {
+	client     ppsidechannel.PPCommandStreamClient
+	chainStore *commandChannelStore
+	sessionId  string
+	nodeId     string
+	policy     config.CommandConfig
+
+	mutex     sync.Mutex
+	stream    ppsidechannel.PPCommandStream_CommandStreamClient
+	cancel    context.CancelFunc
+	idleTimer *time.Timer
+}
+
+func (cl *grpcCommandClient) CreateTransaction(context context.Context, request *models.CreateTransactionCommand) (*models.CreateTransactionResponse, error) {
+	response := &models.CreateTransactionResponse{}
+	err := processCommandWrapper(cl, context, request, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (cl *grpcCommandClient) SignServiceTransaction(context context.Context, request *models.SignServiceTransactionCommand) (*models.SignServiceTransactionResponse, error) {
+	response := &models.SignServiceTransactionResponse{}
+	err := processCommandWrapper(cl, context, request, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (cl *grpcCommandClient) SignChainTransaction(context context.Context, request *models.SignChainTransactionCommand) (*models.SignChainTransactionResponse, error) {
+	response := &models.SignChainTransactionResponse{}
+	err := processCommandWrapper(cl, context, request, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (cl *grpcCommandClient) CommitServiceTransaction(context context.Context, request *models.CommitServiceTransactionCommand) error {
+	return processCommandWrapperNoRes(cl, context, request)
+}
+
+func (cl *grpcCommandClient) CommitChainTransaction(context context.Context, request *models.CommitChainTransactionCommand) error {
+	return processCommandWrapperNoRes(cl, context, request)
+}
+
+func (cl *grpcCommandClient) RevokeTransaction(context context.Context, request *models.RevokeTransactionCommand) (*models.RevokeTransactionResponse, error) {
+	response := &models.RevokeTransactionResponse{}
+	err := processCommandWrapper(cl, context, request, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (cl *grpcCommandClient) QuoteFee(context context.Context, request *models.QuoteFeeCommand) (*models.QuoteFeeResponse, error) {
+	response := &models.QuoteFeeResponse{}
+	err := processCommandWrapper(cl, context, request, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (cl *grpcCommandClient) WrapToCommand(cmd models.InCommandType) (*models.ProcessCommand, error) {
+	return wrapToCommand(cl.sessionId, cl.nodeId, cmd)
+}
+
+func (cl *grpcCommandClient) commandPolicy() config.CommandConfig {
+	return cl.policy
+}
+
+func (cl *grpcCommandClient) processCommand(context context.Context, cmd *models.ProcessCommand) ([]byte, error) {
+	commandId := cmd.CommandId
+	log.Printf("Process command over grpc SessionId=%s, NodeId=%s, CommandId=%s CommandType:%d", cmd.SessionId, cl.nodeId, commandId, cmd.CommandType)
+
+	body, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := cl.send(commandId, &ppsidechannel.CommandRequest{
+		CommandType: int32(cmd.CommandType),
+		CommandBody: string(body),
+	})
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := cl.waitReply(context, ch)
+	cl.chainStore.close(commandId)
+	cl.releaseStream()
+	return responseBody, err
+}
+
+func (cl *grpcCommandClient) waitReply(context context.Context, ch <-chan []byte) ([]byte, error) {
+	select {
+	case bs, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("command stream of session %s closed before the reply", cl.sessionId)
+		}
+		return commandReply(cl.nodeId, bs)
+	case <-context.Done():
+		return nil, context.Err()
+	}
+}
+
+// send opens the stream if needed and registers the command before sending it,
+// so the reply can't arrive before the command is waited for
+func (cl *grpcCommandClient) send(commandId string, request *ppsidechannel.CommandRequest) (<-chan []byte, error) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	if cl.idleTimer != nil {
+		cl.idleTimer.Stop()
+	}
+	if cl.stream == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := cl.client.CommandStream(ctx)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("error opening command stream: %v", err)
+		}
+		cl.stream = stream
+		cl.cancel = cancel
+		go cl.receive(stream)
+	}
+	ch := cl.chainStore.open(commandId)
+	err := cl.stream.Send(request)
+	if err != nil {
+		cl.chainStore.close(commandId)
+		return nil, fmt.Errorf("error sending command: %v", err)
+	}
+	return ch, nil
+}
+
+func (cl *grpcCommandClient) receive(stream ppsidechannel.PPCommandStream_CommandStreamClient) {
+	for {
+		reply, err := stream.Recv()
+		if err != nil {
+			cl.mutex.Lock()
+			defer cl.mutex.Unlock()
+			if cl.stream == stream {
+				log.Printf("Command stream of session %s failed: %v", cl.sessionId, err)
+				cl.cancel()
+				cl.stream = nil
+				cl.chainStore.closeAll()
+			}
+			return
+		}
+		bs := []byte(reply.GetResponseBody())
+		core := &models.CommandResponseCore{}
+		err = json.Unmarshal(bs, core)
+		if err != nil {
+			log.Printf("Invalid command reply on session %s: %v", cl.sessionId, err)
+			continue
+		}
+		if !cl.chainStore.processResponse(core.CommandId, bs) {
+			log.Printf("Unknown command response: : %s on %s", core.CommandId, cl.nodeId)
+		}
+	}
+}
+
+// releaseStream schedules the closing of the stream once no command is waiting for a reply
+func (cl *grpcCommandClient) releaseStream() {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	if cl.stream == nil || !cl.chainStore.empty() {
+		return
+	}
+	if cl.idleTimer == nil {
+		cl.idleTimer = time.AfterFunc(commandStreamIdleTimeout, cl.closeIdleStream)
+	} else {
+		cl.idleTimer.Reset(commandStreamIdleTimeout)
+	}
+}
+
+func (cl *grpcCommandClient) closeIdleStream() {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	if cl.stream == nil || !cl.chainStore.empty() {
+		return
+	}
+	cl.stream.CloseSend()
+	cl.cancel()
+	cl.stream = nil
+}
+
+// ProcessResponse accepts a reply delivered out of the stream (http callback)
+func (cl *grpcCommandClient) ProcessResponse(context context.Context, response *models.UtilityResponse) error {
+	return deliverResponse(cl.chainStore, cl.nodeId, response)
+}
@@ -13,16 +13,15 @@ import (
 type ProxyNode interface {
 	node.PPNode
 
-	ProcessResponse(context context.Context, commandId string, responseBody []byte) error
+	ProcessResponse(context context.Context, response *models.UtilityResponse) error
 }
 
-func NewProxyNode(commandClient CommandClient, responseHandler CommandResponseHandler, address string, fee uint32) ProxyNode {
+func NewProxyNode(commandClient CommandClient, responseHandler CommandResponseHandler, address string) ProxyNode {
 	return &nodeProxy{
 		commandClient:   commandClient,
 		responseHandler: responseHandler,
 		address:         address,
 		tracer:          global.Tracer(fmt.Sprintf("nodeProxy-%v", address)),
-		fee:             fee,
 	}
 }
 
@@ -31,19 +30,14 @@ type nodeProxy struct {
 	responseHandler CommandResponseHandler
 	address         string
 	tracer          trace.Tracer
-	fee             uint32
-}
-
-func (n *nodeProxy) GetFee() uint32 {
-	return n.fee
 }
 
 func (n *nodeProxy) GetAddress() string {
 	return n.address
 }
 
-func (n *nodeProxy) ProcessResponse(context context.Context, commandId string, responseBody []byte) error {
-	return n.responseHandler.ProcessResponse(context, commandId, responseBody)
+func (n *nodeProxy) ProcessResponse(context context.Context, response *models.UtilityResponse) error {
+	return n.responseHandler.ProcessResponse(context, response)
 }
 
 func (n *nodeProxy) CreateTransaction(context context.Context, command *models.CreateTransactionCommand) (*models.CreateTransactionResponse, error) {
@@ -105,3 +99,22 @@ func (n *nodeProxy) CommitChainTransaction(context context.Context, command *mod
 	command.Context = traceContext
 	return n.commandClient.CommitChainTransaction(ctx, command)
 }
+
+func (n *nodeProxy) RevokeTransaction(context context.Context, command *models.RevokeTransactionCommand) (*models.RevokeTransactionResponse, error) {
+	ctx, span := n.tracer.Start(context, "proxy-RevokeTransaction-"+n.address)
+	defer span.End()
+
+	traceContext, err := models.NewTraceContext(span.SpanContext())
+	if err != nil {
+		return nil, err
+	}
+	command.Context = traceContext
+	return n.commandClient.RevokeTransaction(ctx, command)
+}
+
+func (n *nodeProxy) QuoteFee(context context.Context, command *models.QuoteFeeCommand) (*models.QuoteFeeResponse, error) {
+	ctx, span := n.tracer.Start(context, "proxy-QuoteFee-"+n.address)
+	defer span.End()
+
+	return n.commandClient.QuoteFee(ctx, command)
+}
@@ -52,19 +52,19 @@ func (SetUpPeerResponse_SetUpStatus) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{1, 0}
 }
 
+// Signed by the key of stellarAddress, see models.SetUpPeerRequest
 type SetUpPeerRequest struct {
 	StellarAddress       string   `protobuf:"bytes,1,opt,name=stellarAddress,proto3" json:"stellarAddress,omitempty"`
+	Timestamp            int64    `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Signature            string   `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *SetUpPeerRequest) Reset() { *m = SetUpPeerRequest{} }
-
+func (m *SetUpPeerRequest) Reset()         { *m = SetUpPeerRequest{} }
 func (m *SetUpPeerRequest) String() string { return proto.CompactTextString(m) }
-
-func (*SetUpPeerRequest) ProtoMessage() {}
-
+func (*SetUpPeerRequest) ProtoMessage()    {}
 func (*SetUpPeerRequest) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{0}
 }
@@ -72,19 +72,15 @@ func (*SetUpPeerRequest) Descriptor() ([]byte, []int) {
 func (m *SetUpPeerRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SetUpPeerRequest.Unmarshal(m, b)
 }
-
 func (m *SetUpPeerRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_SetUpPeerRequest.Marshal(b, m, deterministic)
 }
-
 func (m *SetUpPeerRequest) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_SetUpPeerRequest.Merge(m, src)
 }
-
 func (m *SetUpPeerRequest) XXX_Size() int {
 	return xxx_messageInfo_SetUpPeerRequest.Size(m)
 }
-
 func (m *SetUpPeerRequest) XXX_DiscardUnknown() {
 	xxx_messageInfo_SetUpPeerRequest.DiscardUnknown(m)
 }
@@ -98,6 +94,20 @@ func (m *SetUpPeerRequest) GetStellarAddress() string {
 	return ""
 }
 
+func (m *SetUpPeerRequest) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *SetUpPeerRequest) GetSignature() string {
+	if m != nil {
+		return m.Signature
+	}
+	return ""
+}
+
 type SetUpPeerResponse struct {
 	Status               SetUpPeerResponse_SetUpStatus `protobuf:"varint,1,opt,name=status,proto3,enum=SetUpPeerResponse_SetUpStatus" json:"status,omitempty"`
 	TransactionXdr       string                        `protobuf:"bytes,2,opt,name=transactionXdr,proto3" json:"transactionXdr,omitempty"`
@@ -106,12 +116,9 @@ type SetUpPeerResponse struct {
 	XXX_sizecache        int32                         `json:"-"`
 }
 
-func (m *SetUpPeerResponse) Reset() { *m = SetUpPeerResponse{} }
-
+func (m *SetUpPeerResponse) Reset()         { *m = SetUpPeerResponse{} }
 func (m *SetUpPeerResponse) String() string { return proto.CompactTextString(m) }
-
-func (*SetUpPeerResponse) ProtoMessage() {}
-
+func (*SetUpPeerResponse) ProtoMessage()    {}
 func (*SetUpPeerResponse) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{1}
 }
@@ -119,19 +126,15 @@ func (*SetUpPeerResponse) Descriptor() ([]byte, []int) {
 func (m *SetUpPeerResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SetUpPeerResponse.Unmarshal(m, b)
 }
-
 func (m *SetUpPeerResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_SetUpPeerResponse.Marshal(b, m, deterministic)
 }
-
 func (m *SetUpPeerResponse) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_SetUpPeerResponse.Merge(m, src)
 }
-
 func (m *SetUpPeerResponse) XXX_Size() int {
 	return xxx_messageInfo_SetUpPeerResponse.Size(m)
 }
-
 func (m *SetUpPeerResponse) XXX_DiscardUnknown() {
 	xxx_messageInfo_SetUpPeerResponse.DiscardUnknown(m)
 }
@@ -159,12 +162,9 @@ type CreateOrFundRequest struct {
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *CreateOrFundRequest) Reset() { *m = CreateOrFundRequest{} }
-
+func (m *CreateOrFundRequest) Reset()         { *m = CreateOrFundRequest{} }
 func (m *CreateOrFundRequest) String() string { return proto.CompactTextString(m) }
-
-func (*CreateOrFundRequest) ProtoMessage() {}
-
+func (*CreateOrFundRequest) ProtoMessage()    {}
 func (*CreateOrFundRequest) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{2}
 }
@@ -172,19 +172,15 @@ func (*CreateOrFundRequest) Descriptor() ([]byte, []int) {
 func (m *CreateOrFundRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_CreateOrFundRequest.Unmarshal(m, b)
 }
-
 func (m *CreateOrFundRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_CreateOrFundRequest.Marshal(b, m, deterministic)
 }
-
 func (m *CreateOrFundRequest) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_CreateOrFundRequest.Merge(m, src)
 }
-
 func (m *CreateOrFundRequest) XXX_Size() int {
 	return xxx_messageInfo_CreateOrFundRequest.Size(m)
 }
-
 func (m *CreateOrFundRequest) XXX_DiscardUnknown() {
 	xxx_messageInfo_CreateOrFundRequest.DiscardUnknown(m)
 }
@@ -205,12 +201,9 @@ type CreateOrFundResponse struct {
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *CreateOrFundResponse) Reset() { *m = CreateOrFundResponse{} }
-
+func (m *CreateOrFundResponse) Reset()         { *m = CreateOrFundResponse{} }
 func (m *CreateOrFundResponse) String() string { return proto.CompactTextString(m) }
-
-func (*CreateOrFundResponse) ProtoMessage() {}
-
+func (*CreateOrFundResponse) ProtoMessage()    {}
 func (*CreateOrFundResponse) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{3}
 }
@@ -218,19 +211,15 @@ func (*CreateOrFundResponse) Descriptor() ([]byte, []int) {
 func (m *CreateOrFundResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_CreateOrFundResponse.Unmarshal(m, b)
 }
-
 func (m *CreateOrFundResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_CreateOrFundResponse.Marshal(b, m, deterministic)
 }
-
 func (m *CreateOrFundResponse) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_CreateOrFundResponse.Merge(m, src)
 }
-
 func (m *CreateOrFundResponse) XXX_Size() int {
 	return xxx_messageInfo_CreateOrFundResponse.Size(m)
 }
-
 func (m *CreateOrFundResponse) XXX_DiscardUnknown() {
 	xxx_messageInfo_CreateOrFundResponse.DiscardUnknown(m)
 }
@@ -258,12 +247,9 @@ type InitiatePaymentRequest struct {
 	XXX_sizecache        int32                                `json:"-"`
 }
 
-func (m *InitiatePaymentRequest) Reset() { *m = InitiatePaymentRequest{} }
-
+func (m *InitiatePaymentRequest) Reset()         { *m = InitiatePaymentRequest{} }
 func (m *InitiatePaymentRequest) String() string { return proto.CompactTextString(m) }
-
-func (*InitiatePaymentRequest) ProtoMessage() {}
-
+func (*InitiatePaymentRequest) ProtoMessage()    {}
 func (*InitiatePaymentRequest) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{4}
 }
@@ -271,19 +257,15 @@ func (*InitiatePaymentRequest) Descriptor() ([]byte, []int) {
 func (m *InitiatePaymentRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_InitiatePaymentRequest.Unmarshal(m, b)
 }
-
 func (m *InitiatePaymentRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_InitiatePaymentRequest.Marshal(b, m, deterministic)
 }
-
 func (m *InitiatePaymentRequest) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_InitiatePaymentRequest.Merge(m, src)
 }
-
 func (m *InitiatePaymentRequest) XXX_Size() int {
 	return xxx_messageInfo_InitiatePaymentRequest.Size(m)
 }
-
 func (m *InitiatePaymentRequest) XXX_DiscardUnknown() {
 	xxx_messageInfo_InitiatePaymentRequest.DiscardUnknown(m)
 }
@@ -371,12 +353,9 @@ type InitiatePaymentResponse struct {
 	XXX_sizecache                 int32    `json:"-"`
 }
 
-func (m *InitiatePaymentResponse) Reset() { *m = InitiatePaymentResponse{} }
-
+func (m *InitiatePaymentResponse) Reset()         { *m = InitiatePaymentResponse{} }
 func (m *InitiatePaymentResponse) String() string { return proto.CompactTextString(m) }
-
-func (*InitiatePaymentResponse) ProtoMessage() {}
-
+func (*InitiatePaymentResponse) ProtoMessage()    {}
 func (*InitiatePaymentResponse) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{5}
 }
@@ -384,19 +363,15 @@ func (*InitiatePaymentResponse) Descriptor() ([]byte, []int) {
 func (m *InitiatePaymentResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_InitiatePaymentResponse.Unmarshal(m, b)
 }
-
 func (m *InitiatePaymentResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_InitiatePaymentResponse.Marshal(b, m, deterministic)
 }
-
 func (m *InitiatePaymentResponse) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_InitiatePaymentResponse.Merge(m, src)
 }
-
 func (m *InitiatePaymentResponse) XXX_Size() int {
 	return xxx_messageInfo_InitiatePaymentResponse.Size(m)
 }
-
 func (m *InitiatePaymentResponse) XXX_DiscardUnknown() {
 	xxx_messageInfo_InitiatePaymentResponse.DiscardUnknown(m)
 }
@@ -424,12 +399,9 @@ type PaymentCommitRequest struct {
 	XXX_sizecache                     int32    `json:"-"`
 }
 
-func (m *PaymentCommitRequest) Reset() { *m = PaymentCommitRequest{} }
-
+func (m *PaymentCommitRequest) Reset()         { *m = PaymentCommitRequest{} }
 func (m *PaymentCommitRequest) String() string { return proto.CompactTextString(m) }
-
-func (*PaymentCommitRequest) ProtoMessage() {}
-
+func (*PaymentCommitRequest) ProtoMessage()    {}
 func (*PaymentCommitRequest) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{6}
 }
@@ -437,19 +409,15 @@ func (*PaymentCommitRequest) Descriptor() ([]byte, []int) {
 func (m *PaymentCommitRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PaymentCommitRequest.Unmarshal(m, b)
 }
-
 func (m *PaymentCommitRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_PaymentCommitRequest.Marshal(b, m, deterministic)
 }
-
 func (m *PaymentCommitRequest) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_PaymentCommitRequest.Merge(m, src)
 }
-
 func (m *PaymentCommitRequest) XXX_Size() int {
 	return xxx_messageInfo_PaymentCommitRequest.Size(m)
 }
-
 func (m *PaymentCommitRequest) XXX_DiscardUnknown() {
 	xxx_messageInfo_PaymentCommitRequest.DiscardUnknown(m)
 }
@@ -470,12 +438,9 @@ type PaymentCommitResponse struct {
 	XXX_sizecache                   int32    `json:"-"`
 }
 
-func (m *PaymentCommitResponse) Reset() { *m = PaymentCommitResponse{} }
-
+func (m *PaymentCommitResponse) Reset()         { *m = PaymentCommitResponse{} }
 func (m *PaymentCommitResponse) String() string { return proto.CompactTextString(m) }
-
-func (*PaymentCommitResponse) ProtoMessage() {}
-
+func (*PaymentCommitResponse) ProtoMessage()    {}
 func (*PaymentCommitResponse) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{7}
 }
@@ -483,19 +448,15 @@ func (*PaymentCommitResponse) Descriptor() ([]byte, []int) {
 func (m *PaymentCommitResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PaymentCommitResponse.Unmarshal(m, b)
 }
-
 func (m *PaymentCommitResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_PaymentCommitResponse.Marshal(b, m, deterministic)
 }
-
 func (m *PaymentCommitResponse) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_PaymentCommitResponse.Merge(m, src)
 }
-
 func (m *PaymentCommitResponse) XXX_Size() int {
 	return xxx_messageInfo_PaymentCommitResponse.Size(m)
 }
-
 func (m *PaymentCommitResponse) XXX_DiscardUnknown() {
 	xxx_messageInfo_PaymentCommitResponse.DiscardUnknown(m)
 }
@@ -517,12 +478,9 @@ type CommandRequest struct {
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *CommandRequest) Reset() { *m = CommandRequest{} }
-
+func (m *CommandRequest) Reset()         { *m = CommandRequest{} }
 func (m *CommandRequest) String() string { return proto.CompactTextString(m) }
-
-func (*CommandRequest) ProtoMessage() {}
-
+func (*CommandRequest) ProtoMessage()    {}
 func (*CommandRequest) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{8}
 }
@@ -530,19 +488,15 @@ func (*CommandRequest) Descriptor() ([]byte, []int) {
 func (m *CommandRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_CommandRequest.Unmarshal(m, b)
 }
-
 func (m *CommandRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_CommandRequest.Marshal(b, m, deterministic)
 }
-
 func (m *CommandRequest) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_CommandRequest.Merge(m, src)
 }
-
 func (m *CommandRequest) XXX_Size() int {
 	return xxx_messageInfo_CommandRequest.Size(m)
 }
-
 func (m *CommandRequest) XXX_DiscardUnknown() {
 	xxx_messageInfo_CommandRequest.DiscardUnknown(m)
 }
@@ -570,12 +524,9 @@ type CommandReply struct {
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *CommandReply) Reset() { *m = CommandReply{} }
-
+func (m *CommandReply) Reset()         { *m = CommandReply{} }
 func (m *CommandReply) String() string { return proto.CompactTextString(m) }
-
-func (*CommandReply) ProtoMessage() {}
-
+func (*CommandReply) ProtoMessage()    {}
 func (*CommandReply) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{9}
 }
@@ -583,19 +534,15 @@ func (*CommandReply) Descriptor() ([]byte, []int) {
 func (m *CommandReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_CommandReply.Unmarshal(m, b)
 }
-
 func (m *CommandReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_CommandReply.Marshal(b, m, deterministic)
 }
-
 func (m *CommandReply) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_CommandReply.Merge(m, src)
 }
-
 func (m *CommandReply) XXX_Size() int {
 	return xxx_messageInfo_CommandReply.Size(m)
 }
-
 func (m *CommandReply) XXX_DiscardUnknown() {
 	xxx_messageInfo_CommandReply.DiscardUnknown(m)
 }
@@ -616,17 +563,20 @@ type PaymentRequest struct {
 	Address              string   `protobuf:"bytes,4,opt,name=address,proto3" json:"address,omitempty"`
 	TransactionAmount    uint32   `protobuf:"varint,5,opt,name=transactionAmount,proto3" json:"transactionAmount,omitempty"`
 	Asset                string   `protobuf:"bytes,6,opt,name=asset,proto3" json:"asset,omitempty"`
+	IssuedAt             int64    `protobuf:"varint,7,opt,name=issuedAt,proto3" json:"issuedAt,omitempty"`
+	ExpiresAt            int64    `protobuf:"varint,8,opt,name=expiresAt,proto3" json:"expiresAt,omitempty"`
+	Nonce                string   `protobuf:"bytes,9,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	Signature            string   `protobuf:"bytes,10,opt,name=signature,proto3" json:"signature,omitempty"`
+	QuoteMultiplier      uint64   `protobuf:"varint,11,opt,name=quoteMultiplier,proto3" json:"quoteMultiplier,omitempty"`
+	QuoteUsedUnits       uint64   `protobuf:"varint,12,opt,name=quoteUsedUnits,proto3" json:"quoteUsedUnits,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *PaymentRequest) Reset() { *m = PaymentRequest{} }
-
+func (m *PaymentRequest) Reset()         { *m = PaymentRequest{} }
 func (m *PaymentRequest) String() string { return proto.CompactTextString(m) }
-
-func (*PaymentRequest) ProtoMessage() {}
-
+func (*PaymentRequest) ProtoMessage()    {}
 func (*PaymentRequest) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{10}
 }
@@ -634,19 +584,15 @@ func (*PaymentRequest) Descriptor() ([]byte, []int) {
 func (m *PaymentRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PaymentRequest.Unmarshal(m, b)
 }
-
 func (m *PaymentRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_PaymentRequest.Marshal(b, m, deterministic)
 }
-
 func (m *PaymentRequest) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_PaymentRequest.Merge(m, src)
 }
-
 func (m *PaymentRequest) XXX_Size() int {
 	return xxx_messageInfo_PaymentRequest.Size(m)
 }
-
 func (m *PaymentRequest) XXX_DiscardUnknown() {
 	xxx_messageInfo_PaymentRequest.DiscardUnknown(m)
 }
@@ -695,18 +641,57 @@ func (m *PaymentRequest) GetAsset() string {
 	return ""
 }
 
+func (m *PaymentRequest) GetIssuedAt() int64 {
+	if m != nil {
+		return m.IssuedAt
+	}
+	return 0
+}
+
+func (m *PaymentRequest) GetExpiresAt() int64 {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return 0
+}
+
+func (m *PaymentRequest) GetNonce() string {
+	if m != nil {
+		return m.Nonce
+	}
+	return ""
+}
+
+func (m *PaymentRequest) GetSignature() string {
+	if m != nil {
+		return m.Signature
+	}
+	return ""
+}
+
+func (m *PaymentRequest) GetQuoteMultiplier() uint64 {
+	if m != nil {
+		return m.QuoteMultiplier
+	}
+	return 0
+}
+
+func (m *PaymentRequest) GetQuoteUsedUnits() uint64 {
+	if m != nil {
+		return m.QuoteUsedUnits
+	}
+	return 0
+}
+
 type PaymentReply struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *PaymentReply) Reset() { *m = PaymentReply{} }
-
+func (m *PaymentReply) Reset()         { *m = PaymentReply{} }
 func (m *PaymentReply) String() string { return proto.CompactTextString(m) }
-
-func (*PaymentReply) ProtoMessage() {}
-
+func (*PaymentReply) ProtoMessage()    {}
 func (*PaymentReply) Descriptor() ([]byte, []int) {
 	return fileDescriptor_8f2b54376d4c2332, []int{11}
 }
@@ -714,19 +699,15 @@ func (*PaymentReply) Descriptor() ([]byte, []int) {
 func (m *PaymentReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PaymentReply.Unmarshal(m, b)
 }
-
 func (m *PaymentReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_PaymentReply.Marshal(b, m, deterministic)
 }
-
 func (m *PaymentReply) XXX_Merge(src proto.Message) {
 	xxx_messageInfo_PaymentReply.Merge(m, src)
 }
-
 func (m *PaymentReply) XXX_Size() int {
 	return xxx_messageInfo_PaymentReply.Size(m)
 }
-
 func (m *PaymentReply) XXX_DiscardUnknown() {
 	xxx_messageInfo_PaymentReply.DiscardUnknown(m)
 }
@@ -752,53 +733,61 @@ func init() {
 func init() { proto.RegisterFile("ppsidechannel.proto", fileDescriptor_8f2b54376d4c2332) }
 
 var fileDescriptor_8f2b54376d4c2332 = []byte{
-	// 724 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x55, 0xdd, 0x4e, 0x13, 0x41,
-	0x14, 0x66, 0xf9, 0xa9, 0x72, 0x68, 0x4b, 0x3b, 0xb4, 0xd0, 0xd4, 0x08, 0xb8, 0x17, 0xc4, 0x18,
-	0xb2, 0x21, 0x35, 0x31, 0x46, 0xa3, 0x09, 0x50, 0x15, 0x12, 0x12, 0x37, 0xdb, 0x92, 0x78, 0x3b,
-	0xec, 0x1e, 0xea, 0x24, 0xdd, 0x1f, 0x67, 0xa6, 0xe0, 0xbe, 0x80, 0xef, 0xe0, 0xab, 0x79, 0xe9,
-	0x5b, 0x78, 0x67, 0x66, 0x77, 0x5a, 0xa6, 0xdb, 0x05, 0xee, 0x76, 0xbe, 0xf3, 0x7f, 0xce, 0x77,
-	0xce, 0xc2, 0x56, 0x92, 0x08, 0x16, 0xa0, 0xff, 0x9d, 0x46, 0x11, 0x8e, 0x9d, 0x84, 0xc7, 0x32,
-	0xb6, 0xdf, 0x41, 0x63, 0x80, 0xf2, 0x32, 0x71, 0x11, 0xb9, 0x87, 0x3f, 0x26, 0x28, 0x24, 0x39,
-	0x80, 0xba, 0x90, 0x38, 0x1e, 0x53, 0x7e, 0x1c, 0x04, 0x1c, 0x85, 0xe8, 0x58, 0xfb, 0xd6, 0xcb,
-	0x75, 0xaf, 0x80, 0xda, 0x7f, 0x2c, 0x68, 0x1a, 0xc6, 0x22, 0x89, 0x23, 0x81, 0xe4, 0x0d, 0x54,
-	0x84, 0xa4, 0x72, 0x92, 0x5b, 0xd5, 0x7b, 0xbb, 0xce, 0x82, 0x4e, 0x8e, 0x0c, 0x32, 0x2d, 0x4f,
-	0x6b, 0xab, 0xa8, 0x92, 0xd3, 0x48, 0x50, 0x5f, 0xb2, 0x38, 0xfa, 0x16, 0xf0, 0xce, 0x72, 0x1e,
-	0x75, 0x1e, 0xb5, 0x11, 0x36, 0x0c, 0x73, 0xd2, 0x86, 0xa6, 0x72, 0x7d, 0x3c, 0xe6, 0x48, 0x83,
-	0xf4, 0xd3, 0x4f, 0x26, 0xa4, 0x68, 0x2c, 0x91, 0x3d, 0x78, 0x96, 0xc1, 0xbe, 0x1f, 0x4f, 0x22,
-	0x79, 0xca, 0x91, 0x2a, 0x7b, 0x55, 0x21, 0xe3, 0x18, 0x34, 0x2c, 0xb2, 0x0b, 0x5d, 0x43, 0xe1,
-	0xf3, 0x24, 0x0a, 0x58, 0x34, 0x9a, 0xc9, 0x97, 0xed, 0x0f, 0xb0, 0x95, 0x59, 0xe1, 0x57, 0xae,
-	0x84, 0x46, 0x6f, 0x0a, 0x59, 0x5a, 0xa5, 0x59, 0x1e, 0x41, 0x6b, 0xde, 0x5c, 0x77, 0xa7, 0x03,
-	0x4f, 0xc4, 0xc4, 0xf7, 0xa7, 0x4d, 0x7d, 0xea, 0x4d, 0x9f, 0xf6, 0x3f, 0x0b, 0xb6, 0xcf, 0x23,
-	0x26, 0x19, 0x95, 0xe8, 0xd2, 0x34, 0xc4, 0x48, 0x4e, 0x83, 0x3a, 0x40, 0xae, 0x79, 0x1c, 0x0e,
-	0xca, 0x86, 0x52, 0x22, 0x21, 0xdb, 0x50, 0xa1, 0xa1, 0x2a, 0x2b, 0x6b, 0xa1, 0xe5, 0xe9, 0x17,
-	0x69, 0xc1, 0x1a, 0x15, 0x02, 0x65, 0x67, 0x25, 0x33, 0xcd, 0x1f, 0x84, 0xc0, 0x6a, 0x88, 0x61,
-	0xdc, 0x59, 0xcd, 0xc0, 0xec, 0x9b, 0x1c, 0x42, 0x43, 0xc6, 0x85, 0x78, 0x6b, 0x4a, 0x7e, 0xb6,
-	0xe4, 0x2d, 0x48, 0xc8, 0x11, 0x90, 0x84, 0xe3, 0xcd, 0x70, 0xbe, 0x31, 0x15, 0xad, 0x5f, 0x22,
-	0x3b, 0xa9, 0xc1, 0x46, 0x80, 0x42, 0xb2, 0x28, 0x1b, 0x8b, 0xfd, 0xdb, 0x82, 0x9d, 0x85, 0xda,
-	0x75, 0xc7, 0xde, 0xc2, 0xce, 0xe8, 0xd6, 0xe5, 0x28, 0x30, 0x92, 0xc3, 0xb2, 0xd6, 0xdf, 0x27,
-	0x26, 0x7d, 0x78, 0x3e, 0xba, 0xf5, 0x90, 0x85, 0x57, 0x13, 0x2e, 0x30, 0x5c, 0xb4, 0xcf, 0x09,
-	0xf6, 0xb0, 0x92, 0x1d, 0x40, 0x4b, 0xa7, 0x74, 0x1a, 0x87, 0x21, 0x9b, 0x0d, 0xe5, 0x02, 0x5e,
-	0x08, 0x36, 0x8a, 0x30, 0x78, 0x28, 0x42, 0x9e, 0xe1, 0xe3, 0x8a, 0x36, 0x85, 0x76, 0x21, 0x8a,
-	0x2e, 0xff, 0x0c, 0xf6, 0x72, 0xeb, 0xfe, 0x5d, 0xbf, 0x4a, 0x83, 0x3c, 0xa6, 0x66, 0x0f, 0xa1,
-	0xae, 0x7c, 0xd3, 0x3b, 0x32, 0xef, 0xc3, 0x86, 0x9f, 0x23, 0xc3, 0x34, 0xc1, 0xcc, 0xcf, 0x9a,
-	0x67, 0x42, 0x86, 0xc6, 0x49, 0x1c, 0xa4, 0xba, 0x61, 0x26, 0x64, 0xf7, 0xa0, 0x3a, 0xf3, 0x9a,
-	0x8c, 0x53, 0x62, 0x43, 0x95, 0xeb, 0xdc, 0x33, 0x93, 0x3c, 0xb9, 0x39, 0xcc, 0xfe, 0x6b, 0x41,
-	0xbd, 0x40, 0xf1, 0x03, 0xa8, 0xf3, 0x78, 0x22, 0x51, 0x53, 0x0a, 0x15, 0xbd, 0x57, 0xd4, 0x5e,
-	0xcd, 0xa3, 0xe4, 0x15, 0x34, 0x04, 0xf2, 0x1b, 0xe6, 0xe3, 0x00, 0x85, 0x60, 0x71, 0x74, 0x1e,
-	0xe8, 0xac, 0x16, 0x70, 0xb2, 0x0b, 0xa0, 0x31, 0x0f, 0xaf, 0x35, 0xe7, 0x0d, 0x44, 0xed, 0x22,
-	0xd5, 0xdc, 0xce, 0xb9, 0x3f, 0x7d, 0x92, 0x43, 0x68, 0x1a, 0xfb, 0x7c, 0x9c, 0xef, 0x92, 0xe2,
-	0x7f, 0xcd, 0x5b, 0x14, 0xdc, 0xad, 0x55, 0xc5, 0x58, 0x2b, 0xbb, 0x0e, 0xd5, 0x59, 0x8d, 0xc9,
-	0x38, 0xed, 0xfd, 0x5a, 0x86, 0x9a, 0xeb, 0x0e, 0x58, 0x80, 0xa7, 0xf9, 0x05, 0x26, 0x3d, 0x58,
-	0x9f, 0x9d, 0x46, 0xd2, 0x74, 0x8a, 0x77, 0xb8, 0x4b, 0x16, 0x2f, 0x27, 0x79, 0x0f, 0x55, 0xf3,
-	0xae, 0x90, 0x96, 0x53, 0x72, 0xa5, 0xba, 0x6d, 0xa7, 0xf4, 0xf8, 0xf4, 0x61, 0xb3, 0xb0, 0x65,
-	0x64, 0xc7, 0x29, 0xbf, 0x39, 0xdd, 0x8e, 0x73, 0xdf, 0x42, 0x7e, 0x84, 0xda, 0x1c, 0x55, 0x49,
-	0xdb, 0x29, 0x5b, 0x90, 0xee, 0xb6, 0x53, 0xca, 0xe8, 0xde, 0x05, 0x74, 0x5c, 0x57, 0x8b, 0x2e,
-	0x25, 0x1b, 0x33, 0x99, 0x0e, 0xf2, 0xa1, 0xa8, 0x4b, 0x52, 0x77, 0x79, 0xac, 0xee, 0xa1, 0x26,
-	0x15, 0xd9, 0x74, 0xe6, 0x49, 0xdb, 0xad, 0x39, 0x26, 0xdf, 0x7a, 0x7d, 0x68, 0xcc, 0xbc, 0x7d,
-	0xa1, 0x12, 0x6f, 0x69, 0x6a, 0x78, 0x99, 0x96, 0xb9, 0xe9, 0x14, 0xca, 0xab, 0x39, 0xe6, 0x70,
-	0xae, 0x2a, 0xd9, 0xdf, 0xf0, 0xf5, 0xff, 0x00, 0x00, 0x00, 0xff, 0xff, 0x34, 0x13, 0x3c, 0xc1,
-	0x24, 0x07, 0x00, 0x00,
+	// 857 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x56, 0xdb, 0x6e, 0xdb, 0x46,
+	0x10, 0x0d, 0x7d, 0x51, 0xac, 0xb1, 0x6e, 0xde, 0xf8, 0x42, 0xa8, 0xad, 0xe3, 0xf2, 0x21, 0x10,
+	0x8a, 0x80, 0x30, 0x14, 0xa0, 0x28, 0x50, 0xb4, 0x80, 0x62, 0x37, 0x4d, 0x80, 0x14, 0x25, 0x28,
+	0x1b, 0xe8, 0xeb, 0x86, 0x9c, 0xa8, 0x0b, 0x90, 0x4b, 0x66, 0x77, 0x69, 0x47, 0x3f, 0xd0, 0x7f,
+	0xe8, 0x6b, 0x3f, 0xab, 0x7f, 0xd2, 0xb7, 0x62, 0x97, 0x2b, 0x89, 0xa4, 0x18, 0xfb, 0x4d, 0x7b,
+	0x66, 0x76, 0x66, 0x76, 0x66, 0xce, 0xa1, 0xe0, 0x59, 0x9e, 0x4b, 0x16, 0x63, 0xf4, 0x27, 0xe5,
+	0x1c, 0x13, 0x3f, 0x17, 0x99, 0xca, 0xbc, 0x3b, 0x18, 0xcd, 0x51, 0xdd, 0xe6, 0x01, 0xa2, 0x08,
+	0xf1, 0x53, 0x81, 0x52, 0x91, 0x17, 0x30, 0x90, 0x0a, 0x93, 0x84, 0x8a, 0x59, 0x1c, 0x0b, 0x94,
+	0xd2, 0x75, 0x2e, 0x9c, 0x49, 0x37, 0x6c, 0xa0, 0xe4, 0x6b, 0xe8, 0x2a, 0x96, 0xa2, 0x54, 0x34,
+	0xcd, 0xdd, 0x9d, 0x0b, 0x67, 0xb2, 0x1b, 0x6e, 0x00, 0x6d, 0x95, 0x6c, 0xc1, 0xa9, 0x2a, 0x04,
+	0xba, 0xbb, 0x26, 0xc0, 0x06, 0xf0, 0xfe, 0x75, 0xe0, 0xa8, 0x92, 0x58, 0xe6, 0x19, 0x97, 0x48,
+	0xbe, 0x87, 0x8e, 0x54, 0x54, 0x15, 0x65, 0xc6, 0xc1, 0xf4, 0xdc, 0xdf, 0xf2, 0x29, 0x91, 0xb9,
+	0xf1, 0x0a, 0xad, 0xb7, 0xae, 0x58, 0x09, 0xca, 0x25, 0x8d, 0x14, 0xcb, 0xf8, 0x1f, 0xb1, 0x30,
+	0xe5, 0x74, 0xc3, 0x06, 0xea, 0x21, 0x1c, 0x56, 0xae, 0x93, 0x13, 0x38, 0xd2, 0xa1, 0x67, 0x89,
+	0x40, 0x1a, 0x2f, 0x7f, 0xf9, 0xcc, 0xa4, 0x92, 0xa3, 0x27, 0xe4, 0x39, 0x7c, 0x65, 0xe0, 0x28,
+	0xca, 0x0a, 0xae, 0xae, 0x04, 0x52, 0x7d, 0x5f, 0x77, 0x87, 0x09, 0x8c, 0x47, 0x0e, 0x39, 0x87,
+	0x71, 0xc5, 0xe1, 0x4d, 0xc1, 0x63, 0xc6, 0x17, 0x6b, 0xfb, 0x8e, 0xf7, 0x13, 0x3c, 0x33, 0xb7,
+	0xf0, 0x77, 0xa1, 0x8d, 0x95, 0xbe, 0x36, 0xaa, 0x74, 0x5a, 0xab, 0xbc, 0x84, 0xe3, 0xfa, 0x75,
+	0xdb, 0x1d, 0x17, 0x9e, 0xca, 0x22, 0x8a, 0x56, 0x03, 0x39, 0x08, 0x57, 0x47, 0xef, 0x3f, 0x07,
+	0x4e, 0xdf, 0x71, 0xa6, 0x18, 0x55, 0x18, 0xd0, 0x65, 0x8a, 0x5c, 0xad, 0x92, 0xfa, 0x40, 0x3e,
+	0x8a, 0x2c, 0x9d, 0xb7, 0x0d, 0xb4, 0xc5, 0x42, 0x4e, 0xa1, 0x43, 0x53, 0xfd, 0x2c, 0xd3, 0x42,
+	0x27, 0xb4, 0x27, 0x72, 0x0c, 0xfb, 0x54, 0x4a, 0x54, 0x76, 0x94, 0xe5, 0x81, 0x10, 0xd8, 0x4b,
+	0x31, 0xcd, 0xdc, 0x3d, 0x03, 0x9a, 0xdf, 0xe4, 0x25, 0x8c, 0x54, 0xd6, 0xc8, 0xb7, 0xaf, 0xed,
+	0x6f, 0x9f, 0x84, 0x5b, 0x16, 0x72, 0x09, 0x24, 0x17, 0x78, 0x77, 0x53, 0x6f, 0x4c, 0xc7, 0xfa,
+	0xb7, 0xd8, 0x5e, 0xf7, 0xe1, 0x30, 0x46, 0xa9, 0x18, 0x37, 0x63, 0xf1, 0xfe, 0x76, 0xe0, 0x6c,
+	0xeb, 0xed, 0xb6, 0x63, 0x3f, 0xc0, 0xd9, 0xe2, 0x3e, 0x10, 0x28, 0x91, 0xab, 0x9b, 0xb6, 0xd6,
+	0x7f, 0xc9, 0x4c, 0xae, 0xe1, 0x9b, 0xc5, 0x7d, 0x88, 0x2c, 0xfd, 0x50, 0x08, 0x89, 0xe9, 0xf6,
+	0xfd, 0x72, 0xc1, 0x1e, 0x76, 0xf2, 0x62, 0x38, 0xb6, 0x25, 0x5d, 0x65, 0x69, 0xca, 0xd6, 0x43,
+	0x79, 0x0f, 0xdf, 0x6a, 0x2a, 0x60, 0xfc, 0x50, 0x86, 0xb2, 0xc2, 0xc7, 0x1d, 0x3d, 0x0a, 0x27,
+	0x8d, 0x2c, 0xf6, 0xf9, 0x6f, 0xe1, 0x79, 0x79, 0xfb, 0x7a, 0xd3, 0xaf, 0xd6, 0x24, 0x8f, 0xb9,
+	0x79, 0x37, 0x30, 0xd0, 0xb1, 0xe9, 0x66, 0x99, 0x2f, 0xe0, 0x30, 0x2a, 0x91, 0x9b, 0x65, 0x8e,
+	0x26, 0xce, 0x7e, 0x58, 0x85, 0x2a, 0x1e, 0xaf, 0xb3, 0x78, 0x69, 0x1b, 0x56, 0x85, 0xbc, 0x29,
+	0xf4, 0xd6, 0x51, 0xf3, 0x64, 0x49, 0x3c, 0xe8, 0x09, 0x5b, 0xbb, 0xb9, 0x52, 0x16, 0x57, 0xc3,
+	0xbc, 0x7f, 0x76, 0x61, 0xd0, 0x58, 0xf1, 0x17, 0x30, 0x10, 0x59, 0xa1, 0xd0, 0xae, 0x14, 0xea,
+	0xf5, 0xde, 0xd5, 0xbc, 0xaa, 0xa3, 0xe4, 0x3b, 0x18, 0x49, 0x14, 0x77, 0x2c, 0xc2, 0x39, 0x4a,
+	0xc9, 0x32, 0xfe, 0x2e, 0xb6, 0x55, 0x6d, 0xe1, 0xe4, 0x1c, 0xc0, 0x62, 0x21, 0x7e, 0xb4, 0x3b,
+	0x5f, 0x41, 0x34, 0x17, 0xa9, 0xdd, 0xed, 0x72, 0xf7, 0x57, 0x47, 0xf2, 0x12, 0x8e, 0x2a, 0x7c,
+	0x9e, 0x95, 0x5c, 0xd2, 0xfb, 0xdf, 0x0f, 0xb7, 0x0d, 0x1b, 0x5a, 0x75, 0xaa, 0xb4, 0x1a, 0xc3,
+	0x01, 0x93, 0xb2, 0xc0, 0x78, 0xa6, 0xdc, 0xa7, 0x46, 0x58, 0xd7, 0x67, 0xad, 0xab, 0xf8, 0x39,
+	0x67, 0x02, 0xe5, 0x4c, 0xb9, 0x07, 0xc6, 0xb8, 0x01, 0x74, 0x3c, 0x9e, 0xf1, 0x08, 0xdd, 0x6e,
+	0x19, 0xcf, 0x1c, 0xea, 0x5a, 0x0c, 0x0d, 0x2d, 0x26, 0x13, 0x18, 0x7e, 0x2a, 0x32, 0x85, 0xbf,
+	0x15, 0x89, 0x62, 0x79, 0xc2, 0x50, 0xb8, 0x87, 0x17, 0xce, 0x64, 0x2f, 0x6c, 0xc2, 0xba, 0xd3,
+	0x06, 0xba, 0x95, 0x18, 0xdf, 0x72, 0xa6, 0xa4, 0xdb, 0x33, 0x8e, 0x0d, 0xd4, 0x1b, 0x40, 0x6f,
+	0x3d, 0xa3, 0x3c, 0x59, 0x4e, 0xff, 0xda, 0x81, 0x7e, 0x10, 0xcc, 0x59, 0x8c, 0x57, 0xe5, 0xd7,
+	0x87, 0x4c, 0xa1, 0xbb, 0x96, 0x76, 0x72, 0xe4, 0x37, 0xbf, 0x41, 0x63, 0xb2, 0xad, 0xfc, 0xe4,
+	0x47, 0xe8, 0x55, 0x75, 0x91, 0x1c, 0xfb, 0x2d, 0x2a, 0x3b, 0x3e, 0xf1, 0x5b, 0xc5, 0xf3, 0x1a,
+	0x86, 0x0d, 0x95, 0x20, 0x67, 0x7e, 0xbb, 0x66, 0x8e, 0x5d, 0xff, 0x4b, 0x82, 0xf2, 0x33, 0xf4,
+	0x6b, 0x54, 0x23, 0x27, 0x7e, 0x1b, 0xc1, 0xc7, 0xa7, 0x7e, 0x2b, 0x23, 0xa7, 0xef, 0xc1, 0x0d,
+	0x02, 0x6b, 0xba, 0x55, 0x2c, 0x61, 0x6a, 0x39, 0x2f, 0x97, 0x4a, 0x2b, 0xe1, 0x20, 0x10, 0x99,
+	0xd6, 0x73, 0x4b, 0x0a, 0x32, 0xf4, 0xeb, 0xa4, 0x1b, 0xf7, 0xfd, 0x2a, 0x5f, 0xa6, 0xd7, 0x30,
+	0x5a, 0x47, 0xfb, 0x95, 0x2a, 0xbc, 0xa7, 0xcb, 0x4a, 0x94, 0xd5, 0x33, 0x87, 0x7e, 0xe3, 0x79,
+	0x7d, 0xbf, 0x36, 0x9c, 0x37, 0x30, 0x0c, 0x02, 0x1b, 0x77, 0xae, 0x04, 0xd2, 0x94, 0xbc, 0x82,
+	0x7e, 0x1d, 0x78, 0xa4, 0x92, 0x89, 0x73, 0xe9, 0x7c, 0xe8, 0x98, 0x7f, 0x14, 0xaf, 0xfe, 0x1f,
+	0x00, 0xfd, 0xf0, 0x87, 0x17, 0x68, 0x08, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -878,15 +867,12 @@ type UnimplementedPPSideChannelServer struct {
 func (*UnimplementedPPSideChannelServer) SetUpPeer(ctx context.Context, req *SetUpPeerRequest) (*SetUpPeerResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetUpPeer not implemented")
 }
-
 func (*UnimplementedPPSideChannelServer) CreateOrFund(ctx context.Context, req *CreateOrFundRequest) (*CreateOrFundResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateOrFund not implemented")
 }
-
 func (*UnimplementedPPSideChannelServer) InitiatePayment(ctx context.Context, req *InitiatePaymentRequest) (*InitiatePaymentResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method InitiatePayment not implemented")
 }
-
 func (*UnimplementedPPSideChannelServer) PaymentCommit(ctx context.Context, req *PaymentCommitRequest) (*PaymentCommitResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PaymentCommit not implemented")
 }
@@ -1135,3 +1121,107 @@ var _PPPaymentGateway_serviceDesc = grpc.ServiceDesc{
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "ppsidechannel.proto",
 }
+
+// PPCommandStreamClient is the client API for PPCommandStream service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type PPCommandStreamClient interface {
+	CommandStream(ctx context.Context, opts ...grpc.CallOption) (PPCommandStream_CommandStreamClient, error)
+}
+
+type pPCommandStreamClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewPPCommandStreamClient(cc *grpc.ClientConn) PPCommandStreamClient {
+	return &pPCommandStreamClient{cc}
+}
+
+func (c *pPCommandStreamClient) CommandStream(ctx context.Context, opts ...grpc.CallOption) (PPCommandStream_CommandStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_PPCommandStream_serviceDesc.Streams[0], "/PPCommandStream/CommandStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pPCommandStreamCommandStreamClient{stream}
+	return x, nil
+}
+
+type PPCommandStream_CommandStreamClient interface {
+	Send(*CommandRequest) error
+	Recv() (*CommandReply, error)
+	grpc.ClientStream
+}
+
+type pPCommandStreamCommandStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *pPCommandStreamCommandStreamClient) Send(m *CommandRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pPCommandStreamCommandStreamClient) Recv() (*CommandReply, error) {
+	m := new(CommandReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PPCommandStreamServer is the server API for PPCommandStream service.
+type PPCommandStreamServer interface {
+	CommandStream(PPCommandStream_CommandStreamServer) error
+}
+
+// UnimplementedPPCommandStreamServer can be embedded to have forward compatible implementations.
+type UnimplementedPPCommandStreamServer struct {
+}
+
+func (*UnimplementedPPCommandStreamServer) CommandStream(srv PPCommandStream_CommandStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method CommandStream not implemented")
+}
+
+func RegisterPPCommandStreamServer(s *grpc.Server, srv PPCommandStreamServer) {
+	s.RegisterService(&_PPCommandStream_serviceDesc, srv)
+}
+
+func _PPCommandStream_CommandStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PPCommandStreamServer).CommandStream(&pPCommandStreamCommandStreamServer{stream})
+}
+
+type PPCommandStream_CommandStreamServer interface {
+	Send(*CommandReply) error
+	Recv() (*CommandRequest, error)
+	grpc.ServerStream
+}
+
+type pPCommandStreamCommandStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *pPCommandStreamCommandStreamServer) Send(m *CommandReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pPCommandStreamCommandStreamServer) Recv() (*CommandRequest, error) {
+	m := new(CommandRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _PPCommandStream_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "PPCommandStream",
+	HandlerType: (*PPCommandStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CommandStream",
+			Handler:       _PPCommandStream_CommandStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ppsidechannel.proto",
+}
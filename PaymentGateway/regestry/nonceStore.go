@@ -0,0 +1,13 @@
+package regestry
+
+import "time"
+
+// NonceStore persists the nonces of the processed payment requests until the requests expire,
+// a signed request isn't paid again after a restart
+type NonceStore interface {
+	// Use records the nonce of the service, false if it is already recorded
+	Use(serviceAddress string, nonce string, expiresAt int64) (bool, error)
+	Release(serviceAddress string, nonce string) error
+	// Prune drops the nonces of the expired requests
+	Prune(now time.Time) error
+}
@@ -18,29 +18,63 @@ type PaymentManager interface {
 	AddDestinationNode(address, nodeId string, node node.PPNode) error
 
 	Run(ctx context.Context, async bool) error
+	// Done is closed when the payment run completes
+	Done() <-chan struct{}
 	Complete(msg *models.PaymentStatusResponseModel)
-	ProcessResponse(context context.Context, nodeId string, commandId string, response []byte) error
+	ProcessResponse(context context.Context, response *models.UtilityResponse) error
 	AddStatusCallbacker(scb StatusCallbacker)
 }
 
+// maxRouteAttempts bounds the routes tried by a session before its payment fails
+const maxRouteAttempts = 3
+
+// rerouteFunc builds the nodes of an alternative route which avoids the failed hops of the session
+type rerouteFunc func(ctx context.Context) (NodeManager, error)
+
 func NewPaymentManager(serviceClient client.ServiceClient,
-	request *models.ProcessPaymentRequest) PaymentManager {
+	session *models.PaymentSession, store PaymentSessionStore) PaymentManager {
+	return newPaymentManager(serviceClient, session, store)
+}
+
+func newPaymentManager(serviceClient client.ServiceClient,
+	session *models.PaymentSession, store PaymentSessionStore) *paymentManager {
 	return &paymentManager{
 		client:        serviceClient,
 		nodes:         NewNodeManager(),
 		ch:            make(chan *models.PaymentStatusResponseModel),
-		request:       request,
+		done:          make(chan struct{}),
+		request:       session.Request,
+		session:       session,
+		store:         store,
 		nodesByNodeId: map[string]proxy.ProxyNode{},
 	}
 }
 
 type paymentManager struct {
 	request           *models.ProcessPaymentRequest
+	session           *models.PaymentSession
+	store             PaymentSessionStore
 	client            client.ServiceClient
 	nodes             NodeManager
 	ch                chan *models.PaymentStatusResponseModel
+	done              chan struct{}
 	nodesByNodeId     map[string]proxy.ProxyNode
 	statusCallbackers []StatusCallbacker
+	reroute           rerouteFunc
+}
+
+func (pm *paymentManager) setState(state models.PaymentState, transactions []*models.PaymentTransactionReplacing, err error) {
+	pm.session.State = state
+	if transactions != nil {
+		pm.session.Transactions = transactions
+	}
+	if err != nil {
+		pm.session.Error = err.Error()
+	}
+	storeErr := pm.store.Update(pm.session)
+	if storeErr != nil {
+		log.Printf("Error saving payment session state SessionId=%s State=%s: %v", pm.session.ServiceSessionId, state, storeErr)
+	}
 }
 
 func (pm *paymentManager) AddStatusCallbacker(scb StatusCallbacker) {
@@ -60,37 +94,106 @@ func (pm *paymentManager) AddDestinationNode(address, nodeId string, node node.P
 	return err
 }
 
-func (pm *paymentManager) paymentProcess(ctx context.Context) error {
+// prepare creates, signs and verifies the transactions of the hops along the current route
+func (pm *paymentManager) prepare(ctx context.Context) ([]*models.PaymentTransactionReplacing, error) {
 	request := pm.request
 	sessionId := request.PaymentRequest.ServiceSessionId
 
 	// Initiate
-	transactions, err := pm.client.InitiatePayment(ctx, pm.nodes, request.PaymentRequest)
+	trs, err := pm.client.CreateTransactions(ctx, pm.nodes, request.PaymentRequest, request.MaxFee)
 
 	if err != nil {
-		log.Printf("Payment failed SessionId=%s", sessionId)
-		log.Print(err)
-		return fmt.Errorf("initiate payment failed: %v", err)
+		logPaymentFailure(sessionId, err)
+		return nil, fmt.Errorf("initiate payment failed: %w", err)
+	}
+	pm.setState(models.PaymentStateHopsCreated, nil, nil)
+
+	transactions, err := pm.client.SignTransactions(ctx, pm.nodes, request.PaymentRequest, trs)
+
+	if err != nil {
+		logPaymentFailure(sessionId, err)
+		return nil, fmt.Errorf("initiate payment failed: %w", err)
 	}
+	pm.setState(models.PaymentStateSigned, transactions, nil)
 
 	// Verify
 	err = pm.client.VerifyTransactions(ctx, transactions)
 
 	if err != nil {
-		log.Printf("Payment failed SessionId=%s", sessionId)
-		log.Print(err)
-		return fmt.Errorf("verification failed")
+		logPaymentFailure(sessionId, err)
+		return nil, fmt.Errorf("verification failed")
 	}
+	pm.setState(models.PaymentStateVerified, nil, nil)
+	return transactions, nil
+}
 
-	// Commit
-	err = pm.client.FinalizePayment(ctx, pm.nodes, request.PaymentRequest, transactions)
+// recordFailedHop adds the route node which caused the error to the failed hops of the session,
+// failures of the source or the destination can't be avoided by another route
+func (pm *paymentManager) recordFailedHop(err error) bool {
+	address, ok := models.FailedHopAddress(err)
+	if !ok {
+		return false
+	}
+	for _, rn := range pm.session.Route {
+		if rn.Address == address {
+			log.Printf("Hop failed SessionId=%s NodeId=%s Address=%s", pm.session.ServiceSessionId, rn.NodeId, address)
+			pm.session.FailedHops = append(pm.session.FailedHops, models.FailedHop{
+				NodeId:  rn.NodeId,
+				Address: address,
+				Error:   err.Error(),
+				Timeout: models.IsCommandTimeout(err),
+			})
+			return true
+		}
+	}
+	return false
+}
 
-	if err != nil {
+// switchRoute moves the session to an alternative route avoiding its failed hops
+func (pm *paymentManager) switchRoute(ctx context.Context) bool {
+	if pm.reroute == nil || ctx.Err() != nil {
+		return false
+	}
+	sessionId := pm.session.ServiceSessionId
+	nodes, routeErr := pm.reroute(ctx)
+	if routeErr != nil {
+		log.Printf("No alternative route SessionId=%s: %v", sessionId, routeErr)
+		return false
+	}
+	log.Printf("Retrying payment on an alternative route SessionId=%s", sessionId)
+	pm.nodes = nodes
+	pm.session.Transactions = nil
+	pm.setState(models.PaymentStateInitiated, nil, nil)
+	return true
+}
 
-		log.Printf("payment failed SessionId=%s", sessionId)
-		log.Print(err)
+func (pm *paymentManager) paymentProcess(ctx context.Context) error {
+	request := pm.request
+	sessionId := request.PaymentRequest.ServiceSessionId
+
+	transactions := pm.session.Transactions
+	// A session restored in the verified state is resumed from the commit
+	if pm.session.State != models.PaymentStateVerified {
+		var err error
+		transactions, err = pm.prepare(ctx)
+		for attempt := 1; err != nil; attempt++ {
+			if !pm.recordFailedHop(err) || attempt >= maxRouteAttempts || !pm.switchRoute(ctx) {
+				return err
+			}
+			transactions, err = pm.prepare(ctx)
+		}
+	}
 
-		return fmt.Errorf("finalize failed: %v", err)
+	// Commit
+	err := pm.client.FinalizePayment(ctx, pm.nodes, request.PaymentRequest, transactions)
+
+	if err != nil {
+		logPaymentFailure(sessionId, err)
+		revokeErr := pm.revoke(ctx, transactions)
+		if revokeErr != nil {
+			return fmt.Errorf("finalize failed: %w, revoke failed: %v", err, revokeErr)
+		}
+		return fmt.Errorf("finalize failed: %w", err)
 	}
 
 	log.Printf("Payment completed SessionId=%s, ServiceRef=%s", sessionId, request.PaymentRequest.ServiceRef)
@@ -98,6 +201,32 @@ func (pm *paymentManager) paymentProcess(ctx context.Context) error {
 	return nil
 }
 
+// revoke compensates the hops which committed before the finalization failed
+func (pm *paymentManager) revoke(ctx context.Context, transactions []*models.PaymentTransactionReplacing) error {
+	if ctx.Err() != nil {
+		// The hops have to be reached even if the payment was canceled
+		ctx = context.Background()
+	}
+	sessionId := pm.request.PaymentRequest.ServiceSessionId
+	log.Printf("Revoking payment SessionId=%s", sessionId)
+	err := pm.client.RevokePayment(ctx, pm.nodes, pm.request.PaymentRequest, transactions)
+	if err != nil {
+		log.Printf("Revoke failed SessionId=%s: %v", sessionId, err)
+		return err
+	}
+	log.Printf("Payment revoked SessionId=%s", sessionId)
+	return nil
+}
+
+func logPaymentFailure(sessionId string, err error) {
+	if models.IsCommandTimeout(err) {
+		log.Printf("Payment timed out SessionId=%s", sessionId)
+	} else {
+		log.Printf("Payment failed SessionId=%s", sessionId)
+	}
+	log.Print(err)
+}
+
 func (pm *paymentManager) callCallbackers(res *models.PaymentStatusResponseModel) error {
 	var outError error = nil
 	for _, cb := range pm.statusCallbackers {
@@ -109,20 +238,34 @@ func (pm *paymentManager) callCallbackers(res *models.PaymentStatusResponseModel
 	return outError
 }
 
+// complete reports the status to the callbackers, a failed report is kept in the session
+func (pm *paymentManager) complete(status *models.PaymentStatusResponseModel) error {
+	err := pm.callCallbackers(status)
+	if err != nil {
+		pm.setState(pm.session.State, nil, fmt.Errorf("error reporting payment status: %v", err))
+	}
+	return err
+}
+
 func (pm *paymentManager) runSync(ctx context.Context) error {
+	defer close(pm.done)
 	err := pm.paymentProcess(ctx)
 	if err != nil {
+		pm.setState(models.PaymentStateFailed, nil, err)
 		status := &models.PaymentStatusResponseModel{
 			SessionId: pm.request.PaymentRequest.ServiceSessionId,
 			Status:    0,
+			Error:     err.Error(),
+			Timeout:   models.IsCommandTimeout(err),
 		}
-		return pm.callCallbackers(status)
+		return pm.complete(status)
 	}
+	pm.setState(models.PaymentStateCommitted, nil, nil)
 	status := &models.PaymentStatusResponseModel{
 		SessionId: pm.request.PaymentRequest.ServiceSessionId,
 		Status:    1,
 	}
-	return pm.callCallbackers(status)
+	return pm.complete(status)
 }
 
 func (pm *paymentManager) Run(ctx context.Context, async bool) error {
@@ -130,7 +273,7 @@ func (pm *paymentManager) Run(ctx context.Context, async bool) error {
 		go func(pm *paymentManager) {
 			err := pm.runSync(context.Background())
 			if err != nil {
-				log.Fatalf("Error paymentProcess %v", err)
+				log.Printf("Error paymentProcess SessionId=%s: %v", pm.session.ServiceSessionId, err)
 			}
 		}(pm)
 		return nil
@@ -138,6 +281,10 @@ func (pm *paymentManager) Run(ctx context.Context, async bool) error {
 	return pm.runSync(ctx)
 }
 
+func (pm *paymentManager) Done() <-chan struct{} {
+	return pm.done
+}
+
 func (pm *paymentManager) Wait() *models.PaymentStatusResponseModel {
 	return <-pm.ch
 }
@@ -148,12 +295,12 @@ func (pm *paymentManager) Complete(msg *models.PaymentStatusResponseModel) {
 	}
 }
 
-func (pm *paymentManager) ProcessResponse(context context.Context, nodeId string, commandId string, response []byte) error {
-	proxyNode, ok := pm.nodesByNodeId[nodeId]
+func (pm *paymentManager) ProcessResponse(context context.Context, response *models.UtilityResponse) error {
+	proxyNode, ok := pm.nodesByNodeId[response.NodeId]
 	if !ok {
 		return fmt.Errorf("proxynode not found")
 	}
-	return proxyNode.ProcessResponse(context, commandId, response)
+	return proxyNode.ProcessResponse(context, response)
 }
 
 type StatusCallbacker interface {
@@ -2,7 +2,10 @@ package regestry
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"sync"
+	"time"
 
 	"paidpiper.com/payment-gateway/client"
 	"paidpiper.com/payment-gateway/commodity"
@@ -14,9 +17,13 @@ import (
 
 type PaymentManagerRegestry interface {
 	New(ctx context.Context, source node.PPNode, request *models.ProcessPaymentRequest) (PaymentManager, error)
+	Recover(ctx context.Context, source node.PPNode, async bool) error
 	Get(sessionId string) PaymentManager
 	Has(sessionId string) bool
 	Set(sessionId string, pm PaymentManager)
+	Drain(ctx context.Context) error
+	// Prune drops the nonces of the expired payment requests
+	Prune(now time.Time) error
 }
 
 type paymentManagerRegestryImpl struct {
@@ -27,6 +34,8 @@ type paymentManagerRegestryImpl struct {
 	torClient            torclient.TorClient
 	serviceClient        client.ServiceClient
 	commandClientFactory CommandClientFactory
+	sessionStore         PaymentSessionStore
+	nonceStore           NonceStore
 }
 type CommandClientFactory func(url string, sessionId string, nodeId string) (proxy.CommandClient, proxy.CommandResponseHandler)
 
@@ -34,7 +43,9 @@ func NewPaymentManagerRegestry(
 	commodityManager commodity.Manager,
 	serviceClient client.ServiceClient,
 	commandClientFactory CommandClientFactory,
-	torClient torclient.TorClient) PaymentManagerRegestry {
+	torClient torclient.TorClient,
+	sessionStore PaymentSessionStore,
+	nonceStore NonceStore) PaymentManagerRegestry {
 	return &paymentManagerRegestryImpl{
 		mutex:                &sync.Mutex{},
 		requestNodeManager:   map[string]PaymentManager{},
@@ -42,47 +53,135 @@ func NewPaymentManagerRegestry(
 		serviceClient:        serviceClient,
 		commandClientFactory: commandClientFactory,
 		torClient:            torClient,
+		sessionStore:         sessionStore,
+		nonceStore:           nonceStore,
 	}
 }
 
 func (g *paymentManagerRegestryImpl) New(ctx context.Context, source node.PPNode,
 	request *models.ProcessPaymentRequest) (PaymentManager, error) {
 
-	sessionId := request.PaymentRequest.ServiceSessionId
-	routingNotes := request.Route
-
-	paymentManager := NewPaymentManager(g.serviceClient, request)
-	statusCallbacker := NewStatusCallbacker(request.StatusCallbackUrl)
-	paymentManager.AddStatusCallbacker(statusCallbacker)
-	localAdderss := source.GetAddress()
-	err := paymentManager.AddSourceNode(localAdderss, source)
+	err := request.PaymentRequest.Verify(time.Now())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("payment request rejected: %w", err)
+	}
+	err = g.useNonce(request.PaymentRequest)
+	if err != nil {
+		return nil, fmt.Errorf("payment request rejected: %w", err)
+	}
+	created := false
+	defer func() {
+		if !created {
+			g.releaseNonce(request.PaymentRequest)
+		}
+	}()
+	sessionId := request.PaymentRequest.ServiceSessionId
+	session := &models.PaymentSession{
+		ServiceSessionId:   sessionId,
+		State:              models.PaymentStateInitiated,
+		Request:            request,
+		Route:              request.Route,
+		CommandCallbackUrl: request.CallbackUrl,
+	}
+	if request.StatusCallbackUrl != "" {
+		session.StatusCallbackUrls = append(session.StatusCallbackUrls, request.StatusCallbackUrl)
 	}
 
+	var alternatives [][]models.RoutingNode
 	//I THINK IT IS WRONG LINE
-	commandCallbackUrl := request.CallbackUrl
-	if routingNotes == nil {
+	if session.Route == nil {
 		routeResponse, err := g.torClient.GetRoute(ctx, sessionId)
 		if err != nil {
 			return nil, err
 		}
-		routingNotes = routeResponse.Route
-		commandCallbackUrl = routeResponse.CallbackUrl
+		session.Route = routeResponse.Route
+		alternatives = routeResponse.AlternativeRoutes
+		session.CommandCallbackUrl = routeResponse.CallbackUrl
 
 		if routeResponse.StatusCallbackUrl != "" {
-			statusCallbacker := NewStatusCallbacker(routeResponse.StatusCallbackUrl)
-			paymentManager.AddStatusCallbacker(statusCallbacker)
+			session.StatusCallbackUrls = append(session.StatusCallbackUrls, routeResponse.StatusCallbackUrl)
 		}
 	}
 
-	for _, rn := range routingNotes {
+	paymentManager, err := g.build(source, session)
+	if err != nil {
+		return nil, err
+	}
+	paymentManager.reroute = func(ctx context.Context) (NodeManager, error) {
+		route, err := g.nextRoute(ctx, session, &alternatives)
+		if err != nil {
+			return nil, err
+		}
+		session.Route = route
+		return g.buildNodes(source, session)
+	}
+	err = g.sessionStore.Create(session)
+	if err != nil {
+		return nil, fmt.Errorf("error saving payment session: %v", err)
+	}
+	created = true
+	return paymentManager, nil
+}
+
+// useNonce accepts a payment request once, its nonce is stored until the request expires
+func (g *paymentManagerRegestryImpl) useNonce(pr *models.PaymentRequest) error {
+	if pr.Nonce == "" {
+		return fmt.Errorf("payment request %s has no nonce", pr.ServiceSessionId)
+	}
+	ok, err := g.nonceStore.Use(pr.Address, pr.Nonce, pr.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error storing nonce of payment request %s: %v", pr.ServiceSessionId, err)
+	}
+	if !ok {
+		return fmt.Errorf("payment request %s was already processed", pr.ServiceSessionId)
+	}
+	return nil
+}
+
+// releaseNonce lets the payment request be processed again when its session wasn't created
+func (g *paymentManagerRegestryImpl) releaseNonce(pr *models.PaymentRequest) {
+	err := g.nonceStore.Release(pr.Address, pr.Nonce)
+	if err != nil {
+		log.Printf("Error releasing nonce of payment request %s: %v", pr.ServiceSessionId, err)
+	}
+}
+
+func (g *paymentManagerRegestryImpl) Prune(now time.Time) error {
+	return g.nonceStore.Prune(now)
+}
+
+func (g *paymentManagerRegestryImpl) build(source node.PPNode, session *models.PaymentSession) (*paymentManager, error) {
+	paymentManager := newPaymentManager(g.serviceClient, session, g.sessionStore)
+	for _, url := range session.StatusCallbackUrls {
+		paymentManager.AddStatusCallbacker(NewStatusCallbacker(url))
+	}
+	nodes, err := g.buildNodes(source, session)
+	if err != nil {
+		return nil, err
+	}
+	paymentManager.nodes = nodes
+	return paymentManager, nil
+}
+
+// buildNodes creates the chain of the session route between the source and the destination
+func (g *paymentManagerRegestryImpl) buildNodes(source node.PPNode, session *models.PaymentSession) (NodeManager, error) {
+	request := session.Request
+	sessionId := session.ServiceSessionId
+
+	nodes := NewNodeManager()
+	localAdderss := source.GetAddress()
+	err := nodes.AddSourceNode(localAdderss, source)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rn := range session.Route {
 		nodeId := rn.NodeId
 
-		commandClient, responseHandler := g.commandClientFactory(commandCallbackUrl, sessionId, nodeId)
+		commandClient, responseHandler := g.commandClientFactory(session.CommandCallbackUrl, sessionId, nodeId)
 
-		n := proxy.NewProxyNode(commandClient, responseHandler, rn.Address, 10)
-		err := paymentManager.AddChainNode(rn.Address, rn.NodeId, n)
+		n := proxy.NewProxyNode(commandClient, responseHandler, rn.Address)
+		err := nodes.AddChainNode(rn.Address, n)
 		if err != nil {
 			return nil, err
 		}
@@ -92,12 +191,132 @@ func (g *paymentManagerRegestryImpl) New(ctx context.Context, source node.PPNode
 	address := request.PaymentRequest.Address
 
 	commandClient, responseHandler := g.commandClientFactory(request.CallbackUrl, sessionId, nodeId)
-	proxyNode := proxy.NewProxyNode(commandClient, responseHandler, address, 0)
-	err = paymentManager.AddDestinationNode(address, nodeId, proxyNode)
+	proxyNode := proxy.NewProxyNode(commandClient, responseHandler, address)
+	err = nodes.AddDestinationNode(address, proxyNode)
 	if err != nil {
 		return nil, err
 	}
-	return paymentManager, nil
+	return nodes, nil
+}
+
+// nextRoute returns the first candidate route which avoids the failed hops of the session,
+// the tor client is re-queried once the candidates are exhausted
+func (g *paymentManagerRegestryImpl) nextRoute(ctx context.Context, session *models.PaymentSession,
+	alternatives *[][]models.RoutingNode) ([]models.RoutingNode, error) {
+	failed := session.FailedNodeIds()
+	for len(*alternatives) > 0 {
+		route := (*alternatives)[0]
+		*alternatives = (*alternatives)[1:]
+		if !routeContains(route, failed) {
+			return route, nil
+		}
+	}
+	routeResponse, err := g.torClient.GetRouteExcluding(ctx, session.ServiceSessionId, failed)
+	if err != nil {
+		return nil, err
+	}
+	if routeContains(routeResponse.Route, failed) {
+		return nil, fmt.Errorf("route of session %s contains failed hops", session.ServiceSessionId)
+	}
+	*alternatives = routeResponse.AlternativeRoutes
+	return routeResponse.Route, nil
+}
+
+func routeContains(route []models.RoutingNode, nodeIds []string) bool {
+	for _, rn := range route {
+		for _, id := range nodeIds {
+			if rn.NodeId == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Recover handles the sessions left unfinished by a previous run of the node. Sessions that
+// collected and verified all signatures, with transactions still within their timebounds, are
+// resumed from the commit; every other session is aborted and its status callbacks are notified.
+func (g *paymentManagerRegestryImpl) Recover(ctx context.Context, source node.PPNode, async bool) error {
+	sessions, err := g.sessionStore.GetUnfinished()
+	if err != nil {
+		return fmt.Errorf("error reading payment sessions: %v", err)
+	}
+	for _, session := range sessions {
+		sessionId := session.ServiceSessionId
+		if session.State == models.PaymentStateVerified {
+			err := validateTimebounds(session.Transactions)
+			if err == nil {
+				log.Printf("Resuming payment SessionId=%s", sessionId)
+				pm, err := g.build(source, session)
+				if err == nil {
+					g.Set(sessionId, pm)
+					g.resume(ctx, sessionId, pm, async)
+					continue
+				}
+			}
+			log.Printf("Payment SessionId=%s can't be resumed: %v", sessionId, err)
+		}
+		g.abort(session, fmt.Errorf("payment interrupted in state %s", session.State))
+	}
+	return nil
+}
+
+// resume runs the resumed payment, a failing status callback is logged instead of exiting like Run does
+func (g *paymentManagerRegestryImpl) resume(ctx context.Context, sessionId string, pm PaymentManager, async bool) {
+	run := func(ctx context.Context) {
+		err := pm.Run(ctx, false)
+		if err != nil {
+			log.Printf("Error resuming payment SessionId=%s: %v", sessionId, err)
+		}
+	}
+	if async {
+		go run(context.Background())
+		return
+	}
+	run(ctx)
+}
+
+func (g *paymentManagerRegestryImpl) abort(session *models.PaymentSession, reason error) {
+	log.Printf("Aborting payment SessionId=%s: %v", session.ServiceSessionId, reason)
+	session.State = models.PaymentStateFailed
+	session.Error = reason.Error()
+	err := g.sessionStore.Update(session)
+	if err != nil {
+		log.Printf("Error saving payment session state SessionId=%s: %v", session.ServiceSessionId, err)
+	}
+	status := &models.PaymentStatusResponseModel{
+		SessionId: session.ServiceSessionId,
+		Status:    0,
+		Error:     session.Error,
+	}
+	for _, url := range session.StatusCallbackUrls {
+		err := NewStatusCallbacker(url).Complete(status)
+		if err != nil {
+			log.Printf("Error calling status callback %s: %v", url, err)
+		}
+	}
+}
+
+func validateTimebounds(transactions []*models.PaymentTransactionReplacing) error {
+	if len(transactions) == 0 {
+		return fmt.Errorf("no transactions")
+	}
+	now := time.Now().Unix()
+	for _, t := range transactions {
+		wrapper, err := t.PendingTransaction.XDR.TransactionFromXDR()
+		if err != nil {
+			return err
+		}
+		tx, ok := wrapper.Transaction()
+		if !ok {
+			return fmt.Errorf("error deserializing transaction (GenericTransaction)")
+		}
+		maxTime := tx.Timebounds().MaxTime
+		if maxTime != 0 && maxTime < now {
+			return fmt.Errorf("transaction timebounds expired")
+		}
+	}
+	return nil
 }
 
 func (g *paymentManagerRegestryImpl) Has(sessionId string) bool {
@@ -125,3 +344,34 @@ func (g *paymentManagerRegestryImpl) Set(sessionId string, pm PaymentManager) {
 
 	g.requestNodeManager[sessionId] = pm
 }
+
+// Drain waits until the payments in progress complete, completed payments are removed.
+// It fails with the number of unfinished payments if the context ends first.
+func (g *paymentManagerRegestryImpl) Drain(ctx context.Context) error {
+	g.mutex.Lock()
+	managers := map[string]PaymentManager{}
+	for sessionId, pm := range g.requestNodeManager {
+		managers[sessionId] = pm
+	}
+	g.mutex.Unlock()
+
+	for sessionId, pm := range managers {
+		select {
+		case <-pm.Done():
+			g.mutex.Lock()
+			delete(g.requestNodeManager, sessionId)
+			g.mutex.Unlock()
+		case <-ctx.Done():
+			pending := 0
+			for _, pm := range managers {
+				select {
+				case <-pm.Done():
+				default:
+					pending++
+				}
+			}
+			return fmt.Errorf("%d payments still in progress: %w", pending, ctx.Err())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+package regestry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"paidpiper.com/payment-gateway/client"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node"
+	"paidpiper.com/payment-gateway/node/proxy"
+	"paidpiper.com/payment-gateway/torclient"
+)
+
+type memorySessionStore struct {
+	sessions map[string]*models.PaymentSession
+}
+
+func (s *memorySessionStore) Create(session *models.PaymentSession) error {
+	s.sessions[session.ServiceSessionId] = session
+	return nil
+}
+
+func (s *memorySessionStore) Update(session *models.PaymentSession) error {
+	s.sessions[session.ServiceSessionId] = session
+	return nil
+}
+
+func (s *memorySessionStore) GetUnfinished() ([]*models.PaymentSession, error) {
+	sessions := []*models.PaymentSession{}
+	for _, session := range s.sessions {
+		if !session.State.IsFinal() {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+type memoryNonceStore struct {
+	nonces map[string]int64
+}
+
+func newMemoryNonceStore() *memoryNonceStore {
+	return &memoryNonceStore{nonces: map[string]int64{}}
+}
+
+func (s *memoryNonceStore) Use(serviceAddress string, nonce string, expiresAt int64) (bool, error) {
+	key := serviceAddress + "/" + nonce
+	if _, ok := s.nonces[key]; ok {
+		return false, nil
+	}
+	s.nonces[key] = expiresAt
+	return true, nil
+}
+
+func (s *memoryNonceStore) Release(serviceAddress string, nonce string) error {
+	delete(s.nonces, serviceAddress+"/"+nonce)
+	return nil
+}
+
+func (s *memoryNonceStore) Prune(now time.Time) error {
+	for key, expiresAt := range s.nonces {
+		if expiresAt <= now.Unix() {
+			delete(s.nonces, key)
+		}
+	}
+	return nil
+}
+
+func TestRecoverAbortsInterruptedSessions(t *testing.T) {
+	notified := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := &models.PaymentStatusResponseModel{}
+		err := json.NewDecoder(r.Body).Decode(status)
+		if err != nil {
+			t.Error(err)
+		}
+		notified[status.SessionId] = status.Status + 1
+	}))
+	defer server.Close()
+
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	for _, s := range []struct {
+		id    string
+		state models.PaymentState
+	}{
+		{"initiated", models.PaymentStateInitiated},
+		{"signed", models.PaymentStateSigned},
+		// No transactions to resume from
+		{"verified", models.PaymentStateVerified},
+		{"committed", models.PaymentStateCommitted},
+	} {
+		store.Create(&models.PaymentSession{
+			ServiceSessionId:   s.id,
+			State:              s.state,
+			Request:            &models.ProcessPaymentRequest{PaymentRequest: &models.PaymentRequest{ServiceSessionId: s.id}},
+			StatusCallbackUrls: []string{server.URL},
+		})
+	}
+
+	g := NewPaymentManagerRegestry(nil, nil, nil, nil, store, newMemoryNonceStore())
+	err := g.Recover(context.Background(), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"initiated", "signed", "verified"} {
+		if store.sessions[id].State != models.PaymentStateFailed {
+			t.Errorf("session %s should be failed, is %s", id, store.sessions[id].State)
+		}
+		if notified[id] != 1 {
+			t.Errorf("failure of session %s wasn't reported", id)
+		}
+	}
+	if store.sessions["committed"].State != models.PaymentStateCommitted {
+		t.Errorf("committed session changed")
+	}
+	if _, ok := notified["committed"]; ok {
+		t.Errorf("committed session reported")
+	}
+}
+
+type addressNode struct {
+	node.PPNode
+	address string
+}
+
+func (n *addressNode) GetAddress() string {
+	return n.address
+}
+
+// routeTorClient returns the route without the excluded nodes
+type routeTorClient struct {
+	route    []models.RoutingNode
+	excluded [][]string
+}
+
+func (c *routeTorClient) GetRoute(ctx context.Context, sessionId string) (*models.RouteResponse, error) {
+	return &models.RouteResponse{Route: c.route}, nil
+}
+
+func (c *routeTorClient) GetRouteExcluding(ctx context.Context, sessionId string, excludeNodeIds []string) (*models.RouteResponse, error) {
+	c.excluded = append(c.excluded, excludeNodeIds)
+	route := []models.RoutingNode{}
+	for _, rn := range c.route {
+		if !routeContains([]models.RoutingNode{rn}, excludeNodeIds) {
+			route = append(route, rn)
+		}
+	}
+	return &models.RouteResponse{Route: route}, nil
+}
+
+// failingHopClient fails the creation of the transactions on the routes through the failing hop
+type failingHopClient struct {
+	client.ServiceClient
+	failingAddress string
+	routes         [][]string
+}
+
+func (c *failingHopClient) CreateTransactions(ctx context.Context, nodes client.NodeChain, pr *models.PaymentRequest, maxFee models.TransactionAmount) (*client.TransactionsCollection, error) {
+	route := []string{}
+	for _, n := range nodes.GetAllNodes() {
+		route = append(route, n.GetAddress())
+	}
+	c.routes = append(c.routes, route)
+	if nodes.GetNodeByAddress(c.failingAddress) != nil {
+		return nil, fmt.Errorf("create transactions error:%w", &models.HopError{
+			Address: c.failingAddress,
+			Err:     &models.CommandTimeoutError{NodeId: c.failingAddress},
+		})
+	}
+	return &client.TransactionsCollection{}, nil
+}
+
+func (c *failingHopClient) SignTransactions(context.Context, client.NodeChain, *models.PaymentRequest, *client.TransactionsCollection) ([]*models.PaymentTransactionReplacing, error) {
+	return []*models.PaymentTransactionReplacing{}, nil
+}
+
+func (c *failingHopClient) VerifyTransactions(context.Context, []*models.PaymentTransactionReplacing) error {
+	return nil
+}
+
+func (c *failingHopClient) FinalizePayment(context.Context, client.NodeChain, *models.PaymentRequest, []*models.PaymentTransactionReplacing) error {
+	return nil
+}
+
+func newRouteTestRegestry(serviceClient client.ServiceClient, torClient torclient.TorClient, store PaymentSessionStore) PaymentManagerRegestry {
+	return newNonceTestRegestry(serviceClient, torClient, store, newMemoryNonceStore())
+}
+
+func newNonceTestRegestry(serviceClient client.ServiceClient, torClient torclient.TorClient, store PaymentSessionStore, nonces NonceStore) PaymentManagerRegestry {
+	commandClientFactory := func(url string, sessionId string, nodeId string) (proxy.CommandClient, proxy.CommandResponseHandler) {
+		return nil, nil
+	}
+	return NewPaymentManagerRegestry(nil, serviceClient, commandClientFactory, torClient, store, nonces)
+}
+
+func signedPaymentRequest(t *testing.T, sessionId string, validity time.Duration) *models.PaymentRequest {
+	kp := keypair.MustRandom()
+	pr := &models.PaymentRequest{
+		ServiceSessionId: sessionId,
+		Address:          kp.Address(),
+		IssuedAt:         time.Now().Unix(),
+		ExpiresAt:        time.Now().Add(validity).Unix(),
+		Nonce:            "nonce",
+	}
+	signature, err := kp.Sign(pr.SigningPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.Signature = base64.StdEncoding.EncodeToString(signature)
+	return pr
+}
+
+func testRoute(ids ...string) []models.RoutingNode {
+	route := []models.RoutingNode{}
+	for _, id := range ids {
+		route = append(route, models.RoutingNode{NodeId: id, Address: id})
+	}
+	return route
+}
+
+func TestPaymentRetriesAlternativeRoute(t *testing.T) {
+	serviceClient := &failingHopClient{failingAddress: "hop2"}
+	torClient := &routeTorClient{route: testRoute("hop1", "hop2", "hop3")}
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	g := newRouteTestRegestry(serviceClient, torClient, store)
+
+	request := &models.ProcessPaymentRequest{
+		PaymentRequest: signedPaymentRequest(t, "session", time.Minute),
+		NodeId:         "service",
+	}
+	pm, err := g.New(context.Background(), &addressNode{address: "source"}, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pm.Run(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := store.sessions["session"]
+	if session.State != models.PaymentStateCommitted {
+		t.Errorf("session should be committed, is %s: %s", session.State, session.Error)
+	}
+	if len(serviceClient.routes) != 2 || strings.Join(serviceClient.routes[1], ",") != "source,hop1,hop3,"+request.PaymentRequest.Address {
+		t.Errorf("unexpected routes %v", serviceClient.routes)
+	}
+	if len(torClient.excluded) != 1 || strings.Join(torClient.excluded[0], ",") != "hop2" {
+		t.Errorf("failed hop wasn't excluded: %v", torClient.excluded)
+	}
+	if len(session.FailedHops) != 1 || session.FailedHops[0].NodeId != "hop2" || !session.FailedHops[0].Timeout {
+		t.Errorf("unexpected failed hops %v", session.FailedHops)
+	}
+	if len(session.Route) != 2 {
+		t.Errorf("session route wasn't replaced: %v", session.Route)
+	}
+}
+
+func TestPaymentFailsOnDestinationError(t *testing.T) {
+	pr := signedPaymentRequest(t, "session", time.Minute)
+	serviceClient := &failingHopClient{failingAddress: pr.Address}
+	torClient := &routeTorClient{route: testRoute("hop1")}
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	g := newRouteTestRegestry(serviceClient, torClient, store)
+
+	request := &models.ProcessPaymentRequest{
+		PaymentRequest: pr,
+		NodeId:         "service",
+	}
+	pm, err := g.New(context.Background(), &addressNode{address: "source"}, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pm.Run(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := store.sessions["session"]
+	if session.State != models.PaymentStateFailed {
+		t.Errorf("session should be failed, is %s", session.State)
+	}
+	if len(serviceClient.routes) != 1 || len(torClient.excluded) != 0 || len(session.FailedHops) != 0 {
+		t.Errorf("destination failure shouldn't be rerouted")
+	}
+}
+
+func TestNewRejectsInvalidPaymentRequest(t *testing.T) {
+	torClient := &routeTorClient{route: testRoute("hop1")}
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	g := newRouteTestRegestry(&failingHopClient{}, torClient, store)
+
+	expired := signedPaymentRequest(t, "expired", -time.Second)
+	tampered := signedPaymentRequest(t, "tampered", time.Minute)
+	tampered.Amount = 1
+	for pr, expected := range map[*models.PaymentRequest]error{
+		expired:  models.ErrPaymentRequestExpired,
+		tampered: models.ErrPaymentRequestSignature,
+	} {
+		_, err := g.New(context.Background(), &addressNode{address: "source"}, &models.ProcessPaymentRequest{PaymentRequest: pr})
+		if !errors.Is(err, expected) {
+			t.Errorf("session %s: expected %v, got %v", pr.ServiceSessionId, expected, err)
+		}
+	}
+	if len(store.sessions) != 0 {
+		t.Errorf("sessions of rejected requests were created")
+	}
+}
+
+func TestNewRejectsReplayedPaymentRequest(t *testing.T) {
+	torClient := &routeTorClient{route: testRoute("hop1")}
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	g := newRouteTestRegestry(&failingHopClient{}, torClient, store)
+	source := &addressNode{address: "source"}
+
+	pr := signedPaymentRequest(t, "session", time.Minute)
+	_, err := g.New(context.Background(), source, &models.ProcessPaymentRequest{PaymentRequest: pr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.New(context.Background(), source, &models.ProcessPaymentRequest{PaymentRequest: pr})
+	if err == nil {
+		t.Errorf("replayed payment request was accepted")
+	}
+}
+
+func TestNewRejectsPaymentRequestReplayedAfterRestart(t *testing.T) {
+	torClient := &routeTorClient{route: testRoute("hop1")}
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	nonces := newMemoryNonceStore()
+	source := &addressNode{address: "source"}
+
+	pr := signedPaymentRequest(t, "session", time.Minute)
+	g := newNonceTestRegestry(&failingHopClient{}, torClient, store, nonces)
+	_, err := g.New(context.Background(), source, &models.ProcessPaymentRequest{PaymentRequest: pr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newNonceTestRegestry(&failingHopClient{}, torClient, store, nonces)
+	_, err = restarted.New(context.Background(), source, &models.ProcessPaymentRequest{PaymentRequest: pr})
+	if err == nil {
+		t.Errorf("payment request replayed after a restart was accepted")
+	}
+
+	// The nonce is kept until the request expires
+	err = restarted.Prune(time.Now())
+	if err != nil || len(nonces.nonces) != 1 {
+		t.Errorf("the nonce of the unexpired request was pruned: %v", err)
+	}
+	err = restarted.Prune(time.Now().Add(time.Hour))
+	if err != nil || len(nonces.nonces) != 0 {
+		t.Errorf("the nonce of the expired request wasn't pruned: %v", err)
+	}
+}
+
+type blockingFinalizeClient struct {
+	failingHopClient
+	release chan struct{}
+}
+
+func (c *blockingFinalizeClient) FinalizePayment(context.Context, client.NodeChain, *models.PaymentRequest, []*models.PaymentTransactionReplacing) error {
+	<-c.release
+	return nil
+}
+
+func TestDrainWaitsForPayments(t *testing.T) {
+	serviceClient := &blockingFinalizeClient{release: make(chan struct{})}
+	torClient := &routeTorClient{route: testRoute("hop1")}
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	g := newRouteTestRegestry(serviceClient, torClient, store)
+
+	request := &models.ProcessPaymentRequest{PaymentRequest: signedPaymentRequest(t, "session", time.Minute)}
+	pm, err := g.New(context.Background(), &addressNode{address: "source"}, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Set("session", pm)
+	err = pm.Run(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = g.Drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.HasPrefix(err.Error(), "1 payments") {
+		t.Errorf("drain should time out with the payment in progress: %v", err)
+	}
+
+	close(serviceClient.release)
+	err = g.Drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Has("session") {
+		t.Errorf("completed payment wasn't removed")
+	}
+	if store.sessions["session"].State != models.PaymentStateCommitted {
+		t.Errorf("session should be committed, is %s", store.sessions["session"].State)
+	}
+}
@@ -1,7 +1,13 @@
 package regestry
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+
+	"paidpiper.com/payment-gateway/client"
+	"paidpiper.com/payment-gateway/models"
 )
 
 func TestPaymentManager(t *testing.T) {
@@ -50,3 +56,102 @@ func TestPaymentManager(t *testing.T) {
 
 // 	return pm, nil
 // }
+
+type statusRecorder struct {
+	statuses []*models.PaymentStatusResponseModel
+}
+
+func (r *statusRecorder) Complete(msg *models.PaymentStatusResponseModel) error {
+	r.statuses = append(r.statuses, msg)
+	return nil
+}
+
+// failingFinalizeClient signs the hops and fails the commit
+type failingFinalizeClient struct {
+	client.ServiceClient
+	transactions []*models.PaymentTransactionReplacing
+	revoked      []*models.PaymentTransactionReplacing
+}
+
+func (c *failingFinalizeClient) CreateTransactions(context.Context, client.NodeChain, *models.PaymentRequest, models.TransactionAmount) (*client.TransactionsCollection, error) {
+	return &client.TransactionsCollection{}, nil
+}
+
+func (c *failingFinalizeClient) SignTransactions(context.Context, client.NodeChain, *models.PaymentRequest, *client.TransactionsCollection) ([]*models.PaymentTransactionReplacing, error) {
+	return c.transactions, nil
+}
+
+func (c *failingFinalizeClient) VerifyTransactions(context.Context, []*models.PaymentTransactionReplacing) error {
+	return nil
+}
+
+func (c *failingFinalizeClient) FinalizePayment(context.Context, client.NodeChain, *models.PaymentRequest, []*models.PaymentTransactionReplacing) error {
+	return errors.New("commit rejected")
+}
+
+func (c *failingFinalizeClient) RevokePayment(_ context.Context, _ client.NodeChain, _ *models.PaymentRequest, trs []*models.PaymentTransactionReplacing) error {
+	c.revoked = trs
+	return nil
+}
+
+func TestFinalizeFailureRevokesTransactions(t *testing.T) {
+	transactions := []*models.PaymentTransactionReplacing{{}, {}}
+	serviceClient := &failingFinalizeClient{transactions: transactions}
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	session := &models.PaymentSession{
+		ServiceSessionId: "session",
+		Request:          &models.ProcessPaymentRequest{PaymentRequest: &models.PaymentRequest{ServiceSessionId: "session"}},
+	}
+	store.Create(session)
+	recorder := &statusRecorder{}
+
+	pm := NewPaymentManager(serviceClient, session, store)
+	pm.AddStatusCallbacker(recorder)
+	err := pm.Run(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(serviceClient.revoked) != len(transactions) {
+		t.Errorf("the signed transactions should be revoked, revoked %d", len(serviceClient.revoked))
+	}
+	if session.State != models.PaymentStateFailed {
+		t.Errorf("session should be failed, is %s", session.State)
+	}
+	if len(recorder.statuses) != 1 || recorder.statuses[0].Status != 0 {
+		t.Fatalf("failure wasn't reported")
+	}
+	if !strings.Contains(recorder.statuses[0].Error, "commit rejected") {
+		t.Errorf("unexpected error %s", recorder.statuses[0].Error)
+	}
+}
+
+type failingCallbacker struct{}
+
+func (failingCallbacker) Complete(*models.PaymentStatusResponseModel) error {
+	return errors.New("callback unreachable")
+}
+
+func TestAsyncCallbackFailureIsKeptInSession(t *testing.T) {
+	serviceClient := &failingFinalizeClient{}
+	store := &memorySessionStore{sessions: map[string]*models.PaymentSession{}}
+	session := &models.PaymentSession{
+		ServiceSessionId: "session",
+		Request:          &models.ProcessPaymentRequest{PaymentRequest: &models.PaymentRequest{ServiceSessionId: "session"}},
+	}
+	store.Create(session)
+
+	pm := NewPaymentManager(serviceClient, session, store)
+	pm.AddStatusCallbacker(failingCallbacker{})
+	if err := pm.Run(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	<-pm.Done()
+
+	if session.State != models.PaymentStateFailed {
+		t.Errorf("session should be failed, is %s", session.State)
+	}
+	if !strings.Contains(session.Error, "callback unreachable") {
+		t.Errorf("callback failure isn't kept in the session: %s", session.Error)
+	}
+}
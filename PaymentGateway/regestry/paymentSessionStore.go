@@ -0,0 +1,10 @@
+package regestry
+
+import "paidpiper.com/payment-gateway/models"
+
+// PaymentSessionStore persists the payment state machine of the sessions started by the node
+type PaymentSessionStore interface {
+	Create(session *models.PaymentSession) error
+	Update(session *models.PaymentSession) error
+	GetUnfinished() ([]*models.PaymentSession, error)
+}
@@ -0,0 +1,243 @@
+package root
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/strkey"
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/txnbuild"
+	"paidpiper.com/payment-gateway/config"
+)
+
+// Channel accounts source the node operations which don't have to consume a sequence number of the
+// node account, e.g. the sequence bumps. The node account is the source of the operations and signs
+// them, the channel only pays the fee and provides the sequence. Each channel tracks its own sequence,
+// so the node operations are submitted concurrently, one per channel.
+
+type channel struct {
+	keyPair  *keypair.Full
+	sequence int64 // of the last transaction, zero if it has to be read from horizon
+}
+
+type channelPool struct {
+	addresses []string
+	free      chan *channel
+}
+
+func newChannelPool(keyPairs []*keypair.Full) *channelPool {
+	pool := &channelPool{
+		free: make(chan *channel, len(keyPairs)),
+	}
+	for _, kp := range keyPairs {
+		pool.addresses = append(pool.addresses, kp.Address())
+		pool.free <- &channel{keyPair: kp}
+	}
+	return pool
+}
+
+// acquire waits for a channel which isn't submitting a transaction
+func (p *channelPool) acquire() *channel {
+	return <-p.free
+}
+
+func (p *channelPool) release(c *channel) {
+	p.free <- c
+}
+
+// deriveChannelKeyPair derives the channel account from the node seed, the same channels are used after a restart
+func deriveChannelKeyPair(node *keypair.Full, index int) (*keypair.Full, error) {
+	rawSeed, err := strkey.Decode(strkey.VersionByteSeed, node.Seed())
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	hash.Write(rawSeed)
+	hash.Write([]byte("channel"))
+	binary.Write(hash, binary.BigEndian, uint32(index))
+	var channelSeed [32]byte
+	copy(channelSeed[:], hash.Sum(nil))
+	return keypair.FromRawSeed(channelSeed)
+}
+
+// SetUpChannels sets up the channel pool from the channel key pairs and the number of channels derived from the node seed,
+// the missing channel accounts are created by the node account
+func (api *rootApi) SetUpChannels(keyPairs []*keypair.Full, derived int) error {
+	for _, kp := range keyPairs {
+		if kp.Address() == api.GetAddress() {
+			return fmt.Errorf("the node account can't be a channel account")
+		}
+	}
+	keyPairs = append([]*keypair.Full(nil), keyPairs...)
+	nodeKeyPair, inProcess := api.signer.(*keyPairSigner)
+	if derived > 0 && !inProcess {
+		return fmt.Errorf("channel accounts are derived from the node seed, which the remote signer keeps, configure the channel keystores instead")
+	}
+	for i := 0; i < derived; i++ {
+		kp, err := deriveChannelKeyPair(nodeKeyPair.keyPair, i)
+		if err != nil {
+			return fmt.Errorf("error deriving channel account: %v", err)
+		}
+		keyPairs = append(keyPairs, kp)
+	}
+	if len(keyPairs) == 0 {
+		return nil
+	}
+	err := api.createChannelAccounts(keyPairs)
+	if err != nil {
+		return err
+	}
+	api.channels = newChannelPool(keyPairs)
+	log.Infof("Node %s uses %d channel accounts: %v", api.GetAddress(), len(keyPairs), api.channels.addresses)
+	return nil
+}
+
+func (api *rootApi) createChannelAccounts(keyPairs []*keypair.Full) error {
+	var ops []txnbuild.Operation
+	for _, kp := range keyPairs {
+		_, err := api.GetPeerAccount(kp.Address())
+		if err == nil {
+			continue
+		}
+		if Kind(err) != ErrNotFound {
+			return fmt.Errorf("error reading channel account %s: %w", kp.Address(), err)
+		}
+		ops = append(ops, &txnbuild.CreateAccount{
+			Destination: kp.Address(),
+			Amount:      config.StellarChannelAccountStartingBalance,
+		})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	sequence, err := api.allocateSequence()
+	if err != nil {
+		return err
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{
+			AccountID: api.GetAddress(),
+			Sequence:  sequence,
+		},
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              api.GetBaseFee(),
+		Timebounds:           txnbuild.NewTimeout(config.StellarImmediateOperationTimeoutSec),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating channel accounts tx: %v", err)
+	}
+	tx, err = api.Sign(tx)
+	if err != nil {
+		return fmt.Errorf("error signing channel accounts tx: %v", err)
+	}
+	_, err = api.client.SubmitTransaction(tx)
+	if err != nil {
+		return fmt.Errorf("error creating channel accounts: %w", err)
+	}
+	api.sequences.submitted(sequence + 1)
+	log.Infof("Created %d channel accounts", len(ops))
+	return nil
+}
+
+// GetChannels returns the addresses of the channel accounts, empty without the channel pool
+func (api *rootApi) GetChannels() []string {
+	if api.channels == nil {
+		return nil
+	}
+	return api.channels.addresses
+}
+
+// SubmitNodeOperations submits operations sourced by the node account from a channel account, without consuming
+// a node sequence. Without channels the node account is the source of the transaction.
+func (api *rootApi) SubmitNodeOperations(ops ...txnbuild.Operation) error {
+	for _, op := range ops {
+		if op.GetSourceAccount() != api.GetAddress() {
+			return fmt.Errorf("operation %T isn't sourced by the node account", op)
+		}
+	}
+	if api.channels == nil {
+		sequence, err := api.allocateSequence()
+		if err != nil {
+			return err
+		}
+		err = api.submitOperations(&txnbuild.SimpleAccount{AccountID: api.GetAddress(), Sequence: sequence}, ops)
+		if err != nil {
+			if !sequenceConsumed(err) {
+				api.sequences.abandon(sequence + 1)
+			}
+			return err
+		}
+		api.sequences.submitted(sequence + 1)
+		return nil
+	}
+
+	c := api.channels.acquire()
+	defer api.channels.release(c)
+	if c.sequence == 0 {
+		account, err := api.GetPeerAccount(c.keyPair.Address())
+		if err != nil {
+			return fmt.Errorf("error reading channel account %s: %w", c.keyPair.Address(), err)
+		}
+		c.sequence, err = account.GetSequenceNumber()
+		if err != nil {
+			return fmt.Errorf("error reading channel sequence: %v", err)
+		}
+	}
+	source := &txnbuild.SimpleAccount{AccountID: c.keyPair.Address(), Sequence: c.sequence}
+	err := api.submitOperations(source, ops, c.keyPair)
+	if err != nil {
+		// The sequence may or may not have been consumed
+		c.sequence = 0
+		return err
+	}
+	c.sequence = source.Sequence
+	return nil
+}
+
+// sequenceConsumed is false if the transaction wasn't submitted or was rejected for its signatures,
+// the signatures are checked before the transaction is applied
+func sequenceConsumed(err error) bool {
+	horizonErr, ok := AsHorizonError(err)
+	if !ok {
+		return false
+	}
+	if horizonErr.ResultCodes == nil {
+		return true
+	}
+	code := horizonErr.ResultCodes.TransactionCode
+	if code == "tx_bad_auth" || code == "tx_bad_auth_extra" {
+		return false
+	}
+	for _, opCode := range horizonErr.ResultCodes.OperationCodes {
+		if opCode == "op_bad_auth" {
+			return false
+		}
+	}
+	return true
+}
+
+func (api *rootApi) submitOperations(source *txnbuild.SimpleAccount, ops []txnbuild.Operation, signers ...*keypair.Full) error {
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        source,
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              api.GetBaseFee(),
+		Timebounds:           txnbuild.NewTimeout(config.StellarImmediateOperationTimeoutSec),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %v", err)
+	}
+	tx, err = tx.Sign(api.networkToken, signers...)
+	if err != nil {
+		return fmt.Errorf("error signing transaction: %v", err)
+	}
+	tx, err = api.Sign(tx)
+	if err != nil {
+		return fmt.Errorf("error signing transaction: %v", err)
+	}
+	_, err = api.client.SubmitTransaction(tx)
+	return err
+}
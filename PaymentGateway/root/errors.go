@@ -0,0 +1,324 @@
+package root
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/txnbuild"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// ErrorKind classifies the failed horizon requests
+type ErrorKind string
+
+const (
+	ErrUnknown             ErrorKind = "unknown"
+	ErrNotFound            ErrorKind = "not found"
+	ErrBadSequence         ErrorKind = "bad sequence"
+	ErrInsufficientBalance ErrorKind = "insufficient balance"
+	ErrNoTrustline         ErrorKind = "no trustline"
+	ErrExpired             ErrorKind = "expired timebounds"
+	ErrBadAuth             ErrorKind = "bad auth"
+	ErrInsufficientFee     ErrorKind = "insufficient fee"
+	ErrTransactionFailed   ErrorKind = "transaction failed" // rejected with other result codes
+	ErrNetwork             ErrorKind = "network"
+	ErrRateLimited         ErrorKind = "rate limited"
+)
+
+// Transient errors may succeed if the request is repeated
+func (k ErrorKind) Transient() bool {
+	return k == ErrNetwork || k == ErrRateLimited
+}
+
+// HorizonError is a failed horizon request with its classification
+type HorizonError struct {
+	Kind        ErrorKind
+	Status      int
+	ResultCodes *models.TransactionResultCodes
+	Err         error
+}
+
+func (e *HorizonError) Error() string {
+	if e.ResultCodes != nil {
+		return fmt.Sprintf("horizon %s: transaction error %s, operation errors %v", e.Kind, e.ResultCodes.TransactionCode, e.ResultCodes.OperationCodes)
+	}
+	return fmt.Sprintf("horizon %s: %v", e.Kind, e.Err)
+}
+
+func (e *HorizonError) Unwrap() error {
+	return e.Err
+}
+
+// AsHorizonError finds the classified horizon error in the chain of err
+func AsHorizonError(err error) (*HorizonError, bool) {
+	var horizonErr *HorizonError
+	if errors.As(err, &horizonErr) {
+		return horizonErr, true
+	}
+	return nil, false
+}
+
+// Kind of err, ErrUnknown if it isn't a horizon error
+func Kind(err error) ErrorKind {
+	if horizonErr, ok := AsHorizonError(err); ok {
+		return horizonErr.Kind
+	}
+	return ErrUnknown
+}
+
+var transactionCodeKinds = map[string]ErrorKind{
+	"tx_bad_seq":              ErrBadSequence,
+	"tx_insufficient_balance": ErrInsufficientBalance,
+	"tx_too_late":             ErrExpired,
+	"tx_bad_auth":             ErrBadAuth,
+	"tx_bad_auth_extra":       ErrBadAuth,
+	"tx_insufficient_fee":     ErrInsufficientFee,
+}
+
+var operationCodeKinds = map[string]ErrorKind{
+	"op_bad_seq":        ErrBadSequence,
+	"op_underfunded":    ErrInsufficientBalance,
+	"op_low_reserve":    ErrInsufficientBalance,
+	"op_no_trust":       ErrNoTrustline,
+	"op_src_no_trust":   ErrNoTrustline,
+	"op_not_authorized": ErrNoTrustline,
+	"op_bad_auth":       ErrBadAuth,
+}
+
+// classify converts the errors of the horizon client, the result codes take precedence over the status
+func classify(err error) *HorizonError {
+	if err == nil {
+		return nil
+	}
+	if horizonErr, ok := AsHorizonError(err); ok {
+		return horizonErr
+	}
+	classified := &HorizonError{Kind: ErrUnknown, Err: err}
+
+	var problem *horizonclient.Error
+	if errors.As(err, &problem) {
+		classified.Status = problem.Problem.Status
+		if codes, codesErr := problem.ResultCodes(); codesErr == nil {
+			classified.ResultCodes = &models.TransactionResultCodes{
+				TransactionCode:      codes.TransactionCode,
+				InnerTransactionCode: innerTransactionCode(problem),
+				OperationCodes:       codes.OperationCodes,
+			}
+			classified.Kind = resultCodesKind(classified.ResultCodes)
+			return classified
+		}
+		switch {
+		case problem.Problem.Status == http.StatusNotFound:
+			classified.Kind = ErrNotFound
+		case problem.Problem.Status == http.StatusTooManyRequests:
+			classified.Kind = ErrRateLimited
+		// Horizon answers 504 if the transaction isn't in a ledger in time, it may still be applied
+		case problem.Problem.Status >= http.StatusInternalServerError:
+			classified.Kind = ErrNetwork
+		}
+		return classified
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	if errors.As(err, &netErr) || errors.As(err, &urlErr) {
+		classified.Kind = ErrNetwork
+	}
+	return classified
+}
+
+// innerTransactionCode is the result of the inner transaction of a failed fee-bump transaction
+func innerTransactionCode(problem *horizonclient.Error) string {
+	codes, ok := problem.Problem.Extras["result_codes"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	code, _ := codes["inner_transaction"].(string)
+	return code
+}
+
+func resultCodesKind(codes *models.TransactionResultCodes) ErrorKind {
+	if kind, ok := transactionCodeKinds[codes.TransactionCode]; ok {
+		return kind
+	}
+	if kind, ok := transactionCodeKinds[codes.InnerTransactionCode]; ok {
+		return kind
+	}
+	for _, code := range codes.OperationCodes {
+		if kind, ok := operationCodeKinds[code]; ok {
+			return kind
+		}
+	}
+	return ErrTransactionFailed
+}
+
+// RetryPolicy repeats the requests failing with transient errors, the backoff doubles up to MaxBackoff
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   4,
+	Backoff:    500 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+}
+
+// Do runs the request until it succeeds, fails with a permanent error or the attempts are exhausted,
+// the returned error is classified
+func (p RetryPolicy) Do(request string, f func() error) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := classify(f())
+		if err == nil {
+			return nil
+		}
+		if !err.Kind.Transient() || attempt >= p.Attempts {
+			return err
+		}
+		log.Warnf("Horizon %s failed (%s), retrying in %v", request, err.Kind, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// retryingClient classifies the errors of the horizon client and retries the transient ones.
+// A submission which failed with a transient error may still have been applied, horizon answers 504 when the
+// transaction doesn't make it into a ledger in time. Submitting it again would then fail with tx_bad_seq, so the
+// transaction is looked up by its hash before it is submitted again and before the failure is reported.
+type retryingClient struct {
+	client            HorizonClient
+	policy            RetryPolicy
+	networkPassphrase string
+}
+
+func newRetryingClient(client HorizonClient, policy RetryPolicy, networkPassphrase string) HorizonClient {
+	if _, ok := client.(*retryingClient); ok {
+		return client
+	}
+	return &retryingClient{
+		client:            client,
+		policy:            policy,
+		networkPassphrase: networkPassphrase,
+	}
+}
+
+func (c *retryingClient) AccountDetail(request horizonclient.AccountRequest) (account horizon.Account, err error) {
+	err = c.policy.Do("account detail", func() error {
+		account, err = c.client.AccountDetail(request)
+		return err
+	})
+	return account, err
+}
+
+func (c *retryingClient) SubmitTransaction(transaction *txnbuild.Transaction) (result horizon.Transaction, err error) {
+	hash, err := transaction.HashHex(c.networkPassphrase)
+	if err != nil {
+		return result, err
+	}
+	return c.submit(hash, func() (horizon.Transaction, error) {
+		return c.client.SubmitTransaction(transaction)
+	})
+}
+
+func (c *retryingClient) SubmitTransactionXDR(transactionXdr string) (result horizon.Transaction, err error) {
+	generic, err := txnbuild.TransactionFromXDR(transactionXdr)
+	if err != nil {
+		return result, err
+	}
+	var hash string
+	if feeBump, ok := generic.FeeBump(); ok {
+		hash, err = feeBump.HashHex(c.networkPassphrase)
+	} else {
+		tx, _ := generic.Transaction()
+		hash, err = tx.HashHex(c.networkPassphrase)
+	}
+	if err != nil {
+		return result, err
+	}
+	return c.submit(hash, func() (horizon.Transaction, error) {
+		return c.client.SubmitTransactionXDR(transactionXdr)
+	})
+}
+
+// submit repeats the submission of the transaction with the hash until it is found in the ledger
+func (c *retryingClient) submit(hash string, submit func() (horizon.Transaction, error)) (result horizon.Transaction, err error) {
+	submissions := 0
+	err = c.policy.Do("transaction submission", func() error {
+		if submissions > 0 {
+			applied, found, err := c.applied(hash)
+			if found {
+				result = applied
+				return err
+			}
+		}
+		submissions++
+		result, err = submit()
+		return err
+	})
+	if err != nil && (Kind(err).Transient() || submissions > 1 && Kind(err) == ErrBadSequence) {
+		if applied, found, appliedErr := c.applied(hash); found {
+			return applied, appliedErr
+		}
+	}
+	return result, err
+}
+
+// applied looks the transaction up in the ledger, it is found only if horizon knows it
+func (c *retryingClient) applied(hash string) (horizon.Transaction, bool, error) {
+	result, err := c.client.TransactionDetail(hash)
+	if err != nil {
+		return horizon.Transaction{}, false, nil
+	}
+	if !result.Successful {
+		return horizon.Transaction{}, true, &HorizonError{
+			Kind: ErrTransactionFailed,
+			Err:  fmt.Errorf("transaction %s failed in ledger %d", hash, result.Ledger),
+		}
+	}
+	log.Infof("Transaction %s was applied in ledger %d by a previous submission", hash, result.Ledger)
+	return result, true, nil
+}
+
+func (c *retryingClient) TransactionDetail(txHash string) (result horizon.Transaction, err error) {
+	err = c.policy.Do("transaction detail", func() error {
+		result, err = c.client.TransactionDetail(txHash)
+		return err
+	})
+	return result, err
+}
+
+func (c *retryingClient) FeeStats() (stats horizon.FeeStats, err error) {
+	err = c.policy.Do("fee stats", func() error {
+		stats, err = c.client.FeeStats()
+		return err
+	})
+	return stats, err
+}
+
+func (c *retryingClient) Fund(addr string) (result horizon.Transaction, err error) {
+	err = c.policy.Do("funding", func() error {
+		result, err = c.client.Fund(addr)
+		return err
+	})
+	return result, err
+}
+
+func (c *retryingClient) Root() (result horizon.Root, err error) {
+	err = c.policy.Do("root", func() error {
+		result, err = c.client.Root()
+		return err
+	})
+	return result, err
+}
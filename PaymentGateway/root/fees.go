@@ -0,0 +1,124 @@
+package root
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/txnbuild"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// Fees are in stroops per operation. The base fee follows the fee charged in the recent ledgers,
+// the fee stats are cached to avoid a horizon request per transaction.
+const feeStatsCacheDuration = 10 * time.Second
+
+type feeOracle struct {
+	mutex      sync.Mutex
+	maxBaseFee int64
+	baseFee    int64
+	updated    time.Time
+}
+
+func newFeeOracle() *feeOracle {
+	return &feeOracle{
+		maxBaseFee: config.StellarMaxBaseFee,
+	}
+}
+
+func (o *feeOracle) setMaxBaseFee(maxBaseFee int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.maxBaseFee = maxBaseFee
+	o.updated = time.Time{}
+}
+
+// get returns the fee charged by 90% of the transactions of the recent ledgers, at least the base fee
+// of the last ledger and at most the ceiling. The fixed fee is used if horizon doesn't serve fee stats.
+func (o *feeOracle) get(client HorizonClient) int64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if time.Since(o.updated) < feeStatsCacheDuration {
+		return o.baseFee
+	}
+
+	fee := int64(config.StellarImmediateOperationBaseFee)
+	stats, err := client.FeeStats()
+	if err != nil {
+		log.Warnf("Error reading fee stats, using base fee %d: %v", fee, err)
+	} else {
+		fee = feeFromStats(stats)
+	}
+	if fee > o.maxBaseFee {
+		log.Warnf("Network fee %d is above the ceiling, using base fee %d", fee, o.maxBaseFee)
+		fee = o.maxBaseFee
+	}
+	o.baseFee = fee
+	o.updated = time.Now()
+	return fee
+}
+
+// expire makes the next transaction read the fee stats again
+func (o *feeOracle) expire() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.updated = time.Time{}
+}
+
+func feeFromStats(stats horizon.FeeStats) int64 {
+	fee := stats.FeeCharged.P90
+	if fee < stats.LastLedgerBaseFee {
+		fee = stats.LastLedgerBaseFee
+	}
+	if fee < txnbuild.MinBaseFee {
+		fee = txnbuild.MinBaseFee
+	}
+	return fee
+}
+
+func (api *rootApi) GetBaseFee() int64 {
+	return api.fees.get(api.client)
+}
+
+func (api *rootApi) SetMaxBaseFee(maxBaseFee int64) {
+	api.fees.setMaxBaseFee(maxBaseFee)
+}
+
+// FeeBumpIfNeeded wraps a pre-signed transaction whose fee is below the current base fee in a fee-bump
+// transaction paid by the node. The base fee of the fee-bump transaction is zero if the transaction is returned as it is.
+func (api *rootApi) FeeBumpIfNeeded(xdr models.XDR) (models.XDR, int64, error) {
+	generic, err := xdr.TransactionFromXDR()
+	if err != nil {
+		return xdr, 0, fmt.Errorf("error deserializing transaction from XDR: %v", err)
+	}
+	inner, ok := generic.Transaction()
+	if !ok {
+		// Already a fee-bump transaction
+		return xdr, 0, nil
+	}
+	baseFee := api.GetBaseFee()
+	if inner.BaseFee() >= baseFee {
+		return xdr, 0, nil
+	}
+	feeBump, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      inner,
+		FeeAccount: api.GetAddress(),
+		BaseFee:    baseFee,
+	})
+	if err != nil {
+		return xdr, 0, fmt.Errorf("error creating fee-bump transaction: %v", err)
+	}
+	feeBump, err = api.signFeeBump(feeBump)
+	if err != nil {
+		return xdr, 0, fmt.Errorf("error signing fee-bump transaction: %v", err)
+	}
+	envelope, err := feeBump.Base64()
+	if err != nil {
+		return xdr, 0, err
+	}
+	log.Infof("Transaction fee %d is below the base fee, bumped to %d", inner.BaseFee(), baseFee)
+	return models.NewXDR(envelope), baseFee, nil
+}
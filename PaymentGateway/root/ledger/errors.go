@@ -0,0 +1,76 @@
+package ledger
+
+import (
+	"net/http"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/support/render/problem"
+)
+
+// Errors are shaped like the horizon problem documents so callers can use
+// horizonclient.Error.ResultCodes() exactly as they would against a real server.
+
+func notFoundError() error {
+	return &horizonclient.Error{
+		Problem: problem.P{
+			Type:   "https://stellar.org/horizon-errors/not_found",
+			Title:  "Resource Missing",
+			Status: http.StatusNotFound,
+			Detail: "The resource at the url requested was not found.",
+		},
+	}
+}
+
+func badRequestError(detail string) error {
+	return &horizonclient.Error{
+		Problem: problem.P{
+			Type:   "https://stellar.org/horizon-errors/bad_request",
+			Title:  "Bad Request",
+			Status: http.StatusBadRequest,
+			Detail: detail,
+		},
+	}
+}
+
+func malformedError(envelope string) error {
+	return &horizonclient.Error{
+		Problem: problem.P{
+			Type:   "https://stellar.org/horizon-errors/transaction_malformed",
+			Title:  "Transaction Malformed",
+			Status: http.StatusBadRequest,
+			Detail: "Horizon could not decode the transaction envelope in this request.",
+			Extras: map[string]interface{}{
+				"envelope_xdr": envelope,
+			},
+		},
+	}
+}
+
+func transactionFailedError(envelope string, transactionCode string, operationCodes []string) error {
+	resultCodes := map[string]interface{}{
+		"transaction": transactionCode,
+	}
+	if len(operationCodes) > 0 {
+		resultCodes["operations"] = operationCodes
+	}
+	return &horizonclient.Error{
+		Problem: problem.P{
+			Type:   "https://stellar.org/horizon-errors/transaction_failed",
+			Title:  "Transaction Failed",
+			Status: http.StatusBadRequest,
+			Detail: "The transaction failed when submitted to the stellar network.",
+			Extras: map[string]interface{}{
+				"envelope_xdr": envelope,
+				"result_codes": resultCodes,
+			},
+		},
+	}
+}
+
+// feeBumpInnerFailedError reports the failure of the inner transaction of a fee-bump transaction
+func feeBumpInnerFailedError(envelope string, innerCode string, operationCodes []string) error {
+	err := transactionFailedError(envelope, TxFeeBumpInnerFailed, operationCodes)
+	resultCodes := err.(*horizonclient.Error).Problem.Extras["result_codes"].(map[string]interface{})
+	resultCodes["inner_transaction"] = innerCode
+	return err
+}
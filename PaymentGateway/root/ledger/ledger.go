@@ -0,0 +1,434 @@
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/protocols/horizon/base"
+	"github.com/stellar/go/txnbuild"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// NetworkPassphrase is the passphrase transactions submitted to the in-memory ledger must be signed with.
+const NetworkPassphrase = "PaidPiper In-Memory Ledger"
+
+const (
+	baseReserve       int64 = 5000000 // 0.5 XLM
+	defaultBaseFee    int64 = 100
+	fundNative              = "10000"
+	fundPPToken             = "1000"
+	nativeAssetKey          = "native"
+	signerTypeEd25519       = "ed25519_public_key"
+)
+
+type trustline struct {
+	asset   txnbuild.CreditAsset
+	balance int64
+	limit   int64
+}
+
+type account struct {
+	address      string
+	sequence     int64
+	native       int64
+	trustlines   map[string]*trustline
+	signers      map[string]int32
+	thresholds   horizon.AccountThresholds
+	lastModified uint32
+}
+
+func newAccount(address string, sequence int64, native int64, ledgerSequence uint32) *account {
+	return &account{
+		address:      address,
+		sequence:     sequence,
+		native:       native,
+		trustlines:   map[string]*trustline{},
+		signers:      map[string]int32{address: 1},
+		lastModified: ledgerSequence,
+	}
+}
+
+func (a *account) clone() *account {
+	c := *a
+	c.trustlines = make(map[string]*trustline, len(a.trustlines))
+	for k, v := range a.trustlines {
+		tl := *v
+		c.trustlines[k] = &tl
+	}
+	c.signers = make(map[string]int32, len(a.signers))
+	for k, v := range a.signers {
+		c.signers[k] = v
+	}
+	return &c
+}
+
+func (a *account) subentries() int32 {
+	count := len(a.trustlines)
+	for key := range a.signers {
+		if key != a.address {
+			count++
+		}
+	}
+	return int32(count)
+}
+
+func (a *account) minBalance() int64 {
+	return (2 + int64(a.subentries())) * baseReserve
+}
+
+func (a *account) toHorizon() horizon.Account {
+	acc := horizon.Account{
+		ID:                 a.address,
+		AccountID:          a.address,
+		Sequence:           strconv.FormatInt(a.sequence, 10),
+		SubentryCount:      a.subentries(),
+		LastModifiedLedger: a.lastModified,
+		Thresholds:         a.thresholds,
+		Data:               map[string]string{},
+		PT:                 a.address,
+	}
+
+	keys := make([]string, 0, len(a.trustlines))
+	for key := range a.trustlines {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tl := a.trustlines[key]
+		assetType, _ := tl.asset.GetType()
+		acc.Balances = append(acc.Balances, horizon.Balance{
+			Balance: amount.StringFromInt64(tl.balance),
+			Limit:   amount.StringFromInt64(tl.limit),
+			Asset: base.Asset{
+				Type:   assetTypeName(assetType),
+				Code:   tl.asset.Code,
+				Issuer: tl.asset.Issuer,
+			},
+		})
+	}
+	acc.Balances = append(acc.Balances, horizon.Balance{
+		Balance: amount.StringFromInt64(a.native),
+		Asset:   base.Asset{Type: nativeAssetKey},
+	})
+
+	signers := make([]string, 0, len(a.signers))
+	for key := range a.signers {
+		signers = append(signers, key)
+	}
+	sort.Strings(signers)
+	for _, key := range signers {
+		acc.Signers = append(acc.Signers, horizon.Signer{
+			Key:    key,
+			Weight: a.signers[key],
+			Type:   signerTypeEd25519,
+		})
+	}
+	return acc
+}
+
+func assetTypeName(assetType txnbuild.AssetType) string {
+	switch assetType {
+	case txnbuild.AssetTypeCreditAlphanum4:
+		return "credit_alphanum4"
+	case txnbuild.AssetTypeCreditAlphanum12:
+		return "credit_alphanum12"
+	default:
+		return nativeAssetKey
+	}
+}
+
+func assetKey(asset txnbuild.Asset) string {
+	if asset == nil || asset.IsNative() {
+		return nativeAssetKey
+	}
+	return asset.GetCode() + ":" + asset.GetIssuer()
+}
+
+// PPTokenAsset is the pptoken credit asset as known to the ledger.
+func PPTokenAsset() txnbuild.CreditAsset {
+	return txnbuild.CreditAsset{
+		Code:   models.PPTokenAssetName,
+		Issuer: models.PPTokenIssuerAddress,
+	}
+}
+
+// Ledger is an in-process simulation of a Stellar network. It keeps accounts,
+// trustlines, sequence numbers and signers in memory and applies submitted
+// transactions with the same validation rules and result codes as stellar-core,
+// so it can stand in for horizon wherever root.HorizonClient is expected.
+type Ledger struct {
+	mutex    sync.Mutex
+	accounts map[string]*account
+	sequence uint32
+	baseFee  int64
+	now      func() time.Time
+	history  map[string]horizon.Transaction
+}
+
+func New() *Ledger {
+	l := &Ledger{
+		accounts: map[string]*account{},
+		sequence: 1,
+		baseFee:  defaultBaseFee,
+		now:      time.Now,
+		history:  map[string]horizon.Transaction{},
+	}
+	// The issuer has to exist for trustlines to be opened by transactions
+	issuer := PPTokenAsset().Issuer
+	if err := l.CreateAccount(issuer, fundNative); err != nil {
+		panic(err)
+	}
+	return l
+}
+
+var (
+	defaultLedger     *Ledger
+	defaultLedgerOnce sync.Once
+)
+
+// Default returns the process wide ledger shared by all nodes configured to use the in-memory ledger.
+func Default() *Ledger {
+	defaultLedgerOnce.Do(func() {
+		defaultLedger = New()
+	})
+	return defaultLedger
+}
+
+// SetClock replaces the time source used for timebounds validation.
+func (l *Ledger) SetClock(now func() time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.now = now
+}
+
+// SetBaseFee sets the network base fee (in stroops per operation).
+func (l *Ledger) SetBaseFee(fee int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.baseFee = fee
+}
+
+func (l *Ledger) BaseFee() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.baseFee
+}
+
+// CreateAccount creates an account funded with the given native amount, bypassing transaction validation.
+func (l *Ledger) CreateAccount(address string, nativeAmount string) error {
+	if _, err := keypair.ParseAddress(address); err != nil {
+		return fmt.Errorf("invalid address %s: %v", address, err)
+	}
+	native, err := amount.ParseInt64(nativeAmount)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %v", nativeAmount, err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, ok := l.accounts[address]; ok {
+		return fmt.Errorf("account %s already exists", address)
+	}
+	l.accounts[address] = newAccount(address, l.initialSequence(), native, l.sequence)
+	return nil
+}
+
+// AddTrustline opens a trustline on behalf of the account, bypassing transaction validation.
+func (l *Ledger) AddTrustline(address string, asset txnbuild.CreditAsset, limit string) error {
+	lim, err := amount.ParseInt64(limit)
+	if err != nil {
+		return fmt.Errorf("invalid limit %s: %v", limit, err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	acc, ok := l.accounts[address]
+	if !ok {
+		return fmt.Errorf("account %s doesn't exist", address)
+	}
+	key := assetKey(asset)
+	if tl, ok := acc.trustlines[key]; ok {
+		tl.limit = lim
+		return nil
+	}
+	acc.trustlines[key] = &trustline{asset: asset, limit: lim}
+	return nil
+}
+
+// Issue credits the account with the asset directly from its issuer.
+func (l *Ledger) Issue(address string, asset txnbuild.CreditAsset, value string) error {
+	v, err := amount.ParseInt64(value)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s: %v", value, err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	acc, ok := l.accounts[address]
+	if !ok {
+		return fmt.Errorf("account %s doesn't exist", address)
+	}
+	tl, ok := acc.trustlines[assetKey(asset)]
+	if !ok {
+		return fmt.Errorf("account %s has no trustline for %s", address, asset.Code)
+	}
+	if tl.balance > tl.limit-v {
+		return fmt.Errorf("trustline limit exceeded for %s", address)
+	}
+	tl.balance += v
+	return nil
+}
+
+// Balance returns the account balance of the asset in stroops.
+func (l *Ledger) Balance(address string, asset txnbuild.Asset) (int64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	acc, ok := l.accounts[address]
+	if !ok {
+		return 0, fmt.Errorf("account %s doesn't exist", address)
+	}
+	if asset.IsNative() {
+		return acc.native, nil
+	}
+	tl, ok := acc.trustlines[assetKey(asset)]
+	if !ok {
+		return 0, fmt.Errorf("account %s has no trustline for %s", address, asset.GetCode())
+	}
+	return tl.balance, nil
+}
+
+// LedgerSequence returns the sequence of the last closed ledger.
+func (l *Ledger) LedgerSequence() uint32 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.sequence
+}
+
+func (l *Ledger) initialSequence() int64 {
+	return int64(l.sequence) << 32
+}
+
+func (l *Ledger) AccountDetail(request horizonclient.AccountRequest) (horizon.Account, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	acc, ok := l.accounts[request.AccountID]
+	if !ok {
+		return horizon.Account{}, notFoundError()
+	}
+	return acc.toHorizon(), nil
+}
+
+// Fund plays the role of friendbot: it creates the account with native funds
+// and, since pptoken has no faucet, a funded pptoken trustline.
+func (l *Ledger) Fund(address string) (horizon.Transaction, error) {
+	if _, err := keypair.ParseAddress(address); err != nil {
+		return horizon.Transaction{}, badRequestError(fmt.Sprintf("invalid address %s", address))
+	}
+
+	err := l.CreateAccount(address, fundNative)
+	if err != nil {
+		return horizon.Transaction{}, badRequestError(err.Error())
+	}
+	err = l.AddTrustline(address, PPTokenAsset(), amount.StringFromInt64(math.MaxInt64))
+	if err != nil {
+		return horizon.Transaction{}, badRequestError(err.Error())
+	}
+	err = l.Issue(address, PPTokenAsset(), fundPPToken)
+	if err != nil {
+		return horizon.Transaction{}, badRequestError(err.Error())
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sequence++
+
+	return horizon.Transaction{
+		ID:              fmt.Sprintf("fund-%s", address),
+		Hash:            fmt.Sprintf("fund-%s", address),
+		Successful:      true,
+		Ledger:          int32(l.sequence),
+		LedgerCloseTime: l.now(),
+		Account:         address,
+		OperationCount:  1,
+	}, nil
+}
+
+// Root describes the ledger the way the horizon root endpoint describes its network.
+func (l *Ledger) Root() (horizon.Root, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return horizon.Root{
+		HorizonSequence:   int32(l.sequence),
+		CoreSequence:      int32(l.sequence),
+		NetworkPassphrase: NetworkPassphrase,
+	}, nil
+}
+
+func (l *Ledger) SubmitTransaction(transaction *txnbuild.Transaction) (horizon.Transaction, error) {
+	envelope, err := transaction.Base64()
+	if err != nil {
+		return horizon.Transaction{}, err
+	}
+	return l.SubmitTransactionXDR(envelope)
+}
+
+func (l *Ledger) SubmitTransactionXDR(envelope string) (horizon.Transaction, error) {
+	generic, err := txnbuild.TransactionFromXDR(envelope)
+	if err != nil {
+		return horizon.Transaction{}, malformedError(envelope)
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if feeBump, ok := generic.FeeBump(); ok {
+		return l.applyFeeBump(feeBump, envelope)
+	}
+	tx, ok := generic.Transaction()
+	if !ok {
+		return horizon.Transaction{}, malformedError(envelope)
+	}
+	return l.apply(tx, envelope)
+}
+
+// TransactionDetail returns the result of a transaction applied to the ledger, successful or not
+func (l *Ledger) TransactionDetail(hash string) (horizon.Transaction, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	result, ok := l.history[hash]
+	if !ok {
+		return horizon.Transaction{}, notFoundError()
+	}
+	return result, nil
+}
+
+// FeeStats reports the base fee of the ledger as the fee charged by all transactions
+func (l *Ledger) FeeStats() (horizon.FeeStats, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	fee := l.baseFee
+	distribution := horizon.FeeDistribution{
+		Max: fee, Min: fee, Mode: fee,
+		P10: fee, P20: fee, P30: fee, P40: fee, P50: fee, P60: fee, P70: fee, P80: fee, P90: fee, P95: fee, P99: fee,
+	}
+	return horizon.FeeStats{
+		LastLedger:        l.sequence,
+		LastLedgerBaseFee: fee,
+		FeeCharged:        distribution,
+		MaxFee:            distribution,
+	}, nil
+}
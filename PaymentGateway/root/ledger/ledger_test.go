@@ -0,0 +1,275 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+)
+
+func resultCodes(t *testing.T, err error) (string, []string) {
+	hError, ok := err.(*horizonclient.Error)
+	if !ok {
+		t.Fatalf("unexpected error type %T: %v", err, err)
+	}
+	codes, err := hError.ResultCodes()
+	if err != nil {
+		t.Fatalf("error reading result codes: %v", err)
+	}
+	return codes.TransactionCode, codes.OperationCodes
+}
+
+func funded(t *testing.T, l *Ledger) *keypair.Full {
+	kp := keypair.MustRandom()
+	_, err := l.Fund(kp.Address())
+	if err != nil {
+		t.Fatalf("fund failed: %v", err)
+	}
+	return kp
+}
+
+func buildTransaction(t *testing.T, l *Ledger, source *keypair.Full, sequence int64, timebounds txnbuild.Timebounds,
+	ops []txnbuild.Operation, signers ...*keypair.Full) *txnbuild.Transaction {
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount: &txnbuild.SimpleAccount{
+			AccountID: source.Address(),
+			Sequence:  sequence,
+		},
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              l.BaseFee(),
+		Timebounds:           timebounds,
+	})
+	if err != nil {
+		t.Fatalf("error building transaction: %v", err)
+	}
+	tx, err = tx.Sign(NetworkPassphrase, signers...)
+	if err != nil {
+		t.Fatalf("error signing transaction: %v", err)
+	}
+	return tx
+}
+
+func accountSequence(t *testing.T, l *Ledger, kp *keypair.Full) int64 {
+	acc, err := l.AccountDetail(horizonclient.AccountRequest{AccountID: kp.Address()})
+	if err != nil {
+		t.Fatalf("error reading account: %v", err)
+	}
+	seq, err := acc.GetSequenceNumber()
+	if err != nil {
+		t.Fatalf("error reading sequence: %v", err)
+	}
+	return seq
+}
+
+func pptokenPayment(from *keypair.Full, to *keypair.Full, value string) *txnbuild.Payment {
+	return &txnbuild.Payment{
+		Destination:   to.Address(),
+		Amount:        value,
+		Asset:         PPTokenAsset(),
+		SourceAccount: from.Address(),
+	}
+}
+
+func TestMissingAccount(t *testing.T) {
+	l := New()
+	_, err := l.AccountDetail(horizonclient.AccountRequest{AccountID: keypair.MustRandom().Address()})
+	assert.True(t, horizonclient.IsNotFoundError(err))
+}
+
+func TestPaymentOnBehalfOfPayer(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+	payer := funded(t, l)
+
+	seq := accountSequence(t, l, node)
+	tx := buildTransaction(t, l, node, seq, txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{pptokenPayment(payer, node, "10")}, node, payer)
+
+	_, err := l.SubmitTransaction(tx)
+	assert.NoError(t, err)
+
+	payerBalance, _ := l.Balance(payer.Address(), PPTokenAsset())
+	nodeBalance, _ := l.Balance(node.Address(), PPTokenAsset())
+	assert.Equal(t, int64(990e7), payerBalance)
+	assert.Equal(t, int64(1010e7), nodeBalance)
+	assert.Equal(t, seq+1, accountSequence(t, l, node))
+}
+
+func TestBadSequence(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+	payer := funded(t, l)
+
+	seq := accountSequence(t, l, node)
+	tx := buildTransaction(t, l, node, seq+5, txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{pptokenPayment(payer, node, "10")}, node, payer)
+
+	_, err := l.SubmitTransaction(tx)
+	code, _ := resultCodes(t, err)
+	assert.Equal(t, TxBadSeq, code)
+	assert.Equal(t, seq, accountSequence(t, l, node))
+}
+
+func TestExpiredTimebounds(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+	payer := funded(t, l)
+
+	tx := buildTransaction(t, l, node, accountSequence(t, l, node), txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{pptokenPayment(payer, node, "10")}, node, payer)
+
+	l.SetClock(func() time.Time { return time.Now().Add(2 * time.Minute) })
+	_, err := l.SubmitTransaction(tx)
+	code, _ := resultCodes(t, err)
+	assert.Equal(t, TxTooLate, code)
+}
+
+func TestMissingPayerSignature(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+	payer := funded(t, l)
+
+	tx := buildTransaction(t, l, node, accountSequence(t, l, node), txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{pptokenPayment(payer, node, "10")}, node)
+
+	_, err := l.SubmitTransaction(tx)
+	code, opCodes := resultCodes(t, err)
+	assert.Equal(t, TxFailed, code)
+	assert.Equal(t, []string{OpBadAuth}, opCodes)
+}
+
+func TestFailedOperationIsRolledBack(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+	payer := funded(t, l)
+	stranger := keypair.MustRandom()
+	assert.NoError(t, l.CreateAccount(stranger.Address(), "10"))
+
+	seq := accountSequence(t, l, node)
+	tx := buildTransaction(t, l, node, seq, txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{
+			pptokenPayment(payer, node, "10"),
+			pptokenPayment(payer, stranger, "10"),
+		}, node, payer)
+
+	_, err := l.SubmitTransaction(tx)
+	code, opCodes := resultCodes(t, err)
+	assert.Equal(t, TxFailed, code)
+	assert.Equal(t, []string{OpSuccess, OpNoTrust}, opCodes)
+
+	payerBalance, _ := l.Balance(payer.Address(), PPTokenAsset())
+	assert.Equal(t, int64(1000e7), payerBalance)
+	// The sequence is consumed even though the operations failed
+	assert.Equal(t, seq+1, accountSequence(t, l, node))
+}
+
+func TestBumpSequence(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+
+	seq := accountSequence(t, l, node)
+	tx := buildTransaction(t, l, node, seq, txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{&txnbuild.BumpSequence{BumpTo: seq + 10}}, node)
+
+	_, err := l.SubmitTransaction(tx)
+	assert.NoError(t, err)
+	assert.Equal(t, seq+10, accountSequence(t, l, node))
+}
+
+func TestCreateAccountWithTrustline(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+	peer := keypair.MustRandom()
+
+	tx := buildTransaction(t, l, node, accountSequence(t, l, node), txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{
+			&txnbuild.CreateAccount{Destination: peer.Address(), Amount: "5"},
+			&txnbuild.ChangeTrust{Line: PPTokenAsset(), Limit: txnbuild.MaxTrustlineLimit, SourceAccount: peer.Address()},
+		}, node, peer)
+
+	_, err := l.SubmitTransaction(tx)
+	assert.NoError(t, err)
+
+	balance, err := l.Balance(peer.Address(), PPTokenAsset())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), balance)
+}
+
+func feeBumpTransaction(t *testing.T, inner *txnbuild.Transaction, feeAccount *keypair.Full, baseFee int64) *txnbuild.FeeBumpTransaction {
+	feeBump, err := txnbuild.NewFeeBumpTransaction(txnbuild.FeeBumpTransactionParams{
+		Inner:      inner,
+		FeeAccount: feeAccount.Address(),
+		BaseFee:    baseFee,
+	})
+	if err != nil {
+		t.Fatalf("error building fee-bump transaction: %v", err)
+	}
+	feeBump, err = feeBump.Sign(NetworkPassphrase, feeAccount)
+	if err != nil {
+		t.Fatalf("error signing fee-bump transaction: %v", err)
+	}
+	return feeBump
+}
+
+func TestFeeBump(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+	payer := funded(t, l)
+	sponsor := funded(t, l)
+
+	seq := accountSequence(t, l, node)
+	tx := buildTransaction(t, l, node, seq, txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{pptokenPayment(payer, node, "10")}, node, payer)
+
+	// The network fee rose after the transaction was signed
+	l.SetBaseFee(l.BaseFee() * 10)
+	_, err := l.SubmitTransaction(tx)
+	code, _ := resultCodes(t, err)
+	assert.Equal(t, TxInsufficientFee, code)
+
+	xdr, err := feeBumpTransaction(t, tx, sponsor, l.BaseFee()/2).Base64()
+	assert.NoError(t, err)
+	_, err = l.SubmitTransactionXDR(xdr)
+	code, _ = resultCodes(t, err)
+	assert.Equal(t, TxInsufficientFee, code)
+
+	nodeNative, _ := l.Balance(node.Address(), txnbuild.NativeAsset{})
+	sponsorNative, _ := l.Balance(sponsor.Address(), txnbuild.NativeAsset{})
+	xdr, err = feeBumpTransaction(t, tx, sponsor, l.BaseFee()).Base64()
+	assert.NoError(t, err)
+	result, err := l.SubmitTransactionXDR(xdr)
+	assert.NoError(t, err)
+	assert.Equal(t, sponsor.Address(), result.FeeAccount)
+
+	nodeBalance, _ := l.Balance(node.Address(), PPTokenAsset())
+	assert.Equal(t, int64(1010e7), nodeBalance)
+	assert.Equal(t, seq+1, accountSequence(t, l, node))
+	// The fee account pays for the inner operations and the fee-bump itself
+	balance, _ := l.Balance(node.Address(), txnbuild.NativeAsset{})
+	assert.Equal(t, nodeNative, balance)
+	balance, _ = l.Balance(sponsor.Address(), txnbuild.NativeAsset{})
+	assert.Equal(t, sponsorNative-2*l.BaseFee(), balance)
+}
+
+func TestFeeBumpInnerFailed(t *testing.T) {
+	l := New()
+	node := funded(t, l)
+	payer := funded(t, l)
+	sponsor := funded(t, l)
+
+	tx := buildTransaction(t, l, node, accountSequence(t, l, node), txnbuild.NewTimeout(60),
+		[]txnbuild.Operation{pptokenPayment(payer, node, "10")}, node)
+	xdr, err := feeBumpTransaction(t, tx, sponsor, l.BaseFee()).Base64()
+	assert.NoError(t, err)
+
+	_, err = l.SubmitTransactionXDR(xdr)
+	code, opCodes := resultCodes(t, err)
+	assert.Equal(t, TxFeeBumpInnerFailed, code)
+	assert.Equal(t, []string{OpBadAuth}, opCodes)
+	codes := err.(*horizonclient.Error).Problem.Extras["result_codes"].(map[string]interface{})
+	assert.Equal(t, TxFailed, codes["inner_transaction"])
+}
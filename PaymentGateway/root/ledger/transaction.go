@@ -0,0 +1,496 @@
+package ledger
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	TxSuccess             = "tx_success"
+	TxFailed              = "tx_failed"
+	TxTooEarly            = "tx_too_early"
+	TxTooLate             = "tx_too_late"
+	TxMissingOperation    = "tx_missing_operation"
+	TxBadSeq              = "tx_bad_seq"
+	TxBadAuth             = "tx_bad_auth"
+	TxInsufficientBalance = "tx_insufficient_balance"
+	TxNoSourceAccount     = "tx_no_source_account"
+	TxInsufficientFee     = "tx_insufficient_fee"
+	TxBadAuthExtra        = "tx_bad_auth_extra"
+	TxFeeBumpInnerFailed  = "tx_fee_bump_inner_failed"
+
+	OpSuccess         = "op_success"
+	OpMalformed       = "op_malformed"
+	OpUnderfunded     = "op_underfunded"
+	OpLowReserve      = "op_low_reserve"
+	OpAlreadyExists   = "op_already_exists"
+	OpSrcNoTrust      = "op_src_no_trust"
+	OpNoDestination   = "op_no_destination"
+	OpNoTrust         = "op_no_trust"
+	OpLineFull        = "op_line_full"
+	OpNoIssuer        = "op_no_issuer"
+	OpInvalidLimit    = "op_invalid_limit"
+	OpBadSeq          = "op_bad_seq"
+	OpBadAuth         = "op_bad_auth"
+	OpNoSourceAccount = "op_no_source_account"
+	OpNotSupported    = "op_not_supported"
+)
+
+type thresholdLevel int
+
+const (
+	thresholdLow thresholdLevel = iota
+	thresholdMedium
+	thresholdHigh
+)
+
+func (a *account) threshold(level thresholdLevel) int32 {
+	var t byte
+	switch level {
+	case thresholdLow:
+		t = a.thresholds.LowThreshold
+	case thresholdMedium:
+		t = a.thresholds.MedThreshold
+	default:
+		t = a.thresholds.HighThreshold
+	}
+	// A zero threshold still requires at least one valid signer.
+	if t == 0 {
+		return 1
+	}
+	return int32(t)
+}
+
+// signatureChecker tracks which of the envelope signatures were consumed while
+// authorizing the transaction and its operations, mirroring stellar-core.
+type signatureChecker struct {
+	hash       [32]byte
+	signatures []xdr.DecoratedSignature
+	used       []bool
+}
+
+func newSignatureChecker(hash [32]byte, signatures []xdr.DecoratedSignature) *signatureChecker {
+	return &signatureChecker{
+		hash:       hash,
+		signatures: signatures,
+		used:       make([]bool, len(signatures)),
+	}
+}
+
+func (c *signatureChecker) check(acc *account, level thresholdLevel) bool {
+	needed := acc.threshold(level)
+
+	keys := make([]string, 0, len(acc.signers))
+	for key := range acc.signers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var total int32
+	for _, key := range keys {
+		weight := acc.signers[key]
+		if weight <= 0 {
+			continue
+		}
+		kp, err := keypair.ParseAddress(key)
+		if err != nil {
+			continue
+		}
+		hint := kp.Hint()
+		for i, sig := range c.signatures {
+			if sig.Hint != xdr.SignatureHint(hint) {
+				continue
+			}
+			if kp.Verify(c.hash[:], sig.Signature) != nil {
+				continue
+			}
+			c.used[i] = true
+			total += weight
+			break
+		}
+		if total >= needed {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *signatureChecker) allUsed() bool {
+	for _, u := range c.used {
+		if !u {
+			return false
+		}
+	}
+	return true
+}
+
+func operationSource(op txnbuild.Operation, tx *txnbuild.Transaction) string {
+	if source := op.GetSourceAccount(); source != "" {
+		return source
+	}
+	return tx.SourceAccount().AccountID
+}
+
+func operationThreshold(op txnbuild.Operation) thresholdLevel {
+	switch o := op.(type) {
+	case *txnbuild.BumpSequence:
+		return thresholdLow
+	case *txnbuild.SetOptions:
+		if o.MasterWeight != nil || o.LowThreshold != nil || o.MediumThreshold != nil ||
+			o.HighThreshold != nil || o.Signer != nil {
+			return thresholdHigh
+		}
+		return thresholdMedium
+	default:
+		return thresholdMedium
+	}
+}
+
+func (l *Ledger) snapshot() map[string]*account {
+	accounts := make(map[string]*account, len(l.accounts))
+	for k, v := range l.accounts {
+		accounts[k] = v.clone()
+	}
+	return accounts
+}
+
+// apply validates the transaction the way stellar-core does on submission and
+// then applies its operations atomically. Validation failures don't consume the
+// sequence number; operation failures do, and also charge the fee.
+func (l *Ledger) apply(tx *txnbuild.Transaction, envelope string) (horizon.Transaction, error) {
+	return l.applyTransaction(tx, envelope, nil, func(code string, opCodes []string) error {
+		return transactionFailedError(envelope, code, opCodes)
+	})
+}
+
+// applyFeeBump validates the outer fee-bump transaction and applies the inner one with the fee paid by the fee account,
+// the fee of the inner transaction doesn't have to cover the network fee
+func (l *Ledger) applyFeeBump(feeBump *txnbuild.FeeBumpTransaction, envelope string) (horizon.Transaction, error) {
+	inner := feeBump.InnerTransaction()
+	feeAccount, ok := l.accounts[feeBump.FeeAccount()]
+	if !ok {
+		return horizon.Transaction{}, transactionFailedError(envelope, TxNoSourceAccount, nil)
+	}
+	if feeBump.BaseFee() < l.baseFee {
+		return horizon.Transaction{}, transactionFailedError(envelope, TxInsufficientFee, nil)
+	}
+	hash, err := feeBump.Hash(NetworkPassphrase)
+	if err != nil {
+		return horizon.Transaction{}, malformedError(envelope)
+	}
+	checker := newSignatureChecker(hash, feeBump.Signatures())
+	if !checker.check(feeAccount, thresholdLow) || !checker.allUsed() {
+		return horizon.Transaction{}, transactionFailedError(envelope, TxBadAuth, nil)
+	}
+	return l.applyTransaction(inner, envelope, feeBump, func(code string, opCodes []string) error {
+		return feeBumpInnerFailedError(envelope, code, opCodes)
+	})
+}
+
+func (l *Ledger) applyTransaction(tx *txnbuild.Transaction, envelope string, feeBump *txnbuild.FeeBumpTransaction,
+	reject func(code string, opCodes []string) error) (horizon.Transaction, error) {
+	ops := tx.Operations()
+	sourceAddress := tx.SourceAccount().AccountID
+
+	source, ok := l.accounts[sourceAddress]
+	if !ok {
+		return horizon.Transaction{}, reject(TxNoSourceAccount, nil)
+	}
+	if len(ops) == 0 {
+		return horizon.Transaction{}, reject(TxMissingOperation, nil)
+	}
+	feeAccount, fee := source, l.baseFee*int64(len(ops))
+	if feeBump != nil {
+		feeAccount, fee = l.accounts[feeBump.FeeAccount()], l.baseFee*int64(len(ops)+1)
+	}
+
+	now := l.now().Unix()
+	tb := tx.Timebounds()
+	if tb.MinTime > 0 && now < tb.MinTime {
+		return horizon.Transaction{}, reject(TxTooEarly, nil)
+	}
+	if tb.MaxTime > 0 && now > tb.MaxTime {
+		return horizon.Transaction{}, reject(TxTooLate, nil)
+	}
+
+	if feeBump == nil && tx.BaseFee() < l.baseFee {
+		return horizon.Transaction{}, reject(TxInsufficientFee, nil)
+	}
+
+	if tx.SourceAccount().Sequence != source.sequence+1 {
+		return horizon.Transaction{}, reject(TxBadSeq, nil)
+	}
+
+	if feeAccount.native-fee < feeAccount.minBalance() {
+		return horizon.Transaction{}, reject(TxInsufficientBalance, nil)
+	}
+
+	hash, err := tx.Hash(NetworkPassphrase)
+	if err != nil {
+		return horizon.Transaction{}, malformedError(envelope)
+	}
+	checker := newSignatureChecker(hash, tx.Signatures())
+	if !checker.check(source, thresholdLow) {
+		return horizon.Transaction{}, reject(TxBadAuth, nil)
+	}
+
+	opCodes := make([]string, len(ops))
+	authFailed := false
+	for i, op := range ops {
+		opCodes[i] = OpSuccess
+		address := operationSource(op, tx)
+		acc, ok := l.accounts[address]
+		if !ok {
+			// The account may be created by a preceding operation, like
+			// stellar-core only its master key signature is checked upfront
+			acc = newAccount(address, 0, 0, 0)
+		}
+		if !checker.check(acc, operationThreshold(op)) {
+			opCodes[i] = OpBadAuth
+			authFailed = true
+		}
+	}
+	if authFailed {
+		return horizon.Transaction{}, reject(TxFailed, opCodes)
+	}
+	if !checker.allUsed() {
+		return horizon.Transaction{}, reject(TxBadAuthExtra, nil)
+	}
+
+	// From here on the transaction makes it into a ledger
+	l.sequence++
+	source.sequence = tx.SourceAccount().Sequence
+	source.lastModified = l.sequence
+	feeAccount.native -= fee
+	feeAccount.lastModified = l.sequence
+
+	beforeOperations := l.snapshot()
+	failed := false
+	for i, op := range ops {
+		if _, ok := l.accounts[operationSource(op, tx)]; !ok {
+			opCodes[i] = OpNoSourceAccount
+			failed = true
+			continue
+		}
+		opCodes[i] = l.applyOperation(op, operationSource(op, tx))
+		if opCodes[i] != OpSuccess {
+			failed = true
+		}
+	}
+
+	hashHex, _ := tx.HashHex(NetworkPassphrase)
+	feeAccountAddress := sourceAddress
+	maxFee := tx.MaxFee()
+	if feeBump != nil {
+		hashHex, _ = feeBump.HashHex(NetworkPassphrase)
+		feeAccountAddress = feeBump.FeeAccount()
+		maxFee = feeBump.MaxFee()
+	}
+	result := horizon.Transaction{
+		ID:              hashHex,
+		PT:              strconv.FormatInt(int64(l.sequence)<<32, 10),
+		Successful:      !failed,
+		Hash:            hashHex,
+		Ledger:          int32(l.sequence),
+		LedgerCloseTime: l.now(),
+		Account:         sourceAddress,
+		AccountSequence: strconv.FormatInt(tx.SourceAccount().Sequence, 10),
+		FeeAccount:      feeAccountAddress,
+		FeeCharged:      fee,
+		MaxFee:          maxFee,
+		OperationCount:  int32(len(ops)),
+		EnvelopeXdr:     envelope,
+	}
+	for _, sig := range tx.Signatures() {
+		result.Signatures = append(result.Signatures, base64.StdEncoding.EncodeToString(sig.Signature))
+	}
+
+	if failed {
+		l.accounts = beforeOperations
+		l.history[hashHex] = result
+		return horizon.Transaction{}, reject(TxFailed, opCodes)
+	}
+	l.history[hashHex] = result
+	return result, nil
+}
+
+func (l *Ledger) applyOperation(op txnbuild.Operation, sourceAddress string) string {
+	source := l.accounts[sourceAddress]
+	source.lastModified = l.sequence
+
+	switch o := op.(type) {
+	case *txnbuild.Payment:
+		return l.applyPayment(source, o)
+	case *txnbuild.CreateAccount:
+		return l.applyCreateAccount(source, o)
+	case *txnbuild.ChangeTrust:
+		return l.applyChangeTrust(source, o)
+	case *txnbuild.BumpSequence:
+		if o.BumpTo < 0 {
+			return OpBadSeq
+		}
+		if o.BumpTo > source.sequence {
+			source.sequence = o.BumpTo
+		}
+		return OpSuccess
+	case *txnbuild.SetOptions:
+		return l.applySetOptions(source, o)
+	default:
+		return OpNotSupported
+	}
+}
+
+func (l *Ledger) applyPayment(source *account, op *txnbuild.Payment) string {
+	value, err := amount.ParseInt64(op.Amount)
+	if err != nil || value <= 0 || op.Asset == nil {
+		return OpMalformed
+	}
+	destination, ok := l.accounts[op.Destination]
+	if !ok {
+		return OpNoDestination
+	}
+	destination.lastModified = l.sequence
+
+	if op.Asset.IsNative() {
+		if source.native-value < source.minBalance() {
+			return OpUnderfunded
+		}
+		source.native -= value
+		destination.native += value
+		return OpSuccess
+	}
+
+	key := assetKey(op.Asset)
+	issuer := op.Asset.GetIssuer()
+
+	if source.address != issuer {
+		tl, ok := source.trustlines[key]
+		if !ok {
+			return OpSrcNoTrust
+		}
+		if tl.balance < value {
+			return OpUnderfunded
+		}
+	}
+	if destination.address != issuer {
+		tl, ok := destination.trustlines[key]
+		if !ok {
+			return OpNoTrust
+		}
+		if tl.balance > tl.limit-value {
+			return OpLineFull
+		}
+	}
+
+	if source.address != issuer {
+		source.trustlines[key].balance -= value
+	}
+	if destination.address != issuer {
+		destination.trustlines[key].balance += value
+	}
+	return OpSuccess
+}
+
+func (l *Ledger) applyCreateAccount(source *account, op *txnbuild.CreateAccount) string {
+	value, err := amount.ParseInt64(op.Amount)
+	if err != nil || value <= 0 {
+		return OpMalformed
+	}
+	if _, ok := l.accounts[op.Destination]; ok {
+		return OpAlreadyExists
+	}
+	if value < 2*baseReserve {
+		return OpLowReserve
+	}
+	if source.native-value < source.minBalance() {
+		return OpUnderfunded
+	}
+	source.native -= value
+	l.accounts[op.Destination] = newAccount(op.Destination, l.initialSequence(), value, l.sequence)
+	return OpSuccess
+}
+
+func (l *Ledger) applyChangeTrust(source *account, op *txnbuild.ChangeTrust) string {
+	if op.Line == nil || op.Line.IsNative() {
+		return OpMalformed
+	}
+	limitString := op.Limit
+	if limitString == "" {
+		limitString = txnbuild.MaxTrustlineLimit
+	}
+	limit, err := amount.ParseInt64(limitString)
+	if err != nil || limit < 0 {
+		return OpMalformed
+	}
+	if _, ok := l.accounts[op.Line.GetIssuer()]; !ok {
+		return OpNoIssuer
+	}
+
+	key := assetKey(op.Line)
+	tl, ok := source.trustlines[key]
+	if ok {
+		if limit < tl.balance {
+			return OpInvalidLimit
+		}
+		if limit == 0 {
+			delete(source.trustlines, key)
+			return OpSuccess
+		}
+		tl.limit = limit
+		return OpSuccess
+	}
+	if limit == 0 {
+		return OpInvalidLimit
+	}
+	if source.native < source.minBalance()+baseReserve {
+		return OpLowReserve
+	}
+	source.trustlines[key] = &trustline{
+		asset: txnbuild.CreditAsset{
+			Code:   op.Line.GetCode(),
+			Issuer: op.Line.GetIssuer(),
+		},
+		limit: limit,
+	}
+	return OpSuccess
+}
+
+func (l *Ledger) applySetOptions(source *account, op *txnbuild.SetOptions) string {
+	if op.MasterWeight != nil {
+		source.signers[source.address] = int32(*op.MasterWeight)
+	}
+	if op.LowThreshold != nil {
+		source.thresholds.LowThreshold = byte(*op.LowThreshold)
+	}
+	if op.MediumThreshold != nil {
+		source.thresholds.MedThreshold = byte(*op.MediumThreshold)
+	}
+	if op.HighThreshold != nil {
+		source.thresholds.HighThreshold = byte(*op.HighThreshold)
+	}
+	if op.Signer != nil {
+		if _, err := keypair.ParseAddress(op.Signer.Address); err != nil {
+			return OpMalformed
+		}
+		if op.Signer.Address == source.address {
+			return OpMalformed
+		}
+		_, exists := source.signers[op.Signer.Address]
+		if op.Signer.Weight == 0 {
+			delete(source.signers, op.Signer.Address)
+			return OpSuccess
+		}
+		if !exists && source.native < source.minBalance()+baseReserve {
+			return OpLowReserve
+		}
+		source.signers[op.Signer.Address] = int32(op.Signer.Weight)
+	}
+	return OpSuccess
+}
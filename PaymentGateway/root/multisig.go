@@ -0,0 +1,291 @@
+package root
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/support/log"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stellar/go/xdr"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// The signers and thresholds of the node account are cached, they are read again after a bad auth failure
+const signerSetCacheDuration = 5 * time.Minute
+
+type thresholdLevel int
+
+const (
+	thresholdNone thresholdLevel = iota - 1
+	thresholdLow
+	thresholdMedium
+	thresholdHigh
+)
+
+// signerSet is the multisig configuration of the node account
+type signerSet struct {
+	weights    map[string]int32
+	thresholds horizon.AccountThresholds
+}
+
+func newSignerSet(account *horizon.Account) *signerSet {
+	return &signerSet{
+		weights:    account.SignerSummary(),
+		thresholds: account.Thresholds,
+	}
+}
+
+func (s *signerSet) threshold(level thresholdLevel) int32 {
+	var t byte
+	switch level {
+	case thresholdLow:
+		t = s.thresholds.LowThreshold
+	case thresholdMedium:
+		t = s.thresholds.MedThreshold
+	default:
+		t = s.thresholds.HighThreshold
+	}
+	// A zero threshold still requires a signer
+	if t == 0 {
+		return 1
+	}
+	return int32(t)
+}
+
+// weight is the sum of the weights of the signers with a valid signature, every signer counts once
+func (s *signerSet) weight(hash [32]byte, signatures []xdr.DecoratedSignature) int32 {
+	var total int32
+	for address, weight := range s.weights {
+		kp, err := keypair.ParseAddress(address)
+		if err != nil || weight <= 0 {
+			continue
+		}
+		hint := xdr.SignatureHint(kp.Hint())
+		for _, signature := range signatures {
+			if signature.Hint == hint && kp.Verify(hash[:], signature.Signature) == nil {
+				total += weight
+				break
+			}
+		}
+	}
+	return total
+}
+
+func operationThreshold(op txnbuild.Operation) thresholdLevel {
+	switch o := op.(type) {
+	case *txnbuild.BumpSequence, *txnbuild.AllowTrust:
+		return thresholdLow
+	case *txnbuild.AccountMerge:
+		return thresholdHigh
+	case *txnbuild.SetOptions:
+		if o.MasterWeight != nil || o.LowThreshold != nil || o.MediumThreshold != nil ||
+			o.HighThreshold != nil || o.Signer != nil {
+			return thresholdHigh
+		}
+		return thresholdMedium
+	default:
+		return thresholdMedium
+	}
+}
+
+// transactionThreshold is the threshold of the account required by the transaction, thresholdNone if it isn't involved
+func transactionThreshold(tx *txnbuild.Transaction, address string) thresholdLevel {
+	level := thresholdNone
+	if tx.SourceAccount().AccountID == address {
+		level = thresholdLow
+	}
+	for _, op := range tx.Operations() {
+		source := op.GetSourceAccount()
+		if source == "" {
+			source = tx.SourceAccount().AccountID
+		}
+		if opLevel := operationThreshold(op); source == address && opLevel > level {
+			level = opLevel
+		}
+	}
+	return level
+}
+
+// multisig collects the signatures of the co-signers when the node key alone doesn't reach the threshold
+type multisig struct {
+	mutex     sync.Mutex
+	coSigners []Signer
+	set       *signerSet
+	updated   time.Time
+}
+
+func newMultisig() *multisig {
+	return &multisig{}
+}
+
+func (m *multisig) getCoSigners() []Signer {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.coSigners
+}
+
+// expire makes the next signature read the signers of the node account again
+func (m *multisig) expire() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.updated = time.Time{}
+}
+
+func (api *rootApi) getSignerSet() (*signerSet, error) {
+	api.multisig.mutex.Lock()
+	defer api.multisig.mutex.Unlock()
+	if api.multisig.set != nil && time.Since(api.multisig.updated) < signerSetCacheDuration {
+		return api.multisig.set, nil
+	}
+	account, err := api.GetAccount()
+	if err != nil {
+		return nil, fmt.Errorf("error reading the signers of %s: %w", api.GetAddress(), err)
+	}
+	api.multisig.set = newSignerSet(account)
+	api.multisig.updated = time.Now()
+	return api.multisig.set, nil
+}
+
+// SetCoSigners sets the other signers of the node account, they are asked in order for their signatures
+func (api *rootApi) SetCoSigners(coSigners []Signer) error {
+	set, err := api.getSignerSet()
+	if err != nil {
+		return err
+	}
+	for _, coSigner := range coSigners {
+		if coSigner.Address() == api.GetAddress() {
+			return fmt.Errorf("the node key can't be a co-signer")
+		}
+		if set.weights[coSigner.Address()] <= 0 {
+			return fmt.Errorf("co-signer %s isn't a signer of %s", coSigner.Address(), api.GetAddress())
+		}
+	}
+	api.multisig.mutex.Lock()
+	defer api.multisig.mutex.Unlock()
+	api.multisig.coSigners = coSigners
+	return nil
+}
+
+// collectSignatures asks the co-signers until the signatures reach the threshold, a signature more than
+// needed would fail the transaction with tx_bad_auth_extra
+func (api *rootApi) collectSignatures(level thresholdLevel, hash [32]byte, signatures func() []xdr.DecoratedSignature, sign func(Signer) error) error {
+	coSigners := api.multisig.getCoSigners()
+	if level == thresholdNone || len(coSigners) == 0 {
+		return nil
+	}
+	set, err := api.getSignerSet()
+	if err != nil {
+		return err
+	}
+	needed := set.threshold(level)
+	weight := set.weight(hash, signatures())
+	for _, coSigner := range coSigners {
+		if weight >= needed {
+			break
+		}
+		err = sign(coSigner)
+		if err != nil {
+			log.Warnf("Co-signer %s didn't sign: %v", coSigner.Address(), err)
+			continue
+		}
+		weight = set.weight(hash, signatures())
+	}
+	if weight < needed {
+		return fmt.Errorf("signature weight %d of %s is below the threshold %d", weight, api.GetAddress(), needed)
+	}
+	return nil
+}
+
+func (api *rootApi) Sign(tr *txnbuild.Transaction) (*txnbuild.Transaction, error) {
+	tx, err := api.signer.SignTransaction(api.networkToken, tr)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := tx.Hash(api.networkToken)
+	if err != nil {
+		return nil, err
+	}
+	signatures := func() []xdr.DecoratedSignature { return tx.Signatures() }
+	err = api.collectSignatures(transactionThreshold(tx, api.GetAddress()), hash, signatures, func(coSigner Signer) error {
+		signed, err := coSigner.SignTransaction(api.networkToken, tx)
+		if err == nil {
+			tx = signed
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (api *rootApi) signFeeBump(feeBump *txnbuild.FeeBumpTransaction) (*txnbuild.FeeBumpTransaction, error) {
+	tx, err := api.signer.SignFeeBump(api.networkToken, feeBump)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := tx.Hash(api.networkToken)
+	if err != nil {
+		return nil, err
+	}
+	signatures := func() []xdr.DecoratedSignature { return tx.Signatures() }
+	err = api.collectSignatures(thresholdLow, hash, signatures, func(coSigner Signer) error {
+		signed, err := coSigner.SignFeeBump(api.networkToken, tx)
+		if err == nil {
+			tx = signed
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// ValidateSignatureWeight checks that the signatures of the transaction reach the threshold of the node
+// account the transaction requires, the signatures of the other accounts aren't checked
+func (api *rootApi) ValidateSignatureWeight(envelope models.XDR) error {
+	generic, err := envelope.TransactionFromXDR()
+	if err != nil {
+		return fmt.Errorf("error deserializing transaction from XDR: %v", err)
+	}
+	set, err := api.getSignerSet()
+	if err != nil {
+		return err
+	}
+	check := func(level thresholdLevel, hash [32]byte, signatures []xdr.DecoratedSignature) error {
+		if level == thresholdNone {
+			return nil
+		}
+		weight := set.weight(hash, signatures)
+		if needed := set.threshold(level); weight < needed {
+			return fmt.Errorf("signature weight %d of %s is below the threshold %d", weight, api.GetAddress(), needed)
+		}
+		return nil
+	}
+	tx, ok := generic.Transaction()
+	if feeBump, isFeeBump := generic.FeeBump(); isFeeBump {
+		if feeBump.FeeAccount() == api.GetAddress() {
+			hash, err := feeBump.Hash(api.networkToken)
+			if err != nil {
+				return err
+			}
+			err = check(thresholdLow, hash, feeBump.Signatures())
+			if err != nil {
+				return err
+			}
+		}
+		tx, ok = feeBump.InnerTransaction(), true
+	}
+	if !ok {
+		return fmt.Errorf("error deserializing transaction from XDR (GenericTransaction)")
+	}
+	hash, err := tx.Hash(api.networkToken)
+	if err != nil {
+		return err
+	}
+	return check(transactionThreshold(tx, api.GetAddress()), hash, tx.Signatures())
+}
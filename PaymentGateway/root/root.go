@@ -2,10 +2,12 @@ package root
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"net/http"
 
 	"strconv"
-	"sync"
+	"time"
 
 	"github.com/go-errors/errors"
 	"github.com/stellar/go/clients/horizonclient"
@@ -19,11 +21,18 @@ import (
 	"paidpiper.com/payment-gateway/models"
 )
 
+// Funding an account is retried until horizon serves it
+const (
+	fundedAccountAttempts     = 5
+	fundedAccountPollInterval = time.Second
+)
+
 type RootApi interface {
 	CreateUser() error
 	ValidateForPPNode() error
 	CheckSourceAddress(address string) error
 	GetAddress() string
+	GetNetworkPassphrase() string
 	GetAccount() (*horizon.Account, error)
 	GetSequenceNumber() (xdr.SequenceNumber, error)
 	GetMicroPPTokenBalance() (models.TransactionAmount, error)
@@ -32,50 +41,92 @@ type RootApi interface {
 	ValidateTimebounds(*models.PaymentTransaction) error
 	SignPaymentTransaction(tr *models.PaymentTransaction) (*models.PaymentTransaction, error)
 	SignXDR(tr models.XDR) (models.XDR, error)
+	SignPaymentRequest(pr *models.PaymentRequest) error
+	SignRevocation(r *models.Revocation) error
 	Sign(tr *txnbuild.Transaction) (*txnbuild.Transaction, error)
 	SubmitTransaction(transaction *models.PaymentTransaction) error
 	SubmitTransactionOld(transaction *txnbuild.Transaction) error
 	GetTransactionSequenceNumber(transaction *models.PaymentTransaction) (int64, error)
 	CreateTransaction(request *models.CreateTransactionCommand, tr *models.PaymentTransactionReplacing) (*models.PaymentTransactionReplacing, error)
 	SetTransactionValiditySecs(transactionValiditySecs int64)
+	// GetBaseFee is the fee per operation for new transactions, from the horizon fee stats under the ceiling
+	GetBaseFee() int64
+	SetMaxBaseFee(maxBaseFee int64)
+	FeeBumpIfNeeded(xdr models.XDR) (models.XDR, int64, error)
 	SubmitTransactionXDR(xdr models.XDR) error
 	PaymentTransactionToStellar(trans *models.PaymentTransaction) (*txnbuild.Transaction, error)
 	RemoveTransactionsIfSequence(transactions []*models.PaymentTransactionWithSequence) ([]*models.PaymentTransactionWithSequence, error)
-	BumpSequenceIfNeed(transaction *models.PaymentTransactionWithSequence) error
+	BumpSequenceIfNeed(transaction *models.PaymentTransactionWithSequence) (*models.SequenceBump, error)
+	// SetSequenceStore persists the sequence allocation state, it is reconciled with horizon
+	SetSequenceStore(store SequenceStore) error
+	GetSequenceState() models.SequenceState
+	SetUpChannels(keyPairs []*keypair.Full, derived int) error
+	GetChannels() []string
+	SubmitNodeOperations(ops ...txnbuild.Operation) error
 	ValidateSignarureCount(xdr models.XDR, count int) error
+	// ValidateSignatureWeight checks the signatures collected for the node account against its thresholds
+	ValidateSignatureWeight(xdr models.XDR) error
+	// SetCoSigners sets the signers asked for their signatures when the node key doesn't reach the threshold
+	SetCoSigners(coSigners []Signer) error
+	GetPeerAccount(address string) (*horizon.Account, error)
+	CreatePeerAccount(address string) error
+	CreatePeerTrustlineTransaction(account *horizon.Account) (models.XDR, error)
+	CreatePeerPaymentTransaction(sourceAddress string, from string, to string, amount float64, memo string) (models.XDR, error)
+	TransactionHash(xdr models.XDR) (string, error)
+}
+
+// HorizonClient is the part of the horizon API used by rootApi, satisfied by
+// *horizonclient.Client and by the in-memory ledger used for offline testing.
+type HorizonClient interface {
+	AccountDetail(request horizonclient.AccountRequest) (horizon.Account, error)
+	SubmitTransaction(transaction *txnbuild.Transaction) (horizon.Transaction, error)
+	SubmitTransactionXDR(transactionXdr string) (horizon.Transaction, error)
+	FeeStats() (horizon.FeeStats, error)
+	Fund(addr string) (horizon.Transaction, error)
+	Root() (horizon.Root, error)
+	TransactionDetail(txHash string) (horizon.Transaction, error)
 }
 
 type rootApiCore struct {
-	client       *horizonclient.Client
+	client       HorizonClient
 	networkToken string
 }
 type rootApi struct {
 	rootApiCore
-	fullKeyPair             keypair.Full
+	signer                  Signer
+	publicKey               keypair.KP
 	rootAccount             *horizon.Account
-	lastSequenceId          xdr.SequenceNumber
-	sequenceMux             sync.Mutex
+	sequences               *sequenceAllocator
 	transactionValiditySecs int64
+	fees                    *feeOracle
+	channels                *channelPool // nil without channel accounts
+	multisig                *multisig
 }
 
 type RootApiFactory func(seed string, transactionValiditySecs int64) (RootApi, error)
 
-func createTestRootApi(seed string, transactionValiditySecs int64) (RootApi, error) {
-	rc := &rootApiCore{
-		client:       horizonclient.DefaultTestNetClient,
-		networkToken: network.TestNetworkPassphrase,
+// SignerRootApiFactory creates root apis which sign with the signer, e.g. a remote one
+type SignerRootApiFactory func(signer Signer, transactionValiditySecs int64) (RootApi, error)
+
+// WithSeed returns the factory of the root apis signing in the process with the seed
+func (f SignerRootApiFactory) WithSeed() RootApiFactory {
+	return func(seed string, transactionValiditySecs int64) (RootApi, error) {
+		signer, err := NewKeyPairSigner(seed)
+		if err != nil {
+			return nil, err
+		}
+		return f(signer, transactionValiditySecs)
 	}
-	r, err := createRootApi(rc, seed, transactionValiditySecs)
-	return r, err
+}
+
+func createTestRootApi(seed string, transactionValiditySecs int64) (RootApi, error) {
+	factory := CreateSignerRootApiFactoryWithClient(horizonclient.DefaultTestNetClient, network.TestNetworkPassphrase)
+	return factory.WithSeed()(seed, transactionValiditySecs)
 }
 
 func createPublicRootApi(seed string, transactionValiditySecs int64) (RootApi, error) {
-	rc := &rootApiCore{
-		client:       horizonclient.DefaultTestNetClient,
-		networkToken: network.TestNetworkPassphrase,
-	}
-	r, err := createRootApi(rc, seed, transactionValiditySecs)
-	return r, err
+	factory := CreateSignerRootApiFactoryWithClient(horizonclient.DefaultPublicNetClient, network.PublicNetworkPassphrase)
+	return factory.WithSeed()(seed, transactionValiditySecs)
 }
 
 func CreateRootApiFactory(useTestApi bool) RootApiFactory {
@@ -87,20 +138,75 @@ func CreateRootApiFactory(useTestApi bool) RootApiFactory {
 
 }
 
-func createRootApi(withCore *rootApiCore, seed string, transactionValiditySecs int64) (*rootApi, error) {
-	fullKeyPair, err := keypair.ParseFull(seed)
+// CreateRootApiFactoryFromConfig returns a factory for the network selected in the configuration
+func CreateRootApiFactoryFromConfig(cfg config.RootApiConfig) (RootApiFactory, error) {
+	factory, err := CreateSignerRootApiFactoryFromConfig(cfg)
 	if err != nil {
-		log.Panicf("Error parsing node key: %s", err)
+		return nil, err
+	}
+	return factory.WithSeed(), nil
+}
 
+// CreateSignerRootApiFactoryFromConfig returns a signer factory for the network selected in the configuration
+func CreateSignerRootApiFactoryFromConfig(cfg config.RootApiConfig) (SignerRootApiFactory, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.GetNetwork() == config.TestNetwork && cfg.HorizonUrl == "":
+		return CreateSignerRootApiFactoryWithClient(horizonclient.DefaultTestNetClient, network.TestNetworkPassphrase), nil
+	case cfg.GetNetwork() == config.PublicNetwork && cfg.HorizonUrl == "":
+		return CreateSignerRootApiFactoryWithClient(horizonclient.DefaultPublicNetClient, network.PublicNetworkPassphrase), nil
+	}
+	client := &horizonclient.Client{
+		HorizonURL: cfg.GetHorizonUrl(),
+		HTTP:       http.DefaultClient,
+	}
+	return CreateSignerRootApiFactoryWithClient(client, cfg.GetNetworkPassphrase()), nil
+}
+
+// CreateRootApiFactoryWithClient returns a factory whose root apis talk to the
+// supplied horizon client using the given network passphrase.
+func CreateRootApiFactoryWithClient(client HorizonClient, networkPassphrase string) RootApiFactory {
+	return CreateSignerRootApiFactoryWithClient(client, networkPassphrase).WithSeed()
+}
+
+// CreateSignerRootApiFactoryWithClient is CreateRootApiFactoryWithClient for the root apis signing with a signer
+func CreateSignerRootApiFactoryWithClient(client HorizonClient, networkPassphrase string) SignerRootApiFactory {
+	return func(signer Signer, transactionValiditySecs int64) (RootApi, error) {
+		rc := &rootApiCore{
+			client:       client,
+			networkToken: networkPassphrase,
+		}
+		r, err := createRootApi(rc, signer, transactionValiditySecs)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+}
+
+func createRootApi(withCore *rootApiCore, signer Signer, transactionValiditySecs int64) (*rootApi, error) {
+	publicKey, err := keypair.ParseAddress(signer.Address())
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer address: %v", err)
+	}
+	withCore.client = newRetryingClient(withCore.client, DefaultRetryPolicy, withCore.networkToken)
+	err = withCore.validateNetwork()
+	if err != nil {
+		return nil, err
 	}
 	rootApi := &rootApi{
 		rootApiCore:             *withCore,
-		fullKeyPair:             *fullKeyPair,
+		signer:                  signer,
+		publicKey:               publicKey,
 		rootAccount:             nil,
-		lastSequenceId:          0,
-		sequenceMux:             sync.Mutex{},
 		transactionValiditySecs: transactionValiditySecs,
+		fees:                    newFeeOracle(),
+		multisig:                newMultisig(),
 	}
+	rootApi.sequences = newSequenceAllocator(rootApi.GetAddress(), rootApi.accountSequence)
 
 	err = rootApi.initialize()
 	if err != nil {
@@ -109,6 +215,19 @@ func createRootApi(withCore *rootApiCore, seed string, transactionValiditySecs i
 	return rootApi, err
 }
 
+// validateNetwork makes sure horizon serves the network the transactions are going to be signed for
+func (core *rootApiCore) validateNetwork() error {
+	info, err := core.client.Root()
+	if err != nil {
+		return fmt.Errorf("error reading horizon network info: %w", err)
+	}
+	if info.NetworkPassphrase != core.networkToken {
+		return fmt.Errorf("network passphrase mismatch: horizon serves %q, node is configured for %q",
+			info.NetworkPassphrase, core.networkToken)
+	}
+	return nil
+}
+
 func (api *rootApi) ValidateSignarureCount(xdr models.XDR, count int) error {
 	transactionWrapper, e := xdr.TransactionFromXDR()
 
@@ -153,23 +272,15 @@ func (api *rootApi) CreateTransaction(request *models.CreateTransactionCommand,
 		return nil, err
 	}
 
-	// Uninitialized
-	if api.lastSequenceId == 0 {
-		seq, err := api.GetSequenceNumber()
-		if err != nil {
-			return nil, err
-		}
-		log.Infof("Sequence number initialization: %d", seq)
-		api.lastSequenceId = seq
-	}
 	var sequenceProvider int64
 	// If this is the first transaction for the node+client pair and there's no reference transaction
 	if tr.ReferenceTransaction == nil {
-		api.sequenceMux.Lock()
-		defer api.sequenceMux.Unlock()
-		log.Infof("No reference transaction, assigning id %d and promoting", api.lastSequenceId)
-		sequenceProvider = int64(api.lastSequenceId)
-		api.lastSequenceId = api.lastSequenceId + 1
+		sequence, err := api.sequences.allocate()
+		if err != nil {
+			return nil, fmt.Errorf("error allocating sequence: %w", err)
+		}
+		sequenceProvider = sequence - 1
+		log.Infof("No reference transaction, assigning id %d and promoting", sequenceProvider)
 	} else {
 		referenceTransactionPayload := tr.ReferenceTransaction
 
@@ -208,7 +319,7 @@ func (api *rootApi) CreateTransaction(request *models.CreateTransactionCommand,
 			},
 			SourceAccount: request.SourceAddress,
 		}},
-		BaseFee:    200,
+		BaseFee:    api.GetBaseFee(),
 		Timebounds: txnbuild.NewTimeout(api.transactionValiditySecs),
 	})
 	//tx.Timebounds().
@@ -250,12 +361,16 @@ func (api *rootApi) ValidateForPPNode() error {
 	if err != nil {
 		return fmt.Errorf("client account doesnt exist: %s ", err.Error())
 	}
+	// The co-signers complete the signatures of the node key on multisig accounts
 	signerMap := nodeAccountDetail.SignerSummary()
-	masterWeight := signerMap[address]
+	weight := signerMap[address]
+	for _, coSigner := range api.multisig.getCoSigners() {
+		weight += signerMap[coSigner.Address()]
+	}
 
-	if masterWeight < int32(nodeAccountDetail.Thresholds.MedThreshold) {
-		return fmt.Errorf("error in client account: master weight (%d) should be at least at medium threshold (%d) ",
-			masterWeight, nodeAccountDetail.Thresholds.MedThreshold)
+	if weight < int32(nodeAccountDetail.Thresholds.MedThreshold) {
+		return fmt.Errorf("error in client account: signer weight (%d) should be at least at medium threshold (%d) ",
+			weight, nodeAccountDetail.Thresholds.MedThreshold)
 	}
 	return nil
 
@@ -266,7 +381,7 @@ func (api *rootApi) CheckSourceAddress(a string) error {
 		horizonclient.AccountRequest{
 			AccountID: a})
 	if err != nil {
-		return fmt.Errorf("error getting source account data: %v", err)
+		return fmt.Errorf("error getting source account data: %w", err)
 	}
 	return nil
 }
@@ -318,8 +433,30 @@ func (api *rootApi) SignXDR(xdr models.XDR) (models.XDR, error) {
 	return signedXdr, nil
 }
 
-func (api *rootApi) Sign(tr *txnbuild.Transaction) (*txnbuild.Transaction, error) {
-	return tr.Sign(api.networkToken, &api.fullKeyPair)
+// SignPaymentRequest signs the request with the node key, the request address must be the node address
+func (api *rootApi) SignPaymentRequest(pr *models.PaymentRequest) error {
+	if pr.Address != api.GetAddress() {
+		return fmt.Errorf("payment request address %s isn't the node address", pr.Address)
+	}
+	signature, err := api.signer.SignPaymentRequest(pr)
+	if err != nil {
+		return fmt.Errorf("failed to sign payment request: %v", err)
+	}
+	pr.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// SignRevocation signs the revocation with the node key, the revocation address must be the node address
+func (api *rootApi) SignRevocation(r *models.Revocation) error {
+	if r.Address != api.GetAddress() {
+		return fmt.Errorf("revocation address %s isn't the node address", r.Address)
+	}
+	signature, err := api.signer.SignRevocation(r)
+	if err != nil {
+		return fmt.Errorf("failed to sign revocation: %v", err)
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(signature)
+	return nil
 }
 
 func (api *rootApi) VerifyTransaction(context context.Context, transaction *models.PaymentTransaction) error {
@@ -442,7 +579,7 @@ func (n *rootApi) verifyTransactionSignatures(context context.Context, transacti
 	payerVerified := false
 	sourceVerified := false
 	signatures := t.Signatures()
-	log.Info("Signatures count: %d", len(signatures))
+	log.Infof("Signatures count: %d", len(signatures))
 	for _, signature := range signatures {
 		from, err := keypair.ParseAddress(payerAccount)
 
@@ -485,7 +622,7 @@ func (n *rootApi) verifyTransactionSignatures(context context.Context, transacti
 }
 
 func (api *rootApi) verifySignature(input []byte, sig []byte) error {
-	return api.fullKeyPair.Verify(input[:], sig)
+	return api.publicKey.Verify(input[:], sig)
 }
 
 func (api *rootApi) SubmitTransactionOld(transaction *txnbuild.Transaction) error {
@@ -511,43 +648,31 @@ func (api *rootApi) SubmitTransaction(t *models.PaymentTransaction) error {
 	if err != nil {
 		return err
 	}
+	api.releaseSequence(t.XDR)
 	return nil
 }
 
+// SubmitTransactionXDR returns a *HorizonError if the submission failed, the transient failures are retried
 func (api *rootApi) SubmitTransactionXDR(xdr models.XDR) error {
 	_, err := api.client.SubmitTransactionXDR(xdr.String())
-	if err != nil {
-		if stellarError, ok := err.(*horizonclient.Error); ok {
-
-			resultCodes, innerErr := stellarError.ResultCodes()
-
-			if innerErr != nil {
-				return fmt.Errorf("error unwrapping stellar errors: %v", innerErr)
-
-			} else {
-				var err error
-
-				for _, operror := range resultCodes.OperationCodes {
-					if err != nil {
-						err = fmt.Errorf("%v: Stellar error details - operation error: %s", err, operror)
-					} else {
-						err = fmt.Errorf("stellar error details - operation error: %s", operror)
-					}
-
-				}
-				return fmt.Errorf("stellar error details - transaction error: %s :%v", resultCodes.TransactionCode, err)
-			}
-		} else {
-			return fmt.Errorf("couldn't parse error as stellar: %v", err)
-
-		}
-
+	switch Kind(err) {
+	case ErrInsufficientFee:
+		api.fees.expire()
+	case ErrBadAuth:
+		api.multisig.expire()
+	}
+	if err == nil {
+		api.releaseSequence(xdr)
 	}
 	return err
 }
 
 func (api *rootApi) GetAddress() string {
-	return api.fullKeyPair.Address()
+	return api.signer.Address()
+}
+
+func (api *rootApi) GetNetworkPassphrase() string {
+	return api.networkToken
 }
 
 func (api *rootApi) RemoveTransactionsIfSequence(transactions []*models.PaymentTransactionWithSequence) ([]*models.PaymentTransactionWithSequence, error) {
@@ -558,7 +683,7 @@ func (api *rootApi) RemoveTransactionsIfSequence(transactions []*models.PaymentT
 	)
 
 	if nodeAccount, err = api.GetAccount(); err != nil {
-		return nil, errors.Errorf("Error gettings account details: %v", err)
+		return nil, fmt.Errorf("error getting account details: %w", err)
 	}
 
 	// Handle unfulfilled transactions, if needed
@@ -567,6 +692,7 @@ func (api *rootApi) RemoveTransactionsIfSequence(transactions []*models.PaymentT
 	if err != nil {
 		return nil, errors.Errorf("Error reading sequence: %v", err)
 	}
+	api.sequences.accountSequence(currentSequence)
 
 	transactionToRemove := 0
 
@@ -602,33 +728,48 @@ func (api *rootApi) RemoveTransactionsIfSequence(transactions []*models.PaymentT
 	return transactions, nil
 }
 
-func (api *rootApi) BumpSequenceIfNeed(transaction *models.PaymentTransactionWithSequence) error {
+// BumpSequenceIfNeed bumps the account sequence to the one preceding the transaction, the bump is nil if none was needed
+func (api *rootApi) BumpSequenceIfNeed(transaction *models.PaymentTransactionWithSequence) (*models.SequenceBump, error) {
 	var (
 		nodeAccount *horizon.Account
 		err         error
 	)
 
 	if nodeAccount, err = api.GetAccount(); err != nil {
-		return errors.Errorf("Error gettings account details: %v", err)
+		return nil, fmt.Errorf("error getting account details: %w", err)
 	}
 	currentSequence, err := nodeAccount.GetSequenceNumber()
 
 	if err != nil {
-		return errors.Errorf("Error reading sequence: %v", err)
+		return nil, errors.Errorf("Error reading sequence: %v", err)
 	}
+	api.sequences.accountSequence(currentSequence)
 	if transaction.Sequence > currentSequence+1 {
 		log.Warnf("Sequence bump needed: %d", transaction.Sequence-(currentSequence+1))
 
 		err := api.BumpSequence(currentSequence, transaction.Sequence-1)
 
 		if err != nil {
-			return errors.Errorf("Error during sequence bump: %s", err)
+			return nil, fmt.Errorf("error during sequence bump: %w", err)
 		}
+		api.sequences.accountSequence(transaction.Sequence - 1)
+		return &models.SequenceBump{From: currentSequence, To: transaction.Sequence - 1}, nil
 	}
-	return nil
+	return nil, nil
 }
 
 func (api *rootApi) BumpSequence(current int64, bumpTo int64) error {
+	if api.channels != nil {
+		// Sourced by a channel, the node sequence moves only by the operation
+		err := api.SubmitNodeOperations(&txnbuild.BumpSequence{
+			BumpTo:        bumpTo,
+			SourceAccount: api.GetAddress(),
+		})
+		if err != nil {
+			return fmt.Errorf("error submitting seq bump tx: %w", err)
+		}
+		return nil
+	}
 	nodeAccount, err := api.GetAccount()
 	if err != nil {
 		return err
@@ -639,7 +780,7 @@ func (api *rootApi) BumpSequence(current int64, bumpTo int64) error {
 			Sequence:  current,
 		},
 		IncrementSequenceNum: true,
-		BaseFee:              config.StellarImmediateOperationBaseFee,
+		BaseFee:              api.GetBaseFee(),
 		Timebounds:           txnbuild.NewTimeout(config.StellarImmediateOperationTimeoutSec),
 		Operations: []txnbuild.Operation{
 			&txnbuild.BumpSequence{
@@ -664,7 +805,7 @@ func (api *rootApi) BumpSequence(current int64, bumpTo int64) error {
 	if err != nil {
 		xdr, _ := tx.Base64()
 		log.Errorf("Error in seq bump transaction: %s" + xdr)
-		return errors.Errorf("Error submitting seq bump tx: %v", err)
+		return fmt.Errorf("error submitting seq bump tx: %w", err)
 	}
 
 	return nil
@@ -745,17 +886,26 @@ func (api *rootApi) initialize() error {
 		api.rootAccount = rootAccount
 		return nil
 	}
+	if Kind(err) != ErrNotFound {
+		return fmt.Errorf("error reading account %s: %w", api.GetAddress(), err)
+	}
 
-	txSuccess, err := api.client.Fund(api.fullKeyPair.Address())
+	txSuccess, err := api.client.Fund(api.GetAddress())
 
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("account %s doesn't exist and couldn't be funded: %w", api.GetAddress(), err)
 	}
 
-	//TODO: Replace optimism with structured error handling
-	rootAccount, err = api.GetAccount()
+	// The funded account may not be served by horizon right away
+	for attempt := 1; ; attempt++ {
+		rootAccount, err = api.GetAccount()
+		if Kind(err) != ErrNotFound || attempt >= fundedAccountAttempts {
+			break
+		}
+		time.Sleep(fundedAccountPollInterval)
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("funded account %s not available: %w", api.GetAddress(), err)
 	}
 	api.rootAccount = rootAccount
 	log.Infof("Account creation performed using transaction#: %s", txSuccess.ResultXdr)
@@ -801,14 +951,14 @@ func getInitialAccountBalance() int {
 }
 
 func (api *rootApi) CreateUser() error {
-	address := api.fullKeyPair.Address()
+	address := api.GetAddress()
 	_, err := api.client.AccountDetail(
 		horizonclient.AccountRequest{
 			AccountID: address})
 
 	accountData, _ := api.client.AccountDetail(
 		horizonclient.AccountRequest{
-			AccountID: api.fullKeyPair.Address()})
+			AccountID: api.GetAddress()})
 
 	if err == nil {
 		return nil
@@ -838,7 +988,7 @@ func (api *rootApi) CreateUser() error {
 		MediumThreshold: &thresholdMed,
 		HighThreshold:   &thresholdHigh,
 		Signer: &txnbuild.Signer{
-			Address: api.fullKeyPair.Address(),
+			Address: api.GetAddress(),
 			Weight:  6,
 		},
 	}
@@ -860,7 +1010,7 @@ func (api *rootApi) CreateUser() error {
 		return err
 	}
 	//TODO is send Sign
-	tx, err = tx.Sign(network.TestNetworkPassphrase, &api.fullKeyPair)
+	tx, err = api.Sign(tx)
 	if err != nil {
 		return err
 	}
@@ -882,17 +1032,16 @@ func (api *rootApi) CreateUser() error {
 		log.Fatal("Cannot deserialize transaction (GenericTransaction):", er2.Error())
 	}
 	//TODO SHULD SEND SIGNED?
-	clientTrans, err = clientTrans.Sign(network.TestNetworkPassphrase, &api.fullKeyPair)
+	clientTrans, err = api.Sign(clientTrans)
 	if err != nil {
 		return err
 	}
 	resp, err := api.client.SubmitTransaction(clientTrans)
 	if err != nil {
-		hError := err.(*horizonclient.Error)
-		log.Fatal("Error submitting transaction:", hError, hError.Problem)
+		log.Fatal("Error submitting transaction:", err)
 	}
 
-	log.Infof("\nTransaction response: ", resp)
+	log.Infof("\nTransaction response: %v", resp)
 
 	return nil
 }
@@ -0,0 +1,219 @@
+package root
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/support/log"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// SequenceStore persists the sequence allocation state, so the sequences of the signed transactions
+// aren't allocated again after a restart
+type SequenceStore interface {
+	// Load returns nil if the state wasn't saved
+	Load() (*models.SequenceState, error)
+	Save(state *models.SequenceState) error
+}
+
+// sequenceAllocator allocates the sequence numbers of the node account above a high-water mark and keeps
+// the allocated sequences until they are submitted or the account sequence passes them
+type sequenceAllocator struct {
+	mutex       sync.Mutex
+	store       SequenceStore // nil if the state is kept in memory only
+	account     func() (int64, error)
+	state       models.SequenceState
+	unsubmitted map[int64]bool
+	initialized bool
+}
+
+func newSequenceAllocator(address string, account func() (int64, error)) *sequenceAllocator {
+	return &sequenceAllocator{
+		account:     account,
+		state:       models.SequenceState{NodeAddress: address},
+		unsubmitted: map[int64]bool{},
+	}
+}
+
+// setStore loads the persisted state and reconciles it with the account sequence on the ledger
+func (a *sequenceAllocator) setStore(store SequenceStore) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	stored, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("error loading sequence state: %v", err)
+	}
+	a.store = store
+	a.unsubmitted = map[int64]bool{}
+	a.state.HighWaterMark = 0
+	if stored != nil {
+		a.state.HighWaterMark = stored.HighWaterMark
+		for _, sequence := range stored.Unsubmitted {
+			a.unsubmitted[sequence] = true
+		}
+	}
+	err = a.reconcile()
+	if err != nil {
+		return err
+	}
+	if stored != nil && stored.HighWaterMark < a.state.AccountSequence {
+		log.Warnf("Account %s sequence %d is past the stored high-water mark %d", a.state.NodeAddress,
+			a.state.AccountSequence, stored.HighWaterMark)
+	}
+	log.Infof("Account %s sequence %d, high-water mark %d, %d unsubmitted sequences", a.state.NodeAddress,
+		a.state.AccountSequence, a.state.HighWaterMark, len(a.unsubmitted))
+	return a.save()
+}
+
+// reconcile reads the account sequence, the allocation continues above it
+func (a *sequenceAllocator) reconcile() error {
+	current, err := a.account()
+	if err != nil {
+		return err
+	}
+	a.observe(current)
+	a.state.Reconciled = time.Now()
+	a.initialized = true
+	return nil
+}
+
+// observe drops the sequences the account already passed
+func (a *sequenceAllocator) observe(current int64) {
+	a.state.AccountSequence = current
+	if a.state.HighWaterMark < current {
+		a.state.HighWaterMark = current
+	}
+	for sequence := range a.unsubmitted {
+		if sequence <= current {
+			delete(a.unsubmitted, sequence)
+		}
+	}
+}
+
+func (a *sequenceAllocator) save() error {
+	if a.store == nil {
+		return nil
+	}
+	state := a.snapshot()
+	err := a.store.Save(&state)
+	if err != nil {
+		return fmt.Errorf("error saving sequence state: %v", err)
+	}
+	return nil
+}
+
+func (a *sequenceAllocator) snapshot() models.SequenceState {
+	state := a.state
+	state.Unsubmitted = make([]int64, 0, len(a.unsubmitted))
+	for sequence := range a.unsubmitted {
+		state.Unsubmitted = append(state.Unsubmitted, sequence)
+	}
+	sort.Slice(state.Unsubmitted, func(i, j int) bool { return state.Unsubmitted[i] < state.Unsubmitted[j] })
+	return state
+}
+
+// allocate returns the next sequence number above the high-water mark
+func (a *sequenceAllocator) allocate() (int64, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if !a.initialized {
+		err := a.reconcile()
+		if err != nil {
+			return 0, err
+		}
+	}
+	sequence := a.state.HighWaterMark + 1
+	a.state.HighWaterMark = sequence
+	a.unsubmitted[sequence] = true
+	err := a.save()
+	if err != nil {
+		return 0, err
+	}
+	return sequence, nil
+}
+
+// accountSequence updates the state with the account sequence read from the ledger
+func (a *sequenceAllocator) accountSequence(current int64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.observe(current)
+	err := a.save()
+	if err != nil {
+		log.Errorf("Account %s: %v", a.state.NodeAddress, err)
+	}
+}
+
+// submitted releases the sequence of a submitted transaction
+func (a *sequenceAllocator) submitted(sequence int64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if !a.unsubmitted[sequence] {
+		return
+	}
+	delete(a.unsubmitted, sequence)
+	if a.state.AccountSequence < sequence {
+		a.state.AccountSequence = sequence
+	}
+	err := a.save()
+	if err != nil {
+		log.Errorf("Account %s: %v", a.state.NodeAddress, err)
+	}
+}
+
+// abandon returns the last allocated sequence, the transaction with the sequence wasn't applied
+func (a *sequenceAllocator) abandon(sequence int64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if sequence != a.state.HighWaterMark || !a.unsubmitted[sequence] {
+		return
+	}
+	delete(a.unsubmitted, sequence)
+	a.state.HighWaterMark--
+	err := a.save()
+	if err != nil {
+		log.Errorf("Account %s: %v", a.state.NodeAddress, err)
+	}
+}
+
+func (a *sequenceAllocator) get() models.SequenceState {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.snapshot()
+}
+
+// SetSequenceStore persists the sequence allocation state in the store, the stored state is reconciled with horizon
+func (api *rootApi) SetSequenceStore(store SequenceStore) error {
+	return api.sequences.setStore(store)
+}
+
+// GetSequenceState returns the sequence allocation state for diagnostics
+func (api *rootApi) GetSequenceState() models.SequenceState {
+	return api.sequences.get()
+}
+
+func (api *rootApi) accountSequence() (int64, error) {
+	seq, err := api.GetSequenceNumber()
+	return int64(seq), err
+}
+
+// releaseSequence releases the sequence of a submitted transaction sourced by the node account
+func (api *rootApi) releaseSequence(xdr models.XDR) {
+	wrapper, err := xdr.TransactionFromXDR()
+	if err != nil {
+		return
+	}
+	tx, ok := wrapper.Transaction()
+	if !ok {
+		feeBump, isFeeBump := wrapper.FeeBump()
+		if !isFeeBump {
+			return
+		}
+		tx = feeBump.InnerTransaction()
+	}
+	source := tx.SourceAccount()
+	if source.AccountID == api.GetAddress() {
+		api.sequences.submitted(source.Sequence)
+	}
+}
@@ -0,0 +1,142 @@
+package root
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/txnbuild"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// Transactions built for peers of the side channel. The peer transactions are
+// sourced by the peer accounts wherever possible so they don't consume sequence
+// numbers of the node account, which are reserved for the accumulated payments.
+
+func ppTokenAsset() txnbuild.CreditAsset {
+	return txnbuild.CreditAsset{
+		Code:   models.PPTokenAssetName,
+		Issuer: models.PPTokenIssuerAddress,
+	}
+}
+
+func (api *rootApi) GetPeerAccount(address string) (*horizon.Account, error) {
+	acc, err := api.client.AccountDetail(
+		horizonclient.AccountRequest{
+			AccountID: address,
+		})
+	if err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// HasPPTokenTrustline checks whether the account can hold pptoken
+func HasPPTokenTrustline(account *horizon.Account) bool {
+	for _, b := range account.Balances {
+		if b.Code == models.PPTokenAssetName && b.Issuer == models.PPTokenIssuerAddress {
+			return true
+		}
+	}
+	return false
+}
+
+// allocateSequence reserves a sequence number of the node account, the returned
+// value precedes the reserved one as expected with IncrementSequenceNum
+func (api *rootApi) allocateSequence() (int64, error) {
+	current, err := api.accountSequence()
+	if err != nil {
+		return 0, err
+	}
+	api.sequences.accountSequence(current)
+	sequence, err := api.sequences.allocate()
+	if err != nil {
+		return 0, err
+	}
+	return sequence - 1, nil
+}
+
+func (api *rootApi) buildPeerTransaction(source txnbuild.Account, memo string, ops ...txnbuild.Operation) (*txnbuild.Transaction, error) {
+	params := txnbuild.TransactionParams{
+		SourceAccount:        source,
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              api.GetBaseFee(),
+		Timebounds:           txnbuild.NewTimeout(api.transactionValiditySecs),
+	}
+	if memo != "" {
+		params.Memo = txnbuild.MemoText(memo)
+	}
+	tx, err := txnbuild.NewTransaction(params)
+	if err != nil {
+		return nil, fmt.Errorf("error creating transaction: %v", err)
+	}
+	return tx, nil
+}
+
+func toXDR(tx *txnbuild.Transaction) (models.XDR, error) {
+	str, err := tx.Base64()
+	if err != nil {
+		return nil, fmt.Errorf("error serializing transaction: %v", err)
+	}
+	return models.NewXDR(str), nil
+}
+
+// CreatePeerAccount funds the peer account with the starting balance, the creation is a node operation
+// so it doesn't take the sequence of the accumulated transactions when channel accounts are set up
+func (api *rootApi) CreatePeerAccount(address string) error {
+	return api.SubmitNodeOperations(&txnbuild.CreateAccount{
+		Destination:   address,
+		Amount:        config.StellarPeerAccountStartingBalance,
+		SourceAccount: api.GetAddress(),
+	})
+}
+
+// CreatePeerTrustlineTransaction adds the pptoken trustline to an existing peer account,
+// the peer is the source and the only signer of the transaction
+func (api *rootApi) CreatePeerTrustlineTransaction(account *horizon.Account) (models.XDR, error) {
+	tx, err := api.buildPeerTransaction(account, "",
+		&txnbuild.ChangeTrust{
+			Line:  ppTokenAsset(),
+			Limit: txnbuild.MaxTrustlineLimit,
+		})
+	if err != nil {
+		return nil, err
+	}
+	return toXDR(tx)
+}
+
+// CreatePeerPaymentTransaction creates an unsigned pptoken payment sourced by the source account,
+// which can differ from the paying account
+func (api *rootApi) CreatePeerPaymentTransaction(sourceAddress string, from string, to string, amount float64, memo string) (models.XDR, error) {
+	source, err := api.GetPeerAccount(sourceAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error getting source account data: %v", err)
+	}
+	tx, err := api.buildPeerTransaction(source, memo,
+		&txnbuild.Payment{
+			Destination:   to,
+			Amount:        strconv.FormatFloat(amount, 'f', 7, 64),
+			Asset:         ppTokenAsset(),
+			SourceAccount: from,
+		})
+	if err != nil {
+		return nil, err
+	}
+	return toXDR(tx)
+}
+
+// TransactionHash identifies the transaction regardless of its signatures
+func (api *rootApi) TransactionHash(xdr models.XDR) (string, error) {
+	transactionWrapper, err := xdr.TransactionFromXDR()
+	if err != nil {
+		return "", fmt.Errorf("error parsing transaction: %v", err)
+	}
+	t, result := transactionWrapper.Transaction()
+	if !result {
+		return "", fmt.Errorf("error deserializing transaction from XDR (GenericTransaction)")
+	}
+	return t.HashHex(api.networkToken)
+}
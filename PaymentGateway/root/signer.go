@@ -0,0 +1,249 @@
+package root
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// The remote signer waits at most signerTimeout for the daemon to sign
+const signerTimeout = 10 * time.Second
+
+// Signer holds the node key, with a remote signer the gateway process doesn't have the seed
+type Signer interface {
+	Address() string
+	SignTransaction(networkPassphrase string, tx *txnbuild.Transaction) (*txnbuild.Transaction, error)
+	SignFeeBump(networkPassphrase string, tx *txnbuild.FeeBumpTransaction) (*txnbuild.FeeBumpTransaction, error)
+	// SignPaymentRequest returns the signature of the payment request signing payload
+	SignPaymentRequest(pr *models.PaymentRequest) ([]byte, error)
+	// SignRevocation returns the signature of the revocation signing payload
+	SignRevocation(r *models.Revocation) ([]byte, error)
+	// SignAuthorization returns the signature of the authorization signing payload
+	SignAuthorization(a *models.SignAuthorization) ([]byte, error)
+}
+
+type keyPairSigner struct {
+	keyPair *keypair.Full
+}
+
+// NewKeyPairSigner signs in the process with the seed
+func NewKeyPairSigner(seed string) (Signer, error) {
+	kp, err := keypair.ParseFull(seed)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing node key: %v", err)
+	}
+	return &keyPairSigner{keyPair: kp}, nil
+}
+
+func (s *keyPairSigner) Address() string {
+	return s.keyPair.Address()
+}
+
+func (s *keyPairSigner) SignTransaction(networkPassphrase string, tx *txnbuild.Transaction) (*txnbuild.Transaction, error) {
+	return tx.Sign(networkPassphrase, s.keyPair)
+}
+
+func (s *keyPairSigner) SignFeeBump(networkPassphrase string, tx *txnbuild.FeeBumpTransaction) (*txnbuild.FeeBumpTransaction, error) {
+	return tx.Sign(networkPassphrase, s.keyPair)
+}
+
+func (s *keyPairSigner) SignPaymentRequest(pr *models.PaymentRequest) ([]byte, error) {
+	return s.keyPair.Sign(pr.SigningPayload())
+}
+
+func (s *keyPairSigner) SignRevocation(r *models.Revocation) ([]byte, error) {
+	return s.keyPair.Sign(r.SigningPayload())
+}
+
+func (s *keyPairSigner) SignAuthorization(a *models.SignAuthorization) ([]byte, error) {
+	return s.keyPair.Sign(a.SigningPayload())
+}
+
+// remoteSigner asks a signing daemon for the signatures, over its unix socket or the co-signing
+// endpoint, the daemon signs only what its policy allows
+type remoteSigner struct {
+	address string
+	send    func(request *models.SignRequest) (*models.SignResponse, error)
+}
+
+// NewRemoteSigner connects to the signing daemon to read the address of the node key
+func NewRemoteSigner(socket string) (Signer, error) {
+	return newRemoteSigner(func(request *models.SignRequest) (*models.SignResponse, error) {
+		return sendUnix(socket, request)
+	})
+}
+
+// NewHttpSigner is the remote signer of a co-signing endpoint, the requests are posted to the url
+// with the authorization of the node key
+func NewHttpSigner(url string, node Signer) (Signer, error) {
+	client := &http.Client{Timeout: signerTimeout}
+	return newRemoteSigner(func(request *models.SignRequest) (*models.SignResponse, error) {
+		return sendHttp(client, url, node, request)
+	})
+}
+
+func newRemoteSigner(send func(request *models.SignRequest) (*models.SignResponse, error)) (Signer, error) {
+	s := &remoteSigner{send: send}
+	response, err := s.request(&models.SignRequest{Kind: models.SignRequestAddress})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = keypair.ParseAddress(response.Address); err != nil {
+		return nil, fmt.Errorf("signer returned an invalid address: %v", err)
+	}
+	s.address = response.Address
+	return s, nil
+}
+
+func sendUnix(socket string, request *models.SignRequest) (*models.SignResponse, error) {
+	conn, err := net.DialTimeout("unix", socket, signerTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to signer: %v", err)
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(signerTimeout))
+	if err != nil {
+		return nil, err
+	}
+	err = json.NewEncoder(conn).Encode(request)
+	if err != nil {
+		return nil, fmt.Errorf("error sending sign request: %v", err)
+	}
+	response := &models.SignResponse{}
+	err = json.NewDecoder(conn).Decode(response)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sign response: %v", err)
+	}
+	return response, nil
+}
+
+func sendHttp(client *http.Client, url string, node Signer, request *models.SignRequest) (*models.SignResponse, error) {
+	raw, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	authorization := &models.SignAuthorization{
+		Address:     node.Address(),
+		Timestamp:   time.Now().Unix(),
+		Nonce:       uuid.New().String(),
+		RequestHash: models.SignRequestHash(raw),
+	}
+	signature, err := node.SignAuthorization(authorization)
+	if err != nil {
+		return nil, fmt.Errorf("error authorizing sign request: %v", err)
+	}
+	authorization.Signature = base64.StdEncoding.EncodeToString(signature)
+	body, err := json.Marshal(&models.AuthorizedSignRequest{
+		Request:       raw,
+		Authorization: authorization,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error sending sign request: %v", err)
+	}
+	defer resp.Body.Close()
+	response := &models.SignResponse{}
+	err = json.NewDecoder(resp.Body).Decode(response)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sign response (%s): %v", resp.Status, err)
+	}
+	return response, nil
+}
+
+func (s *remoteSigner) request(request *models.SignRequest) (*models.SignResponse, error) {
+	response, err := s.send(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("signer refused to sign: %s", response.Error)
+	}
+	return response, nil
+}
+
+func (s *remoteSigner) Address() string {
+	return s.address
+}
+
+func (s *remoteSigner) SignTransaction(networkPassphrase string, tx *txnbuild.Transaction) (*txnbuild.Transaction, error) {
+	envelope, err := tx.Base64()
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.request(&models.SignRequest{
+		Kind:              models.SignRequestTransaction,
+		NetworkPassphrase: networkPassphrase,
+		Transaction:       envelope,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The signature is verified against the hash of the transaction
+	return tx.AddSignatureBase64(networkPassphrase, s.address, response.Signature)
+}
+
+func (s *remoteSigner) SignFeeBump(networkPassphrase string, tx *txnbuild.FeeBumpTransaction) (*txnbuild.FeeBumpTransaction, error) {
+	envelope, err := tx.Base64()
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.request(&models.SignRequest{
+		Kind:              models.SignRequestTransaction,
+		NetworkPassphrase: networkPassphrase,
+		Transaction:       envelope,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx.AddSignatureBase64(networkPassphrase, s.address, response.Signature)
+}
+
+func (s *remoteSigner) SignPaymentRequest(pr *models.PaymentRequest) ([]byte, error) {
+	return s.signPayload(&models.SignRequest{
+		Kind:           models.SignRequestPaymentRequest,
+		PaymentRequest: pr,
+	}, pr.SigningPayload())
+}
+
+func (s *remoteSigner) SignRevocation(r *models.Revocation) ([]byte, error) {
+	return s.signPayload(&models.SignRequest{
+		Kind:       models.SignRequestRevocation,
+		Revocation: r,
+	}, r.SigningPayload())
+}
+
+func (s *remoteSigner) SignAuthorization(a *models.SignAuthorization) ([]byte, error) {
+	return s.signPayload(&models.SignRequest{
+		Kind:          models.SignRequestAuthorization,
+		Authorization: a,
+	}, a.SigningPayload())
+}
+
+// signPayload verifies the signature the daemon returns for the payload of the request
+func (s *remoteSigner) signPayload(request *models.SignRequest, payload []byte) ([]byte, error) {
+	response, err := s.request(request)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("signer returned an invalid signature: %v", err)
+	}
+	kp, _ := keypair.ParseAddress(s.address)
+	if err = kp.Verify(payload, signature); err != nil {
+		return nil, fmt.Errorf("signer returned an invalid signature: %v", err)
+	}
+	return signature, nil
+}
@@ -1,5 +1,5 @@
 #!/bin/bash
 
 cd /opt/paidpiper/PaymentServices/PaymentGateway
-source stellar_seed.conf
-./payment-gateway $stellar_seed 28080
+# keystore.json is created with ./payment-gateway keys import, the passphrase file is readable only by the service user
+./payment-gateway -passphrase-fd 3 3<keystore.passphrase
@@ -0,0 +1,37 @@
+package serviceNode
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"paidpiper.com/payment-gateway/controllers"
+	"paidpiper.com/payment-gateway/node/local"
+	"paidpiper.com/payment-gateway/ppsidechannel"
+)
+
+// GrpcLocalNode serves the ppsidechannel services of the node on address:port, the listener is opened before returning.
+// The services make the node sign and pay, the options set the credentials when address isn't a loopback one.
+func GrpcLocalNode(localNode local.LocalPPNode, address string, port int, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("error listening on grpc port %d: %v", port, err)
+	}
+	if ip := net.ParseIP(address); len(opts) == 0 && address != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		glog.Warningf("grpc services listen on %s without credentials", listener.Addr())
+	}
+	server := grpc.NewServer(opts...)
+	ppsidechannel.RegisterPPSideChannelServer(server, controllers.NewGrpcSideChannelController(localNode))
+	ppsidechannel.RegisterPPPaymentUtilityServicesServer(server, controllers.NewGrpcUtilityController(localNode))
+	ppsidechannel.RegisterPPPaymentGatewayServer(server, controllers.NewGrpcGatewayController(localNode))
+	ppsidechannel.RegisterPPCommandStreamServer(server, controllers.NewGrpcCommandStreamController(localNode))
+
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			glog.Warningf("Error serving grpc: %s", err)
+		}
+	}()
+	return server, nil
+}
@@ -2,6 +2,7 @@ package serviceNode
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 	"paidpiper.com/payment-gateway/config"
 	"paidpiper.com/payment-gateway/controllers"
 	chi_server "paidpiper.com/payment-gateway/http/server"
@@ -31,16 +33,55 @@ func RunHttpServer(config *config.Configuration) (func(), error) {
 		return nil, err
 	}
 	server := HttpLocalNode(local, config.Port)
-	return func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
 
-		if err := server.Shutdown(ctx); err != nil {
-			log.Printf("Error shutting down server: %v", err)
+	var grpcServer *grpc.Server
+	if config.GrpcPort != 0 {
+		grpcServer, err = GrpcLocalNode(local, config.GrpcAddress, config.GrpcPort)
+		if err != nil {
+			server.Close()
+			return nil, err
 		}
+	}
+	return func() {
+		shutdown(local, server, grpcServer, config.ShutdownTimeout)
 	}, nil
 }
 
+// shutdown stops accepting new payment sessions and waits for the sessions in progress while the servers
+// keep serving their commands, then stops the servers and closes the node with a final flush.
+// Each step has its own timeout, a slow drain doesn't cut off the replies in flight.
+func shutdown(local local.LocalPPNode, server *http.Server, grpcServer *grpc.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := local.Shutdown(ctx); err != nil {
+		log.Printf("Error waiting for payments in progress: %v", err)
+	}
+
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(timeout):
+			grpcServer.Stop()
+		}
+	}
+	serverCtx, cancelServer := context.WithTimeout(context.Background(), timeout)
+	defer cancelServer()
+	if err := server.Shutdown(serverCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), timeout)
+	defer cancelFlush()
+	if err := local.Close(flushCtx); err != nil {
+		log.Printf("Error closing node: %v", err)
+	}
+}
+
 func HttpLocalNode(localNode local.LocalPPNode, port int) *http.Server {
 
 	utilityController := controllers.NewHttpUtilityController(localNode)
@@ -55,11 +96,18 @@ func HttpLocalNode(localNode local.LocalPPNode, port int) *http.Server {
 	router.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, version.Version())
 	})
+	router.Handle("/debug/vars", expvar.Handler()).Methods("GET")
 	router.Handle("/api/utility/createPaymentInfo", http.HandlerFunc(utilityController.HttpNewPaymentRequest)).Methods("POST")
 	router.Handle("/api/utility/validatePayment", http.HandlerFunc(utilityController.HttpValidatePayment)).Methods("POST")
 	router.Handle("/api/utility/transactions/flush", http.HandlerFunc(utilityController.HttpFlushTransactions)).Methods("GET")
+	router.Handle("/api/utility/transactions/flushes", http.HandlerFunc(utilityController.HttpFlushHistory)).Methods("GET")
+	router.Handle("/api/utility/transactions/flushes/{id}", http.HandlerFunc(utilityController.HttpGetFlushReport)).Methods("GET")
+	router.Handle("/api/utility/transactions/unflushed", http.HandlerFunc(utilityController.HttpUnflushedTransactions)).Methods("GET")
+	router.Handle("/api/utility/transactions/sequence", http.HandlerFunc(utilityController.HttpGetSequenceState)).Methods("GET")
 	router.Handle("/api/utility/transactions", http.HandlerFunc(utilityController.ListTransactions)).Methods("GET")
 	router.Handle("/api/utility/transaction/{sessionId}", http.HandlerFunc(utilityController.HttpGetTransaction)).Methods("GET")
+	router.Handle("/api/utility/prices", http.HandlerFunc(utilityController.HttpGetPrices)).Methods("GET")
+	router.Handle("/api/utility/fees", http.HandlerFunc(utilityController.HttpGetFeePolicy)).Methods("GET")
 	router.Handle("/api/utility/stellarAddress", http.HandlerFunc(utilityController.HttpGetStellarAddress)).Methods("GET")
 	router.Handle("/api/utility/processCommand", http.HandlerFunc(utilityController.HttpProcessCommand)).Methods("POST")
 	router.Handle("/api/utility/balance", http.HandlerFunc(utilityController.HttpGetBalance)).Methods("GET")
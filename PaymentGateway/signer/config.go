@@ -0,0 +1,149 @@
+package signer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/keypair"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/keystore"
+)
+
+// The socket is in a private directory, of the runtime directory of the user if set
+const (
+	defaultSocketDir  = "/run/paidpiper"
+	defaultSocketName = "pp-signer.sock"
+)
+
+func defaultSocket() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "paidpiper", defaultSocketName)
+	}
+	return filepath.Join(defaultSocketDir, defaultSocketName)
+}
+
+type jsonConfiguration struct {
+	Socket               string
+	Seed                 string // refused, the seed is only read from the keystore
+	Keystore             string
+	Account              string
+	HttpAddress          string
+	StellarNetwork       string
+	NetworkPassphrase    string
+	MaxPaymentAmount     string // pptoken
+	MaxTransactionAmount string // pptoken
+	MaxDailyAmount       string // pptoken
+	MaxStartingBalance   string // XLM
+	AllowAccountCreation bool
+	MaxDailyAccounts     *int64
+	MaxBaseFee           int64
+	AllowSequenceBumps   *bool
+}
+
+type Configuration struct {
+	Socket  string
+	KeyPair *keypair.Full
+	// Account is the multisig node account a co-signer signs for, the address of the key otherwise
+	Account string
+	// HttpAddress is the listen address of the co-signing endpoint, it isn't served if empty
+	HttpAddress       string
+	NetworkPassphrase string
+	Policy            Policy
+}
+
+// ParseConfiguration reads the daemon configuration, the limits of the policy which aren't set are the default ones.
+// The node key is only read from the keystore, its passphrase is read from passphraseFd, the environment or the terminal.
+func ParseConfiguration(configFile string, passphraseFd int) (*Configuration, error) {
+	raw := jsonConfiguration{}
+	body, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(body, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", configFile, err)
+	}
+
+	if raw.Seed != "" {
+		return nil, fmt.Errorf("the seed can't be stored in cleartext, move it to a keystore with `payment-gateway keys import`")
+	}
+	if raw.Keystore == "" {
+		return nil, fmt.Errorf("the keystore of the node key isn't set")
+	}
+	kp, err := keystore.Open(raw.Keystore, passphraseFd)
+	keystore.ForgetEnvSecrets()
+	if err != nil {
+		return nil, fmt.Errorf("error opening keystore %s: %v", raw.Keystore, err)
+	}
+	network := config.RootApiConfig{
+		Network:           config.StellarNetwork(raw.StellarNetwork),
+		NetworkPassphrase: raw.NetworkPassphrase,
+		HorizonUrl:        "http://localhost", // only the passphrase is used
+	}
+	if network.Network == "" {
+		network.Network = config.TestNetwork
+	}
+	err = network.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Configuration{
+		Socket:            raw.Socket,
+		KeyPair:           kp,
+		Account:           raw.Account,
+		HttpAddress:       raw.HttpAddress,
+		NetworkPassphrase: network.GetNetworkPassphrase(),
+		Policy:            DefaultPolicy(),
+	}
+	if cfg.Socket == "" {
+		cfg.Socket = defaultSocket()
+	}
+	if cfg.Account == "" {
+		cfg.Account = kp.Address()
+	} else if _, err = keypair.ParseAddress(cfg.Account); err != nil {
+		return nil, fmt.Errorf("invalid account: %v", err)
+	}
+	if raw.MaxPaymentAmount != "" {
+		cfg.Policy.MaxPaymentAmount, err = amount.ParseInt64(raw.MaxPaymentAmount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max payment amount: %v", err)
+		}
+	}
+	if raw.MaxTransactionAmount != "" {
+		cfg.Policy.MaxTransactionAmount, err = amount.ParseInt64(raw.MaxTransactionAmount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max transaction amount: %v", err)
+		}
+	}
+	if raw.MaxDailyAmount != "" {
+		cfg.Policy.MaxDailyAmount, err = amount.ParseInt64(raw.MaxDailyAmount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max daily amount: %v", err)
+		}
+	}
+	if raw.MaxStartingBalance != "" {
+		cfg.Policy.MaxStartingBalance, err = amount.ParseInt64(raw.MaxStartingBalance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max starting balance: %v", err)
+		}
+	}
+	cfg.Policy.AllowAccountCreation = raw.AllowAccountCreation
+	if raw.MaxDailyAccounts != nil {
+		if *raw.MaxDailyAccounts < 0 {
+			return nil, fmt.Errorf("invalid max daily accounts %d", *raw.MaxDailyAccounts)
+		}
+		cfg.Policy.MaxDailyAccounts = *raw.MaxDailyAccounts
+	}
+	if raw.MaxBaseFee != 0 {
+		cfg.Policy.MaxBaseFee = raw.MaxBaseFee
+	}
+	if raw.AllowSequenceBumps != nil {
+		cfg.Policy.AllowSequenceBumps = *raw.AllowSequenceBumps
+	}
+	return cfg, nil
+}
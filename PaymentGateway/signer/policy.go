@@ -0,0 +1,200 @@
+package signer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/amount"
+	"github.com/stellar/go/txnbuild"
+	"paidpiper.com/payment-gateway/common"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// The daily limits of the policy roll over limitPeriod
+const limitPeriod = 24 * time.Hour
+
+// Policy is the allowlist of the signing daemon. The node key signs only pptoken payments to or from
+// the node, the creation of peer and channel accounts if allowed, pptoken trustlines of other accounts
+// and the sequence bumps of the node, within the limits. Amounts are in stroops.
+type Policy struct {
+	MaxPaymentAmount     int64 // pptoken per payment operation
+	MaxTransactionAmount int64 // pptoken paid by the node per transaction
+	MaxDailyAmount       int64 // pptoken paid by the node within a day
+	MaxStartingBalance   int64 // XLM of a created account
+	AllowAccountCreation bool  // of accounts funded by the node, the side channel peers and the channels
+	MaxDailyAccounts     int64 // accounts funded by the node within a day
+	MaxBaseFee           int64 // per operation, of transactions and fee-bump transactions
+	AllowSequenceBumps   bool
+}
+
+// DefaultPolicy doesn't allow the node to fund accounts
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxPaymentAmount:     int64(amount.MustParse("1000")),
+		MaxTransactionAmount: int64(amount.MustParse("1000")),
+		MaxDailyAmount:       int64(amount.MustParse("10000")),
+		MaxStartingBalance:   int64(amount.MustParse(config.StellarPeerAccountStartingBalance)),
+		MaxDailyAccounts:     20,
+		MaxBaseFee:           config.StellarMaxBaseFee,
+		AllowSequenceBumps:   true,
+	}
+}
+
+// Spending is what a transaction takes from the daily limits of the policy
+type Spending struct {
+	Amount   int64 // pptoken paid by the node
+	Accounts int64 // accounts funded by the node
+}
+
+func isPPToken(asset txnbuild.Asset) bool {
+	return !asset.IsNative() && asset.GetCode() == models.PPTokenAssetName && asset.GetIssuer() == models.PPTokenIssuerAddress
+}
+
+// CheckTransaction checks every operation of the transaction signed by the node, the spending is taken
+// from the daily limits by the caller
+func (p Policy) CheckTransaction(node string, tx *txnbuild.Transaction) (Spending, error) {
+	if tx.BaseFee() > p.MaxBaseFee {
+		return Spending{}, fmt.Errorf("base fee %d exceeds %d", tx.BaseFee(), p.MaxBaseFee)
+	}
+	return p.checkOperations(node, tx, "operation")
+}
+
+func (p Policy) checkOperations(node string, tx *txnbuild.Transaction, name string) (Spending, error) {
+	spending := Spending{}
+	for i, op := range tx.Operations() {
+		source := op.GetSourceAccount()
+		if source == "" {
+			source = tx.SourceAccount().AccountID
+		}
+		err := p.checkOperation(node, source, op, &spending)
+		if err != nil {
+			return Spending{}, fmt.Errorf("%s %d: %v", name, i, err)
+		}
+	}
+	if spending.Amount > p.MaxTransactionAmount {
+		return Spending{}, fmt.Errorf("payments of the node %s exceed %s per transaction",
+			amount.StringFromInt64(spending.Amount), amount.StringFromInt64(p.MaxTransactionAmount))
+	}
+	return spending, nil
+}
+
+func (p Policy) checkOperation(node string, source string, op txnbuild.Operation, spending *Spending) error {
+	switch op := op.(type) {
+	case *txnbuild.Payment:
+		if !isPPToken(op.Asset) {
+			return fmt.Errorf("payment of %s isn't allowed", op.Asset.GetCode())
+		}
+		if source != node && op.Destination != node {
+			return fmt.Errorf("payment %s => %s isn't to or from the node", source, op.Destination)
+		}
+		value, err := amount.ParseInt64(op.Amount)
+		if err != nil {
+			return err
+		}
+		if value > p.MaxPaymentAmount {
+			return fmt.Errorf("payment amount %s exceeds %s", op.Amount, amount.StringFromInt64(p.MaxPaymentAmount))
+		}
+		if source == node && op.Destination != node {
+			spending.Amount += value
+		}
+	case *txnbuild.CreateAccount:
+		if source == node {
+			if !p.AllowAccountCreation {
+				return fmt.Errorf("account creation isn't allowed")
+			}
+			spending.Accounts++
+		}
+		value, err := amount.ParseInt64(op.Amount)
+		if err != nil {
+			return err
+		}
+		if value > p.MaxStartingBalance {
+			return fmt.Errorf("starting balance %s exceeds %s", op.Amount, amount.StringFromInt64(p.MaxStartingBalance))
+		}
+	case *txnbuild.ChangeTrust:
+		if source == node {
+			return fmt.Errorf("trustline changes of the node aren't allowed")
+		}
+		if !isPPToken(op.Line) {
+			return fmt.Errorf("trustline of %s isn't allowed", op.Line.GetCode())
+		}
+	case *txnbuild.BumpSequence:
+		if !p.AllowSequenceBumps {
+			return fmt.Errorf("sequence bumps aren't allowed")
+		}
+		if source != node {
+			return fmt.Errorf("sequence bump of %s isn't allowed", source)
+		}
+	default:
+		return fmt.Errorf("%T isn't allowed", op)
+	}
+	return nil
+}
+
+// CheckFeeBump checks the fee paid by the node and the inner transaction. The spending of the inner
+// transaction was taken when the node signed it.
+func (p Policy) CheckFeeBump(node string, tx *txnbuild.FeeBumpTransaction) error {
+	if tx.BaseFee() > p.MaxBaseFee {
+		return fmt.Errorf("base fee %d exceeds %d", tx.BaseFee(), p.MaxBaseFee)
+	}
+	_, err := p.checkOperations(node, tx.InnerTransaction(), "inner operation")
+	return err
+}
+
+// CheckAuthorization allows the authorizations of the node for its requests to the co-signing endpoints
+func (p Policy) CheckAuthorization(node string, a *models.SignAuthorization) error {
+	if a.Address != node {
+		return fmt.Errorf("authorization address %s isn't the node address", a.Address)
+	}
+	return nil
+}
+
+// spendingLimits are the daily limits of the policy, shared by the requests
+type spendingLimits struct {
+	mutex    sync.Mutex
+	amount   *common.RollingLimit
+	accounts *common.RollingLimit
+}
+
+func newSpendingLimits(p Policy) *spendingLimits {
+	return &spendingLimits{
+		amount:   common.NewRollingLimit(p.MaxDailyAmount, limitPeriod),
+		accounts: common.NewRollingLimit(p.MaxDailyAccounts, limitPeriod),
+	}
+}
+
+// take takes the spending from both limits or from none
+func (l *spendingLimits) take(spending Spending, now time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if remaining := l.amount.Remaining(now); spending.Amount > remaining {
+		return fmt.Errorf("payments of the node %s exceed the %s remaining today",
+			amount.StringFromInt64(spending.Amount), amount.StringFromInt64(remaining))
+	}
+	if remaining := l.accounts.Remaining(now); spending.Accounts > remaining {
+		return fmt.Errorf("%d accounts exceed the %d the node can fund today", spending.Accounts, remaining)
+	}
+	err := l.amount.Take(spending.Amount, now)
+	if err != nil {
+		return err
+	}
+	return l.accounts.Take(spending.Accounts, now)
+}
+
+// CheckPaymentRequest allows the payment requests to the node
+func (p Policy) CheckPaymentRequest(node string, pr *models.PaymentRequest) error {
+	if pr.Address != node {
+		return fmt.Errorf("payment request address %s isn't the node address", pr.Address)
+	}
+	return nil
+}
+
+// CheckRevocation allows the revocations of the node
+func (p Policy) CheckRevocation(node string, r *models.Revocation) error {
+	if r.Address != node {
+		return fmt.Errorf("revocation address %s isn't the node address", r.Address)
+	}
+	return nil
+}
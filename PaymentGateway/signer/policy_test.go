@@ -0,0 +1,204 @@
+package signer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/models"
+)
+
+func pptoken() txnbuild.CreditAsset {
+	return txnbuild.CreditAsset{Code: models.PPTokenAssetName, Issuer: models.PPTokenIssuerAddress}
+}
+
+func transaction(t *testing.T, source string, baseFee int64, ops ...txnbuild.Operation) *txnbuild.Transaction {
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &txnbuild.SimpleAccount{AccountID: source, Sequence: 1},
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              baseFee,
+		Timebounds:           txnbuild.NewTimeout(60),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestPolicy(t *testing.T) {
+	policy := DefaultPolicy()
+	node := keypair.MustRandom().Address()
+	peer := keypair.MustRandom().Address()
+	payment := func(from string, to string, value string) *txnbuild.Payment {
+		return &txnbuild.Payment{Destination: to, Amount: value, Asset: pptoken(), SourceAccount: from}
+	}
+
+	allowed := []*txnbuild.Transaction{
+		// accumulated payment to the node
+		transaction(t, node, 100, payment(peer, node, "10")),
+		// side channel payment from the node
+		transaction(t, peer, 100, payment(node, peer, "10")),
+		transaction(t, peer, 100, &txnbuild.CreateAccount{Destination: keypair.MustRandom().Address(), Amount: "5"}),
+		transaction(t, peer, 100, &txnbuild.ChangeTrust{Line: pptoken(), Limit: txnbuild.MaxTrustlineLimit}),
+		transaction(t, node, 100, &txnbuild.BumpSequence{BumpTo: 10}),
+	}
+	for i, tx := range allowed {
+		_, err := policy.CheckTransaction(node, tx)
+		assert.NoError(t, err, "transaction %d", i)
+	}
+
+	refused := []*txnbuild.Transaction{
+		transaction(t, node, 100, payment(peer, keypair.MustRandom().Address(), "10")),
+		transaction(t, node, 100, payment(node, peer, "1000.0000001")),
+		transaction(t, node, 100, &txnbuild.Payment{Destination: peer, Amount: "1", Asset: txnbuild.NativeAsset{}}),
+		transaction(t, node, 100, payment(node, peer, "600"), payment(node, peer, "600")),
+		transaction(t, node, 100, &txnbuild.CreateAccount{Destination: peer, Amount: "5"}),
+		transaction(t, peer, 100, &txnbuild.CreateAccount{Destination: node, Amount: "100"}),
+		transaction(t, node, 100, &txnbuild.ChangeTrust{Line: pptoken(), Limit: "0"}),
+		transaction(t, node, 100, &txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: peer, Weight: 10}}),
+		transaction(t, node, 100, &txnbuild.AccountMerge{Destination: peer}),
+		transaction(t, peer, 100, &txnbuild.BumpSequence{BumpTo: 10}),
+		transaction(t, node, policy.MaxBaseFee+1, payment(peer, node, "10")),
+	}
+	for i, tx := range refused {
+		_, err := policy.CheckTransaction(node, tx)
+		assert.Error(t, err, "transaction %d", i)
+	}
+
+	policy.AllowSequenceBumps = false
+	_, err := policy.CheckTransaction(node, transaction(t, node, 100, &txnbuild.BumpSequence{BumpTo: 10}))
+	assert.Error(t, err)
+
+	// The accounts funded by the node are allowed by the flag and counted with the payments of the node
+	policy.AllowAccountCreation = true
+	spending, err := policy.CheckTransaction(node, transaction(t, node, 100,
+		&txnbuild.CreateAccount{Destination: peer, Amount: "5"},
+		&txnbuild.ChangeTrust{Line: pptoken(), Limit: txnbuild.MaxTrustlineLimit, SourceAccount: peer},
+		payment(node, peer, "10"), payment(peer, node, "20")))
+	assert.NoError(t, err)
+	assert.Equal(t, Spending{Amount: 10e7, Accounts: 1}, spending)
+}
+
+func TestSpendingLimits(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.MaxDailyAmount = 100e7
+	policy.MaxDailyAccounts = 1
+	limits := newSpendingLimits(policy)
+	now := time.Now()
+
+	assert.NoError(t, limits.take(Spending{Amount: 60e7, Accounts: 1}, now))
+	assert.Error(t, limits.take(Spending{Amount: 60e7}, now))
+	// Neither limit is taken from when one of them is reached
+	assert.Error(t, limits.take(Spending{Amount: 10e7, Accounts: 1}, now))
+	assert.NoError(t, limits.take(Spending{Amount: 40e7}, now))
+	assert.Error(t, limits.take(Spending{Amount: 1}, now))
+
+	assert.NoError(t, limits.take(Spending{Amount: 100e7, Accounts: 1}, now.Add(limitPeriod)))
+}
+
+func TestServerSign(t *testing.T) {
+	kp := keypair.MustRandom()
+	server := NewServer(kp, network.TestNetworkPassphrase, DefaultPolicy())
+	peer := keypair.MustRandom().Address()
+
+	response := server.Sign(&models.SignRequest{Kind: models.SignRequestAddress})
+	assert.Equal(t, kp.Address(), response.Address)
+
+	envelope, err := transaction(t, kp.Address(), 100, &txnbuild.Payment{
+		Destination: kp.Address(), Amount: "10", Asset: pptoken(), SourceAccount: peer,
+	}).Base64()
+	assert.NoError(t, err)
+	response = server.Sign(&models.SignRequest{
+		Kind:              models.SignRequestTransaction,
+		NetworkPassphrase: network.TestNetworkPassphrase,
+		Transaction:       envelope,
+	})
+	assert.Empty(t, response.Error)
+	assert.NotEmpty(t, response.Signature)
+
+	// The payments of the node are taken from its daily limit
+	server.limits = newSpendingLimits(Policy{MaxDailyAmount: 15e7})
+	outgoing := func() *models.SignResponse {
+		envelope, err := transaction(t, kp.Address(), 100, &txnbuild.Payment{
+			Destination: peer, Amount: "10", Asset: pptoken(),
+		}).Base64()
+		assert.NoError(t, err)
+		return server.Sign(&models.SignRequest{
+			Kind:              models.SignRequestTransaction,
+			NetworkPassphrase: network.TestNetworkPassphrase,
+			Transaction:       envelope,
+		})
+	}
+	assert.Empty(t, outgoing().Error)
+	assert.NotEmpty(t, outgoing().Error)
+
+	// The hash is computed for the network of the signer
+	response = server.Sign(&models.SignRequest{
+		Kind:              models.SignRequestTransaction,
+		NetworkPassphrase: network.PublicNetworkPassphrase,
+		Transaction:       envelope,
+	})
+	assert.NotEmpty(t, response.Error)
+	assert.Empty(t, response.Signature)
+
+	response = server.Sign(&models.SignRequest{
+		Kind:           models.SignRequestPaymentRequest,
+		PaymentRequest: &models.PaymentRequest{Address: peer},
+	})
+	assert.NotEmpty(t, response.Error)
+
+	// A co-signer signs for the node account with its own key, not the payment requests
+	node := keypair.MustRandom().Address()
+	server.SetAccount(node)
+	response = server.Sign(&models.SignRequest{
+		Kind:           models.SignRequestPaymentRequest,
+		PaymentRequest: &models.PaymentRequest{Address: node},
+	})
+	assert.NotEmpty(t, response.Error)
+	response = server.Sign(&models.SignRequest{
+		Kind:          models.SignRequestAuthorization,
+		Authorization: &models.SignAuthorization{Address: node},
+	})
+	assert.NotEmpty(t, response.Error)
+	response = server.Sign(&models.SignRequest{Kind: models.SignRequestAddress})
+	assert.Equal(t, kp.Address(), response.Address)
+}
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "private", "signer.sock")
+	listener, err := Listen(socket)
+	assert.NoError(t, err)
+	info, err := os.Stat(socket)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	info, err = os.Stat(filepath.Dir(socket))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	listener.Close()
+
+	// A stale socket is replaced, not a regular file
+	listener, err = Listen(socket)
+	assert.NoError(t, err)
+	listener.Close()
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, ioutil.WriteFile(file, nil, 0600))
+	_, err = Listen(file)
+	assert.Error(t, err)
+
+	shared := filepath.Join(dir, "shared")
+	assert.NoError(t, os.Mkdir(shared, 0700))
+	assert.NoError(t, os.Chmod(shared, 0777))
+	_, err = Listen(filepath.Join(shared, "signer.sock"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,297 @@
+package signer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"paidpiper.com/payment-gateway/models"
+)
+
+// A client has requestTimeout to send its request and read the response
+const requestTimeout = 10 * time.Second
+
+// maxRequestSize limits the body of the http requests
+const maxRequestSize = 1 << 20
+
+// The authorization of an http request is accepted within authorizationWindow of its timestamp,
+// its nonce is remembered until then
+const authorizationWindow = time.Minute
+
+// Server signs with the node key what the policy allows, for the gateway processes connected to its unix socket.
+// A co-signer of a multisig node account signs for the account with its own key, over the unix socket or http.
+type Server struct {
+	keyPair           *keypair.Full
+	account           string
+	networkPassphrase string
+	policy            Policy
+	limits            *spendingLimits
+	nonces            *usedNonces
+}
+
+// usedNonces are the nonces of the authorizations accepted within the window, a request isn't replayed
+type usedNonces struct {
+	mutex sync.Mutex
+	used  map[string]time.Time // expiry by nonce
+}
+
+func (n *usedNonces) use(nonce string, now time.Time) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for used, expiry := range n.used {
+		if now.After(expiry) {
+			delete(n.used, used)
+		}
+	}
+	if _, ok := n.used[nonce]; ok {
+		return fmt.Errorf("authorization nonce %s was used", nonce)
+	}
+	n.used[nonce] = now.Add(2 * authorizationWindow)
+	return nil
+}
+
+func NewServer(keyPair *keypair.Full, networkPassphrase string, policy Policy) *Server {
+	return &Server{
+		keyPair:           keyPair,
+		account:           keyPair.Address(),
+		networkPassphrase: networkPassphrase,
+		policy:            policy,
+		limits:            newSpendingLimits(policy),
+		nonces:            &usedNonces{used: map[string]time.Time{}},
+	}
+}
+
+// SetAccount sets the node account the key co-signs for, the policy applies to the account
+func (s *Server) SetAccount(account string) {
+	s.account = account
+}
+
+// Listen creates the unix socket accessible only by the user running the daemon. The directory of the socket is
+// created private if missing and mustn't be writable by other users, a stale socket is removed but no other file.
+func Listen(socket string) (net.Listener, error) {
+	dir := filepath.Dir(socket)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return nil, fmt.Errorf("directory %s of the socket is writable by other users", dir)
+	}
+	info, err = os.Lstat(socket)
+	switch {
+	case err == nil && info.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("%s exists and isn't a socket", socket)
+	case err == nil:
+		err = os.Remove(socket)
+		if err != nil {
+			return nil, err
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	// The socket is created with the permissions of the user only, it isn't accessible before the chmod
+	mask := umask(0077)
+	listener, err := net.Listen("unix", socket)
+	umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(socket, 0600)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Serve handles the connections until the listener is closed
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	err := conn.SetDeadline(time.Now().Add(requestTimeout))
+	if err != nil {
+		return
+	}
+	request := &models.SignRequest{}
+	response := &models.SignResponse{}
+	err = json.NewDecoder(conn).Decode(request)
+	if err != nil {
+		response.Error = fmt.Sprintf("invalid request: %v", err)
+	} else {
+		response = s.Sign(request)
+	}
+	if response.Error != "" {
+		log.Printf("Refused %s request: %s", request.Kind, response.Error)
+	}
+	err = json.NewEncoder(conn).Encode(response)
+	if err != nil {
+		log.Printf("Error sending response: %v", err)
+	}
+}
+
+// ServeHTTP is the co-signing endpoint, the request is posted as json with the authorization of the node key
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	authorized := &models.AuthorizedSignRequest{}
+	request := &models.SignRequest{}
+	response := &models.SignResponse{}
+	status := http.StatusOK
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(authorized)
+	if err == nil {
+		err = json.Unmarshal(authorized.Request, request)
+	}
+	if err != nil {
+		response.Error = fmt.Sprintf("invalid request: %v", err)
+		status = http.StatusBadRequest
+	} else if err = s.authorize(authorized); err != nil {
+		response.Error = fmt.Sprintf("unauthorized request: %v", err)
+		status = http.StatusUnauthorized
+	} else {
+		response = s.Sign(request)
+		if response.Error != "" {
+			status = http.StatusForbidden
+		}
+	}
+	if response.Error != "" {
+		log.Printf("Refused %s request from %s: %s", request.Kind, r.RemoteAddr, response.Error)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Printf("Error sending response: %v", err)
+	}
+}
+
+// authorize accepts the requests signed by the key of the node account within the window, once
+func (s *Server) authorize(request *models.AuthorizedSignRequest) error {
+	if request.Authorization == nil {
+		return fmt.Errorf("authorization missing")
+	}
+	now := time.Now()
+	err := request.Authorization.Verify(s.account, request.Request, now, authorizationWindow)
+	if err != nil {
+		return err
+	}
+	return s.nonces.use(request.Authorization.Nonce, now)
+}
+
+// Sign returns the signature of the node key if the policy allows the request
+func (s *Server) Sign(request *models.SignRequest) *models.SignResponse {
+	var payload []byte
+	var err error
+	switch request.Kind {
+	case models.SignRequestAddress:
+		return &models.SignResponse{Address: s.keyPair.Address()}
+	case models.SignRequestTransaction:
+		payload, err = s.transactionHash(request)
+	case models.SignRequestPaymentRequest:
+		if request.PaymentRequest == nil {
+			err = fmt.Errorf("payment request missing")
+			break
+		}
+		if s.account != s.keyPair.Address() {
+			err = fmt.Errorf("payment requests are signed by the node key")
+			break
+		}
+		err = s.policy.CheckPaymentRequest(s.account, request.PaymentRequest)
+		payload = request.PaymentRequest.SigningPayload()
+	case models.SignRequestRevocation:
+		if request.Revocation == nil {
+			err = fmt.Errorf("revocation missing")
+			break
+		}
+		if s.account != s.keyPair.Address() {
+			err = fmt.Errorf("revocations are signed by the node key")
+			break
+		}
+		err = s.policy.CheckRevocation(s.account, request.Revocation)
+		payload = request.Revocation.SigningPayload()
+	case models.SignRequestAuthorization:
+		if request.Authorization == nil {
+			err = fmt.Errorf("authorization missing")
+			break
+		}
+		if s.account != s.keyPair.Address() {
+			err = fmt.Errorf("authorizations are signed by the node key")
+			break
+		}
+		err = s.policy.CheckAuthorization(s.account, request.Authorization)
+		payload = request.Authorization.SigningPayload()
+	default:
+		err = fmt.Errorf("unknown request kind %q", request.Kind)
+	}
+	if err != nil {
+		return &models.SignResponse{Error: err.Error()}
+	}
+	signature, err := s.keyPair.Sign(payload)
+	if err != nil {
+		return &models.SignResponse{Error: err.Error()}
+	}
+	return &models.SignResponse{
+		Address:   s.keyPair.Address(),
+		Signature: base64.StdEncoding.EncodeToString(signature),
+	}
+}
+
+// transactionHash checks the transaction against the policy and takes its spending from the daily limits, the hash is computed for the network of the daemon
+func (s *Server) transactionHash(request *models.SignRequest) ([]byte, error) {
+	if request.NetworkPassphrase != s.networkPassphrase {
+		return nil, fmt.Errorf("network passphrase %q isn't the network of the signer", request.NetworkPassphrase)
+	}
+	generic, err := txnbuild.TransactionFromXDR(request.Transaction)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	node := s.account
+	if feeBump, ok := generic.FeeBump(); ok {
+		if feeBump.FeeAccount() != node {
+			return nil, fmt.Errorf("fee account %s isn't the node", feeBump.FeeAccount())
+		}
+		err = s.policy.CheckFeeBump(node, feeBump)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := feeBump.Hash(s.networkPassphrase)
+		return hash[:], err
+	}
+	tx, _ := generic.Transaction()
+	spending, err := s.policy.CheckTransaction(node, tx)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := tx.Hash(s.networkPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	err = s.limits.take(spending, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return hash[:], nil
+}
@@ -0,0 +1,9 @@
+// +build !windows
+
+package signer
+
+import "syscall"
+
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
@@ -0,0 +1,6 @@
+package signer
+
+// umask isn't supported, the socket is restricted by the chmod after it is created
+func umask(mask int) int {
+	return 0
+}
@@ -20,6 +20,7 @@ type TestSetup struct {
 	nodes            map[string]local.LocalPPNode
 	torMock          *TorMock
 	torAddressPrefix string
+	useMemoryLedger  bool
 }
 
 const validityPeriod int64 = 1
@@ -34,16 +35,24 @@ func (setup *TestSetup) startNode(seed string, lushPeriod time.Duration, transac
 	// TODO: eliminate cycle references
 
 	cfg := config.DefaultCfg()
-	cfg.RootApiConfig.Seed = seed
+	cfg.RootApiConfig.CleartextSeed = seed
+	cfg.RootApiConfig.AllowCleartextSeed = true
+	cfg.RootApiConfig.UseMemoryLedger = setup.useMemoryLedger
 
 	node, err := local.FromConfigWithClientFactory(cfg, setup.ClientFactory)
 	if err != nil {
 		log.Fatal("Coudn't start node")
 		return nil, err
 	}
+	setup.nodes[seed] = node
 	return node, nil
 }
 
+// UseMemoryLedger makes nodes started afterwards run against the in-memory ledger instead of horizon.
+func (setup *TestSetup) UseMemoryLedger() {
+	setup.useMemoryLedger = true
+}
+
 func (setup *TestSetup) ClientFactory(url string, sessionId string, nodeId string) (proxy.CommandClient, proxy.CommandResponseHandler) {
 	return setup.torMock.GetNodeByAddress(nodeId), nil
 }
@@ -163,10 +172,13 @@ func (setup *TestSetup) FlushTransactions(context context.Context) error {
 
 	for k, v := range setup.torMock.GetNodes() {
 		log.Printf("Flushing node %s.\n ", k)
-		err := v.FlushTransactions(ctx)
+		report, err := v.FlushTransactions(ctx)
 		if err != nil {
 			return err
 		}
+		if len(report.Failed) > 0 {
+			return fmt.Errorf("node %s failed to submit %d transactions: %s", k, len(report.Failed), report.Failed[0].Error)
+		}
 		span.SetStatus(codes.OK, "FlushTransaction completed successfully")
 	}
 
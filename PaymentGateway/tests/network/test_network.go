@@ -57,9 +57,21 @@ func (net *testNetwork) createNodeWith(seed string) (local.LocalPPNode, error) {
 }
 
 func (net *testNetwork) GetRoute(ctx context.Context, sessionId string) (*models.RouteResponse, error) {
+	return net.GetRouteExcluding(ctx, sessionId, nil)
+}
+
+// GetRouteExcluding leaves the excluded nodes out of the chain
+func (net *testNetwork) GetRouteExcluding(ctx context.Context, sessionId string, excludeNodeIds []string) (*models.RouteResponse, error) {
+	excluded := map[string]bool{}
+	for _, id := range excludeNodeIds {
+		excluded[id] = true
+	}
 	route := []models.RoutingNode{}
 	for _, seed := range net.chainSeeds {
 		nodeId := net.seedNodeIds[seed]
+		if excluded[nodeId] {
+			continue
+		}
 		route = append(route, models.RoutingNode{
 			NodeId:  nodeId,
 			Address: net.nodesByNodeID[nodeId].GetAddress(),
@@ -0,0 +1,90 @@
+package offline
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/root"
+	"paidpiper.com/payment-gateway/root/ledger"
+)
+
+func TestChannelAccountsSubmitConcurrently(t *testing.T) {
+	assert := assert.New(t)
+	factory := root.CreateRootApiFactoryWithClient(ledger.Default(), ledger.NetworkPassphrase)
+	seed := keypair.MustRandom().Seed()
+	api, err := factory(seed, 600)
+	assert.NoError(err)
+	assert.NoError(api.SetUpChannels(nil, 3))
+	channels := api.GetChannels()
+	assert.Len(channels, 3)
+
+	peer := keypair.MustRandom()
+	_, err = ledger.Default().Fund(peer.Address())
+	assert.NoError(err)
+	sequence, err := api.GetSequenceNumber()
+	assert.NoError(err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 9)
+	for i := 0; i < 9; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- api.SubmitNodeOperations(&txnbuild.Payment{
+				Destination:   peer.Address(),
+				Amount:        "1",
+				Asset:         ledger.PPTokenAsset(),
+				SourceAccount: api.GetAddress(),
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(err)
+	}
+	balance, _ := ledger.Default().Balance(peer.Address(), ledger.PPTokenAsset())
+	assert.Equal(int64(1009e7), balance)
+	// The node sequence is left for the accumulated transactions
+	current, err := api.GetSequenceNumber()
+	assert.NoError(err)
+	assert.Equal(sequence, current)
+
+	// The operations have to be sourced by the node
+	assert.Error(api.SubmitNodeOperations(&txnbuild.BumpSequence{BumpTo: 1}))
+
+	// The derived channels are the same after a restart
+	restarted, err := factory(seed, 600)
+	assert.NoError(err)
+	assert.NoError(restarted.SetUpChannels(nil, 3))
+	assert.Equal(channels, restarted.GetChannels())
+	bump, err := restarted.BumpSequenceIfNeed(&models.PaymentTransactionWithSequence{Sequence: int64(current) + 11})
+	assert.NoError(err)
+	assert.Equal(&models.SequenceBump{From: int64(current), To: int64(current) + 10}, bump)
+	bumped, err := restarted.GetSequenceNumber()
+	assert.NoError(err)
+	assert.Equal(current+10, bumped)
+}
+
+func TestChannelKeyPairs(t *testing.T) {
+	assert := assert.New(t)
+	factory := root.CreateRootApiFactoryWithClient(ledger.Default(), ledger.NetworkPassphrase)
+	seed := keypair.MustRandom().Seed()
+	api, err := factory(seed, 600)
+	assert.NoError(err)
+
+	// The node account isn't a channel
+	assert.Error(api.SetUpChannels([]*keypair.Full{keypair.MustParseFull(seed)}, 0))
+
+	channel := keypair.MustRandom()
+	assert.NoError(api.SetUpChannels([]*keypair.Full{channel}, 1))
+	channels := api.GetChannels()
+	assert.Len(channels, 2)
+	assert.Equal(channel.Address(), channels[0])
+	_, err = ledger.Default().Balance(channel.Address(), txnbuild.NativeAsset{})
+	assert.NoError(err)
+}
@@ -0,0 +1,115 @@
+package offline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
+	"paidpiper.com/payment-gateway/tests"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func TestDuplicateCommand(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	node := testSetup.GetNode(Node2Seed)
+
+	command := func(totalIn uint32) *models.UtilityCommand {
+		return &models.UtilityCommand{
+			CommandCore: models.CommandCore{
+				SessionId:   "duplicate-command-session",
+				CommandId:   "duplicate-command",
+				CommandType: models.CommandType_CreateTransaction,
+			},
+			CommandBody: &models.CreateTransactionCommand{
+				TotalIn:          totalIn,
+				TotalOut:         100,
+				SourceAddress:    seed2addr(Node1Seed),
+				ServiceSessionId: "duplicate-command-session",
+			},
+		}
+	}
+	first, err := node.CommandHandler(ctx, command(110))
+	assert.NoError(err)
+	second, err := node.CommandHandler(ctx, command(110))
+	assert.NoError(err)
+	assert.Equal(first.(*models.CreateTransactionResponse).Transaction.PendingTransaction.XDR,
+		second.(*models.CreateTransactionResponse).Transaction.PendingTransaction.XDR)
+
+	_, err = node.CommandHandler(ctx, command(120))
+	assert.Error(err)
+}
+
+func TestCommandReplayedWithAnotherTraceContext(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	hop := testSetup.GetNode(Node3Seed)
+
+	sequencer := tests.CreateSequencer(testSetup, assert, ctx)
+	_, pr, err := sequencer.PerformPayment(User1Seed, Service1Seed, 100e6)
+	assert.NoError(err)
+	committed := hop.GetTransaction(pr.ServiceSessionId)
+	assert.NotNil(committed)
+
+	// A resumed payment sends the command again from another trace
+	command := func(traceId string) *models.UtilityCommand {
+		return &models.UtilityCommand{
+			CommandCore: models.CommandCore{
+				SessionId:   pr.ServiceSessionId,
+				CommandId:   "replayed-command",
+				CommandType: models.CommandType_RevokeTransaction,
+			},
+			CommandBody: &models.RevokeTransactionCommand{
+				Transaction: &models.PaymentTransactionReplacing{PendingTransaction: *committed},
+				Revocation:  signRevocation(Service1Seed, pr.ServiceSessionId),
+				Context:     &models.TraceContext{TraceID: traceId},
+			},
+		}
+	}
+	first, err := hop.CommandHandler(ctx, command("first"))
+	assert.NoError(err)
+	second, err := hop.CommandHandler(ctx, command("second"))
+	assert.NoError(err)
+	assert.Equal(first.(*models.RevokeTransactionResponse).Revocation.Signature,
+		second.(*models.RevokeTransactionResponse).Revocation.Signature)
+
+	assert.NoError(testSetup.FlushTransactions(ctx))
+}
+
+func TestCommandJournalPrune(t *testing.T) {
+	assert := assert.New(t)
+	db, err := database.NewLiteDB()
+	assert.NoError(err)
+	journal := paymentregestry.NewCommandJournal(db, seed2addr(Node1Seed))
+
+	executions := 0
+	process := func() {
+		_, err := journal.Process(&models.UtilityCommand{
+			CommandCore: models.CommandCore{
+				SessionId:   "prune-session",
+				CommandId:   "prune-command",
+				CommandType: models.CommandType_QuoteFee,
+			},
+			CommandBody: &models.QuoteFeeCommand{ServiceSessionId: "prune-session", Amount: 100},
+		}, func() (models.OutCommandType, error) {
+			executions++
+			return &models.QuoteFeeResponse{Fee: 10}, nil
+		})
+		assert.NoError(err)
+	}
+	process()
+	process()
+	assert.Equal(1, executions)
+
+	// The reply is kept within the retention only
+	assert.NoError(journal.Prune(time.Now()))
+	process()
+	assert.Equal(1, executions)
+	assert.NoError(journal.Prune(time.Now().Add(48 * time.Hour)))
+	process()
+	assert.Equal(2, executions)
+}
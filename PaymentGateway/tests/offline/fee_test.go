@@ -0,0 +1,91 @@
+package offline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/client"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/regestry"
+	"paidpiper.com/payment-gateway/root"
+	"paidpiper.com/payment-gateway/root/ledger"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func TestFeeQuote(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	relay := testSetup.GetNode(Node1Seed)
+	service := testSetup.GetNode(Service1Seed)
+
+	pr, err := testSetup.NewPaymentRequest(ctx, Service1Seed, 100)
+	assert.NoError(err)
+
+	quote, err := relay.QuoteFee(ctx, &models.QuoteFeeCommand{
+		ServiceSessionId: pr.ServiceSessionId,
+		Amount:           pr.Amount,
+		Asset:            pr.Asset,
+	})
+	assert.NoError(err)
+	fee, err := relay.GetFeePolicy().Policy(pr.Asset).Fee(pr.Amount)
+	assert.NoError(err)
+	assert.Equal(fee, quote.Fee)
+	assert.NotZero(quote.Fee)
+
+	// The destination doesn't charge its own session
+	quote, err = service.QuoteFee(ctx, &models.QuoteFeeCommand{
+		ServiceSessionId: pr.ServiceSessionId,
+		Amount:           pr.Amount,
+		Asset:            pr.Asset,
+	})
+	assert.NoError(err)
+	assert.Zero(quote.Fee)
+}
+
+func TestCreateTransactionValidatesFee(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	relay := testSetup.GetNode(Node1Seed)
+
+	create := func(totalIn uint32) error {
+		_, err := relay.CreateTransaction(ctx, &models.CreateTransactionCommand{
+			TotalIn:          totalIn,
+			TotalOut:         100,
+			SourceAddress:    seed2addr(User1Seed),
+			ServiceSessionId: "fee-validation-session",
+		})
+		return err
+	}
+	fee, err := relay.GetFeePolicy().Default.Fee(100)
+	assert.NoError(err)
+	assert.Error(create(100 + fee + 1))
+	assert.Error(create(100 + fee - 1))
+	assert.Error(create(99))
+	assert.NoError(create(100 + fee))
+}
+
+func TestPaymentFeesWithinMaximum(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestPaymentFeesWithinMaximum")
+	defer span.End()
+
+	pr, err := testSetup.NewPaymentRequest(ctx, Service1Seed, 100e6)
+	assert.NoError(err)
+	api, err := root.CreateRootApiFactoryWithClient(ledger.Default(), ledger.NetworkPassphrase)(User1Seed, 600)
+	assert.NoError(err)
+	nodes := regestry.NewNodeManager()
+	assert.NoError(nodes.AddSourceNode(seed2addr(User1Seed), testSetup.GetNode(User1Seed)))
+	for _, seed := range []string{Node1Seed, Node2Seed, Node3Seed} {
+		assert.NoError(nodes.AddChainNode(seed2addr(seed), testSetup.GetNode(seed)))
+	}
+	assert.NoError(nodes.AddDestinationNode(pr.Address, testSetup.GetNode(Service1Seed)))
+
+	// The hops are asked for their fees before any transaction is created
+	fee, err := testSetup.GetNode(Node3Seed).GetFeePolicy().Default.Fee(pr.Amount)
+	assert.NoError(err)
+	_, err = client.New(api).CreateTransactions(ctx, nodes, pr, 2*fee)
+	assert.Error(err)
+	failed, ok := models.FailedHopAddress(err)
+	assert.True(ok)
+	assert.Equal(seed2addr(Node1Seed), failed)
+}
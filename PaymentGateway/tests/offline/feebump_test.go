@@ -0,0 +1,31 @@
+package offline
+
+import (
+	"testing"
+
+	"paidpiper.com/payment-gateway/root/ledger"
+	"paidpiper.com/payment-gateway/tests"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func TestFlushFeeBumpsUnderpricedTransactions(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestFlushFeeBumpsUnderpricedTransactions")
+	defer span.End()
+
+	service := testSetup.GetNode(Service1Seed)
+	sequencer := tests.CreateSequencer(testSetup, assert, ctx)
+	_, pr, err := sequencer.PerformPayment(User1Seed, Service1Seed, 100e6)
+	assert.NoError(err)
+
+	// Surge after the transactions were signed
+	baseFee := ledger.Default().BaseFee()
+	ledger.Default().SetBaseFee(baseFee * 10)
+	defer ledger.Default().SetBaseFee(baseFee)
+
+	report, err := service.FlushTransactions(ctx)
+	assert.NoError(err)
+	assert.Empty(report.Failed)
+	assert.Len(report.Submitted, 1)
+	assert.Equal(pr.ServiceSessionId, report.Submitted[0].ServiceSessionId)
+	assert.Equal(baseFee*10, report.Submitted[0].FeeBump)
+}
@@ -0,0 +1,53 @@
+package offline
+
+import (
+	"testing"
+
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/tests"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func TestFlushReportHistory(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestFlushReportHistory")
+	defer span.End()
+
+	service := testSetup.GetNode(Service1Seed)
+	sequencer := tests.CreateSequencer(testSetup, assert, ctx)
+	_, pr, err := sequencer.PerformPayment(User1Seed, Service1Seed, 100e6)
+	assert.NoError(err)
+
+	report, err := service.FlushTransactions(ctx)
+	assert.NoError(err)
+	assert.Equal(models.FlushTriggerRequest, report.Trigger)
+	assert.Equal(service.GetAddress(), report.NodeAddress)
+	assert.Len(report.Submitted, 1)
+	assert.Equal(pr.ServiceSessionId, report.Submitted[0].ServiceSessionId)
+	assert.Equal(pr.Amount, report.Submitted[0].Amount)
+	assert.Empty(report.Failed)
+	assert.Empty(report.Remaining)
+	assert.NotZero(report.Id)
+
+	history, err := service.GetFlushHistory(1)
+	assert.NoError(err)
+	assert.Len(history, 1)
+	assert.Equal(report.Id, history[0].Id)
+	assert.Equal(report.Submitted, history[0].Submitted)
+
+	stored, err := service.GetFlushReport(report.Id)
+	assert.NoError(err)
+	assert.Equal(report.Submitted, stored.Submitted)
+	missing, err := service.GetFlushReport(-1)
+	assert.NoError(err)
+	assert.Nil(missing)
+
+	// A flush without transactions isn't kept
+	empty, err := service.FlushTransactions(ctx)
+	assert.NoError(err)
+	assert.True(empty.Empty())
+	history, err = service.GetFlushHistory(1)
+	assert.NoError(err)
+	assert.Equal(report.Id, history[0].Id)
+
+	assert.NoError(testSetup.FlushTransactions(ctx))
+}
@@ -0,0 +1,198 @@
+package offline
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"paidpiper.com/payment-gateway/config"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local"
+	"paidpiper.com/payment-gateway/ppsidechannel"
+	"paidpiper.com/payment-gateway/root/ledger"
+	"paidpiper.com/payment-gateway/serviceNode"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func grpcConnection(t *testing.T, seed string, port int) *grpc.ClientConn {
+	server, err := serviceNode.GrpcLocalNode(testSetup.GetNode(seed), "127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial(fmt.Sprintf("localhost:%d", port), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func signXdr(t *testing.T, xdr string, kp *keypair.Full) string {
+	generic, err := txnbuild.TransactionFromXDR(xdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, ok := generic.Transaction()
+	if !ok {
+		t.Fatal("not a transaction")
+	}
+	tx, err = tx.Sign(ledger.NetworkPassphrase, kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := tx.Base64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestGrpcSideChannel(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	client := ppsidechannel.NewPPSideChannelClient(grpcConnection(t, Service1Seed, 57901))
+
+	peer := keypair.MustRandom()
+	setUpPeer := func() (*ppsidechannel.SetUpPeerResponse, error) {
+		request := &models.SetUpPeerRequest{}
+		assert.NoError(request.Sign(peer, time.Now()))
+		return client.SetUpPeer(ctx, &ppsidechannel.SetUpPeerRequest{
+			StellarAddress: request.Address,
+			Timestamp:      request.Timestamp,
+			Signature:      request.Signature,
+		})
+	}
+
+	// The peer has to show the key of the account
+	_, err := client.SetUpPeer(ctx, &ppsidechannel.SetUpPeerRequest{StellarAddress: peer.Address(), Timestamp: time.Now().Unix()})
+	assert.Error(err)
+
+	// The node creates the account, the peer signs and pays for its trustline
+	setup, err := setUpPeer()
+	assert.NoError(err)
+	assert.Equal(ppsidechannel.SetUpPeerResponse_PeerAccountFundingRequired, setup.GetStatus())
+	xlm, err := ledger.Default().Balance(peer.Address(), txnbuild.NativeAsset{})
+	assert.NoError(err)
+	assert.Equal(int64(5e7), xlm)
+
+	// Only the transactions issued by the node are submitted
+	user, _ := keypair.ParseFull(User1Seed)
+	_, err = client.CreateOrFund(ctx, &ppsidechannel.CreateOrFundRequest{
+		TransactionXdr: signXdr(t, setup.GetTransactionXdr(), user),
+	})
+	assert.Error(err)
+	setup, err = setUpPeer()
+	assert.NoError(err)
+
+	funded, err := client.CreateOrFund(ctx, &ppsidechannel.CreateOrFundRequest{
+		TransactionXdr: signXdr(t, setup.GetTransactionXdr(), peer),
+	})
+	assert.NoError(err)
+	assert.True(funded.GetSuccess())
+
+	setup, err = setUpPeer()
+	assert.NoError(err)
+	assert.Equal(ppsidechannel.SetUpPeerResponse_PeerAlreadyExists, setup.GetStatus())
+
+	// The user pays the peer through the service node
+	userPre, _ := ledger.Default().Balance(user.Address(), ledger.PPTokenAsset())
+
+	payment, err := client.InitiatePayment(ctx, &ppsidechannel.InitiatePaymentRequest{
+		FromStellarAddress: user.Address(),
+		Amount:             1.5,
+		Asset:              "pptoken",
+		Destination:        &ppsidechannel.InitiatePaymentRequest_ToStellarAddress{ToStellarAddress: peer.Address()},
+	})
+	assert.NoError(err)
+
+	commit, err := client.PaymentCommit(ctx, &ppsidechannel.PaymentCommitRequest{
+		SignedReimbursementTransactionXdr: signXdr(t, payment.GetGwReimbursementTransactionXdr(), user),
+	})
+	assert.NoError(err)
+
+	_, err = ledger.Default().SubmitTransactionXDR(signXdr(t, commit.GetSignedDestinationTransactionXdr(), peer))
+	assert.NoError(err)
+
+	peerBalance, _ := ledger.Default().Balance(peer.Address(), ledger.PPTokenAsset())
+	userPost, _ := ledger.Default().Balance(user.Address(), ledger.PPTokenAsset())
+	assert.Equal(int64(15e6), peerBalance)
+	// The gateway is reimbursed with its relay fee, a transaction unit is 1e4 stroops
+	fee, err := testSetup.GetNode(Service1Seed).GetFeePolicy().Policy(models.PPTokenAssetName).Fee(1500)
+	assert.NoError(err)
+	assert.Equal(userPre-int64(15e6)-int64(fee)*1e4, userPost)
+
+	// A reimbursement is accepted only once
+	_, err = client.PaymentCommit(ctx, &ppsidechannel.PaymentCommitRequest{
+		SignedReimbursementTransactionXdr: signXdr(t, payment.GetGwReimbursementTransactionXdr(), user),
+	})
+	assert.Error(err)
+}
+
+func TestGrpcProcessPayment(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	client := ppsidechannel.NewPPPaymentGatewayClient(grpcConnection(t, User1Seed, 57902))
+
+	pr, err := testSetup.NewPaymentRequest(ctx, Service1Seed, 100e6)
+	assert.NoError(err)
+
+	_, err = client.ProcessPayment(ctx, &ppsidechannel.PaymentRequest{
+		RouteAddresses:    []string{seed2addr(Node1Seed), seed2addr(Node2Seed), seed2addr(Node3Seed)},
+		ServiceSessionId:  pr.ServiceSessionId,
+		ServiceRef:        pr.ServiceRef,
+		Address:           pr.Address,
+		TransactionAmount: pr.Amount,
+		Asset:             pr.Asset,
+		IssuedAt:          pr.IssuedAt,
+		ExpiresAt:         pr.ExpiresAt,
+		Nonce:             pr.Nonce,
+		Signature:         pr.Signature,
+	})
+	assert.NoError(err)
+
+	unflushed, err := testSetup.GetNode(Service1Seed).GetUnflushedTransactions()
+	assert.NoError(err)
+	assert.Equal(1, unflushed.Count)
+
+	assert.NoError(testSetup.FlushTransactions(ctx))
+}
+
+func TestGrpcCommandClient(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	grpcConnection(t, Node1Seed, 57903)
+
+	nodeAddress := seed2addr(Node1Seed)
+	client, _ := local.GrpcClientFactory("localhost:57903", config.DefaultCfg().CommandConfig)("", "grpc-command-session", nodeAddress)
+
+	response, err := client.CreateTransaction(ctx, &models.CreateTransactionCommand{
+		TotalIn:          110,
+		TotalOut:         100,
+		SourceAddress:    seed2addr(User1Seed),
+		ServiceSessionId: "grpc-command-session",
+	})
+	assert.NoError(err)
+	assert.NotEmpty(response.Transaction.PendingTransaction.XDR)
+
+	// Failures are replied on the stream, which remains usable
+	err = client.CommitChainTransaction(ctx, &models.CommitChainTransactionCommand{
+		Transaction: &models.PaymentTransactionReplacing{
+			PendingTransaction: models.PaymentTransaction{XDR: models.NewXDR("invalid")},
+		},
+	})
+	assert.Error(err)
+
+	_, err = client.CreateTransaction(ctx, &models.CreateTransactionCommand{
+		TotalIn:          110,
+		TotalOut:         100,
+		SourceAddress:    seed2addr(User1Seed),
+		ServiceSessionId: "grpc-command-session",
+	})
+	assert.NoError(err)
+}
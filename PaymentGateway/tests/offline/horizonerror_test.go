@@ -0,0 +1,161 @@
+package offline
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/protocols/horizon"
+	"github.com/stellar/go/support/render/problem"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/root"
+	"paidpiper.com/payment-gateway/root/ledger"
+	"paidpiper.com/payment-gateway/tests"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func horizonProblem(status int, transactionCode string, operationCodes ...string) error {
+	extras := map[string]interface{}{}
+	if transactionCode != "" {
+		extras["result_codes"] = map[string]interface{}{
+			"transaction": transactionCode,
+			"operations":  operationCodes,
+		}
+	}
+	return &horizonclient.Error{Problem: problem.P{Status: status, Extras: extras}}
+}
+
+func TestHorizonErrorKinds(t *testing.T) {
+	policy := root.RetryPolicy{Attempts: 1}
+	kinds := map[root.ErrorKind]error{
+		root.ErrBadSequence:         horizonProblem(http.StatusBadRequest, "tx_bad_seq"),
+		root.ErrInsufficientBalance: horizonProblem(http.StatusBadRequest, "tx_failed", "op_success", "op_underfunded"),
+		root.ErrNoTrustline:         horizonProblem(http.StatusBadRequest, "tx_failed", "op_no_trust"),
+		root.ErrExpired:             horizonProblem(http.StatusBadRequest, "tx_too_late"),
+		root.ErrBadAuth:             horizonProblem(http.StatusBadRequest, "tx_bad_auth"),
+		root.ErrTransactionFailed:   horizonProblem(http.StatusBadRequest, "tx_failed", "op_malformed"),
+		root.ErrNotFound:            horizonProblem(http.StatusNotFound, ""),
+		root.ErrRateLimited:         horizonProblem(http.StatusTooManyRequests, ""),
+		root.ErrNetwork:             horizonProblem(http.StatusGatewayTimeout, ""),
+		root.ErrUnknown:             horizonProblem(http.StatusBadRequest, ""),
+	}
+	for kind, problem := range kinds {
+		err := policy.Do("test", func() error { return problem })
+		assert.Equal(t, kind, root.Kind(err), "%v", err)
+	}
+
+	horizonErr, ok := root.AsHorizonError(policy.Do("test", func() error { return kinds[root.ErrNoTrustline] }))
+	assert.True(t, ok)
+	assert.Equal(t, "tx_failed", horizonErr.ResultCodes.TransactionCode)
+	assert.Equal(t, []string{"op_no_trust"}, horizonErr.ResultCodes.OperationCodes)
+	assert.Equal(t, http.StatusBadRequest, horizonErr.Status)
+}
+
+func TestHorizonRetries(t *testing.T) {
+	policy := root.RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	calls := 0
+	err := policy.Do("test", func() error {
+		calls++
+		if calls < 3 {
+			return horizonProblem(http.StatusTooManyRequests, "")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = policy.Do("test", func() error {
+		calls++
+		return horizonProblem(http.StatusServiceUnavailable, "")
+	})
+	assert.Equal(t, root.ErrNetwork, root.Kind(err))
+	assert.Equal(t, 3, calls)
+
+	// Permanent errors aren't repeated
+	calls = 0
+	err = policy.Do("test", func() error {
+		calls++
+		return horizonProblem(http.StatusBadRequest, "tx_bad_seq")
+	})
+	assert.Equal(t, root.ErrBadSequence, root.Kind(err))
+	assert.Equal(t, 1, calls)
+}
+
+// timeoutLedger applies the submitted transactions but answers with a gateway timeout while timeouts remain
+type timeoutLedger struct {
+	*ledger.Ledger
+	timeouts int
+}
+
+func (l *timeoutLedger) SubmitTransaction(tx *txnbuild.Transaction) (horizon.Transaction, error) {
+	envelope, err := tx.Base64()
+	if err != nil {
+		return horizon.Transaction{}, err
+	}
+	return l.SubmitTransactionXDR(envelope)
+}
+
+func (l *timeoutLedger) SubmitTransactionXDR(envelope string) (horizon.Transaction, error) {
+	result, err := l.Ledger.SubmitTransactionXDR(envelope)
+	if l.timeouts > 0 {
+		l.timeouts--
+		return horizon.Transaction{}, horizonProblem(http.StatusGatewayTimeout, "")
+	}
+	return result, err
+}
+
+func TestSubmissionAppliedBeforeTimeout(t *testing.T) {
+	assert := assert.New(t)
+	client := &timeoutLedger{Ledger: ledger.Default()}
+	node := keypair.MustRandom()
+	api, err := root.CreateRootApiFactoryWithClient(client, ledger.NetworkPassphrase)(node.Seed(), 600)
+	assert.NoError(err)
+	peer := keypair.MustRandom()
+	_, err = ledger.Default().Fund(peer.Address())
+	assert.NoError(err)
+	before, err := ledger.Default().Balance(peer.Address(), ledger.PPTokenAsset())
+	assert.NoError(err)
+
+	// The retried submission finds the transaction applied by the timed out one instead of failing with tx_bad_seq
+	client.timeouts = 1
+	assert.NoError(api.SubmitNodeOperations(&txnbuild.Payment{
+		Destination:   peer.Address(),
+		Amount:        "1",
+		Asset:         ledger.PPTokenAsset(),
+		SourceAccount: node.Address(),
+	}))
+	after, err := ledger.Default().Balance(peer.Address(), ledger.PPTokenAsset())
+	assert.NoError(err)
+	assert.Equal(before+1e7, after)
+}
+
+func TestFlushReportsTransactionsExpiredOnLedger(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestFlushReportsTransactionsExpiredOnLedger")
+	defer span.End()
+
+	service := testSetup.GetNode(Service1Seed)
+	sequencer := tests.CreateSequencer(testSetup, assert, ctx)
+	_, pr, err := sequencer.PerformPayment(User1Seed, Service1Seed, 100e6)
+	assert.NoError(err)
+
+	// The node still considers the transaction valid, the ledger rejects it as too late
+	ledger.Default().SetClock(func() time.Time { return time.Now().Add(30 * 24 * time.Hour) })
+	report, err := service.FlushTransactions(ctx)
+	ledger.Default().SetClock(time.Now)
+	assert.NoError(err)
+	assert.Empty(report.Submitted)
+	assert.Len(report.Expired, 1)
+	assert.Equal(pr.ServiceSessionId, report.Expired[0].ServiceSessionId)
+	assert.Equal("tx_too_late", report.Expired[0].ResultCodes.TransactionCode)
+
+	unflushed, err := service.GetUnflushedTransactions()
+	assert.NoError(err)
+	assert.Equal(0, unflushed.Count)
+
+	assert.NoError(testSetup.FlushTransactions(ctx))
+}
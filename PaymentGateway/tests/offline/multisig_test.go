@@ -0,0 +1,156 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/clients/horizonclient"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/root"
+	"paidpiper.com/payment-gateway/root/ledger"
+	"paidpiper.com/payment-gateway/signer"
+)
+
+// makeMultisig leaves the node key the weight of the low threshold, the payments need a co-signer
+func makeMultisig(t *testing.T, node *keypair.Full, coSigners ...*keypair.Full) {
+	account, err := ledger.Default().AccountDetail(horizonclient.AccountRequest{AccountID: node.Address()})
+	assert.NoError(t, err)
+	one, two := txnbuild.Threshold(1), txnbuild.Threshold(2)
+	ops := []txnbuild.Operation{&txnbuild.SetOptions{
+		MasterWeight:    &one,
+		LowThreshold:    &one,
+		MediumThreshold: &two,
+		HighThreshold:   &two,
+	}}
+	for _, coSigner := range coSigners {
+		ops = append(ops, &txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: coSigner.Address(), Weight: 1}})
+	}
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &account,
+		IncrementSequenceNum: true,
+		Operations:           ops,
+		BaseFee:              ledger.Default().BaseFee(),
+		Timebounds:           txnbuild.NewTimeout(60),
+	})
+	assert.NoError(t, err)
+	tx, err = tx.Sign(ledger.NetworkPassphrase, node)
+	assert.NoError(t, err)
+	_, err = ledger.Default().SubmitTransaction(tx)
+	assert.NoError(t, err)
+}
+
+func TestMultisigNodeAccount(t *testing.T) {
+	assert := assert.New(t)
+	factory := root.CreateRootApiFactoryWithClient(ledger.Default(), ledger.NetworkPassphrase)
+	node := keypair.MustRandom()
+	api, err := factory(node.Seed(), 600)
+	assert.NoError(err)
+	local, remote := keypair.MustRandom(), keypair.MustRandom()
+	makeMultisig(t, node, local, remote)
+	peer := keypair.MustRandom()
+	_, err = ledger.Default().Fund(peer.Address())
+	assert.NoError(err)
+	payment := &txnbuild.Payment{
+		Destination:   peer.Address(),
+		Amount:        "1",
+		Asset:         ledger.PPTokenAsset(),
+		SourceAccount: node.Address(),
+	}
+
+	// The node key alone doesn't reach the medium threshold
+	assert.Error(api.ValidateForPPNode())
+	assert.Error(api.SubmitNodeOperations(payment))
+
+	localSigner, err := root.NewKeyPairSigner(local.Seed())
+	assert.NoError(err)
+	outsider, err := root.NewKeyPairSigner(keypair.MustRandom().Seed())
+	assert.NoError(err)
+	assert.Error(api.SetCoSigners([]root.Signer{outsider}))
+	assert.NoError(api.SetCoSigners([]root.Signer{localSigner}))
+	assert.NoError(api.ValidateForPPNode())
+	assert.NoError(api.SubmitNodeOperations(payment))
+	// The low threshold is reached without the co-signer, an extra signature would fail the transaction
+	current, err := api.GetSequenceNumber()
+	assert.NoError(err)
+	_, err = api.BumpSequenceIfNeed(&models.PaymentTransactionWithSequence{Sequence: int64(current) + 11})
+	assert.NoError(err)
+
+	// The co-signing endpoint signs for the node account what its policy allows
+	server := signer.NewServer(remote, ledger.NetworkPassphrase, signer.DefaultPolicy())
+	server.SetAccount(node.Address())
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+	nodeSigner, err := root.NewKeyPairSigner(node.Seed())
+	assert.NoError(err)
+	remoteSigner, err := root.NewHttpSigner(endpoint.URL, nodeSigner)
+	assert.NoError(err)
+	assert.Equal(remote.Address(), remoteSigner.Address())
+
+	// The requests are authorized by the node key, once
+	_, err = root.NewHttpSigner(endpoint.URL, outsider)
+	assert.Error(err)
+	post := func(body []byte) int {
+		resp, err := http.Post(endpoint.URL, "application/json", bytes.NewReader(body))
+		assert.NoError(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	request, _ := json.Marshal(&models.SignRequest{Kind: models.SignRequestAddress})
+	body, _ := json.Marshal(&models.AuthorizedSignRequest{Request: request})
+	assert.Equal(http.StatusUnauthorized, post(body))
+	authorization := &models.SignAuthorization{
+		Address:     node.Address(),
+		Timestamp:   time.Now().Unix(),
+		Nonce:       "nonce",
+		RequestHash: models.SignRequestHash(request),
+	}
+	signature, err := nodeSigner.SignAuthorization(authorization)
+	assert.NoError(err)
+	authorization.Signature = base64.StdEncoding.EncodeToString(signature)
+	body, _ = json.Marshal(&models.AuthorizedSignRequest{Request: request, Authorization: authorization})
+	assert.Equal(http.StatusOK, post(body))
+	assert.Equal(http.StatusUnauthorized, post(body))
+	restarted, err := factory(node.Seed(), 600)
+	assert.NoError(err)
+	assert.NoError(restarted.SetCoSigners([]root.Signer{remoteSigner}))
+	assert.NoError(restarted.SubmitNodeOperations(payment))
+	balance, _ := ledger.Default().Balance(peer.Address(), ledger.PPTokenAsset())
+	assert.Equal(int64(1002e7), balance)
+
+	sequence, err := restarted.GetSequenceNumber()
+	assert.NoError(err)
+	build := func(op txnbuild.Operation) *txnbuild.Transaction {
+		tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+			SourceAccount:        &txnbuild.SimpleAccount{AccountID: node.Address(), Sequence: int64(sequence)},
+			IncrementSequenceNum: true,
+			Operations:           []txnbuild.Operation{op},
+			BaseFee:              txnbuild.MinBaseFee,
+			Timebounds:           txnbuild.NewTimeout(60),
+		})
+		assert.NoError(err)
+		return tx
+	}
+	unsigned := build(payment)
+	nodeOnly, err := unsigned.Sign(ledger.NetworkPassphrase, node)
+	assert.NoError(err)
+	envelope, err := nodeOnly.Base64()
+	assert.NoError(err)
+	assert.Error(restarted.ValidateSignatureWeight(models.NewXDR(envelope)))
+	signed, err := restarted.Sign(unsigned)
+	assert.NoError(err)
+	envelope, err = signed.Base64()
+	assert.NoError(err)
+	assert.NoError(restarted.ValidateSignatureWeight(models.NewXDR(envelope)))
+
+	// The policy of the co-signer refuses the signer changes
+	_, err = restarted.Sign(build(&txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: peer.Address(), Weight: 2}}))
+	assert.Error(err)
+}
@@ -0,0 +1,112 @@
+package offline
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"paidpiper.com/payment-gateway/common"
+	"paidpiper.com/payment-gateway/root/ledger"
+	"paidpiper.com/payment-gateway/tests"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+var testSetup *tests.TestSetup
+
+func seed2addr(seed string) string {
+	kp, _ := keypair.ParseFull(seed)
+	return kp.Address()
+}
+
+func balances(t *testing.T, seeds []string) []int64 {
+	result := make([]int64, len(seeds))
+	for i, seed := range seeds {
+		balance, err := ledger.Default().Balance(seed2addr(seed), ledger.PPTokenAsset())
+		if err != nil {
+			t.Fatalf("error reading balance: %v", err)
+		}
+		result[i] = balance
+	}
+	return result
+}
+
+func TestMain(m *testing.M) {
+	tracerShutdown := common.InitGlobalTracer(nil)
+
+	// The ledger starts empty, transactions persisted by a previous run must not be restored
+	os.Remove("db.db")
+
+	for _, seed := range []string{User1Seed, Service1Seed, Node1Seed, Node2Seed, Node3Seed} {
+		_, err := ledger.Default().Fund(seed2addr(seed))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	testSetup = tests.CreateTestSetup()
+	testSetup.UseMemoryLedger()
+	testSetup.ConfigureTor(57843)
+
+	ctx := context.Background()
+	testSetup.StartUserNode(ctx, User1Seed)
+	testSetup.StartTorNode(ctx, Node1Seed)
+	testSetup.StartTorNode(ctx, Node2Seed)
+	testSetup.StartTorNode(ctx, Node3Seed)
+	testSetup.StartServiceNode(ctx, Service1Seed)
+
+	testSetup.SetDefaultPaymentRoute([]string{
+		seed2addr(Node1Seed),
+		seed2addr(Node2Seed),
+		seed2addr(Node3Seed),
+	})
+
+	code := m.Run()
+	if tracerShutdown != nil {
+		tracerShutdown()
+	}
+	os.Exit(code)
+}
+
+func TestMultiHopPaymentAndFlush(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestMultiHopPaymentAndFlush")
+	defer span.End()
+
+	seeds := []string{User1Seed, Service1Seed, Node1Seed, Node2Seed, Node3Seed}
+	balancesPre := balances(t, seeds)
+	ledgerPre := ledger.Default().LedgerSequence()
+
+	sequencer := tests.CreateSequencer(testSetup, assert, ctx)
+	_, pr, err := sequencer.PerformPayment(User1Seed, Service1Seed, 100e6)
+	assert.NoError(err)
+
+	// Nothing reaches the ledger before the flush
+	assert.Equal(balancesPre, balances(t, seeds))
+	for _, seed := range seeds[1:] {
+		unflushed, err := testSetup.GetNode(seed).GetUnflushedTransactions()
+		assert.NoError(err)
+		assert.Equal(1, unflushed.Count, "Missing unflushed transaction")
+		assert.True(unflushed.Amount > 0)
+	}
+
+	err = testSetup.FlushTransactions(ctx)
+	assert.NoError(err)
+	for _, seed := range seeds[1:] {
+		unflushed, err := testSetup.GetNode(seed).GetUnflushedTransactions()
+		assert.NoError(err)
+		assert.Equal(0, unflushed.Count, "Transaction not flushed")
+	}
+	assert.True(ledger.Default().LedgerSequence() > ledgerPre)
+
+	// Balances are in stroops, payment amounts and fees in units of models.PPTokenUnitPrice
+	const stroopsPerUnit = 1e4
+	paymentAmount := int64(pr.Amount) * stroopsPerUnit
+	hopFee := int64(10) * stroopsPerUnit
+
+	balancesPost := balances(t, seeds)
+	assert.Equal(balancesPre[0]-paymentAmount-3*hopFee, balancesPost[0], "Incorrect user balance")
+	assert.Equal(balancesPre[1]+paymentAmount, balancesPost[1], "Incorrect service balance")
+	for i := 2; i < len(seeds); i++ {
+		assert.Equal(balancesPre[i]+hopFee, balancesPost[i], "Incorrect node balance")
+	}
+}
@@ -0,0 +1,63 @@
+package offline
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"paidpiper.com/payment-gateway/models"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func TestCommitServiceTransactionVerifiesPaymentRequest(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestCommitServiceTransactionVerifiesPaymentRequest")
+	defer span.End()
+
+	service := testSetup.GetNode(Service1Seed)
+	pr, err := testSetup.NewPaymentRequest(ctx, Service1Seed, 100e6)
+	assert.NoError(err)
+	assert.NoError(pr.Verify(time.Now()))
+
+	tampered := *pr
+	tampered.Amount *= 2
+	err = service.CommitServiceTransaction(ctx, &models.CommitServiceTransactionCommand{
+		Transaction:    &models.PaymentTransactionReplacing{},
+		PaymentRequest: &tampered,
+	})
+	assert.True(errors.Is(err, models.ErrPaymentRequestSignature), "%v", err)
+
+	other, err := testSetup.NewPaymentRequest(ctx, Node1Seed, 100e6)
+	assert.NoError(err)
+	err = service.CommitServiceTransaction(ctx, &models.CommitServiceTransactionCommand{
+		Transaction:    &models.PaymentTransactionReplacing{},
+		PaymentRequest: other,
+	})
+	assert.Error(err)
+}
+
+func TestValidatePaymentVerifiesPaymentRequest(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestValidatePaymentVerifiesPaymentRequest")
+	defer span.End()
+
+	service := testSetup.GetNode(Service1Seed)
+	pr, err := testSetup.NewPaymentRequest(ctx, Service1Seed, 100e6)
+	assert.NoError(err)
+	request := &models.ValidatePaymentRequest{
+		ServiceType:    "ipfs",
+		CommodityType:  "data",
+		PaymentRequest: *pr,
+	}
+	response, err := service.ValidatePayment(ctx, request)
+	assert.NoError(err)
+	assert.NotZero(response.Quantity)
+
+	request.PaymentRequest.Quote = &models.PriceQuote{Multiplier: 1}
+	_, err = service.ValidatePayment(ctx, request)
+	assert.True(errors.Is(err, models.ErrPaymentRequestSignature), "%v", err)
+
+	other, err := testSetup.NewPaymentRequest(ctx, Node1Seed, 100e6)
+	assert.NoError(err)
+	request.PaymentRequest = *other
+	_, err = service.ValidatePayment(ctx, request)
+	assert.Error(err)
+}
@@ -0,0 +1,40 @@
+package offline
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"paidpiper.com/payment-gateway/controllers"
+	"paidpiper.com/payment-gateway/models"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func TestCreatePaymentInfoWithUri(t *testing.T) {
+	assert, _, span := InitTestCreateSpan(t, "TestCreatePaymentInfoWithUri")
+	defer span.End()
+
+	controller := controllers.NewHttpUtilityController(testSetup.GetNode(Service1Seed))
+	server := httptest.NewServer(http.HandlerFunc(controller.HttpNewPaymentRequest))
+	defer server.Close()
+
+	body, _ := json.Marshal(&models.CreatePaymentInfo{ServiceType: "tor", CommodityType: "data", Amount: 100})
+	response, err := http.Post(server.URL+"?uri=true", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	pr := &models.PaymentRequestWithUri{}
+	assert.NoError(json.NewDecoder(response.Body).Decode(pr))
+
+	_, err = png.Decode(bytes.NewReader(pr.QrCode))
+	assert.NoError(err)
+	parsed, err := models.ParsePaymentURI(pr.PaymentUri)
+	assert.NoError(err)
+	assert.Equal(pr.Address, parsed.Address)
+	assert.Equal(pr.Amount, parsed.Amount)
+	assert.Equal(pr.ServiceSessionId, parsed.ServiceSessionId)
+}
@@ -0,0 +1,132 @@
+package offline
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/tests"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func signRevocation(seed string, sessionId string) *models.Revocation {
+	kp := keypair.MustParseFull(seed)
+	revocation := &models.Revocation{
+		ServiceSessionId: sessionId,
+		Address:          kp.Address(),
+	}
+	signature, _ := kp.Sign(revocation.SigningPayload())
+	revocation.Signature = base64.StdEncoding.EncodeToString(signature)
+	return revocation
+}
+
+func TestRevokeRestoresReferenceTransaction(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestRevokeRestoresReferenceTransaction")
+	defer span.End()
+
+	hop := testSetup.GetNode(Node3Seed)
+	sequencer := tests.CreateSequencer(testSetup, assert, ctx)
+
+	_, _, err := sequencer.PerformPayment(User1Seed, Service1Seed, 100e6)
+	assert.NoError(err)
+	reference := hop.GetTransactions()
+	assert.Len(reference, 1)
+	unflushedReference, err := hop.GetUnflushedTransactions()
+	assert.NoError(err)
+
+	_, _, err = sequencer.PerformPayment(User1Seed, Service1Seed, 100e6)
+	assert.NoError(err)
+	committed := hop.GetTransactions()
+	assert.Len(committed, 1)
+	sessionId := committed[0].ServiceSessionId
+	assert.NotEqual(reference[0].ServiceSessionId, sessionId)
+
+	revoke := &models.RevokeTransactionCommand{
+		Transaction: &models.PaymentTransactionReplacing{
+			PendingTransaction:   *committed[0],
+			ReferenceTransaction: reference[0],
+		},
+	}
+	// The hop revokes only with the revocation of the service node it paid, not of the payer
+	_, err = hop.RevokeTransaction(ctx, revoke)
+	assert.Error(err)
+	revoke.Revocation = signRevocation(User1Seed, sessionId)
+	_, err = hop.RevokeTransaction(ctx, revoke)
+	assert.Error(err)
+	assert.Equal(sessionId, hop.GetTransactions()[0].ServiceSessionId)
+
+	revoke.Revocation = signRevocation(Service1Seed, sessionId)
+	response, err := hop.RevokeTransaction(ctx, revoke)
+	assert.NoError(err)
+	assert.NoError(response.Revocation.Verify(hop.GetAddress(), sessionId))
+
+	active := hop.GetTransactions()
+	assert.Len(active, 1)
+	assert.Equal(reference[0].ServiceSessionId, active[0].ServiceSessionId)
+	assert.Equal(reference[0].XDR.String(), active[0].XDR.String())
+	assert.Nil(hop.GetTransaction(sessionId))
+	unflushed, err := hop.GetUnflushedTransactions()
+	assert.NoError(err)
+	assert.Equal(unflushedReference.Amount, unflushed.Amount)
+
+	// A second revoke finds nothing to revoke
+	_, err = hop.RevokeTransaction(ctx, revoke)
+	assert.NoError(err)
+	assert.Equal(reference[0].ServiceSessionId, hop.GetTransactions()[0].ServiceSessionId)
+
+	assert.NoError(testSetup.FlushTransactions(ctx))
+}
+
+func TestServiceRevokesOnlyUnpaidSessions(t *testing.T) {
+	assert, ctx, span := InitTestCreateSpan(t, "TestServiceRevokesOnlyUnpaidSessions")
+	defer span.End()
+
+	service := testSetup.GetNode(Service1Seed)
+	sequencer := tests.CreateSequencer(testSetup, assert, ctx)
+
+	// The payer can't take back a payment the service node was paid
+	_, pr, err := sequencer.PerformPayment(User1Seed, Service1Seed, 100e6)
+	assert.NoError(err)
+	paid := service.GetTransaction(pr.ServiceSessionId)
+	assert.NotNil(paid)
+	_, err = service.RevokeTransaction(ctx, &models.RevokeTransactionCommand{
+		Transaction:    &models.PaymentTransactionReplacing{PendingTransaction: *paid},
+		PaymentRequest: pr,
+	})
+	assert.Error(err)
+	assert.NotNil(service.GetTransaction(pr.ServiceSessionId))
+
+	// A session whose commit didn't happen is revoked, its commit is refused afterwards
+	pr, err = testSetup.NewPaymentRequest(ctx, Service1Seed, 100e6)
+	assert.NoError(err)
+	created, err := service.CreateTransaction(ctx, &models.CreateTransactionCommand{
+		TotalIn:          pr.Amount,
+		TotalOut:         pr.Amount,
+		SourceAddress:    seed2addr(Node3Seed),
+		ServiceSessionId: pr.ServiceSessionId,
+		Asset:            pr.Asset,
+	})
+	assert.NoError(err)
+	signed, err := service.SignServiceTransaction(ctx, &models.SignServiceTransactionCommand{Transaction: created.Transaction})
+	assert.NoError(err)
+
+	revoke := &models.RevokeTransactionCommand{
+		Transaction: signed.Transaction,
+	}
+	_, err = service.RevokeTransaction(ctx, revoke)
+	assert.Error(err)
+	revoke.PaymentRequest = pr
+	response, err := service.RevokeTransaction(ctx, revoke)
+	assert.NoError(err)
+	assert.NoError(response.Revocation.Verify(service.GetAddress(), pr.ServiceSessionId))
+
+	err = service.CommitServiceTransaction(ctx, &models.CommitServiceTransactionCommand{
+		Transaction:    signed.Transaction,
+		PaymentRequest: pr,
+	})
+	assert.Error(err)
+	assert.Nil(service.GetTransaction(pr.ServiceSessionId))
+
+	assert.NoError(testSetup.FlushTransactions(ctx))
+}
@@ -0,0 +1,67 @@
+package offline
+
+import (
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
+	"paidpiper.com/payment-gateway/root"
+	"paidpiper.com/payment-gateway/root/ledger"
+	. "paidpiper.com/payment-gateway/tests/util"
+)
+
+func TestSequencesArentReallocatedAfterRestart(t *testing.T) {
+	assert := assert.New(t)
+	factory := root.CreateRootApiFactoryWithClient(ledger.Default(), ledger.NetworkPassphrase)
+	seed := keypair.MustRandom().Seed()
+	db, err := database.NewLiteDB()
+	assert.NoError(err)
+
+	start := func() root.RootApi {
+		api, err := factory(seed, 600)
+		assert.NoError(err)
+		assert.NoError(api.SetSequenceStore(paymentregestry.NewSequenceStore(db, api.GetAddress())))
+		return api
+	}
+	// The transactions of the node account are signed but not submitted
+	allocate := func(api root.RootApi) int64 {
+		tr, err := api.CreateTransaction(&models.CreateTransactionCommand{
+			SourceAddress: seed2addr(User1Seed),
+		}, &models.PaymentTransactionReplacing{
+			PendingTransaction: models.PaymentTransaction{
+				ReferenceAmountIn:         100,
+				PaymentSourceAddress:      seed2addr(User1Seed),
+				PaymentDestinationAddress: api.GetAddress(),
+			},
+		})
+		assert.NoError(err)
+		sequence, err := api.GetTransactionSequenceNumber(&tr.PendingTransaction)
+		assert.NoError(err)
+		return sequence
+	}
+
+	api := start()
+	current, err := api.GetSequenceNumber()
+	assert.NoError(err)
+	account := int64(current)
+	assert.Equal(account+1, allocate(api))
+	assert.Equal(account+2, allocate(api))
+
+	restarted := start()
+	state := restarted.GetSequenceState()
+	assert.Equal(account, state.AccountSequence)
+	assert.Equal(account+2, state.HighWaterMark)
+	assert.Equal([]int64{account + 1, account + 2}, state.Unsubmitted)
+	assert.NotZero(state.Reconciled)
+	assert.Equal(account+3, allocate(restarted))
+
+	// The sequences the account passed are dropped
+	_, err = restarted.BumpSequenceIfNeed(&models.PaymentTransactionWithSequence{Sequence: account + 3})
+	assert.NoError(err)
+	state = restarted.GetSequenceState()
+	assert.Equal(account+2, state.AccountSequence)
+	assert.Equal([]int64{account + 3}, state.Unsubmitted)
+}
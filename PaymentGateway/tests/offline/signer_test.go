@@ -0,0 +1,69 @@
+package offline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/txnbuild"
+	"github.com/stretchr/testify/assert"
+	"paidpiper.com/payment-gateway/models"
+	"paidpiper.com/payment-gateway/root"
+	"paidpiper.com/payment-gateway/root/ledger"
+	"paidpiper.com/payment-gateway/signer"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "signer")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "signer.sock")
+
+	kp := keypair.MustRandom()
+	listener, err := signer.Listen(socket)
+	assert.NoError(err)
+	defer listener.Close()
+	go signer.NewServer(kp, ledger.NetworkPassphrase, signer.DefaultPolicy()).Serve(listener)
+
+	remote, err := root.NewRemoteSigner(socket)
+	assert.NoError(err)
+	assert.Equal(kp.Address(), remote.Address())
+	api, err := root.CreateSignerRootApiFactoryWithClient(ledger.Default(), ledger.NetworkPassphrase)(remote, 600)
+	assert.NoError(err)
+	assert.Equal(kp.Address(), api.GetAddress())
+
+	pr := &models.PaymentRequest{
+		Amount:    100,
+		Asset:     models.PPTokenAssetName,
+		Address:   api.GetAddress(),
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}
+	assert.NoError(api.SignPaymentRequest(pr))
+	assert.NoError(pr.Verify(time.Now()))
+
+	// The sequence bump is signed by the daemon and accepted by the ledger
+	current, err := api.GetSequenceNumber()
+	assert.NoError(err)
+	_, err = api.BumpSequenceIfNeed(&models.PaymentTransactionWithSequence{Sequence: int64(current) + 11})
+	assert.NoError(err)
+	bumped, err := api.GetSequenceNumber()
+	assert.NoError(err)
+	assert.Equal(current+10, bumped)
+
+	// The policy refuses the operations which aren't on the allowlist
+	tx, err := txnbuild.NewTransaction(txnbuild.TransactionParams{
+		SourceAccount:        &txnbuild.SimpleAccount{AccountID: api.GetAddress(), Sequence: int64(bumped)},
+		IncrementSequenceNum: true,
+		Operations:           []txnbuild.Operation{&txnbuild.SetOptions{Signer: &txnbuild.Signer{Address: keypair.MustRandom().Address(), Weight: 10}}},
+		BaseFee:              txnbuild.MinBaseFee,
+		Timebounds:           txnbuild.NewTimeout(60),
+	})
+	assert.NoError(err)
+	_, err = api.Sign(tx)
+	assert.Error(err)
+}
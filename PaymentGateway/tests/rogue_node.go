@@ -17,6 +17,8 @@ import (
 
 	"paidpiper.com/payment-gateway/node"
 	"paidpiper.com/payment-gateway/node/local"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry"
+	"paidpiper.com/payment-gateway/node/local/paymentregestry/database"
 	"paidpiper.com/payment-gateway/node/proxy"
 	"paidpiper.com/payment-gateway/root"
 )
@@ -27,10 +29,6 @@ type RogueNode struct {
 	SignChainTransactionFunction func(r *RogueNode, context context.Context, cmd *models.SignChainTransactionCommand) (*models.SignChainTransactionResponse, error)
 }
 
-func (r *RogueNode) GetFee() uint32 {
-	return 0
-}
-
 // func (r *RogueNode) AddPendingServicePayment(context context.Context, serviceSessionId string, amount models.TransactionAmount) {
 // 	r.internalNode.AddPendingServicePayment(context, serviceSessionId, amount)
 // }
@@ -229,16 +227,22 @@ func CreateRogueNode_NonidenticalSequenceNumbers(address string, seed string, ac
 		return nil, nil
 	}
 	commodityManager := commodity.New()
+	db, err := database.NewLiteDB()
+	if err != nil {
+		return nil, err
+	}
 	paymentManager := regestry.NewPaymentManagerRegestry(
 		commodityManager,
 		client.New(rootClient),
 		commandClientFactory,
 		torclient.NewTorClient(""),
+		paymentregestry.NewPaymentSessionStore(db, rootClient.GetAddress()),
+		paymentregestry.NewNonceStore(db, rootClient.GetAddress()),
 	)
 	factory := func(cmd *models.UtilityCommand) local.CallBacker {
 		return nil
 	}
-	node, _ := local.New(rootClient, paymentManager, factory, config.NodeConfig{
+	node, _ := local.New(rootClient, db, paymentManager, commodityManager, factory, config.NodeConfig{
 		AutoFlushPeriod:        0,
 		AsyncMode:              true,
 		AccumulateTransactions: accumulateTransactions,
@@ -264,16 +268,22 @@ func CreateRogueNode_BadSignature(address string, seed string, accumulateTransac
 	commandClientFactory := func(url string, sessionId string, nodeId string) (proxy.CommandClient, proxy.CommandResponseHandler) {
 		return nil, nil
 	}
+	db, err := database.NewLiteDB()
+	if err != nil {
+		return nil, err
+	}
 	paymentManager := regestry.NewPaymentManagerRegestry(
 		commodityManager,
 		client.New(rootClient),
 		commandClientFactory,
 		torclient.NewTorClient(""),
+		paymentregestry.NewPaymentSessionStore(db, rootClient.GetAddress()),
+		paymentregestry.NewNonceStore(db, rootClient.GetAddress()),
 	)
 	factory := func(cmd *models.UtilityCommand) local.CallBacker {
 		return nil
 	}
-	node, _ := local.New(rootClient, paymentManager, factory, config.NodeConfig{
+	node, _ := local.New(rootClient, db, paymentManager, commodityManager, factory, config.NodeConfig{
 		AutoFlushPeriod:        0,
 		AsyncMode:              true,
 		AccumulateTransactions: accumulateTransactions,
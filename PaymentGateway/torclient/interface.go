@@ -8,4 +8,6 @@ import (
 
 type TorClient interface {
 	GetRoute(ctx context.Context, sessionId string) (*models.RouteResponse, error)
+	// GetRouteExcluding re-queries the route of the session avoiding the nodes which failed it
+	GetRouteExcluding(ctx context.Context, sessionId string, excludeNodeIds []string) (*models.RouteResponse, error)
 }
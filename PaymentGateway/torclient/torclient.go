@@ -3,6 +3,8 @@ package torclient
 import (
 	"context"
 	"encoding/json"
+	"net/url"
+	"strings"
 
 	"github.com/go-errors/errors"
 	"paidpiper.com/payment-gateway/common"
@@ -20,8 +22,17 @@ func NewTorClient(url string) TorClient {
 }
 
 func (c *torClient) GetRoute(ctx context.Context, sessionId string) (*models.RouteResponse, error) {
-	url := c.torUrl + sessionId
-	resp, err := common.HttpGetWithContext(ctx, url)
+	return c.getRoute(ctx, c.torUrl+sessionId)
+}
+
+func (c *torClient) GetRouteExcluding(ctx context.Context, sessionId string, excludeNodeIds []string) (*models.RouteResponse, error) {
+	query := url.Values{}
+	query.Set("exclude", strings.Join(excludeNodeIds, ","))
+	return c.getRoute(ctx, c.torUrl+sessionId+"?"+query.Encode())
+}
+
+func (c *torClient) getRoute(ctx context.Context, routeUrl string) (*models.RouteResponse, error) {
+	resp, err := common.HttpGetWithContext(ctx, routeUrl)
 
 	if err != nil {
 
@@ -2,6 +2,7 @@ package torclient
 
 import (
 	"context"
+	"fmt"
 
 	"paidpiper.com/payment-gateway/models"
 )
@@ -21,3 +22,16 @@ func (c *staticTorClient) GetRoute(ctx context.Context, sessionId string) (*mode
 
 	return c.route, c.err
 }
+
+func (c *staticTorClient) GetRouteExcluding(ctx context.Context, sessionId string, excludeNodeIds []string) (*models.RouteResponse, error) {
+	if c.route != nil {
+		for _, rn := range c.route.Route {
+			for _, id := range excludeNodeIds {
+				if rn.NodeId == id {
+					return nil, fmt.Errorf("no route avoiding node %s", id)
+				}
+			}
+		}
+	}
+	return c.route, c.err
+}